@@ -8,6 +8,7 @@ import (
 	"sentinal-chat/config"
 	"sentinal-chat/internal/events"
 	"sentinal-chat/internal/handler"
+	"sentinal-chat/internal/linkpreview"
 	"sentinal-chat/internal/redis"
 	"sentinal-chat/internal/repository"
 	"sentinal-chat/internal/server"
@@ -47,6 +48,10 @@ func main() {
 	uploadRepo := repository.NewUploadRepository(database.GetInstance())
 	broadcastRepo := repository.NewBroadcastRepository(database.GetInstance())
 	callRepo := repository.NewCallRepository(database.GetInstance())
+	scheduledMessageRepo := repository.NewScheduledMessageRepository(database.GetInstance())
+	syncRepo := repository.NewSyncRepository(database.GetInstance())
+	deliveryRepo := repository.NewDeliveryRepository(database.GetInstance())
+	senderKeyRepo := repository.NewSenderKeyRepository(database.GetInstance())
 
 	// Initialize Redis singleton
 	redis.Initialize(redis.Config{
@@ -59,6 +64,9 @@ func main() {
 	signalingStore := redis.NewSignalingStore(redisClient)
 	rateLimiter := redis.NewRateLimiter(redisClient, redis.DefaultRateLimitConfig())
 	cacheStore := redis.NewCacheStore(redisClient, redis.DefaultCacheConfig())
+	conversationRepo = repository.NewCachedConversationRepository(conversationRepo, cacheStore)
+	presenceTTL := time.Duration(cfg.PresenceTTL) * time.Second
+	presenceStore := redis.NewPresenceStore(redisClient, presenceTTL)
 
 	// Initialize Event Bus (Redis Pub/Sub)
 	channelResolver := events.NewHybridChannelResolver()
@@ -87,17 +95,18 @@ func main() {
 	)
 
 	// Start Outbox Worker
-	outboxWorker := services.NewOutboxWorker(outboxRepo, eventBus)
+	outboxWorker := services.NewOutboxWorker(outboxRepo, eventBus, logInstance.Logger)
 	outboxWorker.Start()
 
 	//Services
-	authService := services.NewAuthService(userRepo, cfg)
-	messageService := services.NewMessageService(database.GetDB(), messageRepo, conversationRepo, eventPublisher, commandExecutor)
-	conversationService := services.NewConversationService(database.GetDB(), conversationRepo, eventPublisher)
-	userService := services.NewUserService(userRepo)
+	authService := services.NewAuthService(userRepo, cfg, cacheStore)
+	messageService := services.NewMessageService(database.GetDB(), messageRepo, conversationRepo, uploadRepo, senderKeyRepo, eventPublisher, commandExecutor)
+	conversationService := services.NewConversationService(database.GetDB(), conversationRepo, eventPublisher, commandExecutor)
+	userService := services.NewUserService(userRepo, cacheStore)
 	var uploadS3Service *services.UploadS3Service
+	var s3Client *storage.Client
 	if cfg.S3Region != "" && cfg.S3Bucket != "" {
-		s3Client, err := storage.NewClient(context.Background(), storage.S3Config{
+		client, err := storage.NewClient(context.Background(), storage.S3Config{
 			Region:     cfg.S3Region,
 			Bucket:     cfg.S3Bucket,
 			AccessKey:  cfg.S3AccessKeyID,
@@ -109,14 +118,67 @@ func main() {
 		if err != nil {
 			log.Fatalf("Failed to initialize S3 client: %v", err)
 		}
+		s3Client = client
 		uploadS3Service = services.NewUploadS3Service(uploadRepo, s3Client)
 	}
-	encryptionService := services.NewEncryptionService(encryptionRepo)
+	encryptionService := services.NewEncryptionService(database.GetDB(), encryptionRepo, eventPublisher, services.KeyPolicy{
+		PreKeyLowWater:          cfg.PreKeyLowWater,
+		ConsumedPreKeyRetention: time.Duration(cfg.ConsumedPreKeyRetention) * time.Second,
+		PreKeysPerConsumer:      cfg.PreKeysPerConsumer,
+		PreKeyConsumerWindow:    time.Duration(cfg.PreKeyConsumerWindow) * time.Second,
+		SignedPreKeyMaxAge:      time.Duration(cfg.SignedPreKeyMaxAge) * time.Second,
+		SignedPreKeyGracePeriod: time.Duration(cfg.SignedPreKeyGrace) * time.Second,
+	})
+	senderKeyService := services.NewSenderKeyService(database.GetDB(), senderKeyRepo, conversationRepo, userRepo, eventPublisher)
 	broadcastService := services.NewBroadcastService(broadcastRepo)
-	callService := services.NewCallService(database.GetDB(), callRepo, signalingStore, eventPublisher)
+	callService := services.NewCallService(database.GetDB(), callRepo, conversationRepo, signalingStore, eventPublisher, services.ICEConfig{
+		STUNURLs:      cfg.STUNURLs,
+		TURNURLs:      cfg.TURNURLs,
+		TURNSecret:    cfg.TURNSecret,
+		CredentialTTL: time.Duration(cfg.TURNTTL) * time.Second,
+	})
+	presenceService := services.NewPresenceService(database.GetDB(), userRepo, presenceStore, cacheStore, eventPublisher, presenceTTL)
+	linkPreviewService := services.NewLinkPreviewService(messageRepo, linkpreview.NewFetcher(linkpreview.Options{
+		Timeout:      time.Duration(cfg.LinkPreviewTimeout) * time.Second,
+		MaxBodyBytes: int64(cfg.LinkPreviewMaxBytes),
+		MaxRedirects: cfg.LinkPreviewMaxRedirects,
+	}), cacheStore, time.Duration(cfg.LinkPreviewCacheTTL)*time.Second, time.Duration(cfg.LinkPreviewFailureTTL)*time.Second)
+	attachmentService := services.NewAttachmentService(database.GetDB(), messageRepo, conversationRepo, s3Client, eventPublisher, time.Duration(cfg.ViewOnceURLTTL)*time.Second, time.Duration(cfg.ViewOnceMaxAge)*time.Second)
+
+	// Start Poll Worker
+	pollWorker := services.NewPollWorker(messageService, logInstance.Logger)
+	pollWorker.Start()
+
+	// Start Scheduled Message Worker
+	scheduledMessageService := services.NewScheduledMessageService(database.GetDB(), scheduledMessageRepo, conversationRepo, messageService)
+	scheduledMessageWorker := services.NewScheduledMessageWorker(scheduledMessageService, logInstance.Logger)
+	scheduledMessageWorker.Start()
+
+	syncService := services.NewSyncService(syncRepo, messageService)
+
+	// Start Attachment Worker
+	attachmentWorker := services.NewAttachmentWorker(attachmentService, logInstance.Logger)
+	attachmentWorker.Start()
+
+	// Start Message Expiry Worker
+	messageExpiryWorker := services.NewMessageExpiryWorker(messageService, attachmentService, logInstance.Logger)
+	messageExpiryWorker.Start()
+
+	// Start Delivery Worker
+	deliveryService := services.NewDeliveryService(database.GetDB(), deliveryRepo, messageService, eventPublisher, time.Duration(cfg.CiphertextRetention)*time.Second)
+	deliveryWorker := services.NewDeliveryWorker(deliveryService, logInstance.Logger)
+	deliveryWorker.Start()
+
+	// Start PreKey Cleanup Worker
+	preKeyCleanupWorker := services.NewPreKeyCleanupWorker(encryptionService, logInstance.Logger)
+	preKeyCleanupWorker.Start()
+
+	// Start Signed PreKey Rotation Worker
+	signedPreKeyRotationWorker := services.NewSignedPreKeyRotationWorker(encryptionService, logInstance.Logger)
+	signedPreKeyRotationWorker.Start()
 
 	// Initialize WebSocket Hub
-	hub := server.NewHub(eventBus, conversationService, messageService, userService)
+	hub := server.NewHub(eventBus, conversationService, messageService, presenceService, deliveryService)
 	go hub.Run()
 
 	// Create WebSocket Handler
@@ -131,20 +193,36 @@ func main() {
 	encryptionHandler := handler.NewEncryptionHandler(encryptionService)
 	broadcastHandler := handler.NewBroadcastHandler(broadcastService)
 	callHandler := handler.NewCallHandler(callService)
+	pollHandler := handler.NewPollHandler(messageService)
+	scheduledMessageHandler := handler.NewScheduledMessageHandler(scheduledMessageService)
+	commandHandler := handler.NewCommandHandler(commandExecutor)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentService)
+	linkPreviewHandler := handler.NewLinkPreviewHandler(linkPreviewService)
+	syncHandler := handler.NewSyncHandler(syncService)
+	deliveryHandler := handler.NewDeliveryHandler(deliveryService)
+	senderKeyHandler := handler.NewSenderKeyHandler(senderKeyService)
 
 	// Server Instance init
 	serverInstance := server.New(cfg, logInstance)
 
 	// struct to init the handlers
 	handlers := &server.Handlers{
-		Auth:         authHandler,
-		Message:      messageHandler,
-		Conversation: conversationHandler,
-		User:         userHandler,
-		Call:         callHandler,
-		Upload:       uploadHandler,
-		Encryption:   encryptionHandler,
-		Broadcast:    broadcastHandler,
+		Auth:             authHandler,
+		Message:          messageHandler,
+		Conversation:     conversationHandler,
+		User:             userHandler,
+		Call:             callHandler,
+		Upload:           uploadHandler,
+		Encryption:       encryptionHandler,
+		Broadcast:        broadcastHandler,
+		Poll:             pollHandler,
+		ScheduledMessage: scheduledMessageHandler,
+		Command:          commandHandler,
+		Attachment:       attachmentHandler,
+		LinkPreview:      linkPreviewHandler,
+		Sync:             syncHandler,
+		Delivery:         deliveryHandler,
+		SenderKey:        senderKeyHandler,
 	}
 
 	// Setup routes
@@ -153,6 +231,13 @@ func main() {
 	// Graceful shutdown
 	defer func() {
 		hub.Stop()
+		pollWorker.Stop()
+		scheduledMessageWorker.Stop()
+		attachmentWorker.Stop()
+		messageExpiryWorker.Stop()
+		deliveryWorker.Stop()
+		preKeyCleanupWorker.Stop()
+		signedPreKeyRotationWorker.Stop()
 		outboxWorker.Stop()
 		eventBus.Stop()
 	}()
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -29,6 +30,28 @@ type Config struct {
 	S3Endpoint     string
 	S3PublicBase   string
 	S3PresignTTL   int
+	PresenceTTL    int
+	STUNURLs       []string
+	TURNURLs       []string
+	TURNSecret     string
+	TURNTTL        int
+	ViewOnceURLTTL int
+	ViewOnceMaxAge int
+
+	LinkPreviewTimeout      int
+	LinkPreviewMaxBytes     int
+	LinkPreviewMaxRedirects int
+	LinkPreviewCacheTTL     int
+	LinkPreviewFailureTTL   int
+
+	CiphertextRetention int
+
+	PreKeyLowWater          int
+	ConsumedPreKeyRetention int
+	PreKeysPerConsumer      int
+	PreKeyConsumerWindow    int
+	SignedPreKeyMaxAge      int
+	SignedPreKeyGrace       int
 }
 
 func LoadConfig() *Config {
@@ -58,6 +81,28 @@ func LoadConfig() *Config {
 		S3Endpoint:     getEnv("S3_ENDPOINT", ""),
 		S3PublicBase:   getEnv("S3_PUBLIC_BASE_URL", ""),
 		S3PresignTTL:   getEnvAsInt("S3_PRESIGN_TTL_SECONDS", 900),
+		PresenceTTL:    getEnvAsInt("PRESENCE_TTL_SECONDS", 300),
+		STUNURLs:       getEnvAsList("STUN_URLS", []string{"stun:stun.l.google.com:19302"}),
+		TURNURLs:       getEnvAsList("TURN_URLS", nil),
+		TURNSecret:     getEnv("TURN_SECRET", ""),
+		TURNTTL:        getEnvAsInt("TURN_CREDENTIAL_TTL_SECONDS", 86400),
+		ViewOnceURLTTL: getEnvAsInt("VIEW_ONCE_URL_TTL_SECONDS", 60),
+		ViewOnceMaxAge: getEnvAsInt("VIEW_ONCE_MAX_AGE_SECONDS", 14*24*3600),
+
+		LinkPreviewTimeout:      getEnvAsInt("LINK_PREVIEW_TIMEOUT_SECONDS", 5),
+		LinkPreviewMaxBytes:     getEnvAsInt("LINK_PREVIEW_MAX_BYTES", 512*1024),
+		LinkPreviewMaxRedirects: getEnvAsInt("LINK_PREVIEW_MAX_REDIRECTS", 3),
+		LinkPreviewCacheTTL:     getEnvAsInt("LINK_PREVIEW_CACHE_TTL_SECONDS", 86400),
+		LinkPreviewFailureTTL:   getEnvAsInt("LINK_PREVIEW_FAILURE_TTL_SECONDS", 600),
+
+		CiphertextRetention: getEnvAsInt("CIPHERTEXT_RETENTION_SECONDS", 30*24*3600),
+
+		PreKeyLowWater:          getEnvAsInt("PREKEY_LOW_WATER", 10),
+		ConsumedPreKeyRetention: getEnvAsInt("CONSUMED_PREKEY_RETENTION_SECONDS", 7*24*3600),
+		PreKeysPerConsumer:      getEnvAsInt("PREKEYS_PER_CONSUMER", 5),
+		PreKeyConsumerWindow:    getEnvAsInt("PREKEY_CONSUMER_WINDOW_SECONDS", 3600),
+		SignedPreKeyMaxAge:      getEnvAsInt("SIGNED_PREKEY_MAX_AGE_SECONDS", 30*24*3600),
+		SignedPreKeyGrace:       getEnvAsInt("SIGNED_PREKEY_GRACE_SECONDS", 7*24*3600),
 	}
 }
 
@@ -75,3 +120,18 @@ func getEnvAsInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+// getEnvAsList reads a comma-separated list, ignoring empty entries.
+func getEnvAsList(key string, fallback []string) []string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return fallback
+	}
+	var values []string
+	for _, v := range strings.Split(valueStr, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
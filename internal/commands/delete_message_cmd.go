@@ -12,10 +12,10 @@ import (
 // DeleteMessageCommand deletes a message with undo support
 type DeleteMessageCommand struct {
 	BaseCommand
-	MessageID       uuid.UUID `json:"message_id"`
-	DeleteForAll    bool      `json:"delete_for_all"`
-	OriginalContent string    `json:"original_content,omitempty"`
-	OriginalState   []byte    `json:"original_state,omitempty"`
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id,omitempty"`
+	DeleteForAll   bool      `json:"delete_for_all"`
+	OriginalState  []byte    `json:"original_state,omitempty"`
 }
 
 // NewDeleteMessageCommand creates a new delete message command
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,13 +12,23 @@ import (
 // EditMessageCommand edits a message with version history
 type EditMessageCommand struct {
 	BaseCommand
-	MessageID       uuid.UUID `json:"message_id"`
-	NewContent      string    `json:"new_content"`
-	PreviousContent string    `json:"previous_content,omitempty"`
+	MessageID       uuid.UUID        `json:"message_id"`
+	SenderDeviceID  uuid.UUID        `json:"sender_device_id"`
+	Ciphertexts     []EditCiphertext `json:"-"`
+	ConversationID  uuid.UUID        `json:"conversation_id,omitempty"`
+	PreviousVersion int              `json:"previous_version,omitempty"`
+}
+
+// EditCiphertext is the new ciphertext of an edited message for one device
+type EditCiphertext struct {
+	RecipientUserID   uuid.UUID
+	RecipientDeviceID uuid.UUID
+	Ciphertext        []byte
+	Header            string
 }
 
 // NewEditMessageCommand creates a new edit message command
-func NewEditMessageCommand(msgID, userID uuid.UUID, newContent string) *EditMessageCommand {
+func NewEditMessageCommand(msgID, userID, senderDeviceID uuid.UUID, ciphertexts []EditCiphertext) *EditMessageCommand {
 	return &EditMessageCommand{
 		BaseCommand: BaseCommand{
 			ID:        uuid.New(),
@@ -27,8 +36,9 @@ func NewEditMessageCommand(msgID, userID uuid.UUID, newContent string) *EditMess
 			UserID:    userID,
 			CreatedAt: time.Now(),
 		},
-		MessageID:  msgID,
-		NewContent: newContent,
+		MessageID:      msgID,
+		SenderDeviceID: senderDeviceID,
+		Ciphertexts:    ciphertexts,
 	}
 }
 
@@ -37,8 +47,16 @@ func (c *EditMessageCommand) Validate() error {
 	if c.MessageID == uuid.Nil {
 		return errors.New("message_id is required")
 	}
-	if strings.TrimSpace(c.NewContent) == "" {
-		return errors.New("new content cannot be empty")
+	if c.SenderDeviceID == uuid.Nil {
+		return errors.New("sender_device_id is required")
+	}
+	if len(c.Ciphertexts) == 0 {
+		return errors.New("ciphertexts are required")
+	}
+	for _, ct := range c.Ciphertexts {
+		if ct.RecipientDeviceID == uuid.Nil || len(ct.Ciphertext) == 0 {
+			return errors.New("each ciphertext needs a recipient device and payload")
+		}
 	}
 	return nil
 }
@@ -4,24 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// SendMessageCommand sends a message with optional scheduling
+// SendMessageCommand records a sent message so the send can be undone
 type SendMessageCommand struct {
 	BaseCommand
 	ConversationID uuid.UUID  `json:"conversation_id"`
 	SenderID       uuid.UUID  `json:"sender_id"`
-	Content        string     `json:"content"`
+	MessageID      uuid.UUID  `json:"message_id"`
 	ScheduledFor   *time.Time `json:"scheduled_for,omitempty"`
 	MaxRetries     int        `json:"max_retries"`
 }
 
 // NewSendMessageCommand creates a new send message command
-func NewSendMessageCommand(convID, senderID uuid.UUID, content string) *SendMessageCommand {
+func NewSendMessageCommand(convID, senderID, messageID uuid.UUID) *SendMessageCommand {
 	return &SendMessageCommand{
 		BaseCommand: BaseCommand{
 			ID:        uuid.New(),
@@ -31,7 +30,7 @@ func NewSendMessageCommand(convID, senderID uuid.UUID, content string) *SendMess
 		},
 		ConversationID: convID,
 		SenderID:       senderID,
-		Content:        content,
+		MessageID:      messageID,
 		MaxRetries:     3,
 	}
 }
@@ -44,8 +43,8 @@ func (c *SendMessageCommand) Validate() error {
 	if c.SenderID == uuid.Nil {
 		return errors.New("sender_id is required")
 	}
-	if strings.TrimSpace(c.Content) == "" {
-		return errors.New("content cannot be empty")
+	if c.MessageID == uuid.Nil {
+		return errors.New("message_id is required")
 	}
 	if c.ScheduledFor != nil && c.ScheduledFor.Before(time.Now()) {
 		return errors.New("scheduled time must be in the future")
@@ -66,3 +66,11 @@ type CallQualityMetric struct {
 func (CallQualityMetric) TableName() string {
 	return "call_quality_metrics"
 }
+
+// ICEServer is a STUN or TURN server handed to WebRTC clients. TURN servers
+// carry time-limited credentials.
+type ICEServer struct {
+	URLs       []string
+	Username   string
+	Credential string
+}
@@ -31,6 +31,7 @@ type CommandLog struct {
 	CreatedAt       time.Time
 	ExecutedAt      *time.Time
 	UndoneAt        *time.Time
+	UndoDeadline    *time.Time
 }
 
 // TableName returns the database table name
@@ -38,18 +39,39 @@ func (CommandLog) TableName() string {
 	return "command_logs"
 }
 
+// IsUndoable reports whether the command completed, has not been undone and
+// is still inside its undo window.
+func (l CommandLog) IsUndoable(now time.Time) bool {
+	return l.Status == StatusCompleted && l.UndoneAt == nil && len(l.UndoData) > 0 &&
+		l.UndoDeadline != nil && now.Before(*l.UndoDeadline)
+}
+
+// Scheduled message states
+const (
+	ScheduledPending  = "PENDING"
+	ScheduledSent     = "SENT"
+	ScheduledCanceled = "CANCELED"
+	ScheduledFailed   = "FAILED"
+)
+
 // ScheduledMessage for delayed delivery
 type ScheduledMessage struct {
-	ID             uuid.UUID
-	MessageID      uuid.UUID
-	ConversationID uuid.UUID
-	SenderID       uuid.UUID
-	Content        string
-	ScheduledFor   time.Time
-	Timezone       string
-	Status         string
-	CreatedAt      time.Time
-	SentAt         *time.Time
+	ID              uuid.UUID
+	MessageID       uuid.NullUUID
+	ConversationID  uuid.UUID
+	SenderID        uuid.UUID
+	SenderDeviceID  uuid.NullUUID
+	MessageType     string
+	ClientMessageID string
+	ScheduledFor    time.Time
+	Timezone        string
+	Status          string
+	Attempts        int
+	NextAttemptAt   time.Time
+	LastError       string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	SentAt          *time.Time
 }
 
 // TableName returns the database table name
@@ -57,7 +79,22 @@ func (ScheduledMessage) TableName() string {
 	return "scheduled_messages"
 }
 
-// MessageVersion for edit history
+// ScheduledMessageCiphertext holds the ciphertext for one recipient device
+type ScheduledMessageCiphertext struct {
+	ID                 uuid.UUID
+	ScheduledMessageID uuid.UUID
+	RecipientDeviceID  uuid.UUID
+	Ciphertext         []byte
+	Header             string
+}
+
+// TableName returns the database table name
+func (ScheduledMessageCiphertext) TableName() string {
+	return "scheduled_message_ciphertexts"
+}
+
+// MessageVersion for edit history. Ciphertexts hold the per-device payloads
+// the message had before the edit.
 type MessageVersion struct {
 	ID            uuid.UUID
 	MessageID     uuid.UUID
@@ -65,9 +102,27 @@ type MessageVersion struct {
 	EditedBy      uuid.UUID
 	EditedAt      time.Time
 	VersionNumber int
+	Ciphertexts   []MessageVersionCiphertext
 }
 
 // TableName returns the database table name
 func (MessageVersion) TableName() string {
 	return "message_versions"
 }
+
+// MessageVersionCiphertext is a prior ciphertext of a message for one device
+type MessageVersionCiphertext struct {
+	ID                uuid.UUID
+	VersionID         uuid.UUID
+	RecipientUserID   uuid.UUID
+	RecipientDeviceID uuid.UUID
+	SenderDeviceID    uuid.NullUUID
+	Ciphertext        []byte
+	Header            string
+	CreatedAt         time.Time
+}
+
+// TableName returns the database table name
+func (MessageVersionCiphertext) TableName() string {
+	return "message_version_ciphertexts"
+}
@@ -0,0 +1,180 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Participant roles, from most to least privileged
+const (
+	RoleOwner  = "OWNER"
+	RoleAdmin  = "ADMIN"
+	RoleMember = "MEMBER"
+)
+
+// Group actions governed by GroupPermissions
+const (
+	ActionSendMessages = "send_messages"
+	ActionEditInfo     = "edit_info"
+	ActionAddMembers   = "add_members"
+	ActionPinMessages  = "pin_messages"
+	ActionStartCalls   = "start_calls"
+)
+
+// Who a group lets perform an action
+const (
+	PermissionEveryone = "EVERYONE"
+	PermissionAdmins   = "ADMINS"
+)
+
+// ErrInvalidPermissions is returned for permission documents with unknown
+// settings.
+var ErrInvalidPermissions = errors.New("invalid permissions")
+
+// GroupPermissions is the typed form of conversations.group_permissions. Each
+// field is PermissionEveryone or PermissionAdmins; owners and admins may always
+// perform every action.
+type GroupPermissions struct {
+	SendMessages string `json:"send_messages"`
+	EditInfo     string `json:"edit_info"`
+	AddMembers   string `json:"add_members"`
+	PinMessages  string `json:"pin_messages"`
+	StartCalls   string `json:"start_calls"`
+}
+
+// DefaultGroupPermissions apply to groups that never changed their settings
+// and fill in settings missing from stored documents.
+func DefaultGroupPermissions() GroupPermissions {
+	return GroupPermissions{
+		SendMessages: PermissionEveryone,
+		EditInfo:     PermissionAdmins,
+		AddMembers:   PermissionAdmins,
+		PinMessages:  PermissionAdmins,
+		StartCalls:   PermissionEveryone,
+	}
+}
+
+// ParseGroupPermissions reads a stored permission document on top of the
+// defaults. A nil or empty document yields the defaults.
+func ParseGroupPermissions(raw *string) (GroupPermissions, error) {
+	perms := DefaultGroupPermissions()
+	if raw == nil || *raw == "" {
+		return perms, nil
+	}
+	if err := json.Unmarshal([]byte(*raw), &perms); err != nil {
+		return DefaultGroupPermissions(), ErrInvalidPermissions
+	}
+	if err := perms.Validate(); err != nil {
+		return DefaultGroupPermissions(), err
+	}
+	return perms, nil
+}
+
+// Validate checks that every setting is known.
+func (g GroupPermissions) Validate() error {
+	for _, setting := range []string{g.SendMessages, g.EditInfo, g.AddMembers, g.PinMessages, g.StartCalls} {
+		if setting != PermissionEveryone && setting != PermissionAdmins {
+			return ErrInvalidPermissions
+		}
+	}
+	return nil
+}
+
+// Setting returns who may perform the action, or "" for unknown actions.
+func (g GroupPermissions) Setting(action string) string {
+	switch action {
+	case ActionSendMessages:
+		return g.SendMessages
+	case ActionEditInfo:
+		return g.EditInfo
+	case ActionAddMembers:
+		return g.AddMembers
+	case ActionPinMessages:
+		return g.PinMessages
+	case ActionStartCalls:
+		return g.StartCalls
+	}
+	return ""
+}
+
+// Settings returns the settings keyed by action.
+func (g GroupPermissions) Settings() map[string]string {
+	return map[string]string{
+		ActionSendMessages: g.SendMessages,
+		ActionEditInfo:     g.EditInfo,
+		ActionAddMembers:   g.AddMembers,
+		ActionPinMessages:  g.PinMessages,
+		ActionStartCalls:   g.StartCalls,
+	}
+}
+
+// ParticipantPermissions is the typed form of participants.permissions: per
+// member overrides of the group settings. A nil field follows the group.
+type ParticipantPermissions struct {
+	SendMessages *bool `json:"send_messages,omitempty"`
+	EditInfo     *bool `json:"edit_info,omitempty"`
+	AddMembers   *bool `json:"add_members,omitempty"`
+	PinMessages  *bool `json:"pin_messages,omitempty"`
+	StartCalls   *bool `json:"start_calls,omitempty"`
+}
+
+// ParseParticipantPermissions reads a stored override document. A nil, empty
+// or unreadable document has no overrides.
+func ParseParticipantPermissions(raw *string) ParticipantPermissions {
+	var perms ParticipantPermissions
+	if raw == nil || *raw == "" {
+		return perms
+	}
+	if err := json.Unmarshal([]byte(*raw), &perms); err != nil {
+		return ParticipantPermissions{}
+	}
+	return perms
+}
+
+func (p ParticipantPermissions) override(action string) *bool {
+	switch action {
+	case ActionSendMessages:
+		return p.SendMessages
+	case ActionEditInfo:
+		return p.EditInfo
+	case ActionAddMembers:
+		return p.AddMembers
+	case ActionPinMessages:
+		return p.PinMessages
+	case ActionStartCalls:
+		return p.StartCalls
+	}
+	return nil
+}
+
+// RoleRank orders roles so that a higher rank outranks a lower one. Unknown
+// roles rank below members.
+func RoleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 3
+	case RoleAdmin:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// IsAdmin reports whether the participant is an admin or the owner.
+func (p Participant) IsAdmin() bool {
+	return RoleRank(p.Role) >= RoleRank(RoleAdmin)
+}
+
+// Can reports whether the participant may perform the action in a conversation
+// with the given group permissions. Owners and admins always can; members
+// follow their own overrides first and then the group setting.
+func (p Participant) Can(perms GroupPermissions, action string) bool {
+	if p.IsAdmin() {
+		return true
+	}
+	if allowed := ParseParticipantPermissions(p.Permissions).override(action); allowed != nil {
+		return *allowed
+	}
+	return perms.Setting(action) == PermissionEveryone
+}
@@ -0,0 +1,59 @@
+package conversation
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of change reported by the delta sync feed
+const (
+	ChangeMessageEdited       = "message_edited"
+	ChangeMessageDeleted      = "message_deleted"
+	ChangeMessageDeletedForMe = "message_deleted_for_me"
+	ChangeConversationCleared = "conversation_cleared"
+	ChangeReceipt             = "receipt"
+	ChangeMemberAdded         = "member_added"
+	ChangeMemberRemoved       = "member_removed"
+	ChangeMemberRoleChanged   = "member_role_changed"
+)
+
+// SequenceState is a conversation of the syncing user with the sequence of
+// its latest message
+type SequenceState struct {
+	ConversationID uuid.UUID
+	LastSequence   int64
+}
+
+// Change is one entry of a user's delta sync feed. MessageID is set for
+// message changes and receipts; Value holds the receipt status or the
+// participant role.
+type Change struct {
+	Kind           string
+	ConversationID uuid.UUID
+	MessageID      uuid.NullUUID
+	UserID         uuid.UUID
+	Value          sql.NullString
+	ChangedAt      time.Time
+}
+
+// ChangeCursor is a position in the delta sync feed. The feed is ordered by
+// ChangedAt and then by the remaining fields, so changes sharing a timestamp
+// can be paged through without repeats.
+type ChangeCursor struct {
+	ChangedAt time.Time
+	Kind      string
+	MessageID uuid.UUID
+	UserID    uuid.UUID
+}
+
+// Cursor returns the feed position just after this change.
+func (c Change) Cursor() ChangeCursor {
+	return ChangeCursor{
+		ChangedAt: c.ChangedAt,
+		Kind:      c.Kind,
+		MessageID: c.MessageID.UUID,
+		UserID:    c.UserID,
+	}
+}
@@ -18,6 +18,19 @@ type IdentityKey struct {
 	// Unique(device_id) - handled by idx/constraint in SQL
 }
 
+// IdentityKeyHistory represents identity_key_history: one identity key a
+// device used, from its upload until it was replaced, deactivated or deleted
+type IdentityKeyHistory struct {
+	ID                 uuid.UUID
+	UserID             uuid.UUID
+	DeviceID           uuid.UUID
+	IdentityKeyID      uuid.UUID
+	PublicKey          []byte
+	ActivatedAt        time.Time
+	DeactivatedAt      sql.NullTime
+	DeactivationReason sql.NullString
+}
+
 // SignedPreKey represents signed_prekeys
 type SignedPreKey struct {
 	ID        uuid.UUID
@@ -28,6 +41,12 @@ type SignedPreKey struct {
 	Signature []byte
 	CreatedAt time.Time
 	IsActive  bool
+	// DeactivatedAt is set once the key is replaced; it is kept for a grace
+	// window after that
+	DeactivatedAt sql.NullTime
+	// RotationRequestedAt is set when the device was asked to replace the
+	// key because it grew stale
+	RotationRequestedAt sql.NullTime
 }
 
 // OneTimePreKey represents onetime_prekeys
@@ -43,10 +62,41 @@ type OneTimePreKey struct {
 	ConsumedByDeviceID uuid.NullUUID
 }
 
+// SenderKey represents sender_keys: the sender key a device currently uses
+// to encrypt group messages, created in the conversation's Epoch
+type SenderKey struct {
+	ConversationID uuid.UUID
+	SenderDeviceID uuid.UUID
+	SenderID       uuid.UUID
+	DistributionID uuid.UUID
+	Epoch          int64
+	CreatedAt      time.Time
+}
+
+// SenderKeyDistribution represents sender_key_distributions: a sender key
+// distribution message pairwise encrypted for one member device
+type SenderKeyDistribution struct {
+	ID                uuid.UUID
+	ConversationID    uuid.UUID
+	SenderID          uuid.UUID
+	SenderDeviceID    uuid.UUID
+	RecipientUserID   uuid.UUID
+	RecipientDeviceID uuid.UUID
+	DistributionID    uuid.UUID
+	Epoch             int64
+	Ciphertext        []byte
+	Header            string
+	CreatedAt         time.Time
+}
+
 func (IdentityKey) TableName() string {
 	return "identity_keys"
 }
 
+func (IdentityKeyHistory) TableName() string {
+	return "identity_key_history"
+}
+
 func (SignedPreKey) TableName() string {
 	return "signed_prekeys"
 }
@@ -54,3 +104,11 @@ func (SignedPreKey) TableName() string {
 func (OneTimePreKey) TableName() string {
 	return "onetime_prekeys"
 }
+
+func (SenderKey) TableName() string {
+	return "sender_keys"
+}
+
+func (SenderKeyDistribution) TableName() string {
+	return "sender_key_distributions"
+}
@@ -0,0 +1,72 @@
+package encryption
+
+import (
+	"crypto/ed25519"
+	"math/big"
+)
+
+// djbKeyType prefixes Curve25519 public keys serialized the way Signal clients
+// send them.
+const djbKeyType = 0x05
+
+var (
+	curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	bigOne      = big.NewInt(1)
+)
+
+// VerifySignedPreKey reports whether signature is the identity key's signature
+// over the signed prekey's public key. A 33-byte identity key starting with
+// 0x05 is a Curve25519 key and is checked as an XEdDSA signature, which is how
+// Signal clients sign; a 32-byte identity key is checked as an Ed25519 key.
+func VerifySignedPreKey(identityKey, signedPreKey, signature []byte) bool {
+	if len(signature) != ed25519.SignatureSize || len(signedPreKey) == 0 {
+		return false
+	}
+	switch {
+	case len(identityKey) == 33 && identityKey[0] == djbKeyType:
+		return verifyXEdDSA(identityKey[1:], signedPreKey, signature)
+	case len(identityKey) == ed25519.PublicKeySize:
+		return ed25519.Verify(ed25519.PublicKey(identityKey), signedPreKey, signature)
+	}
+	return false
+}
+
+// verifyXEdDSA checks an XEdDSA signature made with a Curve25519 key. The
+// Montgomery u-coordinate maps to the Edwards y = (u-1)/(u+1); the signer
+// stores the sign of x in the top bit of the signature, and with both in place
+// the signature verifies as an ordinary Ed25519 signature.
+func verifyXEdDSA(montgomeryKey, message, signature []byte) bool {
+	if len(montgomeryKey) != 32 {
+		return false
+	}
+	uBytes := reversed(montgomeryKey)
+	uBytes[0] &= 0x7f
+	u := new(big.Int).SetBytes(uBytes)
+	u.Mod(u, curve25519P)
+
+	denominator := new(big.Int).Add(u, bigOne)
+	denominator.Mod(denominator, curve25519P)
+	if denominator.Sign() == 0 {
+		return false
+	}
+	y := new(big.Int).Sub(u, bigOne)
+	y.Mul(y, new(big.Int).ModInverse(denominator, curve25519P))
+	y.Mod(y, curve25519P)
+
+	publicKey := reversed(y.FillBytes(make([]byte, 32)))
+	publicKey[31] |= signature[63] & 0x80
+
+	sig := append([]byte(nil), signature...)
+	sig[63] &= 0x7f
+	return ed25519.Verify(ed25519.PublicKey(publicKey), message, sig)
+}
+
+// reversed returns a reversed copy of b, converting a little-endian field
+// element to the big-endian order math/big reads and back.
+func reversed(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, v := range b {
+		out[len(b)-1-i] = v
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// A Curve25519 identity key, the signed prekey it signed and the XEdDSA
+// signature, taken from libsignal's curve signature test. The top bit of the
+// signature is set, so it carries the sign of the Edwards x-coordinate.
+const (
+	libsignalIdentityKey  = "05ab7e717d4a163b7d9a1d8071dfe9dcf8cdcd1cea3339b6356be84d887e322c64"
+	libsignalSignedPreKey = "05edce9d9c415ca78cb7252e72c2c4a554d3eb29485a0e1d503118d1a82d99fb4a"
+	libsignalSignature    = "5de88ca9a89b4a115da79109c67c9c7464a3e4180274f1cb8c63c2984e286dfb" +
+		"ede82deb9dcd9fae0bfbb821569b3d9001bd8130cd11d486cef047bd60b86e88"
+)
+
+// RFC 8032 section 7.1, TEST 2: an Ed25519 key, a one-byte message and its
+// signature.
+const (
+	rfc8032PublicKey = "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c"
+	rfc8032Message   = "72"
+	rfc8032Signature = "92a009a9f0d4cab8720e820b5f642540a2b27b5416503f8fb3762223ebdb69da" +
+		"085ac1e43e15996e458f3613d0f11d8c387b2eaeb4302aeeb00d291612bb0c00"
+	// rfc8032MontgomeryKey is the same key as a Signal Curve25519 key. Its x
+	// sign is zero, so the Ed25519 signature is also a valid XEdDSA one.
+	rfc8032MontgomeryKey = "0525c704c594b88afc00a76b69d1ed2b984d7e22550f3ed0802d04fbcd07d38d47"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return b
+}
+
+// flipped returns a copy of b with one bit inverted.
+func flipped(b []byte, index int, mask byte) []byte {
+	out := append([]byte(nil), b...)
+	out[index] ^= mask
+	return out
+}
+
+func TestVerifySignedPreKeyXEdDSA(t *testing.T) {
+	identity := mustHex(t, libsignalIdentityKey)
+	prekey := mustHex(t, libsignalSignedPreKey)
+	signature := mustHex(t, libsignalSignature)
+
+	if !VerifySignedPreKey(identity, prekey, signature) {
+		t.Fatal("libsignal signature rejected")
+	}
+
+	tests := []struct {
+		name      string
+		identity  []byte
+		prekey    []byte
+		signature []byte
+	}{
+		{"flipped signature bit", identity, prekey, flipped(signature, 0, 0x01)},
+		{"flipped sign bit", identity, prekey, flipped(signature, 63, 0x80)},
+		{"flipped prekey bit", identity, flipped(prekey, 10, 0x04), signature},
+		{"flipped identity bit", flipped(identity, 5, 0x01), prekey, signature},
+		{"wrong identity key", mustHex(t, rfc8032MontgomeryKey), prekey, signature},
+		{"short signature", identity, prekey, signature[:63]},
+		{"long signature", identity, prekey, append(append([]byte(nil), signature...), 0)},
+		{"short identity key", identity[:32], prekey, signature},
+		{"long identity key", append(append([]byte(nil), identity...), 0), prekey, signature},
+		{"unknown key type", flipped(identity, 0, 0x03), prekey, signature},
+		{"empty prekey", identity, nil, signature},
+	}
+	for _, tt := range tests {
+		if VerifySignedPreKey(tt.identity, tt.prekey, tt.signature) {
+			t.Errorf("%s: signature accepted", tt.name)
+		}
+	}
+}
+
+func TestVerifySignedPreKeyXEdDSASignBitClear(t *testing.T) {
+	identity := mustHex(t, rfc8032MontgomeryKey)
+	message := mustHex(t, rfc8032Message)
+	signature := mustHex(t, rfc8032Signature)
+
+	if !VerifySignedPreKey(identity, message, signature) {
+		t.Fatal("signature with a clear sign bit rejected")
+	}
+	if VerifySignedPreKey(identity, message, flipped(signature, 63, 0x80)) {
+		t.Fatal("signature accepted with the sign bit set")
+	}
+}
+
+func TestVerifySignedPreKeyEd25519(t *testing.T) {
+	identity := mustHex(t, rfc8032PublicKey)
+	message := mustHex(t, rfc8032Message)
+	signature := mustHex(t, rfc8032Signature)
+
+	if !VerifySignedPreKey(identity, message, signature) {
+		t.Fatal("RFC 8032 signature rejected")
+	}
+
+	tests := []struct {
+		name      string
+		identity  []byte
+		message   []byte
+		signature []byte
+	}{
+		{"flipped signature bit", identity, message, flipped(signature, 32, 0x01)},
+		{"flipped message bit", identity, flipped(message, 0, 0x01), signature},
+		{"wrong key", mustHex(t, libsignalIdentityKey)[1:], message, signature},
+		{"short signature", identity, message, signature[:63]},
+		{"short key", identity[:31], message, signature},
+	}
+	for _, tt := range tests {
+		if VerifySignedPreKey(tt.identity, tt.message, tt.signature) {
+			t.Errorf("%s: signature accepted", tt.name)
+		}
+	}
+}
@@ -35,6 +35,8 @@ type Attachment struct {
 	DurationSeconds   sql.NullInt32
 	EncryptionKeyHash sql.NullString
 	EncryptionIV      sql.NullString
+	UploadSessionID   uuid.NullUUID
+	ObjectKey         sql.NullString
 	CreatedAt         time.Time
 }
 
@@ -2,6 +2,7 @@ package message
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -33,6 +34,7 @@ type Message struct {
 	RecipientDeviceID  uuid.NullUUID
 	RecipientUserID    uuid.NullUUID
 	SenderDeviceID     uuid.NullUUID
+	Attachments        []Attachment
 }
 
 // MessageReaction represents message_reactions
@@ -44,6 +46,13 @@ type MessageReaction struct {
 	CreatedAt    time.Time
 }
 
+// ReactionSummary aggregates message_reactions by reaction code
+type ReactionSummary struct {
+	ReactionCode string
+	Count        int64
+	ReactedByMe  bool
+}
+
 // MessageReceipt represents message_receipts
 type MessageReceipt struct {
 	MessageID   uuid.UUID
@@ -70,6 +79,29 @@ type StarredMessage struct {
 	StarredAt time.Time
 }
 
+// PinnedMessage represents pinned_messages
+type PinnedMessage struct {
+	ConversationID uuid.UUID
+	MessageID      uuid.UUID
+	PinnedBy       uuid.NullUUID
+	PinnedAt       time.Time
+}
+
+// StarredMessageDetails is a starred message carrying the ciphertext addressed
+// to one of the user's devices
+type StarredMessageDetails struct {
+	Message   Message
+	StarredAt time.Time
+}
+
+// MentionDetails is a message mentioning a user, carrying the ciphertext
+// addressed to one of their devices and whether they have read it
+type MentionDetails struct {
+	Message  Message
+	Mentions []MessageMention
+	IsRead   bool
+}
+
 // MessageCiphertext represents message_ciphertexts
 type MessageCiphertext struct {
 	ID                uuid.UUID
@@ -80,6 +112,7 @@ type MessageCiphertext struct {
 	Ciphertext        []byte
 	Header            string
 	CreatedAt         time.Time
+	DeliveredAt       sql.NullTime
 }
 
 func (Message) TableName() string {
@@ -105,3 +138,22 @@ func (StarredMessage) TableName() string {
 func (MessageCiphertext) TableName() string {
 	return "message_ciphertexts"
 }
+
+// ForwardedManyTimesDepth is the forwarding depth from which clients label a
+// message as "forwarded many times".
+const ForwardedManyTimesDepth = 5
+
+// ForwardDepth returns how many forwards separate the message from the one
+// originally written, as recorded in its metadata, or zero if it was not forwarded.
+func (m Message) ForwardDepth() int {
+	if !m.IsForwarded {
+		return 0
+	}
+	var meta struct {
+		ForwardDepth int `json:"forward_depth"`
+	}
+	if err := json.Unmarshal([]byte(m.Metadata), &meta); err != nil || meta.ForwardDepth < 1 {
+		return 1
+	}
+	return meta.ForwardDepth
+}
@@ -14,9 +14,18 @@ type Poll struct {
 	Question       string
 	AllowsMultiple bool
 	ClosesAt       sql.NullTime
+	ClosedAt       sql.NullTime
 	CreatedAt      time.Time
 }
 
+// IsClosed reports whether the poll no longer accepts votes at the given time
+func (p Poll) IsClosed(now time.Time) bool {
+	if p.ClosedAt.Valid {
+		return true
+	}
+	return p.ClosesAt.Valid && !now.Before(p.ClosesAt.Time)
+}
+
 // PollOption represents poll_options
 type PollOption struct {
 	ID         uuid.UUID
@@ -33,6 +42,22 @@ type PollVote struct {
 	VotedAt  time.Time
 }
 
+// PollTally is the number of votes cast for a poll option
+type PollTally struct {
+	OptionID uuid.UUID
+	Votes    int64
+}
+
+// PollDetails is a poll with its options, tallies and the viewer's own votes
+type PollDetails struct {
+	Poll           Poll
+	ConversationID uuid.UUID
+	Options        []PollOption
+	Tallies        []PollTally
+	TotalVoters    int64
+	MyVotes        []uuid.UUID
+}
+
 func (Poll) TableName() string {
 	return "polls"
 }
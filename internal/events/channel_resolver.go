@@ -25,7 +25,8 @@ func (r *HybridChannelResolver) ResolveChannels(event Event) []string {
 	case *MessageReadEvent:
 		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
 	case *MessageDeliveredEvent:
-		channels = append(channels, fmt.Sprintf("channel:user:%s", e.RecipientID))
+		// Published once; the hub delivers it to the sender and the recipient.
+		channels = append(channels, fmt.Sprintf("channel:user:%s", e.SenderID))
 	case *TypingEvent:
 		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
 	case *PresenceEvent:
@@ -34,6 +35,44 @@ func (r *HybridChannelResolver) ResolveChannels(event Event) []string {
 		channels = append(channels, fmt.Sprintf("channel:user:%s", e.ToID))
 	case *CallEndedEvent:
 		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *ReactionEvent:
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *PollUpdatedEvent:
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *MessageEditedEvent:
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *CommandUndoneEvent:
+		channels = append(channels, fmt.Sprintf("channel:user:%s", e.UserID))
+	case *LabelChangedEvent:
+		channels = append(channels, fmt.Sprintf("channel:user:%s", e.UserID))
+	case *HistoryHiddenEvent:
+		channels = append(channels, fmt.Sprintf("channel:user:%s", e.UserID))
+	case *MessageStarEvent:
+		channels = append(channels, fmt.Sprintf("channel:user:%s", e.UserID))
+	case *MentionNewEvent:
+		channels = append(channels, fmt.Sprintf("channel:user:%s", e.UserID))
+	case *AttachmentViewedEvent:
+		channels = append(channels, fmt.Sprintf("channel:user:%s", e.SenderID))
+	case *MessageExpiredEvent:
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *GroupPermissionsChangedEvent:
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *SenderKeyReceivedEvent:
+		// Published once; the hub delivers it to each of RecipientIDs.
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *SenderKeyRotateEvent:
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *PreKeysLowEvent:
+		channels = append(channels, fmt.Sprintf("channel:device:%s", e.DeviceID))
+	case *SignedPreKeyRotateEvent:
+		channels = append(channels, fmt.Sprintf("channel:device:%s", e.DeviceID))
+	case *IdentityChangedEvent:
+		// Published once; the hub delivers it to each of RecipientIDs.
+		channels = append(channels, fmt.Sprintf("channel:user:%s", e.UserID))
+	case *MessageDeletedEvent:
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
+	case *MessagePinnedEvent:
+		channels = append(channels, fmt.Sprintf("channel:conversation:%s", e.ConversationID))
 	}
 
 	return channels
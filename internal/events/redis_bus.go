@@ -151,6 +151,96 @@ func (b *RedisEventBus) unmarshalEvent(eventType EventType, data []byte) Event {
 		if err := json.Unmarshal(data, &e); err == nil {
 			return &e
 		}
+	case EventReactionAdded, EventReactionRemoved:
+		var e ReactionEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventPollUpdated:
+		var e PollUpdatedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventMessageEdited:
+		var e MessageEditedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventCommandUndone:
+		var e CommandUndoneEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventLabelChanged:
+		var e LabelChangedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventConversationCleared, EventMessageDeletedForMe:
+		var e HistoryHiddenEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventMessageStarred, EventMessageUnstarred:
+		var e MessageStarEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventMentionNew:
+		var e MentionNewEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventAttachmentViewed:
+		var e AttachmentViewedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventMessageExpired:
+		var e MessageExpiredEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventPermissionsChanged:
+		var e GroupPermissionsChangedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventSenderKeyReceived:
+		var e SenderKeyReceivedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventSenderKeyRotate:
+		var e SenderKeyRotateEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventPreKeysLow:
+		var e PreKeysLowEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventSignedPreKeyRotate:
+		var e SignedPreKeyRotateEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventIdentityChanged:
+		var e IdentityChangedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventMessageDeleted, EventMessageRestored:
+		var e MessageDeletedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
+	case EventMessagePinned, EventMessageUnpinned:
+		var e MessagePinnedEvent
+		if err := json.Unmarshal(data, &e); err == nil {
+			return &e
+		}
 	}
 	return nil
 }
@@ -11,17 +11,40 @@ import (
 type EventType string
 
 const (
-	EventMessageNew       EventType = "message:new"
-	EventMessageRead      EventType = "message:read"
-	EventMessageDelivered EventType = "message:delivered"
-	EventTypingStarted    EventType = "typing:started"
-	EventTypingStopped    EventType = "typing:stopped"
-	EventPresenceOnline   EventType = "presence:online"
-	EventPresenceOffline  EventType = "presence:offline"
-	EventCallOffer        EventType = "call:offer"
-	EventCallAnswer       EventType = "call:answer"
-	EventCallICE          EventType = "call:ice"
-	EventCallEnded        EventType = "call:ended"
+	EventMessageNew          EventType = "message:new"
+	EventMessageRead         EventType = "message:read"
+	EventMessageDelivered    EventType = "message:delivered"
+	EventTypingStarted       EventType = "typing:started"
+	EventTypingStopped       EventType = "typing:stopped"
+	EventPresenceOnline      EventType = "presence:online"
+	EventPresenceOffline     EventType = "presence:offline"
+	EventCallOffer           EventType = "call:offer"
+	EventCallAnswer          EventType = "call:answer"
+	EventCallICE             EventType = "call:ice"
+	EventCallEnded           EventType = "call:ended"
+	EventReactionAdded       EventType = "reaction:added"
+	EventReactionRemoved     EventType = "reaction:removed"
+	EventPollUpdated         EventType = "poll:updated"
+	EventMessageEdited       EventType = "message:edited"
+	EventCommandUndone       EventType = "command:undone"
+	EventLabelChanged        EventType = "label:changed"
+	EventConversationCleared EventType = "conversation:cleared"
+	EventMessageDeletedForMe EventType = "message:deleted_for_me"
+	EventMessageStarred      EventType = "message:starred"
+	EventMessageUnstarred    EventType = "message:unstarred"
+	EventMentionNew          EventType = "mention:new"
+	EventAttachmentViewed    EventType = "attachment:viewed"
+	EventMessageExpired      EventType = "message:expired"
+	EventPermissionsChanged  EventType = "conversation:permissions_changed"
+	EventSenderKeyReceived   EventType = "sender_key:received"
+	EventSenderKeyRotate     EventType = "sender_key:rotate"
+	EventPreKeysLow          EventType = "encryption:prekeys_low"
+	EventSignedPreKeyRotate  EventType = "encryption:signed_prekey_rotate"
+	EventIdentityChanged     EventType = "identity:changed"
+	EventMessageDeleted      EventType = "message:deleted"
+	EventMessageRestored     EventType = "message:restored"
+	EventMessagePinned       EventType = "message:pinned"
+	EventMessageUnpinned     EventType = "message:unpinned"
 )
 
 // Event is the base interface for all events
@@ -92,17 +115,22 @@ type MessageDeliveredEvent struct {
 	BaseEvent
 	MessageID      uuid.UUID `json:"message_id"`
 	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
 	RecipientID    uuid.UUID `json:"recipient_id"`
 }
 
 func (e *MessageDeliveredEvent) Payload() interface{} { return e }
 
-// PresenceEvent triggered when user's presence changes
+// PresenceEvent triggered when user's presence changes. Audience lists the users
+// allowed to see it under the user's last-seen privacy setting; the hub strips
+// it before delivery.
 type PresenceEvent struct {
 	BaseEvent
-	UserID   uuid.UUID `json:"user_id"`
-	IsOnline bool      `json:"is_online"`
-	Status   string    `json:"status"` // online, away, busy, offline
+	UserID   uuid.UUID   `json:"user_id"`
+	IsOnline bool        `json:"is_online"`
+	Status   string      `json:"status"` // online, away, busy, offline
+	LastSeen *time.Time  `json:"last_seen,omitempty"`
+	Audience []uuid.UUID `json:"audience,omitempty"`
 }
 
 func (e *PresenceEvent) Payload() interface{} { return e }
@@ -130,3 +158,231 @@ type CallEndedEvent struct {
 }
 
 func (e *CallEndedEvent) Payload() interface{} { return e }
+
+// ReactionEvent triggered when a reaction is added to or removed from a message
+type ReactionEvent struct {
+	BaseEvent
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	ReactionCode   string    `json:"reaction_code"`
+}
+
+func (e *ReactionEvent) Payload() interface{} { return e }
+
+// PollTally is the vote count for a single poll option
+type PollTally struct {
+	OptionID uuid.UUID `json:"option_id"`
+	Votes    int64     `json:"votes"`
+}
+
+// PollUpdatedEvent triggered when poll votes change or the poll closes
+type PollUpdatedEvent struct {
+	BaseEvent
+	PollID         uuid.UUID   `json:"poll_id"`
+	MessageID      uuid.UUID   `json:"message_id"`
+	ConversationID uuid.UUID   `json:"conversation_id"`
+	IsClosed       bool        `json:"is_closed"`
+	TotalVoters    int64       `json:"total_voters"`
+	Tallies        []PollTally `json:"tallies"`
+}
+
+func (e *PollUpdatedEvent) Payload() interface{} { return e }
+
+// MessageEditedEvent triggered when a sender edits a message
+type MessageEditedEvent struct {
+	BaseEvent
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	EditorID       uuid.UUID `json:"editor_id"`
+	VersionNumber  int       `json:"version_number"`
+	EditedAt       time.Time `json:"edited_at"`
+}
+
+func (e *MessageEditedEvent) Payload() interface{} { return e }
+
+// CommandUndoneEvent triggered when a user undoes one of their commands
+type CommandUndoneEvent struct {
+	BaseEvent
+	CommandID   uuid.UUID `json:"command_id"`
+	CommandType string    `json:"command_type"`
+	UserID      uuid.UUID `json:"user_id"`
+	UndoneAt    time.Time `json:"undone_at"`
+}
+
+func (e *CommandUndoneEvent) Payload() interface{} { return e }
+
+// LabelChangedEvent triggered when a user changes their chat labels so their other devices can sync
+type LabelChangedEvent struct {
+	BaseEvent
+	UserID         uuid.UUID   `json:"user_id"`
+	Action         string      `json:"action"`
+	LabelID        *uuid.UUID  `json:"label_id,omitempty"`
+	ConversationID *uuid.UUID  `json:"conversation_id,omitempty"`
+	LabelIDs       []uuid.UUID `json:"label_ids,omitempty"`
+}
+
+func (e *LabelChangedEvent) Payload() interface{} { return e }
+
+// HistoryHiddenEvent triggered when a user clears a conversation or deletes a message for themselves, so their other devices hide the same history
+type HistoryHiddenEvent struct {
+	BaseEvent
+	UserID         uuid.UUID  `json:"user_id"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	MessageID      *uuid.UUID `json:"message_id,omitempty"`
+	ClearedAt      *time.Time `json:"cleared_at,omitempty"`
+}
+
+func (e *HistoryHiddenEvent) Payload() interface{} { return e }
+
+// MessageStarEvent triggered when a user stars or unstars a message, so their other devices stay in sync
+type MessageStarEvent struct {
+	BaseEvent
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	Starred        bool      `json:"starred"`
+}
+
+func (e *MessageStarEvent) Payload() interface{} { return e }
+
+// MentionRange locates one mention inside the decrypted message text
+type MentionRange struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// MentionNewEvent triggered for each user mentioned in a new message, regardless of whether they muted the conversation
+type MentionNewEvent struct {
+	BaseEvent
+	MessageID      uuid.UUID      `json:"message_id"`
+	ConversationID uuid.UUID      `json:"conversation_id"`
+	SenderID       uuid.UUID      `json:"sender_id"`
+	UserID         uuid.UUID      `json:"user_id"`
+	Mentions       []MentionRange `json:"mentions"`
+}
+
+func (e *MentionNewEvent) Payload() interface{} { return e }
+
+// AttachmentViewedEvent triggered when a recipient opens a view-once attachment, sent to the message sender
+type AttachmentViewedEvent struct {
+	BaseEvent
+	AttachmentID   uuid.UUID `json:"attachment_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	ViewerID       uuid.UUID `json:"viewer_id"`
+	ViewedAt       time.Time `json:"viewed_at"`
+}
+
+func (e *AttachmentViewedEvent) Payload() interface{} { return e }
+
+// MessageExpiredEvent triggered when the expiry sweeper deletes a disappearing message
+type MessageExpiredEvent struct {
+	BaseEvent
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SeqID          int64     `json:"seq_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func (e *MessageExpiredEvent) Payload() interface{} { return e }
+
+// GroupPermissionsChangedEvent triggered when an admin changes what members of a group may do
+type GroupPermissionsChangedEvent struct {
+	BaseEvent
+	ConversationID uuid.UUID         `json:"conversation_id"`
+	ActorID        uuid.UUID         `json:"actor_id"`
+	Previous       map[string]string `json:"previous"`
+	Permissions    map[string]string `json:"permissions"`
+}
+
+func (e *GroupPermissionsChangedEvent) Payload() interface{} { return e }
+
+// SenderKeyReceivedEvent tells member devices that a sender key distribution
+// is waiting for them. RecipientIDs lists the users it was sent to; the hub
+// strips it before delivery.
+type SenderKeyReceivedEvent struct {
+	BaseEvent
+	ConversationID uuid.UUID   `json:"conversation_id"`
+	SenderID       uuid.UUID   `json:"sender_id"`
+	SenderDeviceID uuid.UUID   `json:"sender_device_id"`
+	DistributionID uuid.UUID   `json:"distribution_id"`
+	Epoch          int64       `json:"epoch"`
+	RecipientIDs   []uuid.UUID `json:"recipient_ids,omitempty"`
+}
+
+func (e *SenderKeyReceivedEvent) Payload() interface{} { return e }
+
+// SenderKeyRotateEvent asks every member device to create and distribute a
+// new sender key after MemberID joined or left the group.
+type SenderKeyRotateEvent struct {
+	BaseEvent
+	ConversationID uuid.UUID `json:"conversation_id"`
+	Epoch          int64     `json:"epoch"`
+	Reason         string    `json:"reason"`
+	MemberID       uuid.UUID `json:"member_id"`
+}
+
+func (e *SenderKeyRotateEvent) Payload() interface{} { return e }
+
+// PreKeysLowEvent tells a device its stock of one-time prekeys fell below
+// the low-water mark.
+type PreKeysLowEvent struct {
+	BaseEvent
+	UserID    uuid.UUID `json:"user_id"`
+	DeviceID  uuid.UUID `json:"device_id"`
+	Remaining int64     `json:"remaining"`
+	Threshold int       `json:"threshold"`
+}
+
+func (e *PreKeysLowEvent) Payload() interface{} { return e }
+
+// SignedPreKeyRotateEvent asks a device to replace a stale signed prekey.
+// Bundles stop being served with the key at ExpiresAt.
+type SignedPreKeyRotateEvent struct {
+	BaseEvent
+	UserID    uuid.UUID `json:"user_id"`
+	DeviceID  uuid.UUID `json:"device_id"`
+	KeyID     int       `json:"key_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (e *SignedPreKeyRotateEvent) Payload() interface{} { return e }
+
+// IdentityChangedEvent tells a user and everyone sharing a conversation with
+// them that one of the user's device identity keys changed, so safety
+// numbers computed from the old key no longer hold.
+type IdentityChangedEvent struct {
+	BaseEvent
+	UserID        uuid.UUID   `json:"user_id"`
+	DeviceID      uuid.UUID   `json:"device_id"`
+	IdentityKeyID uuid.UUID   `json:"identity_key_id"`
+	Change        string      `json:"change"`
+	RecipientIDs  []uuid.UUID `json:"recipient_ids,omitempty"`
+}
+
+func (e *IdentityChangedEvent) Payload() interface{} { return e }
+
+// MessageDeletedEvent triggered when a message is deleted for everyone or an undo restores it
+type MessageDeletedEvent struct {
+	BaseEvent
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	ActorID        uuid.UUID `json:"actor_id"`
+	Deleted        bool      `json:"deleted"`
+}
+
+func (e *MessageDeletedEvent) Payload() interface{} { return e }
+
+// MessagePinnedEvent triggered when a message is pinned to or unpinned from its conversation
+type MessagePinnedEvent struct {
+	BaseEvent
+	MessageID      uuid.UUID `json:"message_id"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	ActorID        uuid.UUID `json:"actor_id"`
+	Pinned         bool      `json:"pinned"`
+}
+
+func (e *MessagePinnedEvent) Payload() interface{} { return e }
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AttachmentHandler struct {
+	service *services.AttachmentService
+}
+
+func NewAttachmentHandler(service *services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{service: service}
+}
+
+// View issues the single download URL a recipient gets for a view-once attachment.
+func (h *AttachmentHandler) View(c *gin.Context) {
+	attachmentID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid attachment id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	grant, err := h.service.ViewOnce(c.Request.Context(), attachmentID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.ViewOnceResponse{
+		Attachment: httpdto.FromAttachment(grant.Attachment),
+		MessageID:  grant.MessageID.String(),
+		URL:        grant.URL,
+		ViewedAt:   grant.ViewedAt.Format(time.RFC3339),
+		ExpiresAt:  grant.ExpiresAt.Format(time.RFC3339),
+	}))
+}
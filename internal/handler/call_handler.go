@@ -49,6 +49,10 @@ func (h *CallHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid initiator_id", "INVALID_REQUEST"))
 		return
 	}
+	if userID, ok := services.UserIDFromContext(c.Request.Context()); !ok || userID != initiatorID {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(sentinal_errors.ErrForbidden.Error(), "REQUEST_FAILED"))
+		return
+	}
 
 	if err := h.ensureDMCall(c.Request.Context(), conversationID); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
@@ -141,6 +145,20 @@ func (h *CallHandler) ActiveCalls(c *gin.Context) {
 	}))
 }
 
+func (h *CallHandler) ICEServers(c *gin.Context) {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	servers, expiresAt, err := h.service.GetICEServers(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromICEServers(servers, expiresAt)))
+}
+
 func (h *CallHandler) MissedCalls(c *gin.Context) {
 	userID, err := uuid.Parse(c.Query("user_id"))
 	if err != nil {
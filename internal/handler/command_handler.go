@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+
+	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CommandHandler struct {
+	executor *services.CommandExecutor
+}
+
+func NewCommandHandler(executor *services.CommandExecutor) *CommandHandler {
+	return &CommandHandler{executor: executor}
+}
+
+func (h *CommandHandler) List(c *gin.Context) {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	page, err := parseInt(c.Query("page"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid page", "INVALID_REQUEST"))
+		return
+	}
+	limit, err := parseInt(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid limit", "INVALID_REQUEST"))
+		return
+	}
+	logs, total, err := h.executor.ListCommands(c.Request.Context(), userID, c.Query("type"), c.Query("status"), page, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.ListCommandsResponse{
+		Commands: httpdto.FromCommandLogSlice(logs),
+		Total:    total,
+	}))
+}
+
+func (h *CommandHandler) Undo(c *gin.Context) {
+	commandID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid command id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	log, err := h.executor.Undo(c.Request.Context(), commandID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromCommandLog(*log)))
+}
@@ -71,7 +71,19 @@ func (h *ConversationHandler) List(c *gin.Context) {
 
 	page, _ := strconv.Atoi(c.Query("page"))
 	limit, _ := strconv.Atoi(c.Query("limit"))
-	items, total, err := h.service.GetUserConversations(c.Request.Context(), userID, page, limit)
+	var items []conversation.Conversation
+	var total int64
+	var err error
+	if labelParam := c.Query("label_id"); labelParam != "" {
+		labelID, parseErr := uuid.Parse(labelParam)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid label id", "INVALID_REQUEST"))
+			return
+		}
+		items, total, err = h.service.GetUserConversationsByLabel(c.Request.Context(), userID, labelID, page, limit)
+	} else {
+		items, total, err = h.service.GetUserConversations(c.Request.Context(), userID, page, limit)
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
@@ -109,6 +121,12 @@ func (h *ConversationHandler) Update(c *gin.Context) {
 		return
 	}
 
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+
 	// Get existing conversation
 	existing, err := h.service.GetByID(c.Request.Context(), conversationID)
 	if err != nil {
@@ -130,7 +148,7 @@ func (h *ConversationHandler) Update(c *gin.Context) {
 		existing.AvatarURL.Valid = true
 	}
 
-	if err := h.service.Update(c.Request.Context(), existing); err != nil {
+	if err := h.service.Update(c.Request.Context(), userID, existing); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
@@ -143,7 +161,12 @@ func (h *ConversationHandler) Delete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
 		return
 	}
-	if err := h.service.Delete(c.Request.Context(), conversationID); err != nil {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.Delete(c.Request.Context(), conversationID, userID); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
@@ -219,7 +242,12 @@ func (h *ConversationHandler) RegenerateInviteLink(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
 		return
 	}
-	link, err := h.service.RegenerateInviteLink(c.Request.Context(), conversationID)
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	link, err := h.service.RegenerateInviteLink(c.Request.Context(), conversationID, userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
@@ -243,13 +271,18 @@ func (h *ConversationHandler) AddParticipant(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid user_id", "INVALID_REQUEST"))
 		return
 	}
+	actorID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
 	p := &conversation.Participant{
 		ConversationID: conversationID,
 		UserID:         userID,
 		Role:           req.Role,
 		JoinedAt:       time.Now(),
 	}
-	if err := h.service.AddParticipant(c.Request.Context(), p); err != nil {
+	if err := h.service.AddParticipant(c.Request.Context(), actorID, p); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
@@ -267,7 +300,12 @@ func (h *ConversationHandler) RemoveParticipant(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid user_id", "INVALID_REQUEST"))
 		return
 	}
-	if err := h.service.RemoveParticipant(c.Request.Context(), conversationID, userID); err != nil {
+	actorID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.RemoveParticipant(c.Request.Context(), conversationID, actorID, userID); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
@@ -306,7 +344,12 @@ func (h *ConversationHandler) UpdateParticipantRole(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
 		return
 	}
-	if err := h.service.UpdateParticipantRole(c.Request.Context(), conversationID, userID, req.Role); err != nil {
+	actorID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.UpdateParticipantRole(c.Request.Context(), conversationID, actorID, userID, req.Role); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
@@ -406,11 +449,12 @@ func (h *ConversationHandler) Archive(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
 		return
 	}
-	if err := h.service.ArchiveConversation(c.Request.Context(), conversationID, userID); err != nil {
+	cmdLog, err := h.service.ArchiveConversation(c.Request.Context(), conversationID, userID)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
-	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromCommandRef(cmdLog)))
 }
 
 func (h *ConversationHandler) Unarchive(c *gin.Context) {
@@ -431,6 +475,105 @@ func (h *ConversationHandler) Unarchive(c *gin.Context) {
 	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
 }
 
+func (h *ConversationHandler) Clear(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	clearedAt, err := h.service.ClearHistory(c.Request.Context(), conversationID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.ClearConversationResponse{
+		ConversationID: conversationID.String(),
+		ClearedAt:      clearedAt.Format(time.RFC3339),
+	}))
+}
+
+func (h *ConversationHandler) SetDisappearingMode(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	var req httpdto.SetDisappearingModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	conv, announcement, err := h.service.SetDisappearingMode(c.Request.Context(), conversationID, userID, req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	res := httpdto.SetDisappearingModeResponse{Conversation: httpdto.FromConversation(conv)}
+	if announcement != nil {
+		msg := httpdto.FromMessage(*announcement)
+		res.SystemMessage = &msg
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(res))
+}
+
+func (h *ConversationHandler) GetPermissions(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	perms, err := h.service.GetGroupPermissions(c.Request.Context(), conversationID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromGroupPermissions(perms)))
+}
+
+func (h *ConversationHandler) SetPermissions(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	var req httpdto.SetGroupPermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	current, err := h.service.GetGroupPermissions(c.Request.Context(), conversationID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	perms, err := h.service.SetGroupPermissions(c.Request.Context(), conversationID, userID, req.ApplyTo(current))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromGroupPermissions(perms)))
+}
+
 func (h *ConversationHandler) UpdateLastReadSequence(c *gin.Context) {
 	conversationID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -481,3 +624,179 @@ func (h *ConversationHandler) IncrementSequence(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.SequenceResponse{Sequence: seq}))
 }
+
+func (h *ConversationHandler) ListLabels(c *gin.Context) {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	items, err := h.service.ListLabels(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.LabelsResponse{Labels: httpdto.FromChatLabelSlice(items)}))
+}
+
+func (h *ConversationHandler) CreateLabel(c *gin.Context) {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	var req httpdto.CreateLabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	input := services.LabelInput{Name: &req.Name, Position: req.Position}
+	if req.Color != "" {
+		input.Color = &req.Color
+	}
+	item, err := h.service.CreateLabel(c.Request.Context(), userID, input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromChatLabel(item)))
+}
+
+func (h *ConversationHandler) UpdateLabel(c *gin.Context) {
+	labelID, err := uuid.Parse(c.Param("label_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid label id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	var req httpdto.UpdateLabelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	item, err := h.service.UpdateLabel(c.Request.Context(), userID, labelID, services.LabelInput{
+		Name:     req.Name,
+		Color:    req.Color,
+		Position: req.Position,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromChatLabel(item)))
+}
+
+func (h *ConversationHandler) DeleteLabel(c *gin.Context) {
+	labelID, err := uuid.Parse(c.Param("label_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid label id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.DeleteLabel(c.Request.Context(), userID, labelID); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
+}
+
+func (h *ConversationHandler) ReorderLabels(c *gin.Context) {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	var req httpdto.ReorderLabelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	labelIDs := make([]uuid.UUID, 0, len(req.LabelIDs))
+	for _, idStr := range req.LabelIDs {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid label id", "INVALID_REQUEST"))
+			return
+		}
+		labelIDs = append(labelIDs, id)
+	}
+	items, err := h.service.ReorderLabels(c.Request.Context(), userID, labelIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.LabelsResponse{Labels: httpdto.FromChatLabelSlice(items)}))
+}
+
+func (h *ConversationHandler) ListConversationLabels(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	items, err := h.service.GetConversationLabels(c.Request.Context(), userID, conversationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.LabelsResponse{Labels: httpdto.FromChatLabelSlice(items)}))
+}
+
+func (h *ConversationHandler) AssignLabel(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	labelID, err := uuid.Parse(c.Param("label_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid label id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.AssignLabel(c.Request.Context(), userID, conversationID, labelID); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
+}
+
+func (h *ConversationHandler) UnassignLabel(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	labelID, err := uuid.Parse(c.Param("label_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid label id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.UnassignLabel(c.Request.Context(), userID, conversationID, labelID); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"net/http"
+
+	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type DeliveryHandler struct {
+	service *services.DeliveryService
+}
+
+func NewDeliveryHandler(service *services.DeliveryService) *DeliveryHandler {
+	return &DeliveryHandler{service: service}
+}
+
+func (h *DeliveryHandler) Pending(c *gin.Context) {
+	deviceID, ok := services.DeviceIDFromContext(c.Request.Context())
+	if !ok || !deviceID.Valid {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	limit, err := parseInt(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid limit", "INVALID_REQUEST"))
+		return
+	}
+	envelopes, hasMore, err := h.service.GetPending(c.Request.Context(), deviceID.UUID, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromPendingEnvelopes(envelopes, hasMore)))
+}
+
+func (h *DeliveryHandler) Ack(c *gin.Context) {
+	var req httpdto.AckEnvelopesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	deviceID, ok := services.DeviceIDFromContext(c.Request.Context())
+	if !ok || !deviceID.Valid {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	ids := make([]uuid.UUID, 0, len(req.MessageIDs))
+	for _, raw := range req.MessageIDs {
+		id, err := parseUUID(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	acknowledged, err := h.service.Acknowledge(c.Request.Context(), userID, deviceID.UUID, ids)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.AckEnvelopesResponse{Acknowledged: acknowledged}))
+}
@@ -78,6 +78,69 @@ func (h *EncryptionHandler) GetIdentityKey(c *gin.Context) {
 	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(identity))
 }
 
+func (h *EncryptionHandler) GetIdentityKeyHistory(c *gin.Context) {
+	userID, err := uuid.Parse(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid user_id", "INVALID_REQUEST"))
+		return
+	}
+	var deviceID uuid.NullUUID
+	if raw := c.Query("device_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid device_id", "INVALID_REQUEST"))
+			return
+		}
+		deviceID = uuid.NullUUID{UUID: parsed, Valid: true}
+	}
+	viewerID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	items, err := h.service.GetIdentityKeyHistory(c.Request.Context(), viewerID, userID, deviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	history := make([]httpdto.IdentityKeyHistoryDTO, 0, len(items))
+	for _, item := range items {
+		history = append(history, httpdto.FromIdentityKeyHistory(item))
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(history))
+}
+
+func (h *EncryptionHandler) GetFingerprint(c *gin.Context) {
+	remoteUserID, err := uuid.Parse(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid user_id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	material, err := h.service.GetFingerprintMaterial(c.Request.Context(), userID, remoteUserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FingerprintResponse{
+		Version: material.Version,
+		Local:   fingerprintPartyResponse(material.Local),
+		Remote:  fingerprintPartyResponse(material.Remote),
+	}))
+}
+
+func fingerprintPartyResponse(party services.FingerprintParty) httpdto.FingerprintPartyDTO {
+	keys := make([]httpdto.IdentityKeyDTO, 0, len(party.IdentityKeys))
+	for _, k := range party.IdentityKeys {
+		keys = append(keys, httpdto.FromIdentityKey(k))
+	}
+	return httpdto.FingerprintPartyDTO{UserID: party.UserID.String(), IdentityKeys: keys}
+}
+
 func (h *EncryptionHandler) UploadSignedPreKey(c *gin.Context) {
 	var req httpdto.UploadSignedPreKeyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -248,33 +311,49 @@ func (h *EncryptionHandler) UploadOneTimePreKeys(c *gin.Context) {
 	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.UploadedKeysCountResponse{Uploaded: len(req.Keys)}))
 }
 
-func (h *EncryptionHandler) ConsumeOneTimePreKey(c *gin.Context) {
-	userID, err := uuid.Parse(c.Query("user_id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid user_id", "INVALID_REQUEST"))
+func (h *EncryptionHandler) UploadOneTimePreKeyBatch(c *gin.Context) {
+	var req httpdto.UploadOneTimePreKeyBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
 		return
 	}
-	consumedBy, err := uuid.Parse(c.Query("consumed_by"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid consumed_by", "INVALID_REQUEST"))
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
 		return
 	}
-	deviceID, err := uuid.Parse(c.Query("device_id"))
-	if err != nil {
+	var deviceID uuid.UUID
+	if req.DeviceID != "" {
+		parsed, err := uuid.Parse(req.DeviceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid device_id", "INVALID_REQUEST"))
+			return
+		}
+		deviceID = parsed
+	} else if sessionDevice, ok := services.DeviceIDFromContext(c.Request.Context()); ok && sessionDevice.Valid {
+		deviceID = sessionDevice.UUID
+	} else {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid device_id", "INVALID_REQUEST"))
 		return
 	}
-	consumedDeviceID, err := uuid.Parse(c.Query("consumed_device_id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid consumed_device_id", "INVALID_REQUEST"))
-		return
+	keys := make([]services.OneTimePreKeyInput, 0, len(req.Keys))
+	for _, k := range req.Keys {
+		publicKey, err := base64.StdEncoding.DecodeString(k.PublicKey)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid public_key", "INVALID_REQUEST"))
+			return
+		}
+		keys = append(keys, services.OneTimePreKeyInput{KeyID: k.KeyID, PublicKey: publicKey})
 	}
-	item, err := h.service.ConsumeOneTimePreKey(c.Request.Context(), userID, deviceID, consumedBy, consumedDeviceID)
+	available, err := h.service.UploadOneTimePreKeyBatch(c.Request.Context(), userID, deviceID, keys)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
-	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromOneTimePreKey(item)))
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.UploadOneTimePreKeyBatchResponse{
+		Uploaded:  len(keys),
+		Available: available,
+	}))
 }
 
 func (h *EncryptionHandler) GetPreKeyCount(c *gin.Context) {
@@ -346,6 +425,64 @@ func (h *EncryptionHandler) GetKeyBundle(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(keyBundleResponse(item)))
+}
+
+func (h *EncryptionHandler) GetKeyBundles(c *gin.Context) {
+	var req httpdto.FetchKeyBundlesRequest
+	// The rate limiter may already have read the body, so bind it from the copy
+	// cached on the context.
+	if err := c.ShouldBindBodyWithJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	consumerID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	var consumerDeviceID uuid.UUID
+	if req.ConsumerDeviceID != "" {
+		parsed, err := uuid.Parse(req.ConsumerDeviceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid consumer_device_id", "INVALID_REQUEST"))
+			return
+		}
+		consumerDeviceID = parsed
+	} else if sessionDevice, ok := services.DeviceIDFromContext(c.Request.Context()); ok && sessionDevice.Valid {
+		consumerDeviceID = sessionDevice.UUID
+	} else {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid consumer_device_id", "INVALID_REQUEST"))
+		return
+	}
+	userIDs := make([]uuid.UUID, 0, len(req.UserIDs))
+	for _, raw := range req.UserIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid user_ids", "INVALID_REQUEST"))
+			return
+		}
+		userIDs = append(userIDs, id)
+	}
+	batch, err := h.service.GetKeyBundles(c.Request.Context(), userIDs, consumerID, consumerDeviceID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	resp := httpdto.KeyBundleBatchResponse{
+		Bundles:        make([]httpdto.KeyBundleDTO, 0, len(batch.Bundles)),
+		MissingUserIDs: make([]string, 0, len(batch.MissingUserIDs)),
+	}
+	for _, item := range batch.Bundles {
+		resp.Bundles = append(resp.Bundles, keyBundleResponse(item))
+	}
+	for _, id := range batch.MissingUserIDs {
+		resp.MissingUserIDs = append(resp.MissingUserIDs, id.String())
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(resp))
+}
+
+func keyBundleResponse(item services.KeyBundle) httpdto.KeyBundleDTO {
 	bundle := httpdto.KeyBundleDTO{
 		IdentityKey: httpdto.IdentityKeyDTO{
 			UserID:    item.UserID.String(),
@@ -368,7 +505,7 @@ func (h *EncryptionHandler) GetKeyBundle(c *gin.Context) {
 			PublicKey: base64.StdEncoding.EncodeToString(item.OneTimePreKey),
 		}
 	}
-	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(bundle))
+	return bundle
 }
 
 func (h *EncryptionHandler) GetUserKeyBundles(c *gin.Context) {
@@ -404,7 +541,12 @@ func (h *EncryptionHandler) DeactivateIdentityKey(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid key id", "INVALID_REQUEST"))
 		return
 	}
-	if err := h.service.DeactivateIdentityKey(c.Request.Context(), id); err != nil {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.DeactivateIdentityKey(c.Request.Context(), id, userID); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
@@ -417,7 +559,12 @@ func (h *EncryptionHandler) DeleteIdentityKey(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid key id", "INVALID_REQUEST"))
 		return
 	}
-	if err := h.service.DeleteIdentityKey(c.Request.Context(), id); err != nil {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.DeleteIdentityKey(c.Request.Context(), id, userID); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
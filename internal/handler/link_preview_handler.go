@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+
+	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LinkPreviewHandler struct {
+	service *services.LinkPreviewService
+}
+
+func NewLinkPreviewHandler(service *services.LinkPreviewService) *LinkPreviewHandler {
+	return &LinkPreviewHandler{service: service}
+}
+
+// Create fetches, or returns the cached, preview of a URL the client opted to disclose.
+func (h *LinkPreviewHandler) Create(c *gin.Context) {
+	var req httpdto.LinkPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	if _, ok := services.UserIDFromContext(c.Request.Context()); !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	preview, err := h.service.GetPreview(c.Request.Context(), req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromLinkPreview(preview)))
+}
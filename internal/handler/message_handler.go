@@ -4,7 +4,9 @@ import (
 	"encoding/base64"
 	"net/http"
 	"strconv"
+	"time"
 
+	"sentinal-chat/internal/domain/message"
 	"sentinal-chat/internal/services"
 	"sentinal-chat/internal/transport/httpdto"
 
@@ -39,48 +41,168 @@ func (h *MessageHandler) Send(c *gin.Context) {
 		return
 	}
 
-	if len(req.Ciphertexts) == 0 {
-		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("ciphertexts required", "INVALID_REQUEST"))
-		return
+	var items []services.CiphertextPayload
+	var group *services.GroupCiphertextPayload
+	if req.GroupCiphertext != nil {
+		if len(req.Ciphertexts) > 0 {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("ciphertexts and group_ciphertext are exclusive", "INVALID_REQUEST"))
+			return
+		}
+		distributionID, err := parseUUID(req.GroupCiphertext.DistributionID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid distribution_id", "INVALID_REQUEST"))
+			return
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(req.GroupCiphertext.Ciphertext)
+		if err != nil || len(ciphertext) == 0 {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("ciphertext must be base64", "INVALID_REQUEST"))
+			return
+		}
+		group = &services.GroupCiphertextPayload{
+			DistributionID: distributionID,
+			Ciphertext:     ciphertext,
+			Header:         req.GroupCiphertext.Header,
+		}
+	} else {
+		var errMsg string
+		items, errMsg = parseCiphertextInputs(req.Ciphertexts)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(errMsg, "INVALID_REQUEST"))
+			return
+		}
 	}
 
-	items := make([]services.CiphertextPayload, 0, len(req.Ciphertexts))
-	for _, payload := range req.Ciphertexts {
-		recipientDeviceID, err := parseUUID(payload.RecipientDeviceID)
+	var poll *services.PollInput
+	if req.Poll != nil {
+		poll = &services.PollInput{
+			Question:       req.Poll.Question,
+			Options:        req.Poll.Options,
+			AllowsMultiple: req.Poll.AllowsMultiple,
+		}
+		if req.Poll.ClosesAt != "" {
+			closesAt, err := time.Parse(time.RFC3339, req.Poll.ClosesAt)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("closes_at must be RFC3339", "INVALID_REQUEST"))
+				return
+			}
+			poll.ClosesAt = closesAt
+		}
+	}
+
+	mentions := make([]services.MentionInput, 0, len(req.Mentions))
+	for _, m := range req.Mentions {
+		mentionedID, err := parseUUID(m.UserID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid recipient_device_id", "INVALID_REQUEST"))
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid mention user_id", "INVALID_REQUEST"))
 			return
 		}
-		if payload.Ciphertext == "" {
-			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("ciphertext required", "INVALID_REQUEST"))
+		mentions = append(mentions, services.MentionInput{UserID: mentionedID, Offset: m.Offset, Length: m.Length})
+	}
+
+	attachments := make([]services.AttachmentInput, 0, len(req.Attachments))
+	for _, a := range req.Attachments {
+		uploadID, err := parseUUID(a.UploadID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid attachment upload_id", "INVALID_REQUEST"))
 			return
 		}
-		ciphertext, err := base64.StdEncoding.DecodeString(payload.Ciphertext)
+		attachments = append(attachments, services.AttachmentInput{
+			UploadID:          uploadID,
+			Width:             a.Width,
+			Height:            a.Height,
+			DurationSeconds:   a.DurationSeconds,
+			EncryptionKeyHash: a.EncryptionKeyHash,
+			EncryptionIV:      a.EncryptionIV,
+			ThumbnailURL:      a.ThumbnailURL,
+			ViewOnce:          a.ViewOnce,
+		})
+	}
+
+	var replyTo uuid.NullUUID
+	if req.ReplyToMessageID != "" {
+		id, err := parseUUID(req.ReplyToMessageID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("ciphertext must be base64", "INVALID_REQUEST"))
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid reply_to_message_id", "INVALID_REQUEST"))
 			return
 		}
-		items = append(items, services.CiphertextPayload{
-			RecipientDeviceID: recipientDeviceID,
-			Ciphertext:        ciphertext,
-			Header:            payload.Header,
-		})
+		replyTo = uuid.NullUUID{UUID: id, Valid: true}
 	}
 
-	result, err := h.service.SendMessage(c.Request.Context(), services.SendMessageInput{
-		ConversationID: conversationID,
-		SenderID:       userID,
-		Ciphertexts:    items,
-		MessageType:    req.MessageType,
-		ClientMsgID:    req.ClientMsgID,
-		IdempotencyKey: req.IdempotencyKey,
+	result, cmdLog, err := h.service.SendMessage(c.Request.Context(), services.SendMessageInput{
+		ConversationID:   conversationID,
+		SenderID:         userID,
+		Ciphertexts:      items,
+		GroupCiphertext:  group,
+		MessageType:      req.MessageType,
+		ClientMsgID:      req.ClientMsgID,
+		IdempotencyKey:   req.IdempotencyKey,
+		Poll:             poll,
+		Mentions:         mentions,
+		Attachments:      attachments,
+		ExpiresInSeconds: req.ExpiresInSeconds,
+		ReplyToMsgID:     replyTo,
 	})
 	if err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
 
-	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromSendMessage(result)))
+	resp := httpdto.FromSendMessage(result)
+	resp.CommandRefDTO = httpdto.FromCommandRef(cmdLog)
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(resp))
+}
+
+func (h *MessageHandler) Forward(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	var req httpdto.ForwardMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+
+	targets := make([]services.ForwardTarget, 0, len(req.Targets))
+	for _, t := range req.Targets {
+		conversationID, err := parseUUID(t.ConversationID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation_id", "INVALID_REQUEST"))
+			return
+		}
+		items, errMsg := parseCiphertextInputs(t.Ciphertexts)
+		if errMsg != "" {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(errMsg, "INVALID_REQUEST"))
+			return
+		}
+		targets = append(targets, services.ForwardTarget{
+			ConversationID: conversationID,
+			Ciphertexts:    items,
+			ClientMsgID:    t.ClientMsgID,
+			IdempotencyKey: t.IdempotencyKey,
+		})
+	}
+
+	sent, err := h.service.ForwardMessage(c.Request.Context(), services.ForwardMessageInput{
+		MessageID: messageID,
+		SenderID:  userID,
+		Targets:   targets,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	res := httpdto.ForwardMessageResponse{Messages: make([]httpdto.SendMessageResponse, len(sent))}
+	for i, m := range sent {
+		res.Messages[i] = httpdto.FromSendMessage(m)
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(res))
 }
 
 func (h *MessageHandler) List(c *gin.Context) {
@@ -129,20 +251,251 @@ func (h *MessageHandler) Delete(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
 		return
 	}
-	if err := h.service.Delete(c.Request.Context(), messageID); err != nil {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	cmdLog, err := h.service.DeleteMessage(c.Request.Context(), messageID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromCommandRef(cmdLog)))
+}
+
+func (h *MessageHandler) DeleteForMe(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.DeleteForMe(c.Request.Context(), messageID, userID); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
+}
+
+func (h *MessageHandler) Star(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	starred, err := h.service.StarMessage(c.Request.Context(), messageID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.StarMessageResponse{
+		MessageID: starred.MessageID.String(),
+		StarredAt: starred.StarredAt.Format(time.RFC3339),
+	}))
+}
+
+func (h *MessageHandler) Unstar(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.UnstarMessage(c.Request.Context(), messageID, userID); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
+}
+
+func (h *MessageHandler) Pin(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	pinned, err := h.service.PinMessage(c.Request.Context(), messageID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromPinnedMessage(pinned)))
+}
+
+func (h *MessageHandler) Unpin(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.UnpinMessage(c.Request.Context(), messageID, userID); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
 		return
 	}
 	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
 }
 
+func (h *MessageHandler) ListPinned(c *gin.Context) {
+	conversationID, err := parseUUID(c.Query("conversation_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation_id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	items, err := h.service.GetPinnedMessages(c.Request.Context(), conversationID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.ListPinnedMessagesResponse{
+		Pinned: httpdto.FromPinnedMessageSlice(items),
+	}))
+}
+
+func (h *MessageHandler) ListStarred(c *gin.Context) {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	page, err := parseInt(c.Query("page"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid page", "INVALID_REQUEST"))
+		return
+	}
+	limit, err := parseInt(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid limit", "INVALID_REQUEST"))
+		return
+	}
+	items, total, err := h.service.GetUserStarredMessages(c.Request.Context(), userID, page, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	resp := httpdto.StarredMessagesResponse{
+		Messages: make([]httpdto.StarredMessageDTO, len(items)),
+		Total:    total,
+	}
+	for i, item := range items {
+		resp.Messages[i] = httpdto.FromStarredMessage(item)
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(resp))
+}
+
+func (h *MessageHandler) ListMentions(c *gin.Context) {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	page, err := parseInt(c.Query("page"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid page", "INVALID_REQUEST"))
+		return
+	}
+	limit, err := parseInt(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid limit", "INVALID_REQUEST"))
+		return
+	}
+	unreadOnly := c.Query("unread_only") == "true"
+	items, total, err := h.service.GetUserMentions(c.Request.Context(), userID, unreadOnly, page, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	resp := httpdto.MentionsResponse{
+		Mentions: make([]httpdto.MentionDTO, len(items)),
+		Total:    total,
+	}
+	for i, item := range items {
+		resp.Mentions[i] = httpdto.FromMention(item)
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(resp))
+}
+
 func (h *MessageHandler) Update(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
 	var req httpdto.UpdateMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
 		return
 	}
-	c.JSON(http.StatusNotImplemented, httpdto.NewErrorResponse("message updates not supported for e2e", "NOT_SUPPORTED"))
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	items, errMsg := parseCiphertextInputs(req.Ciphertexts)
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(errMsg, "INVALID_REQUEST"))
+		return
+	}
+	msg, cmdLog, err := h.service.EditMessage(c.Request.Context(), services.EditMessageInput{
+		MessageID:   messageID,
+		EditorID:    userID,
+		Ciphertexts: items,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.EditMessageResponse{
+		MessageDTO:    httpdto.FromMessage(msg),
+		CommandRefDTO: httpdto.FromCommandRef(cmdLog),
+	}))
+}
+
+func (h *MessageHandler) ListVersions(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	versions, err := h.service.GetMessageVersions(c.Request.Context(), messageID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromMessageVersions(messageID, versions)))
 }
 
 func (h *MessageHandler) HardDelete(c *gin.Context) {
@@ -194,6 +547,83 @@ func (h *MessageHandler) MarkDelivered(c *gin.Context) {
 	c.JSON(http.StatusOK, httpdto.NewSuccessResponse[any](nil))
 }
 
+func (h *MessageHandler) AddReaction(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	var req httpdto.ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.AddReaction(c.Request.Context(), &message.MessageReaction{
+		MessageID:    messageID,
+		UserID:       userID,
+		ReactionCode: req.ReactionCode,
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	h.respondReactions(c, messageID, userID)
+}
+
+func (h *MessageHandler) RemoveReaction(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	reactionCode := c.Query("reaction_code")
+	if reactionCode == "" {
+		var req httpdto.ReactionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+			return
+		}
+		reactionCode = req.ReactionCode
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	if err := h.service.RemoveReaction(c.Request.Context(), messageID, userID, reactionCode); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	h.respondReactions(c, messageID, userID)
+}
+
+func (h *MessageHandler) ListReactions(c *gin.Context) {
+	messageID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	h.respondReactions(c, messageID, userID)
+}
+
+func (h *MessageHandler) respondReactions(c *gin.Context, messageID, userID uuid.UUID) {
+	summary, err := h.service.GetReactionSummary(c.Request.Context(), messageID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromReactionSummary(messageID, summary)))
+}
+
 func parseUUID(value string) (uuid.UUID, error) {
 	return uuid.Parse(value)
 }
@@ -219,3 +649,31 @@ func parseInt64(value string) (int64, error) {
 	}
 	return parsed, nil
 }
+
+// parseCiphertextInputs decodes per-device ciphertexts from a request body. It
+// returns a client-facing message when the input is invalid.
+func parseCiphertextInputs(inputs []httpdto.MessageCiphertextInput) ([]services.CiphertextPayload, string) {
+	if len(inputs) == 0 {
+		return nil, "ciphertexts required"
+	}
+	items := make([]services.CiphertextPayload, 0, len(inputs))
+	for _, payload := range inputs {
+		recipientDeviceID, err := parseUUID(payload.RecipientDeviceID)
+		if err != nil {
+			return nil, "invalid recipient_device_id"
+		}
+		if payload.Ciphertext == "" {
+			return nil, "ciphertext required"
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(payload.Ciphertext)
+		if err != nil {
+			return nil, "ciphertext must be base64"
+		}
+		items = append(items, services.CiphertextPayload{
+			RecipientDeviceID: recipientDeviceID,
+			Ciphertext:        ciphertext,
+			Header:            payload.Header,
+		})
+	}
+	return items, ""
+}
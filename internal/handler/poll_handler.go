@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+
+	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PollHandler struct {
+	service *services.MessageService
+}
+
+func NewPollHandler(service *services.MessageService) *PollHandler {
+	return &PollHandler{service: service}
+}
+
+func (h *PollHandler) GetByID(c *gin.Context) {
+	pollID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid poll id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	details, err := h.service.GetPoll(c.Request.Context(), pollID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromPollDetails(details)))
+}
+
+func (h *PollHandler) Vote(c *gin.Context) {
+	pollID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid poll id", "INVALID_REQUEST"))
+		return
+	}
+	var req httpdto.VotePollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	optionIDs := make([]uuid.UUID, 0, len(req.OptionIDs))
+	for _, raw := range req.OptionIDs {
+		optionID, err := parseUUID(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid option_id", "INVALID_REQUEST"))
+			return
+		}
+		optionIDs = append(optionIDs, optionID)
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	details, err := h.service.VotePoll(c.Request.Context(), pollID, userID, optionIDs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromPollDetails(details)))
+}
+
+func (h *PollHandler) Retract(c *gin.Context) {
+	pollID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid poll id", "INVALID_REQUEST"))
+		return
+	}
+	var optionID uuid.NullUUID
+	if raw := c.Query("option_id"); raw != "" {
+		parsed, err := parseUUID(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid option_id", "INVALID_REQUEST"))
+			return
+		}
+		optionID = uuid.NullUUID{UUID: parsed, Valid: true}
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	details, err := h.service.RetractPollVote(c.Request.Context(), pollID, userID, optionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromPollDetails(details)))
+}
+
+func (h *PollHandler) Close(c *gin.Context) {
+	pollID, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid poll id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	details, err := h.service.ClosePoll(c.Request.Context(), pollID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromPollDetails(details)))
+}
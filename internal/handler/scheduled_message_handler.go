@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"net/http"
+
+	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduledMessageHandler struct {
+	service *services.ScheduledMessageService
+}
+
+func NewScheduledMessageHandler(service *services.ScheduledMessageService) *ScheduledMessageHandler {
+	return &ScheduledMessageHandler{service: service}
+}
+
+func (h *ScheduledMessageHandler) Create(c *gin.Context) {
+	var req httpdto.ScheduleMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	conversationID, err := parseUUID(req.ConversationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation_id", "INVALID_REQUEST"))
+		return
+	}
+	items, errMsg := parseCiphertextInputs(req.Ciphertexts)
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(errMsg, "INVALID_REQUEST"))
+		return
+	}
+	scheduled, err := h.service.Schedule(c.Request.Context(), services.ScheduleMessageInput{
+		Message: services.SendMessageInput{
+			ConversationID: conversationID,
+			SenderID:       userID,
+			Ciphertexts:    items,
+			MessageType:    req.MessageType,
+			ClientMsgID:    req.ClientMsgID,
+		},
+		ScheduledFor: req.ScheduledFor,
+		Timezone:     req.Timezone,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusCreated, httpdto.NewSuccessResponse(httpdto.FromScheduledMessage(scheduled)))
+}
+
+func (h *ScheduledMessageHandler) List(c *gin.Context) {
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	page, err := parseInt(c.Query("page"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid page", "INVALID_REQUEST"))
+		return
+	}
+	limit, err := parseInt(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid limit", "INVALID_REQUEST"))
+		return
+	}
+	items, total, err := h.service.List(c.Request.Context(), userID, c.Query("status"), page, limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	resp := httpdto.ScheduledMessageListResponse{
+		ScheduledMessages: make([]httpdto.ScheduledMessageDTO, len(items)),
+		Total:             total,
+	}
+	for i, m := range items {
+		resp.ScheduledMessages[i] = httpdto.FromScheduledMessage(m)
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(resp))
+}
+
+func (h *ScheduledMessageHandler) GetByID(c *gin.Context) {
+	id, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid scheduled message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	scheduled, err := h.service.GetByID(c.Request.Context(), id, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromScheduledMessage(scheduled)))
+}
+
+func (h *ScheduledMessageHandler) Cancel(c *gin.Context) {
+	id, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid scheduled message id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	scheduled, err := h.service.Cancel(c.Request.Context(), id, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromScheduledMessage(scheduled)))
+}
+
+func (h *ScheduledMessageHandler) Reschedule(c *gin.Context) {
+	id, err := parseUUID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid scheduled message id", "INVALID_REQUEST"))
+		return
+	}
+	var req httpdto.RescheduleMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	scheduled, err := h.service.Reschedule(c.Request.Context(), id, userID, req.ScheduledFor, req.Timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(httpdto.FromScheduledMessage(scheduled)))
+}
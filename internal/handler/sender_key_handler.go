@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type SenderKeyHandler struct {
+	service *services.SenderKeyService
+}
+
+func NewSenderKeyHandler(service *services.SenderKeyService) *SenderKeyHandler {
+	return &SenderKeyHandler{service: service}
+}
+
+func (h *SenderKeyHandler) Get(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	state, err := h.service.GetState(c.Request.Context(), conversationID, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(senderKeyStateResponse(state)))
+}
+
+func (h *SenderKeyHandler) Distribute(c *gin.Context) {
+	conversationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+	var req httpdto.DistributeSenderKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	distributionID, err := parseUUID(req.DistributionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid distribution_id", "INVALID_REQUEST"))
+		return
+	}
+	distributions := make([]services.SenderKeyDistributionInput, 0, len(req.Distributions))
+	for _, d := range req.Distributions {
+		recipientDeviceID, err := parseUUID(d.RecipientDeviceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid recipient_device_id", "INVALID_REQUEST"))
+			return
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(d.Ciphertext)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("ciphertext must be base64", "INVALID_REQUEST"))
+			return
+		}
+		distributions = append(distributions, services.SenderKeyDistributionInput{
+			RecipientDeviceID: recipientDeviceID,
+			Ciphertext:        ciphertext,
+			Header:            d.Header,
+		})
+	}
+
+	state, err := h.service.Distribute(c.Request.Context(), services.DistributeSenderKeyInput{
+		ConversationID: conversationID,
+		SenderID:       userID,
+		DistributionID: distributionID,
+		Distributions:  distributions,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(senderKeyStateResponse(state)))
+}
+
+func senderKeyStateResponse(state services.SenderKeyState) httpdto.SenderKeyStateResponse {
+	resp := httpdto.SenderKeyStateResponse{
+		Epoch:            state.Epoch,
+		MissingDeviceIDs: make([]string, 0, len(state.MissingDeviceIDs)),
+	}
+	if state.SenderKey != nil {
+		key := httpdto.FromSenderKey(*state.SenderKey)
+		resp.SenderKey = &key
+	}
+	for _, id := range state.MissingDeviceIDs {
+		resp.MissingDeviceIDs = append(resp.MissingDeviceIDs, id.String())
+	}
+	for _, d := range state.Distributions {
+		resp.Distributions = append(resp.Distributions, httpdto.FromSenderKeyDistribution(d))
+	}
+	return resp
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type SyncHandler struct {
+	service *services.SyncService
+}
+
+func NewSyncHandler(service *services.SyncService) *SyncHandler {
+	return &SyncHandler{service: service}
+}
+
+func (h *SyncHandler) Sync(c *gin.Context) {
+	var req httpdto.SyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid request", "INVALID_REQUEST"))
+		return
+	}
+	userID, ok := services.UserIDFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, httpdto.NewErrorResponse("unauthorized", "UNAUTHORIZED"))
+		return
+	}
+
+	sequences := make(map[uuid.UUID]int64, len(req.Conversations))
+	for rawID, seq := range req.Conversations {
+		id, err := parseUUID(rawID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid conversation id", "INVALID_REQUEST"))
+			return
+		}
+		sequences[id] = seq
+	}
+	var since time.Time
+	if req.Since != "" {
+		t, err := time.Parse(time.RFC3339, req.Since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse("invalid since", "INVALID_REQUEST"))
+			return
+		}
+		since = t
+	}
+
+	result, err := h.service.Sync(c.Request.Context(), services.SyncInput{
+		UserID:    userID,
+		Sequences: sequences,
+		Since:     since,
+		Token:     req.SyncToken,
+		Limit:     req.Limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, httpdto.NewErrorResponse(err.Error(), "REQUEST_FAILED"))
+		return
+	}
+
+	resp := httpdto.SyncResponse{
+		Messages:      make([]httpdto.MessageDTO, 0, len(result.Messages)),
+		Edits:         make([]httpdto.MessageDTO, 0, len(result.Edits)),
+		Changes:       make([]httpdto.SyncChangeDTO, 0, len(result.Changes)),
+		Conversations: make(map[string]int64, len(result.Sequences)),
+		SyncToken:     result.Token,
+		HasMore:       result.HasMore,
+	}
+	for _, m := range result.Messages {
+		resp.Messages = append(resp.Messages, httpdto.FromMessage(m))
+	}
+	for _, m := range result.Edits {
+		resp.Edits = append(resp.Edits, httpdto.FromMessage(m))
+	}
+	for _, change := range result.Changes {
+		resp.Changes = append(resp.Changes, httpdto.FromSyncChange(change))
+	}
+	for id, seq := range result.Sequences {
+		resp.Conversations[id.String()] = seq
+	}
+	c.JSON(http.StatusOK, httpdto.NewSuccessResponse(resp))
+}
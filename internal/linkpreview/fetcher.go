@@ -0,0 +1,243 @@
+// Package linkpreview fetches OpenGraph and Twitter card metadata for URLs a
+// client chooses to disclose. Every connection is checked against the resolved
+// IP address, so a hostname cannot be used to reach internal services, and each
+// fetch is bounded in time, size and redirects.
+package linkpreview
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultTimeout      = 5 * time.Second
+	DefaultMaxBodyBytes = 512 << 10
+	DefaultMaxRedirects = 3
+	DefaultUserAgent    = "SentinalChat-LinkPreview/1.0"
+)
+
+var (
+	ErrInvalidURL       = errors.New("url must be an absolute http or https URL")
+	ErrBlockedAddress   = errors.New("url resolves to a blocked address")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrUnexpectedStatus = errors.New("url returned a non-success status")
+	ErrNotHTML          = errors.New("url did not return an HTML page")
+)
+
+// Options bounds a fetch. Zero values use the package defaults.
+type Options struct {
+	// Timeout covers the whole fetch, including redirects and reading the body.
+	Timeout time.Duration
+	// MaxBodyBytes caps how much of the page is read; metadata past it is ignored.
+	MaxBodyBytes int64
+	// MaxRedirects is the number of redirects followed. Negative disables redirects.
+	MaxRedirects int
+	UserAgent    string
+	// AllowIP reports whether the fetcher may connect to ip. It defaults to
+	// IsPublicIP; tests against a local server can allow loopback here.
+	AllowIP func(ip net.IP) bool
+}
+
+// Preview is the metadata extracted from a page.
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+// Fetcher downloads pages and extracts preview metadata from them.
+type Fetcher struct {
+	client       *http.Client
+	maxBodyBytes int64
+	userAgent    string
+}
+
+// NewFetcher creates a fetcher whose connections only reach addresses accepted
+// by opts.AllowIP. Proxies from the environment are ignored, since a proxy
+// would hide the address actually being contacted.
+func NewFetcher(opts Options) *Fetcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = DefaultMaxRedirects
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent
+	}
+	allowIP := opts.AllowIP
+	if allowIP == nil {
+		allowIP = IsPublicIP
+	}
+
+	dialer := &net.Dialer{
+		Timeout: opts.Timeout,
+		// Control runs after DNS resolution with the address about to be
+		// dialed, so rebinding a hostname between checks does not help.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return ErrBlockedAddress
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !allowIP(ip) {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	maxRedirects := opts.MaxRedirects
+	client := &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return ErrTooManyRedirects
+			}
+			if _, err := NormalizeURL(req.URL.String()); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+
+	return &Fetcher{
+		client:       client,
+		maxBodyBytes: opts.MaxBodyBytes,
+		userAgent:    opts.UserAgent,
+	}
+}
+
+// Fetch downloads rawURL and returns its preview metadata. Only HTML responses
+// with a 2xx status are accepted.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	normalized, err := NormalizeURL(rawURL)
+	if err != nil {
+		return Preview{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, normalized, nil)
+	if err != nil {
+		return Preview{}, ErrInvalidURL
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		for _, known := range []error{ErrBlockedAddress, ErrTooManyRedirects, ErrInvalidURL} {
+			if errors.Is(err, known) {
+				return Preview{}, known
+			}
+		}
+		return Preview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Preview{}, ErrUnexpectedStatus
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return Preview{}, ErrNotHTML
+	}
+
+	preview := parseMetadata(io.LimitReader(resp.Body, f.maxBodyBytes), resp.Request.URL)
+	preview.URL = normalized
+	return preview, nil
+}
+
+// NormalizeURL validates rawURL as an absolute http(s) URL without credentials
+// and returns it with a lower-case scheme and host and no fragment, so the same
+// page always maps to the same cache key.
+func NormalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", ErrInvalidURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", ErrInvalidURL
+	}
+	if u.User != nil || u.Hostname() == "" {
+		return "", ErrInvalidURL
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+// HashURL returns the cache key of a normalized URL.
+func HashURL(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// blockedNetworks are special-purpose ranges not covered by the net.IP
+// predicates used in IsPublicIP.
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+	"2001:db8::/32",
+)
+
+// IsPublicIP reports whether ip is a globally routable unicast address, i.e.
+// not loopback, private, link-local, multicast, unspecified or reserved.
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
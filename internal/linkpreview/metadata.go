@@ -0,0 +1,131 @@
+package linkpreview
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxSiteNameLength    = 100
+	maxImageURLLength    = 2048
+)
+
+// parseMetadata reads the document head and picks OpenGraph values first, then
+// Twitter card values, then the plain <title> and description meta tag. It
+// stops at <body>, since preview metadata lives in the head.
+func parseMetadata(r io.Reader, base *url.URL) Preview {
+	meta := map[string]string{}
+	var title string
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Body:
+				break loop
+			case atom.Title:
+				inTitle = title == ""
+			case atom.Meta:
+				if !hasAttr {
+					continue
+				}
+				var key, content string
+				for {
+					k, v, more := z.TagAttr()
+					switch string(k) {
+					case "property", "name":
+						if key == "" {
+							key = strings.ToLower(strings.TrimSpace(string(v)))
+						}
+					case "content":
+						content = string(v)
+					}
+					if !more {
+						break
+					}
+				}
+				if key != "" && content != "" {
+					if _, seen := meta[key]; !seen {
+						meta[key] = content
+					}
+				}
+			}
+		case html.TextToken:
+			if inTitle {
+				title += string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				break loop
+			}
+		}
+	}
+
+	preview := Preview{
+		Title:       clean(firstOf(meta["og:title"], meta["twitter:title"], title), maxTitleLength),
+		Description: clean(firstOf(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescriptionLength),
+		SiteName:    clean(meta["og:site_name"], maxSiteNameLength),
+	}
+	image := firstOf(meta["og:image:secure_url"], meta["og:image"], meta["twitter:image"], meta["twitter:image:src"])
+	preview.ImageURL = resolveImageURL(strings.TrimSpace(image), base)
+	return preview
+}
+
+// resolveImageURL makes a relative image reference absolute and drops anything
+// that is not an http(s) URL, such as data: or javascript: references.
+func resolveImageURL(ref string, base *url.URL) string {
+	if ref == "" || len(ref) > maxImageURLLength {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	normalized, err := NormalizeURL(u.String())
+	if err != nil {
+		return ""
+	}
+	return normalized
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace and truncates to max runes.
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max])
+}
@@ -101,6 +101,78 @@ func CallRateLimitMiddleware(limiter *redis.RateLimiter) gin.HandlerFunc {
 	}
 }
 
+// KeyBundleRateLimitMiddleware creates a middleware for key bundle rate limiting
+// Should be applied to key bundle endpoints after auth middleware. A batch
+// fetch is charged for every user it names.
+func KeyBundleRateLimitMiddleware(limiter *redis.RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := services.UserIDFromContext(c.Request.Context())
+		if !ok {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.AllowKeyBundleFetch(c.Request.Context(), userID.String(), keyBundleTargets(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, httpdto.NewErrorResponse("rate limit error", "INTERNAL_ERROR"))
+			c.Abort()
+			return
+		}
+
+		setRateLimitHeaders(c, result)
+
+		if !result.Allowed {
+			c.JSON(http.StatusTooManyRequests, httpdto.NewErrorResponse("key bundle rate limit exceeded", "RATE_LIMITED"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// LinkPreviewRateLimitMiddleware creates a middleware for link preview rate limiting
+// Should be applied to the link preview endpoint after auth middleware
+func LinkPreviewRateLimitMiddleware(limiter *redis.RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := services.UserIDFromContext(c.Request.Context())
+		if !ok {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.AllowLinkPreview(c.Request.Context(), userID.String())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, httpdto.NewErrorResponse("rate limit error", "INTERNAL_ERROR"))
+			c.Abort()
+			return
+		}
+
+		setRateLimitHeaders(c, result)
+
+		if !result.Allowed {
+			c.JSON(http.StatusTooManyRequests, httpdto.NewErrorResponse("link preview rate limit exceeded", "RATE_LIMITED"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// keyBundleTargets returns how many users a key bundle request names. The
+// batch body is cached on the context so the handler can bind it again.
+func keyBundleTargets(c *gin.Context) int {
+	if c.Request.Method != http.MethodPost {
+		return 1
+	}
+	var req httpdto.FetchKeyBundlesRequest
+	if err := c.ShouldBindBodyWithJSON(&req); err != nil || len(req.UserIDs) == 0 {
+		return 1
+	}
+	return len(req.UserIDs)
+}
+
 // setRateLimitHeaders sets standard rate limit response headers
 func setRateLimitHeaders(c *gin.Context, result *redis.RateLimitResult) {
 	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
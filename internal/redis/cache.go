@@ -2,8 +2,10 @@ package redis
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"sentinal-chat/internal/domain/conversation"
@@ -18,6 +20,10 @@ import (
 // - user:{user_id} - 5m TTL, profile cache
 // - conversation:{conv_id} - 5m TTL, metadata cache
 // - conversation:{conv_id}:participants - 5m TTL, participants cache
+// - user_sessions:{user_id} - index of cached session IDs per user
+// - session_version:{session_id}, user_sessions_version:{user_id} - bumped on
+//   invalidation so a concurrent read-through does not cache a revoked session
+// - link_preview_failure:{url_hash} - failed link preview fetch, caller-set TTL
 
 // CacheConfig contains configuration for caching
 type CacheConfig struct {
@@ -37,8 +43,34 @@ func DefaultCacheConfig() CacheConfig {
 
 // CacheStore handles caching in Redis
 type CacheStore struct {
-	client *goredis.Client
-	config CacheConfig
+	client       *goredis.Client
+	config       CacheConfig
+	sessions     cacheCounter
+	users        cacheCounter
+	participants cacheCounter
+}
+
+// cacheCounter counts lookups served from cache and those that fell through
+// to the database. Counts are per process.
+type cacheCounter struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (c *cacheCounter) record(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+func (c *cacheCounter) stats() CacheHitStats {
+	stats := CacheHitStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
 }
 
 // NewCacheStore creates a new cache store
@@ -65,31 +97,80 @@ func (c *CacheStore) GetSession(ctx context.Context, sessionID uuid.UUID) (*Sess
 	key := fmt.Sprintf("session:%s", sessionID.String())
 	data, err := c.client.Get(ctx, key).Result()
 	if err == goredis.Nil {
+		c.sessions.record(false)
 		return nil, nil // Cache miss
 	}
 	if err != nil {
+		c.sessions.record(false)
 		return nil, err
 	}
 
 	var session SessionCache
 	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		c.sessions.record(false)
 		return nil, err
 	}
+	c.sessions.record(true)
 	return &session, nil
 }
 
-// SetSession stores a session in cache
-func (c *CacheStore) SetSession(ctx context.Context, session *SessionCache) error {
-	key := fmt.Sprintf("session:%s", session.SessionID.String())
+// SessionReadToken returns the current invalidation versions of a session and
+// of its user's sessions. Take it before reading the session from the
+// database and pass it to SetSession, so a revocation that lands in between
+// keeps the stale session out of the cache.
+func (c *CacheStore) SessionReadToken(ctx context.Context, sessionID, userID uuid.UUID) (string, error) {
+	versions, err := c.client.MGet(ctx, sessionVersionKey(sessionID), userSessionsVersionKey(userID)).Result()
+	if err != nil {
+		return "", err
+	}
+	return sessionToken(versions[0], versions[1]), nil
+}
+
+func sessionToken(sessionVersion, userVersion interface{}) string {
+	token := ""
+	for _, v := range []interface{}{sessionVersion, userVersion} {
+		s, _ := v.(string)
+		token += s + ":"
+	}
+	return token
+}
+
+// setSessionScript stores a session and indexes it under its user, unless the
+// session or the user's sessions were invalidated since the read token was
+// taken.
+var setSessionScript = goredis.NewScript(`
+local sv = redis.call('GET', KEYS[3]) or ''
+local uv = redis.call('GET', KEYS[4]) or ''
+if sv .. ':' .. uv .. ':' ~= ARGV[4] then
+    return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+redis.call('SADD', KEYS[2], ARGV[3])
+redis.call('EXPIRE', KEYS[2], ARGV[2])
+return 1
+`)
+
+// SetSession stores a session in cache. token comes from SessionReadToken.
+func (c *CacheStore) SetSession(ctx context.Context, session *SessionCache, token string) error {
 	data, err := json.Marshal(session)
 	if err != nil {
 		return err
 	}
-	return c.client.Set(ctx, key, data, c.config.SessionTTL).Err()
+
+	// Index the session under its user so all of them can be invalidated at once
+	return setSessionScript.Run(ctx, c.client,
+		[]string{
+			fmt.Sprintf("session:%s", session.SessionID.String()),
+			userSessionsKey(session.UserID),
+			sessionVersionKey(session.SessionID),
+			userSessionsVersionKey(session.UserID),
+		},
+		data, int64(c.config.SessionTTL/time.Second), session.SessionID.String(), token,
+	).Err()
 }
 
 // SetSessionFromEntity stores a session from the domain entity
-func (c *CacheStore) SetSessionFromEntity(ctx context.Context, session *user.UserSession) error {
+func (c *CacheStore) SetSessionFromEntity(ctx context.Context, session *user.UserSession, token string) error {
 	deviceID := ""
 	if session.DeviceID != nil {
 		deviceID = session.DeviceID.String()
@@ -101,7 +182,7 @@ func (c *CacheStore) SetSessionFromEntity(ctx context.Context, session *user.Use
 		ExpiresAt:  session.ExpiresAt,
 		LastActive: time.Now(),
 	}
-	return c.SetSession(ctx, cached)
+	return c.SetSession(ctx, cached, token)
 }
 
 // RefreshSession extends the session TTL (call on activity)
@@ -110,41 +191,51 @@ func (c *CacheStore) RefreshSession(ctx context.Context, sessionID uuid.UUID) er
 	return c.client.Expire(ctx, key, c.config.SessionTTL).Err()
 }
 
-// InvalidateSession removes a session from cache
+// InvalidateSession removes a session from cache and bumps its version, so a
+// read that started before the revocation cannot cache it again
 func (c *CacheStore) InvalidateSession(ctx context.Context, sessionID uuid.UUID) error {
 	key := fmt.Sprintf("session:%s", sessionID.String())
-	return c.client.Del(ctx, key).Err()
+	pipe := c.client.TxPipeline()
+	pipe.Incr(ctx, sessionVersionKey(sessionID))
+	pipe.Expire(ctx, sessionVersionKey(sessionID), c.config.SessionTTL)
+	pipe.Del(ctx, key)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-// InvalidateUserSessions removes all sessions for a user from cache
-// Note: This requires scanning, so use sparingly
+// InvalidateUserSessions removes all cached sessions of a user and bumps the
+// user's session version
 func (c *CacheStore) InvalidateUserSessions(ctx context.Context, userID uuid.UUID) error {
-	// This is an expensive operation; in production, consider maintaining a set of session IDs per user
-	pattern := "session:*"
-	iter := c.client.Scan(ctx, 0, pattern, 100).Iterator()
-
-	var keysToDelete []string
-	for iter.Next(ctx) {
-		key := iter.Val()
-		data, err := c.client.Get(ctx, key).Result()
-		if err != nil {
-			continue
-		}
-
-		var session SessionCache
-		if err := json.Unmarshal([]byte(data), &session); err != nil {
-			continue
-		}
-
-		if session.UserID == userID {
-			keysToDelete = append(keysToDelete, key)
-		}
+	indexKey := userSessionsKey(userID)
+	if err := c.client.Incr(ctx, userSessionsVersionKey(userID)).Err(); err != nil {
+		return err
+	}
+	if err := c.client.Expire(ctx, userSessionsVersionKey(userID), c.config.SessionTTL).Err(); err != nil {
+		return err
+	}
+	sessionIDs, err := c.client.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return err
 	}
 
-	if len(keysToDelete) > 0 {
-		return c.client.Del(ctx, keysToDelete...).Err()
+	keys := make([]string, 0, len(sessionIDs)+1)
+	for _, id := range sessionIDs {
+		keys = append(keys, fmt.Sprintf("session:%s", id))
 	}
-	return nil
+	keys = append(keys, indexKey)
+	return c.client.Del(ctx, keys...).Err()
+}
+
+func sessionVersionKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf("session_version:%s", sessionID.String())
+}
+
+func userSessionsVersionKey(userID uuid.UUID) string {
+	return fmt.Sprintf("user_sessions_version:%s", userID.String())
+}
+
+func userSessionsKey(userID uuid.UUID) string {
+	return fmt.Sprintf("user_sessions:%s", userID.String())
 }
 
 // --- User Cache ---
@@ -153,11 +244,39 @@ func (c *CacheStore) InvalidateUserSessions(ctx context.Context, userID uuid.UUI
 type UserCache struct {
 	ID          uuid.UUID `json:"id"`
 	Username    string    `json:"username,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	PhoneNumber string    `json:"phone_number,omitempty"`
 	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio,omitempty"`
 	AvatarURL   string    `json:"avatar_url,omitempty"`
 	IsOnline    bool      `json:"is_online"`
 	LastSeenAt  time.Time `json:"last_seen_at,omitempty"`
 	Role        string    `json:"role"`
+	IsActive    bool      `json:"is_active"`
+	IsVerified  bool      `json:"is_verified"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ToEntity converts the cached profile back to a domain user. The password
+// hash is never cached, so the result must not be used for authentication.
+func (u *UserCache) ToEntity() user.User {
+	return user.User{
+		ID:          u.ID,
+		Username:    sql.NullString{String: u.Username, Valid: u.Username != ""},
+		Email:       sql.NullString{String: u.Email, Valid: u.Email != ""},
+		PhoneNumber: sql.NullString{String: u.PhoneNumber, Valid: u.PhoneNumber != ""},
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarURL:   u.AvatarURL,
+		IsOnline:    u.IsOnline,
+		LastSeenAt:  sql.NullTime{Time: u.LastSeenAt, Valid: !u.LastSeenAt.IsZero()},
+		Role:        u.Role,
+		IsActive:    u.IsActive,
+		IsVerified:  u.IsVerified,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+	}
 }
 
 // GetUser retrieves a user from cache
@@ -165,16 +284,20 @@ func (c *CacheStore) GetUser(ctx context.Context, userID uuid.UUID) (*UserCache,
 	key := fmt.Sprintf("user:%s", userID.String())
 	data, err := c.client.Get(ctx, key).Result()
 	if err == goredis.Nil {
+		c.users.record(false)
 		return nil, nil // Cache miss
 	}
 	if err != nil {
+		c.users.record(false)
 		return nil, err
 	}
 
 	var u UserCache
 	if err := json.Unmarshal([]byte(data), &u); err != nil {
+		c.users.record(false)
 		return nil, err
 	}
+	c.users.record(true)
 	return &u, nil
 }
 
@@ -190,22 +313,25 @@ func (c *CacheStore) SetUser(ctx context.Context, u *UserCache) error {
 
 // SetUserFromEntity stores a user from the domain entity
 func (c *CacheStore) SetUserFromEntity(ctx context.Context, u *user.User) error {
-	username := ""
-	if u.Username.Valid {
-		username = u.Username.String
-	}
 	var lastSeen time.Time
 	if u.LastSeenAt.Valid {
 		lastSeen = u.LastSeenAt.Time
 	}
 	cached := &UserCache{
 		ID:          u.ID,
-		Username:    username,
+		Username:    u.Username.String,
+		Email:       u.Email.String,
+		PhoneNumber: u.PhoneNumber.String,
 		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
 		AvatarURL:   u.AvatarURL,
 		IsOnline:    u.IsOnline,
 		LastSeenAt:  lastSeen,
 		Role:        u.Role,
+		IsActive:    u.IsActive,
+		IsVerified:  u.IsVerified,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
 	}
 	return c.SetUser(ctx, cached)
 }
@@ -347,22 +473,29 @@ func (c *CacheStore) GetConversationParticipants(ctx context.Context, conversati
 	key := fmt.Sprintf("conversation:%s:participants", conversationID.String())
 	data, err := c.client.Get(ctx, key).Result()
 	if err == goredis.Nil {
+		c.participants.record(false)
 		return nil, nil // Cache miss
 	}
 	if err != nil {
+		c.participants.record(false)
 		return nil, err
 	}
 
-	var participants []uuid.UUID
+	participants := []uuid.UUID{}
 	if err := json.Unmarshal([]byte(data), &participants); err != nil {
+		c.participants.record(false)
 		return nil, err
 	}
+	c.participants.record(true)
 	return participants, nil
 }
 
 // SetConversationParticipants stores participant IDs in cache
 func (c *CacheStore) SetConversationParticipants(ctx context.Context, conversationID uuid.UUID, participantIDs []uuid.UUID) error {
 	key := fmt.Sprintf("conversation:%s:participants", conversationID.String())
+	if participantIDs == nil {
+		participantIDs = []uuid.UUID{}
+	}
 	data, err := json.Marshal(participantIDs)
 	if err != nil {
 		return err
@@ -376,6 +509,28 @@ func (c *CacheStore) InvalidateConversationParticipants(ctx context.Context, con
 	return c.client.Del(ctx, key).Err()
 }
 
+// --- Link Preview Failure Cache ---
+
+// GetLinkPreviewFailure returns the reason a recent fetch of the URL failed,
+// or "" when there is none
+func (c *CacheStore) GetLinkPreviewFailure(ctx context.Context, urlHash string) (string, error) {
+	reason, err := c.client.Get(ctx, linkPreviewFailureKey(urlHash)).Result()
+	if err == goredis.Nil {
+		return "", nil
+	}
+	return reason, err
+}
+
+// SetLinkPreviewFailure remembers that fetching the URL failed, so it is not
+// fetched again for ttl
+func (c *CacheStore) SetLinkPreviewFailure(ctx context.Context, urlHash, reason string, ttl time.Duration) error {
+	return c.client.Set(ctx, linkPreviewFailureKey(urlHash), reason, ttl).Err()
+}
+
+func linkPreviewFailureKey(urlHash string) string {
+	return fmt.Sprintf("link_preview_failure:%s", urlHash)
+}
+
 // --- Utility Methods ---
 
 // Ping checks if Redis is available
@@ -388,15 +543,29 @@ func (c *CacheStore) FlushAll(ctx context.Context) error {
 	return c.client.FlushAll(ctx).Err()
 }
 
+// CacheHitStats counts read-through lookups for one kind of cached data
+type CacheHitStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
 // GetStats returns cache statistics
 type CacheStats struct {
-	SessionCount      int64 `json:"session_count"`
-	UserCount         int64 `json:"user_count"`
-	ConversationCount int64 `json:"conversation_count"`
+	SessionCount      int64         `json:"session_count"`
+	UserCount         int64         `json:"user_count"`
+	ConversationCount int64         `json:"conversation_count"`
+	Sessions          CacheHitStats `json:"sessions"`
+	Users             CacheHitStats `json:"users"`
+	Participants      CacheHitStats `json:"participants"`
 }
 
 func (c *CacheStore) GetStats(ctx context.Context) (*CacheStats, error) {
-	stats := &CacheStats{}
+	stats := &CacheStats{
+		Sessions:     c.sessions.stats(),
+		Users:        c.users.stats(),
+		Participants: c.participants.stats(),
+	}
 
 	// Count sessions
 	sessionIter := c.client.Scan(ctx, 0, "session:*", 0).Iterator()
@@ -29,11 +29,15 @@ type PresenceStore struct {
 
 // Redis key prefixes for presence
 const (
-	presenceKeyPrefix    = "presence:"           // Hash storing user presence data
-	presenceOnlineSet    = "presence:online"     // Set of online user IDs
-	presenceHeartbeatKey = "presence:heartbeat:" // Sorted set for heartbeat timestamps
+	presenceKeyPrefix      = "presence:"             // Hash storing user presence data
+	presenceOnlineSet      = "presence:online"       // Set of online user IDs
+	presenceHeartbeatKey   = "presence:heartbeat:"   // Sorted set for heartbeat timestamps
+	presenceConnectionsKey = "presence:connections:" // Sorted set of a user's connections by last heartbeat
 )
 
+// offlinePresenceTTL is how long an offline status is kept for last_seen queries
+const offlinePresenceTTL = 24 * time.Hour
+
 // NewPresenceStore creates a new presence store
 func NewPresenceStore(client *goredis.Client, ttl time.Duration) *PresenceStore {
 	if ttl == 0 {
@@ -96,7 +100,7 @@ func (p *PresenceStore) SetOffline(ctx context.Context, userID string) error {
 		Status:   "offline",
 	}
 	data, _ := json.Marshal(status)
-	pipe.Set(ctx, key, data, 24*time.Hour) // Keep offline status longer for last_seen queries
+	pipe.Set(ctx, key, data, offlinePresenceTTL) // Keep offline status longer for last_seen queries
 
 	// Remove from online users set
 	pipe.SRem(ctx, presenceOnlineSet, userID)
@@ -147,8 +151,8 @@ func (p *PresenceStore) UpdateStatus(ctx context.Context, userID, status string)
 	return nil
 }
 
-// Heartbeat updates the user's heartbeat to prevent timeout
-func (p *PresenceStore) Heartbeat(ctx context.Context, userID string) error {
+// Heartbeat refreshes a user's presence and the liveness of one of their connections
+func (p *PresenceStore) Heartbeat(ctx context.Context, userID, clientID string) error {
 	now := time.Now()
 
 	pipe := p.client.Pipeline()
@@ -157,6 +161,14 @@ func (p *PresenceStore) Heartbeat(ctx context.Context, userID string) error {
 	key := presenceKeyPrefix + userID
 	pipe.Expire(ctx, key, p.ttl)
 
+	// Refresh this connection so it is not pruned as stale
+	pipe.ZAddXX(ctx, presenceConnectionsKey+userID, goredis.Z{
+		Score:  float64(now.Unix()),
+		Member: clientID,
+	})
+	pipe.Expire(ctx, presenceConnectionsKey+userID, p.ttl)
+	pipe.Expire(ctx, connectionsKey(userID), p.ttl)
+
 	// Update heartbeat timestamp
 	pipe.ZAdd(ctx, presenceHeartbeatKey+"all", goredis.Z{
 		Score:  float64(now.Unix()),
@@ -259,8 +271,10 @@ func (p *PresenceStore) GetOnlineCount(ctx context.Context) (int64, error) {
 	return p.client.SCard(ctx, presenceOnlineSet).Result()
 }
 
-// CleanupStalePresence removes presence data for users who haven't sent a heartbeat
-func (p *PresenceStore) CleanupStalePresence(ctx context.Context, maxAge time.Duration) (int64, error) {
+// CleanupStalePresence prunes connections that stopped sending heartbeats, for
+// example because the API instance holding them crashed, and marks users with no
+// live connection left as offline. It returns the IDs of users that went offline.
+func (p *PresenceStore) CleanupStalePresence(ctx context.Context, maxAge time.Duration) ([]string, error) {
 	threshold := time.Now().Add(-maxAge).Unix()
 
 	// Get stale users (heartbeat older than threshold)
@@ -269,19 +283,21 @@ func (p *PresenceStore) CleanupStalePresence(ctx context.Context, maxAge time.Du
 		Max: strconv.FormatInt(threshold, 10),
 	}).Result()
 	if err != nil {
-		return 0, err
-	}
-
-	if len(staleUsers) == 0 {
-		return 0, nil
+		return nil, err
 	}
 
-	// Mark each stale user as offline
+	var offline []string
 	for _, userID := range staleUsers {
-		p.SetOffline(ctx, userID)
+		wentOffline, err := p.removeConnection(ctx, userID, "", time.Unix(threshold, 0))
+		if err != nil {
+			return offline, err
+		}
+		if wentOffline {
+			offline = append(offline, userID)
+		}
 	}
 
-	return int64(len(staleUsers)), nil
+	return offline, nil
 }
 
 // TrackTyping sets a typing indicator for a user in a conversation
@@ -307,50 +323,114 @@ func (p *PresenceStore) GetTypingUsers(ctx context.Context, conversationID strin
 	return p.client.SMembers(ctx, key).Result()
 }
 
-// TrackUserConnection tracks a user's WebSocket connection
-func (p *PresenceStore) TrackUserConnection(ctx context.Context, userID, clientID, deviceID string) error {
-	key := fmt.Sprintf("connections:%s", userID)
+// trackConnectionScript prunes stale connections, records a new one and adds
+// the user to the online set, storing a fresh online status when they were
+// offline. It returns the user's live connection count and whether this call
+// moved the user from offline to online, so exactly one instance sees the
+// transition.
+var trackConnectionScript = goredis.NewScript(`
+local stale = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+for _, id in ipairs(stale) do
+    redis.call('HDEL', KEYS[2], id)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[3])
+redis.call('HSET', KEYS[2], ARGV[3], ARGV[4])
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+redis.call('EXPIRE', KEYS[2], ARGV[5])
+local added = redis.call('SADD', KEYS[3], ARGV[6])
+if added == 1 then
+    redis.call('SET', KEYS[4], ARGV[7], 'EX', ARGV[5])
+end
+redis.call('ZADD', KEYS[5], ARGV[1], ARGV[6])
+return {redis.call('ZCARD', KEYS[1]), added}
+`)
+
+// removeConnectionScript removes a connection (if ARGV[1] is set), prunes stale
+// ones and, when none are left, removes the user from the online set and stores
+// their offline status. It returns the remaining connection count and whether
+// this call took the user offline.
+var removeConnectionScript = goredis.NewScript(`
+if ARGV[1] ~= '' then
+    redis.call('ZREM', KEYS[1], ARGV[1])
+    redis.call('HDEL', KEYS[2], ARGV[1])
+end
+local stale = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+for _, id in ipairs(stale) do
+    redis.call('HDEL', KEYS[2], id)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local count = redis.call('ZCARD', KEYS[1])
+local removed = 0
+if count == 0 then
+    redis.call('DEL', KEYS[1], KEYS[2])
+    redis.call('ZREM', KEYS[4], ARGV[3])
+    removed = redis.call('SREM', KEYS[3], ARGV[3])
+    if removed == 1 then
+        redis.call('SET', KEYS[5], ARGV[4], 'EX', ARGV[5])
+    end
+end
+return {count, removed}
+`)
+
+// TrackUserConnection tracks a user's WebSocket connection. It returns true when
+// this is the user's first live connection across all API instances.
+func (p *PresenceStore) TrackUserConnection(ctx context.Context, userID, clientID, deviceID string) (bool, error) {
+	now := time.Now()
 	connectionData := map[string]interface{}{
 		"client_id":    clientID,
 		"device_id":    deviceID,
-		"connected_at": time.Now().UTC().Format(time.RFC3339),
+		"connected_at": now.UTC().Format(time.RFC3339),
 	}
 	data, _ := json.Marshal(connectionData)
+	status, _ := json.Marshal(PresenceStatus{
+		UserID:   userID,
+		IsOnline: true,
+		LastSeen: now,
+		Status:   "online",
+		DeviceID: deviceID,
+		ClientID: clientID,
+	})
 
-	pipe := p.client.Pipeline()
-	pipe.HSet(ctx, key, clientID, data)
-	pipe.Expire(ctx, key, p.ttl)
-	_, err := pipe.Exec(ctx)
-	return err
+	res, err := trackConnectionScript.Run(ctx, p.client,
+		[]string{presenceConnectionsKey + userID, connectionsKey(userID), presenceOnlineSet, presenceKeyPrefix + userID, presenceHeartbeatKey + "all"},
+		now.Unix(), now.Add(-p.ttl).Unix(), clientID, data, int64(p.ttl/time.Second), userID, status,
+	).Int64Slice()
+	if err != nil {
+		return false, err
+	}
+	return res[1] == 1, nil
 }
 
-// RemoveUserConnection removes a user's WebSocket connection tracking
-func (p *PresenceStore) RemoveUserConnection(ctx context.Context, userID, clientID string) error {
-	key := fmt.Sprintf("connections:%s", userID)
+// RemoveUserConnection removes a user's WebSocket connection tracking. It returns
+// true when the user has no live connection left on any API instance, in which
+// case the user is marked offline.
+func (p *PresenceStore) RemoveUserConnection(ctx context.Context, userID, clientID string) (bool, error) {
+	return p.removeConnection(ctx, userID, clientID, time.Now().Add(-p.ttl))
+}
 
-	// Remove this connection
-	if err := p.client.HDel(ctx, key, clientID).Err(); err != nil {
-		return err
-	}
+func (p *PresenceStore) removeConnection(ctx context.Context, userID, clientID string, staleBefore time.Time) (bool, error) {
+	now := time.Now()
+	status, _ := json.Marshal(PresenceStatus{
+		UserID:   userID,
+		IsOnline: false,
+		LastSeen: now,
+		Status:   "offline",
+	})
 
-	// Check if user has any remaining connections
-	count, err := p.client.HLen(ctx, key).Result()
+	res, err := removeConnectionScript.Run(ctx, p.client,
+		[]string{presenceConnectionsKey + userID, connectionsKey(userID), presenceOnlineSet, presenceHeartbeatKey + "all", presenceKeyPrefix + userID},
+		clientID, staleBefore.Unix(), userID, status, int64(offlinePresenceTTL/time.Second),
+	).Int64Slice()
 	if err != nil {
-		return err
-	}
-
-	// If no connections remain, mark user offline
-	if count == 0 {
-		return p.SetOffline(ctx, userID)
+		return false, err
 	}
-
-	return nil
+	return res[1] == 1, nil
 }
 
 // GetUserConnections returns all active connections for a user
 func (p *PresenceStore) GetUserConnections(ctx context.Context, userID string) ([]map[string]string, error) {
-	key := fmt.Sprintf("connections:%s", userID)
-	data, err := p.client.HGetAll(ctx, key).Result()
+	data, err := p.client.HGetAll(ctx, connectionsKey(userID)).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -368,10 +448,14 @@ func (p *PresenceStore) GetUserConnections(ctx context.Context, userID string) (
 	return connections, nil
 }
 
-// GetUserConnectionCount returns the number of active connections for a user
+// GetUserConnectionCount returns the number of live connections for a user
 func (p *PresenceStore) GetUserConnectionCount(ctx context.Context, userID string) (int64, error) {
-	key := fmt.Sprintf("connections:%s", userID)
-	return p.client.HLen(ctx, key).Result()
+	return p.client.ZCount(ctx, presenceConnectionsKey+userID,
+		strconv.FormatInt(time.Now().Add(-p.ttl).Unix(), 10), "+inf").Result()
+}
+
+func connectionsKey(userID string) string {
+	return fmt.Sprintf("connections:%s", userID)
 }
 
 // LastSeenKey generates the key for storing last seen time
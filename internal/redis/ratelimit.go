@@ -11,27 +11,37 @@ import (
 // Rate limiting key patterns (from database.md Appendix H):
 // - ratelimit:{user_id}:messages - 60s TTL, per-minute message limit
 // - ratelimit:{user_id}:calls - 60s TTL, per-minute call limit
+// - ratelimit:{user_id}:key_bundles - 60s TTL, per-minute key bundle targets
+// - ratelimit:{user_id}:link_previews - 60s TTL, per-minute link preview requests
 // - ratelimit:{ip}:auth - 60s TTL, per-minute auth attempts
 
 // RateLimitConfig contains configuration for rate limiting
 type RateLimitConfig struct {
-	MessageLimit  int           // Max messages per window
-	MessageWindow time.Duration // Message rate limit window
-	CallLimit     int           // Max calls per window
-	CallWindow    time.Duration // Call rate limit window
-	AuthLimit     int           // Max auth attempts per window
-	AuthWindow    time.Duration // Auth rate limit window
+	MessageLimit      int           // Max messages per window
+	MessageWindow     time.Duration // Message rate limit window
+	CallLimit         int           // Max calls per window
+	CallWindow        time.Duration // Call rate limit window
+	AuthLimit         int           // Max auth attempts per window
+	AuthWindow        time.Duration // Auth rate limit window
+	KeyBundleLimit    int           // Max users named in key bundle fetches per window
+	KeyBundleWindow   time.Duration // Key bundle rate limit window
+	LinkPreviewLimit  int           // Max link preview requests per window
+	LinkPreviewWindow time.Duration // Link preview rate limit window
 }
 
 // DefaultRateLimitConfig returns sensible defaults
 func DefaultRateLimitConfig() RateLimitConfig {
 	return RateLimitConfig{
-		MessageLimit:  60, // 60 messages per minute
-		MessageWindow: 60 * time.Second,
-		CallLimit:     10, // 10 calls per minute
-		CallWindow:    60 * time.Second,
-		AuthLimit:     5, // 5 auth attempts per minute
-		AuthWindow:    60 * time.Second,
+		MessageLimit:      60, // 60 messages per minute
+		MessageWindow:     60 * time.Second,
+		CallLimit:         10, // 10 calls per minute
+		CallWindow:        60 * time.Second,
+		AuthLimit:         5, // 5 auth attempts per minute
+		AuthWindow:        60 * time.Second,
+		KeyBundleLimit:    100, // 100 users' key bundles per minute
+		KeyBundleWindow:   60 * time.Second,
+		LinkPreviewLimit:  30, // 30 link previews per minute
+		LinkPreviewWindow: 60 * time.Second,
 	}
 }
 
@@ -69,6 +79,22 @@ func (r *RateLimiter) AllowCall(ctx context.Context, userID string) (*RateLimitR
 	return r.checkLimit(ctx, key, r.config.CallLimit, r.config.CallWindow)
 }
 
+// AllowKeyBundleFetch checks if a user can fetch the key bundles of targets
+// users. Each target is charged, so a batch costs as much as fetching its
+// users one by one. How many of one device's one-time prekeys a user may
+// consume is capped separately by the encryption service.
+func (r *RateLimiter) AllowKeyBundleFetch(ctx context.Context, userID string, targets int) (*RateLimitResult, error) {
+	key := fmt.Sprintf("ratelimit:%s:key_bundles", userID)
+	return r.checkLimitN(ctx, key, r.config.KeyBundleLimit, targets, r.config.KeyBundleWindow)
+}
+
+// AllowLinkPreview checks if a user can request a link preview. Each request
+// may make the server fetch an external URL.
+func (r *RateLimiter) AllowLinkPreview(ctx context.Context, userID string) (*RateLimitResult, error) {
+	key := fmt.Sprintf("ratelimit:%s:link_previews", userID)
+	return r.checkLimit(ctx, key, r.config.LinkPreviewLimit, r.config.LinkPreviewWindow)
+}
+
 // AllowAuth checks if an IP can make an auth attempt
 func (r *RateLimiter) AllowAuth(ctx context.Context, ip string) (*RateLimitResult, error) {
 	key := fmt.Sprintf("ratelimit:%s:auth", ip)
@@ -77,11 +103,18 @@ func (r *RateLimiter) AllowAuth(ctx context.Context, ip string) (*RateLimitResul
 
 // checkLimit performs the actual rate limit check using a sliding window counter
 func (r *RateLimiter) checkLimit(ctx context.Context, key string, limit int, window time.Duration) (*RateLimitResult, error) {
+	return r.checkLimitN(ctx, key, limit, 1, window)
+}
+
+// checkLimitN is checkLimit for an action that uses up cost units of the limit
+// at once. It is refused unless all of them fit.
+func (r *RateLimiter) checkLimitN(ctx context.Context, key string, limit, cost int, window time.Duration) (*RateLimitResult, error) {
 	// Use Lua script for atomic increment and check
 	script := goredis.NewScript(`
 		local key = KEYS[1]
 		local limit = tonumber(ARGV[1])
 		local window = tonumber(ARGV[2])
+		local cost = tonumber(ARGV[3])
 		
 		local current = redis.call('GET', key)
 		if current == false then
@@ -95,18 +128,18 @@ func (r *RateLimiter) checkLimit(ctx context.Context, key string, limit int, win
 			ttl = window
 		end
 		
-		if current < limit then
-			redis.call('INCR', key)
+		if current + cost <= limit then
+			redis.call('INCRBY', key, cost)
 			if ttl == window then
 				redis.call('EXPIRE', key, window)
 			end
-			return {1, limit - current - 1, ttl}
+			return {1, limit - current - cost, ttl}
 		else
 			return {0, 0, ttl}
 		end
 	`)
 
-	result, err := script.Run(ctx, r.client, []string{key}, limit, int(window.Seconds())).Result()
+	result, err := script.Run(ctx, r.client, []string{key}, limit, int(window.Seconds()), cost).Result()
 	if err != nil {
 		return nil, fmt.Errorf("rate limit check failed: %w", err)
 	}
@@ -167,6 +200,8 @@ func (r *RateLimiter) ResetUser(ctx context.Context, userID string) error {
 	keys := []string{
 		fmt.Sprintf("ratelimit:%s:messages", userID),
 		fmt.Sprintf("ratelimit:%s:calls", userID),
+		fmt.Sprintf("ratelimit:%s:key_bundles", userID),
+		fmt.Sprintf("ratelimit:%s:link_previews", userID),
 	}
 	return r.client.Del(ctx, keys...).Err()
 }
@@ -2,11 +2,13 @@ package redis
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"time"
 
-	"github.com/google/uuid"
 	goredis "github.com/redis/go-redis/v9"
 )
 
@@ -239,18 +241,18 @@ func (s *SignalingStore) SendCallEnded(ctx context.Context, callID, reason strin
 	return nil
 }
 
-// GenerateTURNCredentials generates temporary TURN server credentials
+// GenerateTURNCredentials generates time-limited TURN credentials following the
+// TURN REST API scheme used by coturn's use-auth-secret mode: the username is
+// "<expiry unix time>:<user id>" and the password is base64(HMAC-SHA1(secret, username)).
 func (s *SignalingStore) GenerateTURNCredentials(ctx context.Context, userID string, turnSecret string, ttl time.Duration) (string, string, time.Time) {
-	// Simple time-limited TURN credential generation
-	// In production, use proper TURN REST API or coturn's turnutils
-	timestamp := time.Now().Add(ttl).Unix()
-	username := fmt.Sprintf("%d:%s", timestamp, userID)
+	expiresAt := time.Now().Add(ttl)
+	username := fmt.Sprintf("%d:%s", expiresAt.Unix(), userID)
 
-	// HMAC-SHA1 would be used here with turnSecret to generate password
-	// For now, return placeholder - implement proper TURN auth in production
-	password := fmt.Sprintf("turn_%s_%d", uuid.New().String()[:8], timestamp)
+	mac := hmac.New(sha1.New, []byte(turnSecret))
+	mac.Write([]byte(username))
+	password := base64.StdEncoding.EncodeToString(mac.Sum(nil))
 
-	return username, password, time.Now().Add(ttl)
+	return username, password, expiresAt
 }
 
 // GetActiveCallsForUser returns active calls the user is part of
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+
+	"sentinal-chat/internal/domain/conversation"
+	"sentinal-chat/internal/redis"
+
+	"github.com/google/uuid"
+)
+
+// CachedConversationRepository serves participant checks from the Redis cache
+// and invalidates the cached participant list whenever membership changes.
+// Writes made through a transaction-scoped repository bypass it; callers run
+// InvalidateConversationCache once such a transaction has committed.
+type CachedConversationRepository struct {
+	ConversationRepository
+	cache *redis.CacheStore
+}
+
+func NewCachedConversationRepository(inner ConversationRepository, cache *redis.CacheStore) ConversationRepository {
+	if cache == nil {
+		return inner
+	}
+	return &CachedConversationRepository{ConversationRepository: inner, cache: cache}
+}
+
+func (r *CachedConversationRepository) IsParticipant(ctx context.Context, conversationID, userID uuid.UUID) (bool, error) {
+	ids, err := r.cache.GetConversationParticipants(ctx, conversationID)
+	if err != nil {
+		return r.ConversationRepository.IsParticipant(ctx, conversationID, userID)
+	}
+	if ids == nil {
+		participants, err := r.ConversationRepository.GetParticipants(ctx, conversationID)
+		if err != nil {
+			return false, err
+		}
+		ids = make([]uuid.UUID, 0, len(participants))
+		for _, p := range participants {
+			ids = append(ids, p.UserID)
+		}
+		_ = r.cache.SetConversationParticipants(ctx, conversationID, ids)
+	}
+	for _, id := range ids {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *CachedConversationRepository) AddParticipant(ctx context.Context, p *conversation.Participant) error {
+	if err := r.ConversationRepository.AddParticipant(ctx, p); err != nil {
+		return err
+	}
+	return r.cache.InvalidateConversationParticipants(ctx, p.ConversationID)
+}
+
+func (r *CachedConversationRepository) RemoveParticipant(ctx context.Context, conversationID, userID uuid.UUID) error {
+	if err := r.ConversationRepository.RemoveParticipant(ctx, conversationID, userID); err != nil {
+		return err
+	}
+	return r.cache.InvalidateConversationParticipants(ctx, conversationID)
+}
+
+func (r *CachedConversationRepository) UpdateParticipantRole(ctx context.Context, conversationID, userID uuid.UUID, role string) error {
+	if err := r.ConversationRepository.UpdateParticipantRole(ctx, conversationID, userID, role); err != nil {
+		return err
+	}
+	return r.cache.InvalidateConversationParticipants(ctx, conversationID)
+}
+
+func (r *CachedConversationRepository) Update(ctx context.Context, c conversation.Conversation) error {
+	if err := r.ConversationRepository.Update(ctx, c); err != nil {
+		return err
+	}
+	return r.cache.InvalidateConversation(ctx, c.ID)
+}
+
+func (r *CachedConversationRepository) UpdateInfo(ctx context.Context, c conversation.Conversation) error {
+	if err := r.ConversationRepository.UpdateInfo(ctx, c); err != nil {
+		return err
+	}
+	return r.cache.InvalidateConversation(ctx, c.ID)
+}
+
+func (r *CachedConversationRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := r.ConversationRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+	return r.cache.InvalidateConversation(ctx, id)
+}
+
+// InvalidateConversationCache drops the cached conversation and participant
+// list when repo is cached. It is meant to run after a transaction that wrote
+// through a tx-scoped repository has committed, so a concurrent reader cannot
+// repopulate the cache from pre-commit rows. Failures are ignored; the entry
+// then expires with its TTL.
+func InvalidateConversationCache(ctx context.Context, repo ConversationRepository, conversationID uuid.UUID) {
+	if cached, ok := repo.(*CachedConversationRepository); ok {
+		_ = cached.cache.InvalidateConversation(ctx, conversationID)
+	}
+}
@@ -2,11 +2,20 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"sentinal-chat/internal/domain/command"
+	sentinal_errors "sentinal-chat/pkg/errors"
 )
 
+const commandLogColumns = `
+        id, command_type, user_id, status, payload, result, undo_data, error_message, execution_time_ms,
+        created_at, executed_at, undone_at, undo_deadline`
+
 type commandRepository struct {
 	db DBTX
 }
@@ -17,8 +26,8 @@ func NewCommandRepository(db DBTX) CommandRepository {
 
 func (r *commandRepository) CreateLog(ctx context.Context, log *command.CommandLog) error {
 	_, err := r.db.ExecContext(ctx, `
-        INSERT INTO command_logs (id, command_type, user_id, status, payload, result, undo_data, error_message, execution_time_ms, created_at, executed_at, undone_at)
-        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+        INSERT INTO command_logs (id, command_type, user_id, status, payload, result, undo_data, error_message, execution_time_ms, created_at, executed_at, undone_at, undo_deadline)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
     `,
 		log.ID,
 		log.CommandType,
@@ -32,6 +41,7 @@ func (r *commandRepository) CreateLog(ctx context.Context, log *command.CommandL
 		log.CreatedAt,
 		log.ExecutedAt,
 		log.UndoneAt,
+		log.UndoDeadline,
 	)
 	return err
 }
@@ -40,8 +50,9 @@ func (r *commandRepository) UpdateLog(ctx context.Context, log *command.CommandL
 	_, err := r.db.ExecContext(ctx, `
         UPDATE command_logs
         SET command_type = $1, user_id = $2, status = $3, payload = $4, result = $5, undo_data = $6,
-            error_message = $7, execution_time_ms = $8, created_at = $9, executed_at = $10, undone_at = $11
-        WHERE id = $12
+            error_message = $7, execution_time_ms = $8, created_at = $9, executed_at = $10, undone_at = $11,
+            undo_deadline = $12
+        WHERE id = $13
     `,
 		log.CommandType,
 		log.UserID,
@@ -54,80 +65,56 @@ func (r *commandRepository) UpdateLog(ctx context.Context, log *command.CommandL
 		log.CreatedAt,
 		log.ExecutedAt,
 		log.UndoneAt,
+		log.UndoDeadline,
 		log.ID,
 	)
 	return err
 }
 
 func (r *commandRepository) GetLogByID(ctx context.Context, id uuid.UUID) (command.CommandLog, error) {
-	var log command.CommandLog
-	err := r.db.QueryRowContext(ctx, `
-        SELECT id, command_type, user_id, status, payload, result, undo_data, error_message, execution_time_ms,
-               created_at, executed_at, undone_at
+	row := r.db.QueryRowContext(ctx, `SELECT`+commandLogColumns+`
         FROM command_logs WHERE id = $1
-    `, id).Scan(
-		&log.ID,
-		&log.CommandType,
-		&log.UserID,
-		&log.Status,
-		&log.Payload,
-		&log.Result,
-		&log.UndoData,
-		&log.ErrorMessage,
-		&log.ExecutionTimeMs,
-		&log.CreatedAt,
-		&log.ExecutedAt,
-		&log.UndoneAt,
-	)
+    `, id)
+	log, err := scanCommandLog(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return command.CommandLog{}, sentinal_errors.ErrNotFound
+		}
+		return command.CommandLog{}, err
+	}
+	return log, nil
+}
+
+// LockLog loads a command log and holds a row lock on it until the
+// surrounding transaction ends.
+func (r *commandRepository) LockLog(ctx context.Context, id uuid.UUID) (command.CommandLog, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT`+commandLogColumns+`
+        FROM command_logs WHERE id = $1
+        FOR UPDATE
+    `, id)
+	log, err := scanCommandLog(row)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return command.CommandLog{}, sentinal_errors.ErrNotFound
+		}
 		return command.CommandLog{}, err
 	}
 	return log, nil
 }
 
 func (r *commandRepository) GetPendingCommands(ctx context.Context, limit int) ([]command.CommandLog, error) {
-	var logs []command.CommandLog
-	rows, err := r.db.QueryContext(ctx, `
-        SELECT id, command_type, user_id, status, payload, result, undo_data, error_message, execution_time_ms,
-               created_at, executed_at, undone_at
+	rows, err := r.db.QueryContext(ctx, `SELECT`+commandLogColumns+`
         FROM command_logs WHERE status = $1
         LIMIT $2
     `, command.StatusPending, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var log command.CommandLog
-		if err := rows.Scan(
-			&log.ID,
-			&log.CommandType,
-			&log.UserID,
-			&log.Status,
-			&log.Payload,
-			&log.Result,
-			&log.UndoData,
-			&log.ErrorMessage,
-			&log.ExecutionTimeMs,
-			&log.CreatedAt,
-			&log.ExecutedAt,
-			&log.UndoneAt,
-		); err != nil {
-			return nil, err
-		}
-		logs = append(logs, log)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return logs, nil
+	return collectCommandLogs(rows)
 }
 
 func (r *commandRepository) GetCommandsByUser(ctx context.Context, userID uuid.UUID, limit int) ([]command.CommandLog, error) {
-	var logs []command.CommandLog
-	rows, err := r.db.QueryContext(ctx, `
-        SELECT id, command_type, user_id, status, payload, result, undo_data, error_message, execution_time_ms,
-               created_at, executed_at, undone_at
+	rows, err := r.db.QueryContext(ctx, `SELECT`+commandLogColumns+`
         FROM command_logs
         WHERE user_id = $1
         ORDER BY created_at DESC
@@ -136,40 +123,68 @@ func (r *commandRepository) GetCommandsByUser(ctx context.Context, userID uuid.U
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var log command.CommandLog
-		if err := rows.Scan(
-			&log.ID,
-			&log.CommandType,
-			&log.UserID,
-			&log.Status,
-			&log.Payload,
-			&log.Result,
-			&log.UndoData,
-			&log.ErrorMessage,
-			&log.ExecutionTimeMs,
-			&log.CreatedAt,
-			&log.ExecutedAt,
-			&log.UndoneAt,
-		); err != nil {
-			return nil, err
-		}
-		logs = append(logs, log)
+	return collectCommandLogs(rows)
+}
+
+// ListCommands returns a page of the user's command history, newest first,
+// optionally filtered by command type and status.
+func (r *commandRepository) ListCommands(ctx context.Context, userID uuid.UUID, commandType, status string, page, limit int) ([]command.CommandLog, int64, error) {
+	where := "WHERE user_id = $1"
+	args := []interface{}{userID}
+	if commandType != "" {
+		args = append(args, commandType)
+		where += fmt.Sprintf(" AND command_type = $%d", len(args))
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
 	}
-	return logs, nil
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM command_logs "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	query := `SELECT` + commandLogColumns + `
+        FROM command_logs ` + where +
+		fmt.Sprintf(" ORDER BY created_at DESC OFFSET $%d LIMIT $%d", len(args)+1, len(args)+2)
+	args = append(args, offset, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	logs, err := collectCommandLogs(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
 }
 
 func (r *commandRepository) CanUndo(ctx context.Context, commandID uuid.UUID, userID uuid.UUID) (bool, error) {
-	var log command.CommandLog
-	err := r.db.QueryRowContext(ctx, `
-        SELECT id, command_type, user_id, status, payload, result, undo_data, error_message, execution_time_ms,
-               created_at, executed_at, undone_at
+	row := r.db.QueryRowContext(ctx, `SELECT`+commandLogColumns+`
         FROM command_logs WHERE id = $1 AND user_id = $2
-    `, commandID, userID).Scan(
+    `, commandID, userID)
+	log, err := scanCommandLog(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, sentinal_errors.ErrNotFound
+		}
+		return false, err
+	}
+	return log.IsUndoable(time.Now()), nil
+}
+
+type commandLogScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCommandLog(row commandLogScanner) (command.CommandLog, error) {
+	var log command.CommandLog
+	var errorMessage sql.NullString
+	var executionTimeMs sql.NullInt64
+	if err := row.Scan(
 		&log.ID,
 		&log.CommandType,
 		&log.UserID,
@@ -177,14 +192,32 @@ func (r *commandRepository) CanUndo(ctx context.Context, commandID uuid.UUID, us
 		&log.Payload,
 		&log.Result,
 		&log.UndoData,
-		&log.ErrorMessage,
-		&log.ExecutionTimeMs,
+		&errorMessage,
+		&executionTimeMs,
 		&log.CreatedAt,
 		&log.ExecutedAt,
 		&log.UndoneAt,
-	)
-	if err != nil {
-		return false, err
+		&log.UndoDeadline,
+	); err != nil {
+		return command.CommandLog{}, err
+	}
+	log.ErrorMessage = errorMessage.String
+	log.ExecutionTimeMs = int(executionTimeMs.Int64)
+	return log, nil
+}
+
+func collectCommandLogs(rows *sql.Rows) ([]command.CommandLog, error) {
+	defer rows.Close()
+	var logs []command.CommandLog
+	for rows.Next() {
+		log, err := scanCommandLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
 	}
-	return log.Status == command.StatusCompleted && log.UndoneAt == nil, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return logs, nil
 }
@@ -88,6 +88,24 @@ func (r *PostgresConversationRepository) GetByID(ctx context.Context, id uuid.UU
 	return c, nil
 }
 
+// UpdateInfo writes only the conversation's subject, description and avatar,
+// so it cannot undo a concurrent change to its settings.
+func (r *PostgresConversationRepository) UpdateInfo(ctx context.Context, c conversation.Conversation) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE conversations
+        SET subject = $1, description = $2, avatar_url = $3, updated_at = $4
+        WHERE id = $5
+    `, c.Subject, c.Description, c.AvatarURL, c.UpdatedAt, c.ID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
 func (r *PostgresConversationRepository) Update(ctx context.Context, c conversation.Conversation) error {
 	res, err := r.db.ExecContext(ctx, `
         UPDATE conversations
@@ -644,3 +662,273 @@ func (r *PostgresConversationRepository) IncrementSequence(ctx context.Context,
 	}
 	return seq.LastSequence, nil
 }
+
+func (r *PostgresConversationRepository) GetUserConversationsByLabel(ctx context.Context, userID, labelID uuid.UUID, page, limit int) ([]conversation.Conversation, int64, error) {
+	var conversations []conversation.Conversation
+	var total int64
+
+	if err := r.db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM conversations c
+        WHERE c.id IN (SELECT conversation_id FROM participants WHERE user_id = $1)
+          AND c.id IN (SELECT conversation_id FROM conversation_labels WHERE user_id = $1 AND label_id = $2)
+    `, userID, labelID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT c.id, c.type, c.subject, c.description, c.avatar_url, c.expiry_seconds, c.disappearing_mode,
+               c.message_expiry_seconds, c.group_permissions, c.invite_link, c.invite_link_revoked_at, c.created_by,
+               c.created_at, c.updated_at
+        FROM conversations c
+        WHERE c.id IN (SELECT conversation_id FROM participants WHERE user_id = $1)
+          AND c.id IN (SELECT conversation_id FROM conversation_labels WHERE user_id = $1 AND label_id = $2)
+        ORDER BY c.updated_at DESC
+        OFFSET $3 LIMIT $4
+    `, userID, labelID, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c conversation.Conversation
+		if err := rows.Scan(
+			&c.ID,
+			&c.Type,
+			&c.Subject,
+			&c.Description,
+			&c.AvatarURL,
+			&c.ExpirySeconds,
+			&c.DisappearingMode,
+			&c.MessageExpirySeconds,
+			&c.GroupPermissions,
+			&c.InviteLink,
+			&c.InviteLinkRevokedAt,
+			&c.CreatedBy,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		participants, err := r.GetParticipants(ctx, c.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		c.Participants = participants
+		conversations = append(conversations, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return conversations, total, nil
+}
+
+// CreateLabel inserts a label, appending it after the user's existing labels
+// when no position is given.
+func (r *PostgresConversationRepository) CreateLabel(ctx context.Context, l *conversation.ChatLabel) error {
+	err := r.db.QueryRowContext(ctx, `
+        INSERT INTO chat_labels (id, user_id, name, color, position, created_at)
+        VALUES ($1, $2, $3, $4,
+                COALESCE($5, (SELECT COALESCE(MAX(position) + 1, 0) FROM chat_labels WHERE user_id = $2)),
+                $6)
+        RETURNING position
+    `, l.ID, l.UserID, l.Name, l.Color, l.Position, l.CreatedAt).Scan(&l.Position)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return sentinal_errors.ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresConversationRepository) GetLabel(ctx context.Context, labelID uuid.UUID) (conversation.ChatLabel, error) {
+	var l conversation.ChatLabel
+	err := r.db.QueryRowContext(ctx, `
+        SELECT id, user_id, name, color, position, created_at
+        FROM chat_labels WHERE id = $1
+    `, labelID).Scan(&l.ID, &l.UserID, &l.Name, &l.Color, &l.Position, &l.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return conversation.ChatLabel{}, sentinal_errors.ErrNotFound
+		}
+		return conversation.ChatLabel{}, err
+	}
+	return l, nil
+}
+
+func (r *PostgresConversationRepository) GetUserLabels(ctx context.Context, userID uuid.UUID) ([]conversation.ChatLabel, error) {
+	var labels []conversation.ChatLabel
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, user_id, name, color, position, created_at
+        FROM chat_labels WHERE user_id = $1
+        ORDER BY position ASC NULLS LAST, created_at ASC
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l conversation.ChatLabel
+		if err := rows.Scan(&l.ID, &l.UserID, &l.Name, &l.Color, &l.Position, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func (r *PostgresConversationRepository) UpdateLabel(ctx context.Context, l conversation.ChatLabel) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE chat_labels SET name = $1, color = $2, position = $3
+        WHERE id = $4 AND user_id = $5
+    `, l.Name, l.Color, l.Position, l.ID, l.UserID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return sentinal_errors.ErrAlreadyExists
+		}
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+func (r *PostgresConversationRepository) DeleteLabel(ctx context.Context, labelID, userID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM chat_labels WHERE id = $1 AND user_id = $2", labelID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+// ReorderLabels sets each label's position to its index in labelIDs. Callers
+// should run it in a transaction so a partial reorder is never visible.
+func (r *PostgresConversationRepository) ReorderLabels(ctx context.Context, userID uuid.UUID, labelIDs []uuid.UUID) error {
+	for i, labelID := range labelIDs {
+		res, err := r.db.ExecContext(ctx, "UPDATE chat_labels SET position = $1 WHERE id = $2 AND user_id = $3", i, labelID, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return sentinal_errors.ErrNotFound
+		}
+	}
+	return nil
+}
+
+func (r *PostgresConversationRepository) AssignLabel(ctx context.Context, cl *conversation.ConversationLabel) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO conversation_labels (conversation_id, label_id, user_id, created_at)
+        VALUES ($1,$2,$3,$4)
+    `, cl.ConversationID, cl.LabelID, cl.UserID, cl.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return sentinal_errors.ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresConversationRepository) UnassignLabel(ctx context.Context, conversationID, labelID, userID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, `
+        DELETE FROM conversation_labels WHERE conversation_id = $1 AND label_id = $2 AND user_id = $3
+    `, conversationID, labelID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+func (r *PostgresConversationRepository) GetConversationLabels(ctx context.Context, conversationID, userID uuid.UUID) ([]conversation.ChatLabel, error) {
+	var labels []conversation.ChatLabel
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT l.id, l.user_id, l.name, l.color, l.position, l.created_at
+        FROM chat_labels l
+        JOIN conversation_labels cl ON cl.label_id = l.id
+        WHERE cl.conversation_id = $1 AND cl.user_id = $2
+        ORDER BY l.position ASC NULLS LAST, l.created_at ASC
+    `, conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l conversation.ChatLabel
+		if err := rows.Scan(&l.ID, &l.UserID, &l.Name, &l.Color, &l.Position, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// SetDisappearingMode changes only the disappearing message settings, so it
+// cannot overwrite a concurrent edit of the other conversation fields.
+func (r *PostgresConversationRepository) SetDisappearingMode(ctx context.Context, conversationID uuid.UUID, mode string, expirySeconds sql.NullInt32) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE conversations
+        SET disappearing_mode = $1, message_expiry_seconds = $2, updated_at = $3
+        WHERE id = $4
+    `, mode, expirySeconds, time.Now(), conversationID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+func (r *PostgresConversationRepository) SetGroupPermissions(ctx context.Context, conversationID uuid.UUID, permissions string) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE conversations
+        SET group_permissions = $1, updated_at = $2
+        WHERE id = $3
+    `, permissions, time.Now(), conversationID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+// ClearHistory records that the user cleared the conversation, hiding every
+// message created up to ClearedAt from them.
+func (r *PostgresConversationRepository) ClearHistory(ctx context.Context, c *conversation.ConversationClear) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO conversation_clears (conversation_id, user_id, cleared_at)
+        VALUES ($1,$2,$3)
+        ON CONFLICT (conversation_id, user_id) DO UPDATE SET cleared_at = EXCLUDED.cleared_at
+    `, c.ConversationID, c.UserID, c.ClearedAt)
+	return err
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"sentinal-chat/internal/domain/message"
+
+	"github.com/google/uuid"
+)
+
+type PostgresDeliveryRepository struct {
+	db DBTX
+}
+
+func NewDeliveryRepository(db DBTX) DeliveryRepository {
+	return &PostgresDeliveryRepository{db: db}
+}
+
+// GetPendingEnvelopes returns the messages queued for a device that it has not
+// acknowledged yet, oldest first, each with the device's ciphertext.
+func (r *PostgresDeliveryRepository) GetPendingEnvelopes(ctx context.Context, deviceID uuid.UUID, limit int) ([]message.Message, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT`+deviceMessageColumns+`
+        FROM message_ciphertexts mc
+        JOIN messages m ON m.id = mc.message_id
+        WHERE mc.recipient_device_id = $1 AND mc.delivered_at IS NULL AND m.deleted_at IS NULL
+        `+visibleToUserClause("mc.recipient_user_id")+`
+        ORDER BY mc.created_at, m.seq_id
+        LIMIT $2
+    `, deviceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []message.Message
+	for rows.Next() {
+		m, err := scanDeviceMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// AcknowledgeEnvelopes marks the device's envelopes for the given messages as
+// delivered and returns the messages that were still pending. The envelopes of
+// the user's other devices are locked first, so when two devices acknowledge
+// the same message at once the second sees the first's acknowledgement.
+func (r *PostgresDeliveryRepository) AcknowledgeEnvelopes(ctx context.Context, userID, deviceID uuid.UUID, messageIDs []uuid.UUID, deliveredAt time.Time) ([]uuid.UUID, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{userID, deviceID, deliveredAt}
+	placeholders := make([]string, len(messageIDs))
+	for i, id := range messageIDs {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        WITH locked AS (
+            SELECT id FROM message_ciphertexts
+            WHERE recipient_user_id = $1 AND message_id IN (`+strings.Join(placeholders, ", ")+`)
+            ORDER BY id
+            FOR UPDATE
+        )
+        UPDATE message_ciphertexts SET delivered_at = $3
+        WHERE id IN (SELECT id FROM locked) AND recipient_device_id = $2 AND delivered_at IS NULL
+        RETURNING message_id
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var acked []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		acked = append(acked, id)
+	}
+	return acked, rows.Err()
+}
+
+// GetDeliveredToUser returns those of the given messages that every active
+// device of the user has acknowledged. Only ID, ConversationID and SenderID are
+// set.
+func (r *PostgresDeliveryRepository) GetDeliveredToUser(ctx context.Context, userID uuid.UUID, messageIDs []uuid.UUID) ([]message.Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{userID}
+	placeholders := make([]string, len(messageIDs))
+	for i, id := range messageIDs {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT m.id, m.conversation_id, m.sender_id
+        FROM messages m
+        WHERE m.id IN (`+strings.Join(placeholders, ", ")+`)
+          AND NOT EXISTS (
+            SELECT 1 FROM message_ciphertexts p
+            JOIN devices d ON d.id = p.recipient_device_id
+            WHERE p.message_id = m.id AND p.recipient_user_id = $1 AND p.delivered_at IS NULL AND d.is_active
+          )
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []message.Message
+	for rows.Next() {
+		var m message.Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// MarkUserDelivered records the user's DELIVERED receipt unless the message has
+// already been read or played. It reports whether the receipt changed.
+func (r *PostgresDeliveryRepository) MarkUserDelivered(ctx context.Context, messageID, userID uuid.UUID, deliveredAt time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO message_receipts (message_id, user_id, status, delivered_at, updated_at)
+        VALUES ($1, $2, 'DELIVERED', $3, $3)
+        ON CONFLICT (message_id, user_id) DO UPDATE
+        SET status = 'DELIVERED', delivered_at = EXCLUDED.delivered_at, updated_at = EXCLUDED.updated_at
+        WHERE message_receipts.status IN ('PENDING', 'SENT')
+    `, messageID, userID, deliveredAt)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// DeleteDeliveredCiphertexts removes all envelopes of up to limit messages whose
+// last acknowledgement is older than deliveredBefore and that no active device
+// still has to fetch. Envelopes of messages hidden from their recipient do not
+// hold the others back. It returns the number of messages collected.
+func (r *PostgresDeliveryRepository) DeleteDeliveredCiphertexts(ctx context.Context, deliveredBefore time.Time, limit int) (int, error) {
+	var collected int
+	err := r.db.QueryRowContext(ctx, `
+        WITH done AS (
+            SELECT c.message_id
+            FROM message_ciphertexts c
+            WHERE c.delivered_at IS NOT NULL
+            GROUP BY c.message_id
+            HAVING MAX(c.delivered_at) <= $1
+               AND NOT EXISTS (
+                SELECT 1 FROM message_ciphertexts mc
+                JOIN devices d ON d.id = mc.recipient_device_id
+                JOIN messages m ON m.id = mc.message_id
+                WHERE mc.message_id = c.message_id AND mc.delivered_at IS NULL AND d.is_active AND m.deleted_at IS NULL
+                `+visibleToUserClause("mc.recipient_user_id")+`
+               )
+            LIMIT $2
+        ),
+        deleted AS (
+            DELETE FROM message_ciphertexts WHERE message_id IN (SELECT message_id FROM done)
+        )
+        SELECT COUNT(*) FROM done
+    `, deliveredBefore, limit).Scan(&collected)
+	return collected, err
+}
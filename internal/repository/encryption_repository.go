@@ -54,11 +54,27 @@ func (r *PostgresEncryptionRepository) GetIdentityKey(ctx context.Context, userI
 	return k, nil
 }
 
+func (r *PostgresEncryptionRepository) GetIdentityKeyByID(ctx context.Context, id uuid.UUID) (encryption.IdentityKey, error) {
+	var k encryption.IdentityKey
+	err := r.db.QueryRowContext(ctx, `
+        SELECT id, user_id, device_id, public_key, is_active, created_at
+        FROM identity_keys WHERE id = $1
+    `, id).Scan(&k.ID, &k.UserID, &k.DeviceID, &k.PublicKey, &k.IsActive, &k.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return encryption.IdentityKey{}, sentinal_errors.ErrNotFound
+		}
+		return encryption.IdentityKey{}, err
+	}
+	return k, nil
+}
+
 func (r *PostgresEncryptionRepository) GetUserIdentityKeys(ctx context.Context, userID uuid.UUID) ([]encryption.IdentityKey, error) {
 	var keys []encryption.IdentityKey
 	rows, err := r.db.QueryContext(ctx, `
         SELECT id, user_id, device_id, public_key, is_active, created_at
         FROM identity_keys WHERE user_id = $1 AND is_active = true
+        ORDER BY device_id
     `, userID)
 	if err != nil {
 		return nil, err
@@ -101,6 +117,106 @@ func (r *PostgresEncryptionRepository) DeleteIdentityKey(ctx context.Context, id
 	return err
 }
 
+func (r *PostgresEncryptionRepository) CreateIdentityKeyHistory(ctx context.Context, h *encryption.IdentityKeyHistory) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO identity_key_history (id, user_id, device_id, identity_key_id, public_key, activated_at)
+        VALUES ($1,$2,$3,$4,$5,$6)
+    `, h.ID, h.UserID, h.DeviceID, h.IdentityKeyID, h.PublicKey, h.ActivatedAt)
+	return err
+}
+
+// CloseIdentityKeyHistory records when and why an identity key stopped being
+// its device's active key.
+func (r *PostgresEncryptionRepository) CloseIdentityKeyHistory(ctx context.Context, identityKeyID uuid.UUID, deactivatedAt time.Time, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE identity_key_history SET deactivated_at = $2, deactivation_reason = $3
+        WHERE identity_key_id = $1 AND deactivated_at IS NULL
+    `, identityKeyID, deactivatedAt, reason)
+	return err
+}
+
+// GetIdentityKeyHistory returns the identity keys a user's devices have used,
+// or only those of one device, newest first.
+func (r *PostgresEncryptionRepository) GetIdentityKeyHistory(ctx context.Context, userID uuid.UUID, deviceID uuid.NullUUID) ([]encryption.IdentityKeyHistory, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, user_id, device_id, identity_key_id, public_key, activated_at, deactivated_at, deactivation_reason
+        FROM identity_key_history
+        WHERE user_id = $1 AND ($2::uuid IS NULL OR device_id = $2)
+        ORDER BY activated_at DESC
+    `, userID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []encryption.IdentityKeyHistory
+	for rows.Next() {
+		var h encryption.IdentityKeyHistory
+		if err := rows.Scan(
+			&h.ID,
+			&h.UserID,
+			&h.DeviceID,
+			&h.IdentityKeyID,
+			&h.PublicKey,
+			&h.ActivatedAt,
+			&h.DeactivatedAt,
+			&h.DeactivationReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, h)
+	}
+	return items, rows.Err()
+}
+
+// GetIdentityAudience returns every other user who shares a conversation with
+// the user. They are the ones whose safety numbers change with the user's
+// identity keys.
+func (r *PostgresEncryptionRepository) GetIdentityAudience(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT DISTINCT other.user_id
+        FROM participants self
+        JOIN participants other ON other.conversation_id = self.conversation_id AND other.user_id <> self.user_id
+        WHERE self.user_id = $1
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// IsIdentityVisible reports whether the viewer may see the user's identity
+// keys: the user themselves, anyone sharing a conversation with them, and
+// anyone either of them has as an unblocked contact.
+func (r *PostgresEncryptionRepository) IsIdentityVisible(ctx context.Context, viewerID, userID uuid.UUID) (bool, error) {
+	if viewerID == userID {
+		return true, nil
+	}
+	var visible bool
+	err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM participants self
+            JOIN participants other ON other.conversation_id = self.conversation_id
+            WHERE self.user_id = $1 AND other.user_id = $2
+        ) OR EXISTS (
+            SELECT 1 FROM user_contacts
+            WHERE ((user_id = $1 AND contact_user_id = $2) OR (user_id = $2 AND contact_user_id = $1))
+              AND is_blocked = false
+        )
+    `, viewerID, userID).Scan(&visible)
+	return visible, err
+}
+
 func (r *PostgresEncryptionRepository) CreateSignedPreKey(ctx context.Context, k *encryption.SignedPreKey) error {
 	_, err := r.db.ExecContext(ctx, `
         INSERT INTO signed_prekeys (id, user_id, device_id, key_id, public_key, signature, created_at, is_active)
@@ -115,12 +231,14 @@ func (r *PostgresEncryptionRepository) CreateSignedPreKey(ctx context.Context, k
 	return nil
 }
 
+const signedPreKeyColumns = `
+        id, user_id, device_id, key_id, public_key, signature, created_at, is_active, deactivated_at, rotation_requested_at`
+
 func (r *PostgresEncryptionRepository) GetSignedPreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID, keyID int) (encryption.SignedPreKey, error) {
-	var k encryption.SignedPreKey
-	err := r.db.QueryRowContext(ctx, `
-        SELECT id, user_id, device_id, key_id, public_key, signature, created_at, is_active
+	row := r.db.QueryRowContext(ctx, `SELECT`+signedPreKeyColumns+`
         FROM signed_prekeys WHERE user_id = $1 AND device_id = $2 AND key_id = $3
-    `, userID, deviceID, keyID).Scan(&k.ID, &k.UserID, &k.DeviceID, &k.KeyID, &k.PublicKey, &k.Signature, &k.CreatedAt, &k.IsActive)
+    `, userID, deviceID, keyID)
+	k, err := scanSignedPreKey(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return encryption.SignedPreKey{}, sentinal_errors.ErrNotFound
@@ -131,12 +249,11 @@ func (r *PostgresEncryptionRepository) GetSignedPreKey(ctx context.Context, user
 }
 
 func (r *PostgresEncryptionRepository) GetActiveSignedPreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (encryption.SignedPreKey, error) {
-	var k encryption.SignedPreKey
-	err := r.db.QueryRowContext(ctx, `
-        SELECT id, user_id, device_id, key_id, public_key, signature, created_at, is_active
+	row := r.db.QueryRowContext(ctx, `SELECT`+signedPreKeyColumns+`
         FROM signed_prekeys WHERE user_id = $1 AND device_id = $2 AND is_active = true
         ORDER BY created_at DESC LIMIT 1
-    `, userID, deviceID).Scan(&k.ID, &k.UserID, &k.DeviceID, &k.KeyID, &k.PublicKey, &k.Signature, &k.CreatedAt, &k.IsActive)
+    `, userID, deviceID)
+	k, err := scanSignedPreKey(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return encryption.SignedPreKey{}, sentinal_errors.ErrNotFound
@@ -146,21 +263,39 @@ func (r *PostgresEncryptionRepository) GetActiveSignedPreKey(ctx context.Context
 	return k, nil
 }
 
+// RotateSignedPreKey makes newKey the device's active signed prekey. The keys
+// it replaces are deactivated, not deleted, so they stay available for the
+// grace window.
 func (r *PostgresEncryptionRepository) RotateSignedPreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID, newKey *encryption.SignedPreKey) error {
 	return WithTx(ctx, r.db, func(tx DBTX) error {
-		if _, err := tx.ExecContext(ctx, "UPDATE signed_prekeys SET is_active = false WHERE user_id = $1 AND device_id = $2 AND is_active = true", userID, deviceID); err != nil {
+		if err := NewEncryptionRepository(tx).DeactivateDeviceSignedPreKeys(ctx, userID, deviceID, newKey.CreatedAt); err != nil {
 			return err
 		}
 		_, err := tx.ExecContext(ctx, `
             INSERT INTO signed_prekeys (id, user_id, device_id, key_id, public_key, signature, created_at, is_active)
             VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
         `, newKey.ID, newKey.UserID, newKey.DeviceID, newKey.KeyID, newKey.PublicKey, newKey.Signature, newKey.CreatedAt, newKey.IsActive)
-		return err
+		if err != nil {
+			if isUniqueViolation(err) {
+				return sentinal_errors.ErrAlreadyExists
+			}
+			return err
+		}
+		return nil
 	})
 }
 
+// DeactivateDeviceSignedPreKeys retires the device's active signed prekeys.
+func (r *PostgresEncryptionRepository) DeactivateDeviceSignedPreKeys(ctx context.Context, userID, deviceID uuid.UUID, deactivatedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE signed_prekeys SET is_active = false, deactivated_at = $3
+        WHERE user_id = $1 AND device_id = $2 AND is_active = true
+    `, userID, deviceID, deactivatedAt)
+	return err
+}
+
 func (r *PostgresEncryptionRepository) DeactivateSignedPreKey(ctx context.Context, id uuid.UUID) error {
-	res, err := r.db.ExecContext(ctx, "UPDATE signed_prekeys SET is_active = false WHERE id = $1", id)
+	res, err := r.db.ExecContext(ctx, "UPDATE signed_prekeys SET is_active = false, deactivated_at = COALESCE(deactivated_at, NOW()) WHERE id = $1", id)
 	if err != nil {
 		return err
 	}
@@ -171,6 +306,73 @@ func (r *PostgresEncryptionRepository) DeactivateSignedPreKey(ctx context.Contex
 	return err
 }
 
+// GetStaleSignedPreKeys returns active signed prekeys created before
+// createdBefore whose devices were not asked to rotate them since
+// requestedBefore, oldest first.
+func (r *PostgresEncryptionRepository) GetStaleSignedPreKeys(ctx context.Context, createdBefore, requestedBefore time.Time, limit int) ([]encryption.SignedPreKey, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT`+signedPreKeyColumns+`
+        FROM signed_prekeys
+        WHERE is_active = true AND created_at < $1
+          AND (rotation_requested_at IS NULL OR rotation_requested_at < $2)
+        ORDER BY created_at
+        LIMIT $3
+    `, createdBefore, requestedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []encryption.SignedPreKey
+	for rows.Next() {
+		k, err := scanSignedPreKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresEncryptionRepository) MarkSignedPreKeyRotationRequested(ctx context.Context, id uuid.UUID, requestedAt time.Time) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE signed_prekeys SET rotation_requested_at = $2 WHERE id = $1", id, requestedAt)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+// MarkPreKeysLowWarned records that the device was warned about running low on
+// one-time prekeys, unless it was already warned at or after warnedBefore. It
+// reports whether the warning was recorded.
+func (r *PostgresEncryptionRepository) MarkPreKeysLowWarned(ctx context.Context, deviceID uuid.UUID, warnedAt, warnedBefore time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE devices SET prekeys_low_warned_at = $2
+        WHERE id = $1 AND (prekeys_low_warned_at IS NULL OR prekeys_low_warned_at < $3)
+    `, deviceID, warnedAt, warnedBefore)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// DeleteRetiredSignedPreKeys deletes signed prekeys deactivated before
+// deactivatedBefore and returns how many were deleted.
+func (r *PostgresEncryptionRepository) DeleteRetiredSignedPreKeys(ctx context.Context, deactivatedBefore time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM signed_prekeys WHERE is_active = false AND deactivated_at < $1", deactivatedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (r *PostgresEncryptionRepository) UploadOneTimePreKeys(ctx context.Context, keys []encryption.OneTimePreKey) error {
 	if len(keys) == 0 {
 		return nil
@@ -182,6 +384,9 @@ func (r *PostgresEncryptionRepository) UploadOneTimePreKeys(ctx context.Context,
                 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
             `, k.ID, k.UserID, k.DeviceID, k.KeyID, k.PublicKey, k.UploadedAt, k.ConsumedAt, k.ConsumedBy, k.ConsumedByDeviceID)
 			if err != nil {
+				if isUniqueViolation(err) {
+					return sentinal_errors.ErrAlreadyExists
+				}
 				return err
 			}
 		}
@@ -189,46 +394,60 @@ func (r *PostgresEncryptionRepository) UploadOneTimePreKeys(ctx context.Context,
 	})
 }
 
+// ConsumeOneTimePreKey marks the device's oldest unused one-time prekey as
+// consumed and returns it. Keys locked by a concurrent consumer are skipped, so
+// no key is ever handed out twice.
 func (r *PostgresEncryptionRepository) ConsumeOneTimePreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID, consumedBy uuid.UUID, consumedByDeviceID uuid.UUID) (encryption.OneTimePreKey, error) {
 	var key encryption.OneTimePreKey
-	err := WithTx(ctx, r.db, func(tx DBTX) error {
-		err := tx.QueryRowContext(ctx, `
-            SELECT id, user_id, device_id, key_id, public_key, uploaded_at, consumed_at, consumed_by, consumed_by_device_id
-            FROM onetime_prekeys
+	err := r.db.QueryRowContext(ctx, `
+        UPDATE onetime_prekeys
+        SET consumed_at = $3, consumed_by = $4, consumed_by_device_id = $5
+        WHERE id = (
+            SELECT id FROM onetime_prekeys
             WHERE user_id = $1 AND device_id = $2 AND consumed_at IS NULL
             ORDER BY uploaded_at ASC LIMIT 1
-        `, userID, deviceID).Scan(
-			&key.ID,
-			&key.UserID,
-			&key.DeviceID,
-			&key.KeyID,
-			&key.PublicKey,
-			&key.UploadedAt,
-			&key.ConsumedAt,
-			&key.ConsumedBy,
-			&key.ConsumedByDeviceID,
-		)
-		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return sentinal_errors.ErrNotFound
-			}
-			return err
-		}
-
-		now := time.Now()
-		_, err = tx.ExecContext(ctx, `
-            UPDATE onetime_prekeys
-            SET consumed_at = $1, consumed_by = $2, consumed_by_device_id = $3
-            WHERE id = $4
-        `, now, consumedBy, consumedByDeviceID, key.ID)
-		return err
-	})
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, user_id, device_id, key_id, public_key, uploaded_at, consumed_at, consumed_by, consumed_by_device_id
+    `, userID, deviceID, time.Now(), consumedBy, consumedByDeviceID).Scan(
+		&key.ID,
+		&key.UserID,
+		&key.DeviceID,
+		&key.KeyID,
+		&key.PublicKey,
+		&key.UploadedAt,
+		&key.ConsumedAt,
+		&key.ConsumedBy,
+		&key.ConsumedByDeviceID,
+	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return encryption.OneTimePreKey{}, sentinal_errors.ErrNotFound
+		}
 		return encryption.OneTimePreKey{}, err
 	}
 	return key, nil
 }
 
+// LockPreKeyConsumer serializes the user's one-time prekey consumption until
+// the surrounding transaction ends. It is taken per consumer rather than per
+// device, so a batch that touches many devices cannot deadlock with another.
+func (r *PostgresEncryptionRepository) LockPreKeyConsumer(ctx context.Context, consumedBy uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtextextended($1, 0))", "prekey_consumer:"+consumedBy.String())
+	return err
+}
+
+// CountPreKeysConsumedBy counts the device's one-time prekeys the user has
+// consumed since the given time.
+func (r *PostgresEncryptionRepository) CountPreKeysConsumedBy(ctx context.Context, deviceID, consumedBy uuid.UUID, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COUNT(*) FROM onetime_prekeys
+        WHERE device_id = $1 AND consumed_by = $2 AND consumed_at >= $3
+    `, deviceID, consumedBy, since).Scan(&count)
+	return count, err
+}
+
 func (r *PostgresEncryptionRepository) GetAvailablePreKeyCount(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (int64, error) {
 	var count int64
 	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM onetime_prekeys WHERE user_id = $1 AND device_id = $2 AND consumed_at IS NULL", userID, deviceID).Scan(&count); err != nil {
@@ -249,6 +468,67 @@ func (r *PostgresEncryptionRepository) DeleteConsumedPreKeys(ctx context.Context
 	return rows, nil
 }
 
+// GetBundleDeviceIDs returns the user's active devices that have an active
+// identity key, ordered by ID.
+func (r *PostgresEncryptionRepository) GetBundleDeviceIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT d.id
+        FROM devices d
+        JOIN identity_keys ik ON ik.device_id = d.id AND ik.user_id = d.user_id AND ik.is_active = true
+        WHERE d.user_id = $1 AND d.is_active = true
+        ORDER BY d.id
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetBlockedUserIDs returns those of otherIDs that have blocked the user or
+// that the user has blocked.
+func (r *PostgresEncryptionRepository) GetBlockedUserIDs(ctx context.Context, userID uuid.UUID, otherIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(otherIDs) == 0 {
+		return nil, nil
+	}
+	placeholders := buildPlaceholders(2, len(otherIDs))
+	args := make([]interface{}, 0, len(otherIDs)+1)
+	args = append(args, userID)
+	for _, id := range otherIDs {
+		args = append(args, id)
+	}
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT contact_user_id FROM user_contacts
+        WHERE user_id = $1 AND is_blocked = true AND contact_user_id IN (`+placeholders+`)
+        UNION
+        SELECT user_id FROM user_contacts
+        WHERE contact_user_id = $1 AND is_blocked = true AND user_id IN (`+placeholders+`)
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (r *PostgresEncryptionRepository) HasActiveKeys(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (bool, error) {
 	var count int64
 	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM identity_keys WHERE user_id = $1 AND device_id = $2 AND is_active = true", userID, deviceID).Scan(&count); err != nil {
@@ -256,3 +536,26 @@ func (r *PostgresEncryptionRepository) HasActiveKeys(ctx context.Context, userID
 	}
 	return count > 0, nil
 }
+
+type signedPreKeyScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSignedPreKey(row signedPreKeyScanner) (encryption.SignedPreKey, error) {
+	var k encryption.SignedPreKey
+	if err := row.Scan(
+		&k.ID,
+		&k.UserID,
+		&k.DeviceID,
+		&k.KeyID,
+		&k.PublicKey,
+		&k.Signature,
+		&k.CreatedAt,
+		&k.IsActive,
+		&k.DeactivatedAt,
+		&k.RotationRequestedAt,
+	); err != nil {
+		return encryption.SignedPreKey{}, err
+	}
+	return k, nil
+}
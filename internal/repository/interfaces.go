@@ -3,6 +3,7 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -33,6 +34,7 @@ type UserRepository interface {
 
 	UpdateOnlineStatus(ctx context.Context, userID uuid.UUID, isOnline bool) error
 	UpdateLastSeen(ctx context.Context, userID uuid.UUID, lastSeen time.Time) error
+	GetPresenceAudience(ctx context.Context, userID uuid.UUID, contactsOnly bool) ([]uuid.UUID, error)
 
 	GetUserContacts(ctx context.Context, userID uuid.UUID) ([]user.UserContact, error)
 	AddUserContact(ctx context.Context, c *user.UserContact) error
@@ -69,6 +71,7 @@ type ConversationRepository interface {
 	Create(ctx context.Context, c *conversation.Conversation) error
 	GetByID(ctx context.Context, id uuid.UUID) (conversation.Conversation, error)
 	Update(ctx context.Context, c conversation.Conversation) error
+	UpdateInfo(ctx context.Context, c conversation.Conversation) error
 	Delete(ctx context.Context, id uuid.UUID) error
 
 	GetUserConversations(ctx context.Context, userID uuid.UUID, page, limit int) ([]conversation.Conversation, int64, error)
@@ -97,6 +100,21 @@ type ConversationRepository interface {
 
 	GetConversationSequence(ctx context.Context, conversationID uuid.UUID) (conversation.ConversationSequence, error)
 	IncrementSequence(ctx context.Context, conversationID uuid.UUID) (int64, error)
+
+	GetUserConversationsByLabel(ctx context.Context, userID, labelID uuid.UUID, page, limit int) ([]conversation.Conversation, int64, error)
+	CreateLabel(ctx context.Context, l *conversation.ChatLabel) error
+	GetLabel(ctx context.Context, labelID uuid.UUID) (conversation.ChatLabel, error)
+	GetUserLabels(ctx context.Context, userID uuid.UUID) ([]conversation.ChatLabel, error)
+	UpdateLabel(ctx context.Context, l conversation.ChatLabel) error
+	DeleteLabel(ctx context.Context, labelID, userID uuid.UUID) error
+	ReorderLabels(ctx context.Context, userID uuid.UUID, labelIDs []uuid.UUID) error
+	AssignLabel(ctx context.Context, cl *conversation.ConversationLabel) error
+	UnassignLabel(ctx context.Context, conversationID, labelID, userID uuid.UUID) error
+	GetConversationLabels(ctx context.Context, conversationID, userID uuid.UUID) ([]conversation.ChatLabel, error)
+
+	ClearHistory(ctx context.Context, c *conversation.ConversationClear) error
+	SetDisappearingMode(ctx context.Context, conversationID uuid.UUID, mode string, expirySeconds sql.NullInt32) error
+	SetGroupPermissions(ctx context.Context, conversationID uuid.UUID, permissions string) error
 }
 
 // MessageRepository manages messages and related data.
@@ -105,10 +123,16 @@ type MessageRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (message.Message, error)
 	Update(ctx context.Context, m message.Message) error
 	SoftDelete(ctx context.Context, id uuid.UUID) error
+	Restore(ctx context.Context, id uuid.UUID) error
 	HardDelete(ctx context.Context, id uuid.UUID) error
 	CreateCiphertext(ctx context.Context, c *message.MessageCiphertext) error
+	GetCiphertexts(ctx context.Context, messageID uuid.UUID) ([]message.MessageCiphertext, error)
+	QueueGroupEnvelopes(ctx context.Context, messageID uuid.UUID, senderDeviceID uuid.NullUUID, createdAt time.Time) error
+	DeleteCiphertexts(ctx context.Context, messageID uuid.UUID) error
+	LockByID(ctx context.Context, id uuid.UUID) (message.Message, error)
+	DeleteForUser(ctx context.Context, messageID, userID uuid.UUID) error
 
-	GetConversationMessages(ctx context.Context, conversationID uuid.UUID, beforeSeq int64, limit int, recipientDeviceID uuid.UUID) ([]message.Message, error)
+	GetConversationMessages(ctx context.Context, conversationID uuid.UUID, beforeSeq int64, limit int, recipientDeviceID, userID uuid.UUID) ([]message.Message, error)
 	GetMessagesBySeqRange(ctx context.Context, conversationID uuid.UUID, startSeq, endSeq int64) ([]message.Message, error)
 	GetUnreadMessages(ctx context.Context, conversationID, userID uuid.UUID) ([]message.Message, error)
 	SearchMessages(ctx context.Context, conversationID uuid.UUID, query string, page, limit int) ([]message.Message, int64, error)
@@ -116,6 +140,11 @@ type MessageRepository interface {
 	GetLatestMessage(ctx context.Context, conversationID uuid.UUID) (message.Message, error)
 
 	MarkAsEdited(ctx context.Context, messageID uuid.UUID) error
+	UnmarkEdited(ctx context.Context, messageID uuid.UUID) error
+	CreateVersion(ctx context.Context, v *command.MessageVersion) error
+	GetVersions(ctx context.Context, messageID, recipientDeviceID uuid.UUID) ([]command.MessageVersion, error)
+	GetLatestVersion(ctx context.Context, messageID uuid.UUID) (command.MessageVersion, error)
+	DeleteVersion(ctx context.Context, versionID uuid.UUID) error
 	GetMessageCountSince(ctx context.Context, conversationID uuid.UUID, since time.Time) (int64, error)
 
 	GetByIdempotencyKey(ctx context.Context, key string) (message.Message, error)
@@ -125,6 +154,7 @@ type MessageRepository interface {
 	RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, reactionCode string) error
 	GetMessageReactions(ctx context.Context, messageID uuid.UUID) ([]message.MessageReaction, error)
 	GetUserReaction(ctx context.Context, messageID, userID uuid.UUID) (message.MessageReaction, error)
+	GetReactionSummary(ctx context.Context, messageID, userID uuid.UUID) ([]message.ReactionSummary, error)
 
 	CreateReceipt(ctx context.Context, r *message.MessageReceipt) error
 	UpdateReceipt(ctx context.Context, r message.MessageReceipt) error
@@ -137,34 +167,50 @@ type MessageRepository interface {
 
 	AddMention(ctx context.Context, m *message.MessageMention) error
 	GetMessageMentions(ctx context.Context, messageID uuid.UUID) ([]message.MessageMention, error)
-	GetUserMentions(ctx context.Context, userID uuid.UUID, page, limit int) ([]message.Message, int64, error)
+	GetUserMentions(ctx context.Context, userID, recipientDeviceID uuid.UUID, unreadOnly bool, page, limit int) ([]message.MentionDetails, int64, error)
 
 	StarMessage(ctx context.Context, s *message.StarredMessage) error
 	UnstarMessage(ctx context.Context, userID, messageID uuid.UUID) error
-	GetUserStarredMessages(ctx context.Context, userID uuid.UUID, page, limit int) ([]message.StarredMessage, int64, error)
+	GetUserStarredMessages(ctx context.Context, userID, recipientDeviceID uuid.UUID, page, limit int) ([]message.StarredMessageDetails, int64, error)
 	IsMessageStarred(ctx context.Context, userID, messageID uuid.UUID) (bool, error)
+	PinMessage(ctx context.Context, p *message.PinnedMessage) error
+	UnpinMessage(ctx context.Context, conversationID, messageID uuid.UUID) error
+	GetPinnedMessages(ctx context.Context, conversationID uuid.UUID) ([]message.PinnedMessage, error)
 
 	CreateAttachment(ctx context.Context, a *message.Attachment) error
 	GetAttachmentByID(ctx context.Context, id uuid.UUID) (message.Attachment, error)
 	LinkAttachmentToMessage(ctx context.Context, ma *message.MessageAttachment) error
 	GetMessageAttachments(ctx context.Context, messageID uuid.UUID) ([]message.Attachment, error)
+	GetAttachmentsForMessages(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID][]message.Attachment, error)
 	MarkViewOnceViewed(ctx context.Context, attachmentID uuid.UUID) error
+	GetAttachmentMessageID(ctx context.Context, attachmentID uuid.UUID) (uuid.UUID, error)
+	RecordAttachmentView(ctx context.Context, attachmentID, userID uuid.UUID, viewedAt time.Time) error
+	CountPendingAttachmentViewers(ctx context.Context, attachmentID, conversationID, senderID uuid.UUID, sentAt time.Time) (int64, error)
+	GetViewedAttachmentsToPurge(ctx context.Context, viewedBefore, createdBefore time.Time, limit int) ([]message.Attachment, error)
+	ClearAttachmentObject(ctx context.Context, attachmentID uuid.UUID) error
+	GetOrphanedAttachments(ctx context.Context, createdBefore time.Time, limit int) ([]message.Attachment, error)
+	DeleteAttachment(ctx context.Context, attachmentID uuid.UUID) error
 
 	CreateLinkPreview(ctx context.Context, lp *message.LinkPreview) error
+	UpsertLinkPreview(ctx context.Context, lp *message.LinkPreview) error
 	GetLinkPreviewByHash(ctx context.Context, urlHash string) (message.LinkPreview, error)
 	GetLinkPreviewByID(ctx context.Context, id uuid.UUID) (message.LinkPreview, error)
 
 	CreatePoll(ctx context.Context, p *message.Poll) error
 	GetPollByID(ctx context.Context, id uuid.UUID) (message.Poll, error)
+	LockPoll(ctx context.Context, id uuid.UUID) (message.Poll, error)
+	CloseDuePolls(ctx context.Context, limit int) ([]message.Poll, error)
 	ClosePoll(ctx context.Context, pollID uuid.UUID) error
 	AddPollOption(ctx context.Context, o *message.PollOption) error
 	GetPollOptions(ctx context.Context, pollID uuid.UUID) ([]message.PollOption, error)
 	VotePoll(ctx context.Context, v *message.PollVote) error
 	RemoveVote(ctx context.Context, pollID, optionID, userID uuid.UUID) error
+	RemoveUserVotes(ctx context.Context, pollID, userID uuid.UUID) error
+	GetPollTallies(ctx context.Context, pollID uuid.UUID) ([]message.PollTally, int64, error)
 	GetPollVotes(ctx context.Context, pollID uuid.UUID) ([]message.PollVote, error)
 	GetUserVotes(ctx context.Context, pollID, userID uuid.UUID) ([]message.PollVote, error)
 
-	DeleteExpiredMessages(ctx context.Context) (int64, error)
+	DeleteExpiredMessages(ctx context.Context, now time.Time, limit int) ([]message.Message, error)
 }
 
 type CallRepository interface {
@@ -220,17 +266,32 @@ type EncryptionRepository interface {
 	GetUserIdentityKeys(ctx context.Context, userID uuid.UUID) ([]encryption.IdentityKey, error)
 	DeactivateIdentityKey(ctx context.Context, id uuid.UUID) error
 	DeleteIdentityKey(ctx context.Context, id uuid.UUID) error
+	GetIdentityKeyByID(ctx context.Context, id uuid.UUID) (encryption.IdentityKey, error)
+	CreateIdentityKeyHistory(ctx context.Context, h *encryption.IdentityKeyHistory) error
+	CloseIdentityKeyHistory(ctx context.Context, identityKeyID uuid.UUID, deactivatedAt time.Time, reason string) error
+	GetIdentityKeyHistory(ctx context.Context, userID uuid.UUID, deviceID uuid.NullUUID) ([]encryption.IdentityKeyHistory, error)
+	GetIdentityAudience(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	IsIdentityVisible(ctx context.Context, viewerID, userID uuid.UUID) (bool, error)
 
 	CreateSignedPreKey(ctx context.Context, k *encryption.SignedPreKey) error
 	GetSignedPreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID, keyID int) (encryption.SignedPreKey, error)
 	GetActiveSignedPreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (encryption.SignedPreKey, error)
 	RotateSignedPreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID, newKey *encryption.SignedPreKey) error
 	DeactivateSignedPreKey(ctx context.Context, id uuid.UUID) error
+	GetStaleSignedPreKeys(ctx context.Context, createdBefore, requestedBefore time.Time, limit int) ([]encryption.SignedPreKey, error)
+	MarkSignedPreKeyRotationRequested(ctx context.Context, id uuid.UUID, requestedAt time.Time) error
+	DeactivateDeviceSignedPreKeys(ctx context.Context, userID, deviceID uuid.UUID, deactivatedAt time.Time) error
+	MarkPreKeysLowWarned(ctx context.Context, deviceID uuid.UUID, warnedAt, warnedBefore time.Time) (bool, error)
+	DeleteRetiredSignedPreKeys(ctx context.Context, deactivatedBefore time.Time) (int64, error)
 
 	UploadOneTimePreKeys(ctx context.Context, keys []encryption.OneTimePreKey) error
 	ConsumeOneTimePreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID, consumedBy uuid.UUID, consumedByDeviceID uuid.UUID) (encryption.OneTimePreKey, error)
 	GetAvailablePreKeyCount(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (int64, error)
+	LockPreKeyConsumer(ctx context.Context, consumedBy uuid.UUID) error
+	CountPreKeysConsumedBy(ctx context.Context, deviceID, consumedBy uuid.UUID, since time.Time) (int64, error)
 	DeleteConsumedPreKeys(ctx context.Context, olderThan time.Time) (int64, error)
+	GetBundleDeviceIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	GetBlockedUserIDs(ctx context.Context, userID uuid.UUID, otherIDs []uuid.UUID) ([]uuid.UUID, error)
 
 	HasActiveKeys(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (bool, error)
 }
@@ -266,7 +327,54 @@ type CommandRepository interface {
 	CreateLog(ctx context.Context, log *command.CommandLog) error
 	UpdateLog(ctx context.Context, log *command.CommandLog) error
 	GetLogByID(ctx context.Context, id uuid.UUID) (command.CommandLog, error)
+	LockLog(ctx context.Context, id uuid.UUID) (command.CommandLog, error)
 	GetPendingCommands(ctx context.Context, limit int) ([]command.CommandLog, error)
 	GetCommandsByUser(ctx context.Context, userID uuid.UUID, limit int) ([]command.CommandLog, error)
+	ListCommands(ctx context.Context, userID uuid.UUID, commandType, status string, page, limit int) ([]command.CommandLog, int64, error)
 	CanUndo(ctx context.Context, commandID uuid.UUID, userID uuid.UUID) (bool, error)
 }
+
+// DeliveryRepository tracks which device has fetched which envelope.
+type DeliveryRepository interface {
+	GetPendingEnvelopes(ctx context.Context, deviceID uuid.UUID, limit int) ([]message.Message, error)
+	AcknowledgeEnvelopes(ctx context.Context, userID, deviceID uuid.UUID, messageIDs []uuid.UUID, deliveredAt time.Time) ([]uuid.UUID, error)
+	GetDeliveredToUser(ctx context.Context, userID uuid.UUID, messageIDs []uuid.UUID) ([]message.Message, error)
+	MarkUserDelivered(ctx context.Context, messageID, userID uuid.UUID, deliveredAt time.Time) (bool, error)
+	DeleteDeliveredCiphertexts(ctx context.Context, deliveredBefore time.Time, limit int) (int, error)
+}
+
+// SenderKeyRepository stores group sender keys and their distribution
+// messages, and the epoch that invalidates them on membership changes.
+type SenderKeyRepository interface {
+	GetEpoch(ctx context.Context, conversationID uuid.UUID) (int64, error)
+	BumpEpoch(ctx context.Context, conversationID uuid.UUID) (int64, error)
+	UpsertSenderKey(ctx context.Context, k *encryption.SenderKey) error
+	GetSenderKey(ctx context.Context, conversationID, senderDeviceID uuid.UUID) (encryption.SenderKey, error)
+	UpsertDistribution(ctx context.Context, d *encryption.SenderKeyDistribution) error
+	GetDistributionsForDevice(ctx context.Context, conversationID, recipientDeviceID uuid.UUID) ([]encryption.SenderKeyDistribution, error)
+	GetUndistributedDevices(ctx context.Context, conversationID, senderDeviceID, distributionID uuid.UUID) ([]uuid.UUID, error)
+	DeleteUserKeys(ctx context.Context, conversationID, userID uuid.UUID) error
+}
+
+// SyncRepository reads what changed for a user since a device last synced.
+type SyncRepository interface {
+	GetSequenceStates(ctx context.Context, userID uuid.UUID) ([]conversation.SequenceState, error)
+	GetMessagesAfter(ctx context.Context, conversationID uuid.UUID, afterSeq int64, limit int, recipientDeviceID, userID uuid.UUID) ([]message.Message, error)
+	GetMessagesByIDs(ctx context.Context, ids []uuid.UUID, recipientDeviceID, userID uuid.UUID) ([]message.Message, error)
+	GetChanges(ctx context.Context, userID uuid.UUID, after conversation.ChangeCursor, limit int) ([]conversation.Change, error)
+}
+
+// ScheduledMessageRepository manages messages queued for future delivery.
+type ScheduledMessageRepository interface {
+	Create(ctx context.Context, m *command.ScheduledMessage) error
+	CreateCiphertext(ctx context.Context, c *command.ScheduledMessageCiphertext) error
+	GetByID(ctx context.Context, id uuid.UUID) (command.ScheduledMessage, error)
+	GetCiphertexts(ctx context.Context, scheduledMessageID uuid.UUID) ([]command.ScheduledMessageCiphertext, error)
+	ListBySender(ctx context.Context, senderID uuid.UUID, status string, page, limit int) ([]command.ScheduledMessage, int64, error)
+	Cancel(ctx context.Context, id, senderID uuid.UUID) error
+	Reschedule(ctx context.Context, id, senderID uuid.UUID, scheduledFor time.Time, timezone string) error
+
+	LockNextDue(ctx context.Context, now time.Time) (command.ScheduledMessage, error)
+	MarkSent(ctx context.Context, id, messageID uuid.UUID, sentAt time.Time) error
+	RecordFailure(ctx context.Context, id uuid.UUID, errMsg string, final bool, nextAttemptAt time.Time) error
+}
@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"sentinal-chat/internal/domain/command"
 	"sentinal-chat/internal/domain/message"
 	sentinal_errors "sentinal-chat/pkg/errors"
 
@@ -26,8 +28,8 @@ func (r *PostgresMessageRepository) Create(ctx context.Context, m *message.Messa
         INSERT INTO messages (
             id, conversation_id, sender_id, client_message_id, idempotency_key, seq_id, type, metadata,
             is_forwarded, forwarded_from_msg_id, reply_to_msg_id, poll_id, link_preview_id, mention_count,
-            created_at, edited_at, deleted_at, expires_at
-        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)
+            created_at, edited_at, deleted_at, expires_at, ciphertext, header
+        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20)
     `,
 		m.ID,
 		m.ConversationID,
@@ -47,6 +49,8 @@ func (r *PostgresMessageRepository) Create(ctx context.Context, m *message.Messa
 		m.EditedAt,
 		m.DeletedAt,
 		m.ExpiresAt,
+		m.Ciphertext,
+		sql.NullString{String: m.Header, Valid: m.Header != ""},
 	)
 	if err != nil {
 		if isUniqueViolation(err) {
@@ -80,15 +84,71 @@ func (r *PostgresMessageRepository) CreateCiphertext(ctx context.Context, c *mes
 	return nil
 }
 
+// QueueGroupEnvelopes queues a sender-key group message for every active
+// device of the conversation's participants except the sending one. The rows
+// carry no ciphertext of their own; readers fall back to the message's shared
+// ciphertext, so they only track delivery.
+func (r *PostgresMessageRepository) QueueGroupEnvelopes(ctx context.Context, messageID uuid.UUID, senderDeviceID uuid.NullUUID, createdAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO message_ciphertexts (message_id, recipient_user_id, recipient_device_id, sender_device_id, created_at)
+        SELECT m.id, d.user_id, d.id, $2, $3
+        FROM messages m
+        JOIN participants p ON p.conversation_id = m.conversation_id
+        JOIN devices d ON d.user_id = p.user_id AND d.is_active
+        WHERE m.id = $1 AND ($2::uuid IS NULL OR d.id <> $2)
+        ON CONFLICT (message_id, recipient_device_id) DO NOTHING
+    `, messageID, senderDeviceID, createdAt)
+	return err
+}
+
+// GetCiphertexts returns the per-device ciphertexts of a message. Queue rows of
+// sender-key group messages, which have none, are left out.
+func (r *PostgresMessageRepository) GetCiphertexts(ctx context.Context, messageID uuid.UUID) ([]message.MessageCiphertext, error) {
+	var items []message.MessageCiphertext
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, message_id, recipient_user_id, recipient_device_id, sender_device_id, ciphertext, header::text, created_at, delivered_at
+        FROM message_ciphertexts WHERE message_id = $1 AND ciphertext IS NOT NULL
+    `, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c message.MessageCiphertext
+		if err := rows.Scan(&c.ID, &c.MessageID, &c.RecipientUserID, &c.RecipientDeviceID, &c.SenderDeviceID, &c.Ciphertext, &c.Header, &c.CreatedAt, &c.DeliveredAt); err != nil {
+			return nil, err
+		}
+		items = append(items, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *PostgresMessageRepository) DeleteCiphertexts(ctx context.Context, messageID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM message_ciphertexts WHERE message_id = $1", messageID)
+	return err
+}
+
 func (r *PostgresMessageRepository) GetByID(ctx context.Context, id uuid.UUID) (message.Message, error) {
+	return r.getByID(ctx, id, "")
+}
+
+// LockByID loads a message and holds a row lock on it until the surrounding
+// transaction ends.
+func (r *PostgresMessageRepository) LockByID(ctx context.Context, id uuid.UUID) (message.Message, error) {
+	return r.getByID(ctx, id, " FOR UPDATE")
+}
+
+func (r *PostgresMessageRepository) getByID(ctx context.Context, id uuid.UUID, lockClause string) (message.Message, error) {
 	var m message.Message
-	var metadata sql.NullString
+	var metadata, header sql.NullString
 	err := r.db.QueryRowContext(ctx, `
         SELECT id, conversation_id, sender_id, client_message_id, idempotency_key, seq_id, type, metadata,
                is_forwarded, forwarded_from_msg_id, reply_to_msg_id, poll_id, link_preview_id, mention_count,
-               created_at, edited_at, deleted_at, expires_at
-        FROM messages WHERE id = $1
-    `, id).Scan(
+               created_at, edited_at, deleted_at, expires_at, ciphertext, header::text
+        FROM messages WHERE id = $1`+lockClause, id).Scan(
 		&m.ID,
 		&m.ConversationID,
 		&m.SenderID,
@@ -107,17 +167,17 @@ func (r *PostgresMessageRepository) GetByID(ctx context.Context, id uuid.UUID) (
 		&m.EditedAt,
 		&m.DeletedAt,
 		&m.ExpiresAt,
+		&m.Ciphertext,
+		&header,
 	)
-	if err == nil {
-		m.Metadata = metadata.String
-	}
 	if err != nil {
-
 		if errors.Is(err, sql.ErrNoRows) {
 			return message.Message{}, sentinal_errors.ErrNotFound
 		}
 		return message.Message{}, err
 	}
+	m.Metadata = metadata.String
+	m.Header = header.String
 	return m, nil
 }
 
@@ -169,6 +229,19 @@ func (r *PostgresMessageRepository) SoftDelete(ctx context.Context, id uuid.UUID
 	return err
 }
 
+// Restore clears deleted_at on a soft-deleted message.
+func (r *PostgresMessageRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE messages SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
 func (r *PostgresMessageRepository) HardDelete(ctx context.Context, id uuid.UUID) error {
 	res, err := r.db.ExecContext(ctx, "DELETE FROM messages WHERE id = $1", id)
 	if err != nil {
@@ -181,22 +254,20 @@ func (r *PostgresMessageRepository) HardDelete(ctx context.Context, id uuid.UUID
 	return err
 }
 
-func (r *PostgresMessageRepository) GetConversationMessages(ctx context.Context, conversationID uuid.UUID, beforeSeq int64, limit int, recipientDeviceID uuid.UUID) ([]message.Message, error) {
+// GetConversationMessages returns the messages encrypted for the device, plus
+// server-authored SYSTEM messages, which carry no ciphertext.
+func (r *PostgresMessageRepository) GetConversationMessages(ctx context.Context, conversationID uuid.UUID, beforeSeq int64, limit int, recipientDeviceID, userID uuid.UUID) ([]message.Message, error) {
 	var messages []message.Message
 
-	query := `
-        SELECT m.id, m.conversation_id, m.sender_id, m.client_message_id, m.idempotency_key, m.seq_id, m.type, m.metadata,
-               m.is_forwarded, m.forwarded_from_msg_id, m.reply_to_msg_id, m.poll_id, m.link_preview_id, m.mention_count,
-               m.created_at, m.edited_at, m.deleted_at, m.expires_at,
-               mc.ciphertext, mc.header, mc.recipient_device_id, mc.recipient_user_id, mc.sender_device_id
+	query := `SELECT` + deviceMessageColumns + `
         FROM messages m
-        JOIN message_ciphertexts mc ON mc.message_id = m.id
-        WHERE m.conversation_id = $1 AND m.deleted_at IS NULL AND mc.recipient_device_id = $2
-    `
+        LEFT JOIN message_ciphertexts mc ON mc.message_id = m.id AND mc.recipient_device_id = $2
+        WHERE m.conversation_id = $1 AND m.deleted_at IS NULL AND ` + deviceMessageReadable + `
+    ` + visibleToUserClause("$3")
 
-	args := []interface{}{conversationID, recipientDeviceID}
+	args := []interface{}{conversationID, recipientDeviceID, userID}
 	if beforeSeq > 0 {
-		query += " AND m.seq_id < $3"
+		query += " AND m.seq_id < $4"
 		args = append(args, beforeSeq)
 	}
 	query += fmt.Sprintf(" ORDER BY m.seq_id DESC LIMIT $%d", len(args)+1)
@@ -209,36 +280,10 @@ func (r *PostgresMessageRepository) GetConversationMessages(ctx context.Context,
 	defer rows.Close()
 
 	for rows.Next() {
-		var m message.Message
-		var metadata sql.NullString
-		if err := rows.Scan(
-			&m.ID,
-			&m.ConversationID,
-			&m.SenderID,
-			&m.ClientMessageID,
-			&m.IdempotencyKey,
-			&m.SeqID,
-			&m.Type,
-			&metadata,
-			&m.IsForwarded,
-			&m.ForwardedFromMsgID,
-			&m.ReplyToMsgID,
-			&m.PollID,
-			&m.LinkPreviewID,
-			&m.MentionCount,
-			&m.CreatedAt,
-			&m.EditedAt,
-			&m.DeletedAt,
-			&m.ExpiresAt,
-			&m.Ciphertext,
-			&m.Header,
-			&m.RecipientDeviceID,
-			&m.RecipientUserID,
-			&m.SenderDeviceID,
-		); err != nil {
+		m, err := scanDeviceMessage(rows)
+		if err != nil {
 			return nil, err
 		}
-		m.Metadata = metadata.String
 		messages = append(messages, m)
 	}
 	if err := rows.Err(); err != nil {
@@ -247,6 +292,33 @@ func (r *PostgresMessageRepository) GetConversationMessages(ctx context.Context,
 	return messages, nil
 }
 
+// DeleteForUser hides a message from one user while other participants keep it.
+func (r *PostgresMessageRepository) DeleteForUser(ctx context.Context, messageID, userID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO message_user_states (message_id, user_id, is_deleted, deleted_at)
+        VALUES ($1, $2, true, $3)
+        ON CONFLICT (message_id, user_id) DO UPDATE SET is_deleted = true, deleted_at = EXCLUDED.deleted_at
+    `, messageID, userID, time.Now())
+	return err
+}
+
+// visibleToUserClause filters out messages the user deleted for themselves or
+// cleared from the conversation, and disappearing messages past their expiry
+// that the sweeper has not removed yet. It expects messages aliased as m;
+// userExpr is the placeholder or column holding the user's ID.
+func visibleToUserClause(userExpr string) string {
+	return `
+        AND (m.expires_at IS NULL OR m.expires_at > NOW())
+        AND NOT EXISTS (
+            SELECT 1 FROM message_user_states mus
+            WHERE mus.message_id = m.id AND mus.user_id = ` + userExpr + ` AND mus.is_deleted
+        )
+        AND NOT EXISTS (
+            SELECT 1 FROM conversation_clears cc
+            WHERE cc.conversation_id = m.conversation_id AND cc.user_id = ` + userExpr + ` AND m.created_at <= cc.cleared_at
+        )`
+}
+
 func (r *PostgresMessageRepository) GetMessagesBySeqRange(ctx context.Context, conversationID uuid.UUID, startSeq, endSeq int64) ([]message.Message, error) {
 	var messages []message.Message
 	rows, err := r.db.QueryContext(ctx, `
@@ -305,7 +377,7 @@ func (r *PostgresMessageRepository) GetUnreadMessages(ctx context.Context, conve
         FROM messages m
         WHERE m.conversation_id = $1 AND m.sender_id != $2 AND m.deleted_at IS NULL AND NOT EXISTS (
             SELECT 1 FROM message_receipts r WHERE r.message_id = m.id AND r.user_id = $2 AND r.read_at IS NOT NULL
-        )
+        )`+visibleToUserClause("$2")+`
         ORDER BY m.seq_id ASC
     `, conversationID, userID)
 	if err != nil {
@@ -457,6 +529,18 @@ func (r *PostgresMessageRepository) MarkAsEdited(ctx context.Context, messageID
 	return err
 }
 
+func (r *PostgresMessageRepository) UnmarkEdited(ctx context.Context, messageID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "UPDATE messages SET edited_at = NULL WHERE id = $1", messageID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
 func (r *PostgresMessageRepository) GetMessageCountSince(ctx context.Context, conversationID uuid.UUID, since time.Time) (int64, error) {
 	var count int64
 	if err := r.db.QueryRowContext(ctx, `
@@ -614,6 +698,32 @@ func (r *PostgresMessageRepository) GetUserReaction(ctx context.Context, message
 	return reaction, nil
 }
 
+func (r *PostgresMessageRepository) GetReactionSummary(ctx context.Context, messageID, userID uuid.UUID) ([]message.ReactionSummary, error) {
+	var summary []message.ReactionSummary
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT reaction_code, COUNT(*), BOOL_OR(user_id = $2)
+        FROM message_reactions
+        WHERE message_id = $1
+        GROUP BY reaction_code
+        ORDER BY COUNT(*) DESC, MIN(created_at) ASC
+    `, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item message.ReactionSummary
+		if err := rows.Scan(&item.ReactionCode, &item.Count, &item.ReactedByMe); err != nil {
+			return nil, err
+		}
+		summary = append(summary, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
 func (r *PostgresMessageRepository) CreateReceipt(ctx context.Context, receipt *message.MessageReceipt) error {
 	_, err := r.db.ExecContext(ctx, `
         INSERT INTO message_receipts (message_id, user_id, status, delivered_at, read_at, played_at, updated_at)
@@ -821,64 +931,55 @@ func (r *PostgresMessageRepository) GetMessageMentions(ctx context.Context, mess
 	return mentions, nil
 }
 
-func (r *PostgresMessageRepository) GetUserMentions(ctx context.Context, userID uuid.UUID, page, limit int) ([]message.Message, int64, error) {
-	var messages []message.Message
+// GetUserMentions returns messages mentioning the user joined with the
+// ciphertext addressed to recipientDeviceID, newest first, with their read state.
+func (r *PostgresMessageRepository) GetUserMentions(ctx context.Context, userID, recipientDeviceID uuid.UUID, unreadOnly bool, page, limit int) ([]message.MentionDetails, int64, error) {
+	var mentions []message.MentionDetails
 	var total int64
 
-	if err := r.db.QueryRowContext(ctx, `
-        SELECT COUNT(*) FROM messages
-        WHERE id IN (SELECT message_id FROM message_mentions WHERE user_id = $1) AND deleted_at IS NULL
-    `, userID).Scan(&total); err != nil {
+	where := `
+        FROM messages m
+        LEFT JOIN message_ciphertexts mc ON mc.message_id = m.id AND mc.recipient_device_id = $2
+        WHERE m.id IN (SELECT message_id FROM message_mentions WHERE user_id = $1) AND m.deleted_at IS NULL
+          AND ` + deviceMessageReadable +
+		visibleToUserClause("$1")
+	if unreadOnly {
+		where += " AND NOT " + mentionReadClause
+	}
+
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*)"+where, userID, recipientDeviceID).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
 	offset := (page - 1) * limit
-	rows, err := r.db.QueryContext(ctx, `
-        SELECT id, conversation_id, sender_id, client_message_id, idempotency_key, seq_id, type, metadata,
-               is_forwarded, forwarded_from_msg_id, reply_to_msg_id, poll_id, link_preview_id, mention_count,
-               created_at, edited_at, deleted_at, expires_at
-        FROM messages
-        WHERE id IN (SELECT message_id FROM message_mentions WHERE user_id = $1) AND deleted_at IS NULL
-        ORDER BY created_at DESC
-        OFFSET $2 LIMIT $3
-    `, userID, offset, limit)
+	rows, err := r.db.QueryContext(ctx, `SELECT`+deviceMessageColumns+`,
+        `+mentionReadClause+where+`
+        ORDER BY m.created_at DESC
+        OFFSET $3 LIMIT $4
+    `, userID, recipientDeviceID, offset, limit)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var m message.Message
-		if err := rows.Scan(
-			&m.ID,
-			&m.ConversationID,
-			&m.SenderID,
-			&m.ClientMessageID,
-			&m.IdempotencyKey,
-			&m.SeqID,
-			&m.Type,
-			&m.Metadata,
-			&m.IsForwarded,
-			&m.ForwardedFromMsgID,
-			&m.ReplyToMsgID,
-			&m.PollID,
-			&m.LinkPreviewID,
-			&m.MentionCount,
-			&m.CreatedAt,
-			&m.EditedAt,
-			&m.DeletedAt,
-			&m.ExpiresAt,
-		); err != nil {
+		var d message.MentionDetails
+		if d.Message, err = scanDeviceMessage(rows, &d.IsRead); err != nil {
 			return nil, 0, err
 		}
-		messages = append(messages, m)
+		mentions = append(mentions, d)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, 0, err
 	}
-	return messages, total, nil
+	return mentions, total, nil
 }
 
+// mentionReadClause is true when the user ($1) has a read receipt for m.
+const mentionReadClause = `EXISTS (
+            SELECT 1 FROM message_receipts r WHERE r.message_id = m.id AND r.user_id = $1 AND r.read_at IS NOT NULL
+        )`
+
 func (r *PostgresMessageRepository) StarMessage(ctx context.Context, s *message.StarredMessage) error {
 	_, err := r.db.ExecContext(ctx, `
         INSERT INTO starred_messages (user_id, message_id, starred_at)
@@ -905,31 +1006,39 @@ func (r *PostgresMessageRepository) UnstarMessage(ctx context.Context, userID, m
 	return err
 }
 
-func (r *PostgresMessageRepository) GetUserStarredMessages(ctx context.Context, userID uuid.UUID, page, limit int) ([]message.StarredMessage, int64, error) {
-	var starred []message.StarredMessage
+// GetUserStarredMessages returns the user's starred messages joined with the
+// ciphertext addressed to recipientDeviceID, most recently starred first.
+func (r *PostgresMessageRepository) GetUserStarredMessages(ctx context.Context, userID, recipientDeviceID uuid.UUID, page, limit int) ([]message.StarredMessageDetails, int64, error) {
+	var starred []message.StarredMessageDetails
 	var total int64
-	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM starred_messages WHERE user_id = $1", userID).Scan(&total); err != nil {
+
+	where := `
+        FROM starred_messages s
+        JOIN messages m ON m.id = s.message_id
+        LEFT JOIN message_ciphertexts mc ON mc.message_id = m.id AND mc.recipient_device_id = $2
+        WHERE s.user_id = $1 AND m.deleted_at IS NULL AND ` + deviceMessageReadable + visibleToUserClause("$1")
+
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*)"+where, userID, recipientDeviceID).Scan(&total); err != nil {
 		return nil, 0, err
 	}
 
 	offset := (page - 1) * limit
-	rows, err := r.db.QueryContext(ctx, `
-        SELECT user_id, message_id, starred_at
-        FROM starred_messages
-        WHERE user_id = $1
-        ORDER BY starred_at DESC
-        OFFSET $2 LIMIT $3
-    `, userID, offset, limit)
+	rows, err := r.db.QueryContext(ctx, `SELECT`+deviceMessageColumns+`,
+        s.starred_at`+where+`
+        ORDER BY s.starred_at DESC
+        OFFSET $3 LIMIT $4
+    `, userID, recipientDeviceID, offset, limit)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer rows.Close()
+
 	for rows.Next() {
-		var s message.StarredMessage
-		if err := rows.Scan(&s.UserID, &s.MessageID, &s.StarredAt); err != nil {
+		var d message.StarredMessageDetails
+		if d.Message, err = scanDeviceMessage(rows, &d.StarredAt); err != nil {
 			return nil, 0, err
 		}
-		starred = append(starred, s)
+		starred = append(starred, d)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, 0, err
@@ -945,12 +1054,72 @@ func (r *PostgresMessageRepository) IsMessageStarred(ctx context.Context, userID
 	return count > 0, nil
 }
 
+func (r *PostgresMessageRepository) PinMessage(ctx context.Context, p *message.PinnedMessage) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO pinned_messages (conversation_id, message_id, pinned_by, pinned_at)
+        VALUES ($1,$2,$3,$4)
+    `, p.ConversationID, p.MessageID, p.PinnedBy, p.PinnedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return sentinal_errors.ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresMessageRepository) UnpinMessage(ctx context.Context, conversationID, messageID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM pinned_messages WHERE conversation_id = $1 AND message_id = $2", conversationID, messageID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+// GetPinnedMessages returns the conversation's pins, most recent first. Pins of
+// deleted or expired messages are left out.
+func (r *PostgresMessageRepository) GetPinnedMessages(ctx context.Context, conversationID uuid.UUID) ([]message.PinnedMessage, error) {
+	var pinned []message.PinnedMessage
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT p.conversation_id, p.message_id, p.pinned_by, p.pinned_at
+        FROM pinned_messages p
+        JOIN messages m ON m.id = p.message_id
+        WHERE p.conversation_id = $1 AND m.deleted_at IS NULL
+          AND (m.expires_at IS NULL OR m.expires_at > NOW())
+        ORDER BY p.pinned_at DESC
+    `, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p message.PinnedMessage
+		if err := rows.Scan(&p.ConversationID, &p.MessageID, &p.PinnedBy, &p.PinnedAt); err != nil {
+			return nil, err
+		}
+		pinned = append(pinned, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
+
+const attachmentColumns = `
+        a.id, a.uploader_id, a.url, a.filename, a.mime_type, a.size_bytes, a.view_once, a.viewed_at,
+        a.thumbnail_url, a.width, a.height, a.duration_seconds, a.encryption_key_hash, a.encryption_iv,
+        a.upload_session_id, a.object_key, a.created_at`
+
 func (r *PostgresMessageRepository) CreateAttachment(ctx context.Context, a *message.Attachment) error {
 	_, err := r.db.ExecContext(ctx, `
         INSERT INTO attachments (
             id, uploader_id, url, filename, mime_type, size_bytes, view_once, viewed_at, thumbnail_url,
-            width, height, duration_seconds, encryption_key_hash, encryption_iv, created_at
-        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+            width, height, duration_seconds, encryption_key_hash, encryption_iv, upload_session_id, object_key, created_at
+        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)
     `,
 		a.ID,
 		a.UploaderID,
@@ -966,34 +1135,24 @@ func (r *PostgresMessageRepository) CreateAttachment(ctx context.Context, a *mes
 		a.DurationSeconds,
 		a.EncryptionKeyHash,
 		a.EncryptionIV,
+		a.UploadSessionID,
+		a.ObjectKey,
 		a.CreatedAt,
 	)
-	return err
+	if err != nil {
+		if isUniqueViolation(err) {
+			return sentinal_errors.ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
 }
 
 func (r *PostgresMessageRepository) GetAttachmentByID(ctx context.Context, id uuid.UUID) (message.Attachment, error) {
-	var a message.Attachment
-	err := r.db.QueryRowContext(ctx, `
-        SELECT id, uploader_id, url, filename, mime_type, size_bytes, view_once, viewed_at, thumbnail_url,
-               width, height, duration_seconds, encryption_key_hash, encryption_iv, created_at
-        FROM attachments WHERE id = $1
-    `, id).Scan(
-		&a.ID,
-		&a.UploaderID,
-		&a.URL,
-		&a.Filename,
-		&a.MimeType,
-		&a.SizeBytes,
-		&a.ViewOnce,
-		&a.ViewedAt,
-		&a.ThumbnailURL,
-		&a.Width,
-		&a.Height,
-		&a.DurationSeconds,
-		&a.EncryptionKeyHash,
-		&a.EncryptionIV,
-		&a.CreatedAt,
-	)
+	row := r.db.QueryRowContext(ctx, `SELECT`+attachmentColumns+`
+        FROM attachments a WHERE a.id = $1
+    `, id)
+	a, err := scanAttachment(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return message.Attachment{}, sentinal_errors.ErrNotFound
@@ -1019,35 +1178,18 @@ func (r *PostgresMessageRepository) LinkAttachmentToMessage(ctx context.Context,
 
 func (r *PostgresMessageRepository) GetMessageAttachments(ctx context.Context, messageID uuid.UUID) ([]message.Attachment, error) {
 	var attachments []message.Attachment
-	rows, err := r.db.QueryContext(ctx, `
-        SELECT a.id, a.uploader_id, a.url, a.filename, a.mime_type, a.size_bytes, a.view_once, a.viewed_at,
-               a.thumbnail_url, a.width, a.height, a.duration_seconds, a.encryption_key_hash, a.encryption_iv, a.created_at
+	rows, err := r.db.QueryContext(ctx, `SELECT`+attachmentColumns+`
         FROM attachments a
         WHERE a.id IN (SELECT attachment_id FROM message_attachments WHERE message_id = $1)
+        ORDER BY a.created_at ASC
     `, messageID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var a message.Attachment
-		if err := rows.Scan(
-			&a.ID,
-			&a.UploaderID,
-			&a.URL,
-			&a.Filename,
-			&a.MimeType,
-			&a.SizeBytes,
-			&a.ViewOnce,
-			&a.ViewedAt,
-			&a.ThumbnailURL,
-			&a.Width,
-			&a.Height,
-			&a.DurationSeconds,
-			&a.EncryptionKeyHash,
-			&a.EncryptionIV,
-			&a.CreatedAt,
-		); err != nil {
+		a, err := scanAttachment(rows)
+		if err != nil {
 			return nil, err
 		}
 		attachments = append(attachments, a)
@@ -1058,6 +1200,45 @@ func (r *PostgresMessageRepository) GetMessageAttachments(ctx context.Context, m
 	return attachments, nil
 }
 
+// GetAttachmentsForMessages loads the attachments of several messages in one
+// query, keyed by message ID. Messages without attachments are absent from the map.
+func (r *PostgresMessageRepository) GetAttachmentsForMessages(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID][]message.Attachment, error) {
+	result := make(map[uuid.UUID][]message.Attachment)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := make([]string, len(messageIDs))
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT ma.message_id,`+attachmentColumns+`
+        FROM message_attachments ma
+        JOIN attachments a ON a.id = ma.attachment_id
+        WHERE ma.message_id IN (`+strings.Join(placeholders, ",")+`)
+        ORDER BY a.created_at ASC
+    `, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var messageID uuid.UUID
+		a, err := scanAttachment(rows, &messageID)
+		if err != nil {
+			return nil, err
+		}
+		result[messageID] = append(result[messageID], a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (r *PostgresMessageRepository) MarkViewOnceViewed(ctx context.Context, attachmentID uuid.UUID) error {
 	res, err := r.db.ExecContext(ctx, `
         UPDATE attachments SET viewed_at = $1 WHERE id = $2 AND view_once = true
@@ -1072,6 +1253,147 @@ func (r *PostgresMessageRepository) MarkViewOnceViewed(ctx context.Context, atta
 	return err
 }
 
+// GetAttachmentMessageID returns the message an attachment was sent with.
+func (r *PostgresMessageRepository) GetAttachmentMessageID(ctx context.Context, attachmentID uuid.UUID) (uuid.UUID, error) {
+	var messageID uuid.UUID
+	err := r.db.QueryRowContext(ctx, `
+        SELECT ma.message_id
+        FROM message_attachments ma
+        JOIN messages m ON m.id = ma.message_id
+        WHERE ma.attachment_id = $1
+        ORDER BY m.created_at ASC
+        LIMIT 1
+    `, attachmentID).Scan(&messageID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return uuid.Nil, sentinal_errors.ErrNotFound
+		}
+		return uuid.Nil, err
+	}
+	return messageID, nil
+}
+
+// RecordAttachmentView stores a user's single view of a view-once attachment.
+// It returns ErrAlreadyExists if the user has viewed it before.
+func (r *PostgresMessageRepository) RecordAttachmentView(ctx context.Context, attachmentID, userID uuid.UUID, viewedAt time.Time) error {
+	res, err := r.db.ExecContext(ctx, `
+        INSERT INTO attachment_views (attachment_id, user_id, viewed_at)
+        VALUES ($1,$2,$3)
+        ON CONFLICT (attachment_id, user_id) DO NOTHING
+    `, attachmentID, userID, viewedAt)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrAlreadyExists
+	}
+	return err
+}
+
+// CountPendingAttachmentViewers counts the recipients of the message, i.e. the
+// participants other than the sender who had joined by sentAt, that have not
+// viewed the attachment yet. Members who joined later never received it.
+func (r *PostgresMessageRepository) CountPendingAttachmentViewers(ctx context.Context, attachmentID, conversationID, senderID uuid.UUID, sentAt time.Time) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, `
+        SELECT COUNT(*)
+        FROM participants p
+        WHERE p.conversation_id = $1 AND p.user_id <> $2 AND p.joined_at <= $4
+          AND NOT EXISTS (
+              SELECT 1 FROM attachment_views av
+              WHERE av.attachment_id = $3 AND av.user_id = p.user_id
+          )
+    `, conversationID, senderID, attachmentID, sentAt).Scan(&count)
+	return count, err
+}
+
+// GetViewedAttachmentsToPurge returns view-once attachments whose object is
+// still stored and that either every recipient viewed before viewedBefore or
+// were created before createdBefore, viewed or not.
+func (r *PostgresMessageRepository) GetViewedAttachmentsToPurge(ctx context.Context, viewedBefore, createdBefore time.Time, limit int) ([]message.Attachment, error) {
+	var attachments []message.Attachment
+	rows, err := r.db.QueryContext(ctx, `SELECT`+attachmentColumns+`
+        FROM attachments a
+        WHERE a.view_once = true AND a.object_key IS NOT NULL
+          AND ((a.viewed_at IS NOT NULL AND a.viewed_at < $1) OR a.created_at < $2)
+        ORDER BY COALESCE(a.viewed_at, a.created_at) ASC
+        LIMIT $3
+    `, viewedBefore, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// GetOrphanedAttachments returns attachments no longer linked to any message,
+// e.g. because their messages expired. createdBefore leaves alone attachments
+// that are still being linked by an in-flight send.
+func (r *PostgresMessageRepository) GetOrphanedAttachments(ctx context.Context, createdBefore time.Time, limit int) ([]message.Attachment, error) {
+	var attachments []message.Attachment
+	rows, err := r.db.QueryContext(ctx, `SELECT`+attachmentColumns+`
+        FROM attachments a
+        WHERE a.created_at < $1
+          AND NOT EXISTS (SELECT 1 FROM message_attachments ma WHERE ma.attachment_id = a.id)
+        ORDER BY a.created_at ASC
+        LIMIT $2
+    `, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func (r *PostgresMessageRepository) DeleteAttachment(ctx context.Context, attachmentID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM attachments WHERE id = $1", attachmentID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+// ClearAttachmentObject forgets the stored object of an attachment once it has
+// been deleted from S3.
+func (r *PostgresMessageRepository) ClearAttachmentObject(ctx context.Context, attachmentID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE attachments SET object_key = NULL, url = '' WHERE id = $1
+    `, attachmentID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
 func (r *PostgresMessageRepository) CreateLinkPreview(ctx context.Context, lp *message.LinkPreview) error {
 	_, err := r.db.ExecContext(ctx, `
         INSERT INTO link_previews (id, url, url_hash, title, description, image_url, site_name, fetched_at)
@@ -1086,6 +1408,23 @@ func (r *PostgresMessageRepository) CreateLinkPreview(ctx context.Context, lp *m
 	return nil
 }
 
+// UpsertLinkPreview stores a freshly fetched preview, replacing the cached one
+// for the same URL hash. lp.ID is set to the ID of the stored row.
+func (r *PostgresMessageRepository) UpsertLinkPreview(ctx context.Context, lp *message.LinkPreview) error {
+	return r.db.QueryRowContext(ctx, `
+        INSERT INTO link_previews (id, url, url_hash, title, description, image_url, site_name, fetched_at)
+        VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+        ON CONFLICT (url_hash) DO UPDATE SET
+            url = EXCLUDED.url,
+            title = EXCLUDED.title,
+            description = EXCLUDED.description,
+            image_url = EXCLUDED.image_url,
+            site_name = EXCLUDED.site_name,
+            fetched_at = EXCLUDED.fetched_at
+        RETURNING id
+    `, lp.ID, lp.URL, lp.URLHash, lp.Title, lp.Description, lp.ImageURL, lp.SiteName, lp.FetchedAt).Scan(&lp.ID)
+}
+
 func (r *PostgresMessageRepository) GetLinkPreviewByHash(ctx context.Context, urlHash string) (message.LinkPreview, error) {
 	var lp message.LinkPreview
 	err := r.db.QueryRowContext(ctx, `
@@ -1136,18 +1475,18 @@ func (r *PostgresMessageRepository) GetLinkPreviewByID(ctx context.Context, id u
 
 func (r *PostgresMessageRepository) CreatePoll(ctx context.Context, p *message.Poll) error {
 	_, err := r.db.ExecContext(ctx, `
-        INSERT INTO polls (id, message_id, question, allows_multiple, closes_at, created_at)
-        VALUES ($1,$2,$3,$4,$5,$6)
-    `, p.ID, p.MessageID, p.Question, p.AllowsMultiple, p.ClosesAt, p.CreatedAt)
+        INSERT INTO polls (id, message_id, question, allows_multiple, closes_at, closed_at, created_at)
+        VALUES ($1,$2,$3,$4,$5,$6,$7)
+    `, p.ID, p.MessageID, p.Question, p.AllowsMultiple, p.ClosesAt, p.ClosedAt, p.CreatedAt)
 	return err
 }
 
 func (r *PostgresMessageRepository) GetPollByID(ctx context.Context, id uuid.UUID) (message.Poll, error) {
 	var p message.Poll
 	err := r.db.QueryRowContext(ctx, `
-        SELECT id, message_id, question, allows_multiple, closes_at, created_at
+        SELECT id, message_id, question, allows_multiple, closes_at, closed_at, created_at
         FROM polls WHERE id = $1
-    `, id).Scan(&p.ID, &p.MessageID, &p.Question, &p.AllowsMultiple, &p.ClosesAt, &p.CreatedAt)
+    `, id).Scan(&p.ID, &p.MessageID, &p.Question, &p.AllowsMultiple, &p.ClosesAt, &p.ClosedAt, &p.CreatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return message.Poll{}, sentinal_errors.ErrNotFound
@@ -1157,8 +1496,57 @@ func (r *PostgresMessageRepository) GetPollByID(ctx context.Context, id uuid.UUI
 	return p, nil
 }
 
+// LockPoll loads a poll with a row lock; it must be called inside a transaction.
+func (r *PostgresMessageRepository) LockPoll(ctx context.Context, id uuid.UUID) (message.Poll, error) {
+	var p message.Poll
+	err := r.db.QueryRowContext(ctx, `
+        SELECT id, message_id, question, allows_multiple, closes_at, closed_at, created_at
+        FROM polls WHERE id = $1
+        FOR UPDATE
+    `, id).Scan(&p.ID, &p.MessageID, &p.Question, &p.AllowsMultiple, &p.ClosesAt, &p.ClosedAt, &p.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return message.Poll{}, sentinal_errors.ErrNotFound
+		}
+		return message.Poll{}, err
+	}
+	return p, nil
+}
+
+// CloseDuePolls marks polls whose closes_at has passed as closed and returns them.
+// Rows locked by another worker are skipped so each poll is finalized once.
+func (r *PostgresMessageRepository) CloseDuePolls(ctx context.Context, limit int) ([]message.Poll, error) {
+	var polls []message.Poll
+	rows, err := r.db.QueryContext(ctx, `
+        UPDATE polls SET closed_at = NOW()
+        WHERE id IN (
+            SELECT id FROM polls
+            WHERE closed_at IS NULL AND closes_at IS NOT NULL AND closes_at <= NOW()
+            ORDER BY closes_at ASC
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, message_id, question, allows_multiple, closes_at, closed_at, created_at
+    `, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p message.Poll
+		if err := rows.Scan(&p.ID, &p.MessageID, &p.Question, &p.AllowsMultiple, &p.ClosesAt, &p.ClosedAt, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		polls = append(polls, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return polls, nil
+}
+
 func (r *PostgresMessageRepository) ClosePoll(ctx context.Context, pollID uuid.UUID) error {
-	res, err := r.db.ExecContext(ctx, "UPDATE polls SET closes_at = $1 WHERE id = $2", time.Now(), pollID)
+	res, err := r.db.ExecContext(ctx, "UPDATE polls SET closed_at = $1 WHERE id = $2 AND closed_at IS NULL", time.Now(), pollID)
 	if err != nil {
 		return err
 	}
@@ -1227,6 +1615,50 @@ func (r *PostgresMessageRepository) RemoveVote(ctx context.Context, pollID, opti
 	return err
 }
 
+func (r *PostgresMessageRepository) RemoveUserVotes(ctx context.Context, pollID, userID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM poll_votes WHERE poll_id = $1 AND user_id = $2", pollID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+func (r *PostgresMessageRepository) GetPollTallies(ctx context.Context, pollID uuid.UUID) ([]message.PollTally, int64, error) {
+	var tallies []message.PollTally
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT po.id, COUNT(pv.user_id)
+        FROM poll_options po
+        LEFT JOIN poll_votes pv ON pv.option_id = po.id
+        WHERE po.poll_id = $1
+        GROUP BY po.id, po.position
+        ORDER BY po.position ASC
+    `, pollID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t message.PollTally
+		if err := rows.Scan(&t.OptionID, &t.Votes); err != nil {
+			return nil, 0, err
+		}
+		tallies = append(tallies, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var voters int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(DISTINCT user_id) FROM poll_votes WHERE poll_id = $1", pollID).Scan(&voters); err != nil {
+		return nil, 0, err
+	}
+	return tallies, voters, nil
+}
+
 func (r *PostgresMessageRepository) GetPollVotes(ctx context.Context, pollID uuid.UUID) ([]message.PollVote, error) {
 	var votes []message.PollVote
 	rows, err := r.db.QueryContext(ctx, `
@@ -1273,18 +1705,261 @@ func (r *PostgresMessageRepository) GetUserVotes(ctx context.Context, pollID, us
 	return votes, nil
 }
 
-func (r *PostgresMessageRepository) DeleteExpiredMessages(ctx context.Context) (int64, error) {
-	res, err := r.db.ExecContext(ctx, "DELETE FROM messages WHERE expires_at IS NOT NULL AND expires_at < NOW()")
+// DeleteExpiredMessages deletes up to limit messages whose expiry has passed and
+// returns them. Ciphertexts, receipts and attachment links cascade; replies and
+// forwards of an expired message keep existing but lose the reference. Rows
+// locked by another sweeper are skipped, so callers should run this in a
+// transaction to keep the lock until the delete commits.
+func (r *PostgresMessageRepository) DeleteExpiredMessages(ctx context.Context, now time.Time, limit int) ([]message.Message, error) {
+	var expired []message.Message
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, conversation_id, sender_id, seq_id, expires_at
+        FROM messages
+        WHERE expires_at IS NOT NULL AND expires_at <= $1
+        ORDER BY expires_at ASC
+        LIMIT $2
+        FOR UPDATE SKIP LOCKED
+    `, now, limit)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	rows, err := res.RowsAffected()
+	defer rows.Close()
+	for rows.Next() {
+		var m message.Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.SeqID, &m.ExpiresAt); err != nil {
+			return nil, err
+		}
+		expired = append(expired, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(expired))
+	args := make([]interface{}, len(expired))
+	for i, m := range expired {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = m.ID
+	}
+	in := strings.Join(placeholders, ",")
+
+	if _, err := r.db.ExecContext(ctx, "UPDATE messages SET reply_to_msg_id = NULL WHERE reply_to_msg_id IN ("+in+")", args...); err != nil {
+		return nil, err
+	}
+	if _, err := r.db.ExecContext(ctx, "UPDATE messages SET forwarded_from_msg_id = NULL WHERE forwarded_from_msg_id IN ("+in+")", args...); err != nil {
+		return nil, err
+	}
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM messages WHERE id IN ("+in+")", args...); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// CreateVersion appends a version with the next version number for the
+// message. Callers should hold the message row lock so numbers stay dense.
+func (r *PostgresMessageRepository) CreateVersion(ctx context.Context, v *command.MessageVersion) error {
+	err := r.db.QueryRowContext(ctx, `
+        INSERT INTO message_versions (id, message_id, content, edited_by, edited_at, version_number)
+        SELECT $1, $2, $3, $4, $5, COALESCE(MAX(version_number), 0) + 1
+        FROM message_versions WHERE message_id = $2
+        RETURNING version_number
+    `, v.ID, v.MessageID, sql.NullString{String: v.Content, Valid: v.Content != ""}, v.EditedBy, v.EditedAt).Scan(&v.VersionNumber)
 	if err != nil {
-		return 0, err
+		if isUniqueViolation(err) {
+			return sentinal_errors.ErrConflict
+		}
+		return err
+	}
+	for i := range v.Ciphertexts {
+		c := &v.Ciphertexts[i]
+		c.VersionID = v.ID
+		if _, err := r.db.ExecContext(ctx, `
+            INSERT INTO message_version_ciphertexts (id, version_id, recipient_user_id, recipient_device_id, sender_device_id, ciphertext, header, created_at)
+            VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+        `, c.ID, c.VersionID, c.RecipientUserID, c.RecipientDeviceID, c.SenderDeviceID, c.Ciphertext, c.Header, c.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetVersions returns the edit history of a message, newest first, limited to
+// versions that carry a ciphertext for recipientDeviceID.
+func (r *PostgresMessageRepository) GetVersions(ctx context.Context, messageID, recipientDeviceID uuid.UUID) ([]command.MessageVersion, error) {
+	var versions []command.MessageVersion
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT v.id, v.message_id, v.edited_by, v.edited_at, v.version_number,
+               c.id, c.recipient_user_id, c.recipient_device_id, c.sender_device_id, c.ciphertext, c.header::text, c.created_at
+        FROM message_versions v
+        JOIN message_version_ciphertexts c ON c.version_id = v.id AND c.recipient_device_id = $2
+        WHERE v.message_id = $1
+        ORDER BY v.version_number DESC
+    `, messageID, recipientDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v command.MessageVersion
+		var c command.MessageVersionCiphertext
+		if err := rows.Scan(
+			&v.ID, &v.MessageID, &v.EditedBy, &v.EditedAt, &v.VersionNumber,
+			&c.ID, &c.RecipientUserID, &c.RecipientDeviceID, &c.SenderDeviceID, &c.Ciphertext, &c.Header, &c.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		c.VersionID = v.ID
+		v.Ciphertexts = []command.MessageVersionCiphertext{c}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetLatestVersion returns the newest version of a message with the
+// ciphertexts of every device.
+func (r *PostgresMessageRepository) GetLatestVersion(ctx context.Context, messageID uuid.UUID) (command.MessageVersion, error) {
+	var v command.MessageVersion
+	err := r.db.QueryRowContext(ctx, `
+        SELECT id, message_id, edited_by, edited_at, version_number
+        FROM message_versions WHERE message_id = $1
+        ORDER BY version_number DESC
+        LIMIT 1
+    `, messageID).Scan(&v.ID, &v.MessageID, &v.EditedBy, &v.EditedAt, &v.VersionNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return command.MessageVersion{}, sentinal_errors.ErrNotFound
+		}
+		return command.MessageVersion{}, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, version_id, recipient_user_id, recipient_device_id, sender_device_id, ciphertext, header::text, created_at
+        FROM message_version_ciphertexts WHERE version_id = $1
+    `, v.ID)
+	if err != nil {
+		return command.MessageVersion{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c command.MessageVersionCiphertext
+		if err := rows.Scan(&c.ID, &c.VersionID, &c.RecipientUserID, &c.RecipientDeviceID, &c.SenderDeviceID, &c.Ciphertext, &c.Header, &c.CreatedAt); err != nil {
+			return command.MessageVersion{}, err
+		}
+		v.Ciphertexts = append(v.Ciphertexts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return command.MessageVersion{}, err
 	}
-	return rows, nil
+	return v, nil
+}
+
+func (r *PostgresMessageRepository) DeleteVersion(ctx context.Context, versionID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM message_versions WHERE id = $1", versionID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
 }
 
 func toNullTime(t time.Time) sql.NullTime {
 	return sql.NullTime{Time: t, Valid: true}
 }
+
+// deviceMessageColumns selects a message together with the ciphertext addressed
+// to one device, joined as mc. Group messages sent with a sender key have no
+// per-device row and return their shared ciphertext instead. The ciphertext
+// columns are NULL for SYSTEM messages, which are not encrypted.
+const deviceMessageColumns = `
+        m.id, m.conversation_id, m.sender_id, m.client_message_id, m.idempotency_key, m.seq_id, m.type, m.metadata,
+        m.is_forwarded, m.forwarded_from_msg_id, m.reply_to_msg_id, m.poll_id, m.link_preview_id, m.mention_count,
+        m.created_at, m.edited_at, m.deleted_at, m.expires_at,
+        COALESCE(mc.ciphertext, m.ciphertext), COALESCE(mc.header, m.header), mc.recipient_device_id, mc.recipient_user_id, mc.sender_device_id`
+
+// deviceMessageReadable keeps the messages a device joined as mc can read: those
+// with a ciphertext for it or a shared group ciphertext, and SYSTEM messages.
+const deviceMessageReadable = "(mc.id IS NOT NULL OR m.ciphertext IS NOT NULL OR m.type = 'SYSTEM')"
+
+type deviceMessageScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDeviceMessage reads deviceMessageColumns, followed by any trailing
+// columns whose destinations are passed in suffix.
+func scanDeviceMessage(row deviceMessageScanner, suffix ...interface{}) (message.Message, error) {
+	var m message.Message
+	var metadata, header sql.NullString
+	dest := []interface{}{
+		&m.ID,
+		&m.ConversationID,
+		&m.SenderID,
+		&m.ClientMessageID,
+		&m.IdempotencyKey,
+		&m.SeqID,
+		&m.Type,
+		&metadata,
+		&m.IsForwarded,
+		&m.ForwardedFromMsgID,
+		&m.ReplyToMsgID,
+		&m.PollID,
+		&m.LinkPreviewID,
+		&m.MentionCount,
+		&m.CreatedAt,
+		&m.EditedAt,
+		&m.DeletedAt,
+		&m.ExpiresAt,
+		&m.Ciphertext,
+		&header,
+		&m.RecipientDeviceID,
+		&m.RecipientUserID,
+		&m.SenderDeviceID,
+	}
+	if err := row.Scan(append(dest, suffix...)...); err != nil {
+		return message.Message{}, err
+	}
+	m.Metadata = metadata.String
+	m.Header = header.String
+	return m, nil
+}
+
+type attachmentScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAttachment reads attachmentColumns, after any leading columns whose
+// destinations are passed in prefix.
+func scanAttachment(row attachmentScanner, prefix ...interface{}) (message.Attachment, error) {
+	var a message.Attachment
+	dest := append(prefix,
+		&a.ID,
+		&a.UploaderID,
+		&a.URL,
+		&a.Filename,
+		&a.MimeType,
+		&a.SizeBytes,
+		&a.ViewOnce,
+		&a.ViewedAt,
+		&a.ThumbnailURL,
+		&a.Width,
+		&a.Height,
+		&a.DurationSeconds,
+		&a.EncryptionKeyHash,
+		&a.EncryptionIV,
+		&a.UploadSessionID,
+		&a.ObjectKey,
+		&a.CreatedAt,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return message.Attachment{}, err
+	}
+	return a, nil
+}
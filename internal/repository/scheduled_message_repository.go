@@ -0,0 +1,260 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sentinal-chat/internal/domain/command"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+const scheduledMessageColumns = `
+        id, message_id, conversation_id, sender_id, sender_device_id, message_type, client_message_id,
+        scheduled_for, COALESCE(timezone, 'UTC'), status, attempts, COALESCE(next_attempt_at, scheduled_for),
+        last_error, created_at, updated_at, sent_at`
+
+type PostgresScheduledMessageRepository struct {
+	db DBTX
+}
+
+func NewScheduledMessageRepository(db DBTX) ScheduledMessageRepository {
+	return &PostgresScheduledMessageRepository{db: db}
+}
+
+func (r *PostgresScheduledMessageRepository) Create(ctx context.Context, m *command.ScheduledMessage) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO scheduled_messages (
+            id, message_id, conversation_id, sender_id, sender_device_id, message_type, client_message_id,
+            scheduled_for, timezone, status, attempts, next_attempt_at, created_at, updated_at
+        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$8,$12,$13)
+    `,
+		m.ID,
+		m.MessageID,
+		m.ConversationID,
+		m.SenderID,
+		m.SenderDeviceID,
+		m.MessageType,
+		sql.NullString{String: m.ClientMessageID, Valid: m.ClientMessageID != ""},
+		m.ScheduledFor,
+		m.Timezone,
+		m.Status,
+		m.Attempts,
+		m.CreatedAt,
+		m.UpdatedAt,
+	)
+	return err
+}
+
+func (r *PostgresScheduledMessageRepository) CreateCiphertext(ctx context.Context, c *command.ScheduledMessageCiphertext) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO scheduled_message_ciphertexts (id, scheduled_message_id, recipient_device_id, ciphertext, header)
+        VALUES ($1,$2,$3,$4,$5)
+    `, c.ID, c.ScheduledMessageID, c.RecipientDeviceID, c.Ciphertext, c.Header)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return sentinal_errors.ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *PostgresScheduledMessageRepository) GetByID(ctx context.Context, id uuid.UUID) (command.ScheduledMessage, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT`+scheduledMessageColumns+`
+        FROM scheduled_messages WHERE id = $1
+    `, id)
+	m, err := scanScheduledMessage(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return command.ScheduledMessage{}, sentinal_errors.ErrNotFound
+		}
+		return command.ScheduledMessage{}, err
+	}
+	return m, nil
+}
+
+func (r *PostgresScheduledMessageRepository) GetCiphertexts(ctx context.Context, scheduledMessageID uuid.UUID) ([]command.ScheduledMessageCiphertext, error) {
+	var items []command.ScheduledMessageCiphertext
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, scheduled_message_id, recipient_device_id, ciphertext, COALESCE(header::text, '')
+        FROM scheduled_message_ciphertexts WHERE scheduled_message_id = $1
+    `, scheduledMessageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c command.ScheduledMessageCiphertext
+		if err := rows.Scan(&c.ID, &c.ScheduledMessageID, &c.RecipientDeviceID, &c.Ciphertext, &c.Header); err != nil {
+			return nil, err
+		}
+		items = append(items, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *PostgresScheduledMessageRepository) ListBySender(ctx context.Context, senderID uuid.UUID, status string, page, limit int) ([]command.ScheduledMessage, int64, error) {
+	var items []command.ScheduledMessage
+	var total int64
+
+	where := "WHERE sender_id = $1"
+	args := []interface{}{senderID}
+	if status != "" {
+		where += " AND status = $2"
+		args = append(args, status)
+	}
+
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM scheduled_messages "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	query := `SELECT` + scheduledMessageColumns + `
+        FROM scheduled_messages ` + where +
+		fmt.Sprintf(" ORDER BY scheduled_for ASC OFFSET $%d LIMIT $%d", len(args)+1, len(args)+2)
+	args = append(args, offset, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m, err := scanScheduledMessage(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (r *PostgresScheduledMessageRepository) Cancel(ctx context.Context, id, senderID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE scheduled_messages SET status = 'CANCELED', updated_at = $1
+        WHERE id = $2 AND sender_id = $3 AND status = 'PENDING'
+    `, time.Now().UTC(), id, senderID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+func (r *PostgresScheduledMessageRepository) Reschedule(ctx context.Context, id, senderID uuid.UUID, scheduledFor time.Time, timezone string) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE scheduled_messages SET scheduled_for = $1, next_attempt_at = $1, timezone = $2, attempts = 0, last_error = NULL, updated_at = $3
+        WHERE id = $4 AND sender_id = $5 AND status = 'PENDING'
+    `, scheduledFor, timezone, time.Now().UTC(), id, senderID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+// LockNextDue claims the oldest due message with a row lock, skipping rows
+// already claimed by another worker and rows waiting out a retry delay. It
+// must be called inside a transaction.
+func (r *PostgresScheduledMessageRepository) LockNextDue(ctx context.Context, now time.Time) (command.ScheduledMessage, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT`+scheduledMessageColumns+`
+        FROM scheduled_messages
+        WHERE status = 'PENDING' AND next_attempt_at <= $1
+        ORDER BY next_attempt_at ASC
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED
+    `, now)
+	m, err := scanScheduledMessage(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return command.ScheduledMessage{}, sentinal_errors.ErrNotFound
+		}
+		return command.ScheduledMessage{}, err
+	}
+	return m, nil
+}
+
+func (r *PostgresScheduledMessageRepository) MarkSent(ctx context.Context, id, messageID uuid.UUID, sentAt time.Time) error {
+	res, err := r.db.ExecContext(ctx, `
+        UPDATE scheduled_messages SET status = 'SENT', message_id = $1, sent_at = $2, updated_at = $2
+        WHERE id = $3 AND status = 'PENDING'
+    `, messageID, sentAt, id)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err == nil && rows == 0 {
+		return sentinal_errors.ErrNotFound
+	}
+	return err
+}
+
+// RecordFailure counts a failed delivery attempt. A message that stays
+// PENDING is not claimed again before nextAttemptAt.
+func (r *PostgresScheduledMessageRepository) RecordFailure(ctx context.Context, id uuid.UUID, errMsg string, final bool, nextAttemptAt time.Time) error {
+	status := command.ScheduledPending
+	if final {
+		status = command.ScheduledFailed
+	}
+	_, err := r.db.ExecContext(ctx, `
+        UPDATE scheduled_messages SET attempts = attempts + 1, last_error = $1, status = $2, next_attempt_at = $3, updated_at = $4
+        WHERE id = $5 AND status = 'PENDING'
+    `, errMsg, status, nextAttemptAt, time.Now().UTC(), id)
+	return err
+}
+
+type scheduledMessageScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanScheduledMessage(row scheduledMessageScanner) (command.ScheduledMessage, error) {
+	var m command.ScheduledMessage
+	var clientMsgID, lastError sql.NullString
+	var updatedAt, sentAt sql.NullTime
+	if err := row.Scan(
+		&m.ID,
+		&m.MessageID,
+		&m.ConversationID,
+		&m.SenderID,
+		&m.SenderDeviceID,
+		&m.MessageType,
+		&clientMsgID,
+		&m.ScheduledFor,
+		&m.Timezone,
+		&m.Status,
+		&m.Attempts,
+		&m.NextAttemptAt,
+		&lastError,
+		&m.CreatedAt,
+		&updatedAt,
+		&sentAt,
+	); err != nil {
+		return command.ScheduledMessage{}, err
+	}
+	m.ClientMessageID = clientMsgID.String
+	m.LastError = lastError.String
+	if updatedAt.Valid {
+		m.UpdatedAt = updatedAt.Time
+	}
+	if sentAt.Valid {
+		m.SentAt = &sentAt.Time
+	}
+	return m, nil
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"sentinal-chat/internal/domain/encryption"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+type PostgresSenderKeyRepository struct {
+	db DBTX
+}
+
+func NewSenderKeyRepository(db DBTX) SenderKeyRepository {
+	return &PostgresSenderKeyRepository{db: db}
+}
+
+// GetEpoch returns the conversation's current sender key epoch.
+func (r *PostgresSenderKeyRepository) GetEpoch(ctx context.Context, conversationID uuid.UUID) (int64, error) {
+	var epoch int64
+	err := r.db.QueryRowContext(ctx, "SELECT sender_key_epoch FROM conversations WHERE id = $1", conversationID).Scan(&epoch)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, sentinal_errors.ErrNotFound
+		}
+		return 0, err
+	}
+	return epoch, nil
+}
+
+// BumpEpoch starts a new sender key epoch and returns it. Sender keys created
+// in earlier epochs stop being accepted for new messages.
+func (r *PostgresSenderKeyRepository) BumpEpoch(ctx context.Context, conversationID uuid.UUID) (int64, error) {
+	var epoch int64
+	err := r.db.QueryRowContext(ctx, `
+        UPDATE conversations SET sender_key_epoch = sender_key_epoch + 1
+        WHERE id = $1
+        RETURNING sender_key_epoch
+    `, conversationID).Scan(&epoch)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, sentinal_errors.ErrNotFound
+		}
+		return 0, err
+	}
+	return epoch, nil
+}
+
+// UpsertSenderKey records the sender key a device now sends with, replacing
+// its previous one.
+func (r *PostgresSenderKeyRepository) UpsertSenderKey(ctx context.Context, k *encryption.SenderKey) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO sender_keys (conversation_id, sender_device_id, sender_id, distribution_id, epoch, created_at)
+        VALUES ($1,$2,$3,$4,$5,$6)
+        ON CONFLICT (conversation_id, sender_device_id) DO UPDATE
+        SET sender_id = EXCLUDED.sender_id, distribution_id = EXCLUDED.distribution_id,
+            epoch = EXCLUDED.epoch, created_at = EXCLUDED.created_at
+    `, k.ConversationID, k.SenderDeviceID, k.SenderID, k.DistributionID, k.Epoch, k.CreatedAt)
+	return err
+}
+
+func (r *PostgresSenderKeyRepository) GetSenderKey(ctx context.Context, conversationID, senderDeviceID uuid.UUID) (encryption.SenderKey, error) {
+	var k encryption.SenderKey
+	err := r.db.QueryRowContext(ctx, `
+        SELECT conversation_id, sender_device_id, sender_id, distribution_id, epoch, created_at
+        FROM sender_keys WHERE conversation_id = $1 AND sender_device_id = $2
+    `, conversationID, senderDeviceID).Scan(&k.ConversationID, &k.SenderDeviceID, &k.SenderID, &k.DistributionID, &k.Epoch, &k.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return encryption.SenderKey{}, sentinal_errors.ErrNotFound
+		}
+		return encryption.SenderKey{}, err
+	}
+	return k, nil
+}
+
+// UpsertDistribution stores a distribution message for one device, replacing
+// the previous one the same sender device addressed to it.
+func (r *PostgresSenderKeyRepository) UpsertDistribution(ctx context.Context, d *encryption.SenderKeyDistribution) error {
+	_, err := r.db.ExecContext(ctx, `
+        INSERT INTO sender_key_distributions (
+            id, conversation_id, sender_id, sender_device_id, recipient_user_id, recipient_device_id,
+            distribution_id, epoch, ciphertext, header, created_at
+        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+        ON CONFLICT (conversation_id, sender_device_id, recipient_device_id) DO UPDATE
+        SET id = EXCLUDED.id, sender_id = EXCLUDED.sender_id, recipient_user_id = EXCLUDED.recipient_user_id,
+            distribution_id = EXCLUDED.distribution_id, epoch = EXCLUDED.epoch, ciphertext = EXCLUDED.ciphertext,
+            header = EXCLUDED.header, created_at = EXCLUDED.created_at
+    `,
+		d.ID,
+		d.ConversationID,
+		d.SenderID,
+		d.SenderDeviceID,
+		d.RecipientUserID,
+		d.RecipientDeviceID,
+		d.DistributionID,
+		d.Epoch,
+		d.Ciphertext,
+		d.Header,
+		d.CreatedAt,
+	)
+	return err
+}
+
+// GetDistributionsForDevice returns the latest distribution of every sender
+// device in the conversation that is addressed to the device, oldest first.
+func (r *PostgresSenderKeyRepository) GetDistributionsForDevice(ctx context.Context, conversationID, recipientDeviceID uuid.UUID) ([]encryption.SenderKeyDistribution, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, conversation_id, sender_id, sender_device_id, recipient_user_id, recipient_device_id,
+               distribution_id, epoch, ciphertext, header::text, created_at
+        FROM sender_key_distributions
+        WHERE conversation_id = $1 AND recipient_device_id = $2
+        ORDER BY created_at
+    `, conversationID, recipientDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []encryption.SenderKeyDistribution
+	for rows.Next() {
+		var d encryption.SenderKeyDistribution
+		if err := rows.Scan(
+			&d.ID,
+			&d.ConversationID,
+			&d.SenderID,
+			&d.SenderDeviceID,
+			&d.RecipientUserID,
+			&d.RecipientDeviceID,
+			&d.DistributionID,
+			&d.Epoch,
+			&d.Ciphertext,
+			&d.Header,
+			&d.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, d)
+	}
+	return items, rows.Err()
+}
+
+// GetUndistributedDevices returns the active devices of the conversation's
+// participants, other than the sender device, that have not been sent the
+// given sender key.
+func (r *PostgresSenderKeyRepository) GetUndistributedDevices(ctx context.Context, conversationID, senderDeviceID, distributionID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT d.id
+        FROM participants p
+        JOIN devices d ON d.user_id = p.user_id AND d.is_active = true
+        WHERE p.conversation_id = $1 AND d.id <> $2
+          AND NOT EXISTS (
+              SELECT 1 FROM sender_key_distributions skd
+              WHERE skd.conversation_id = $1 AND skd.sender_device_id = $2
+                AND skd.recipient_device_id = d.id AND skd.distribution_id = $3
+          )
+        ORDER BY d.id
+    `, conversationID, senderDeviceID, distributionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteUserKeys drops the sender keys of a user's devices in a conversation
+// and every distribution sent by or addressed to them.
+func (r *PostgresSenderKeyRepository) DeleteUserKeys(ctx context.Context, conversationID, userID uuid.UUID) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM sender_keys WHERE conversation_id = $1 AND sender_id = $2", conversationID, userID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `
+        DELETE FROM sender_key_distributions
+        WHERE conversation_id = $1 AND (sender_id = $2 OR recipient_user_id = $2)
+    `, conversationID, userID)
+	return err
+}
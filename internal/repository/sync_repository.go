@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sentinal-chat/internal/domain/conversation"
+	"sentinal-chat/internal/domain/message"
+
+	"github.com/google/uuid"
+)
+
+type PostgresSyncRepository struct {
+	db DBTX
+}
+
+func NewSyncRepository(db DBTX) SyncRepository {
+	return &PostgresSyncRepository{db: db}
+}
+
+func (r *PostgresSyncRepository) GetSequenceStates(ctx context.Context, userID uuid.UUID) ([]conversation.SequenceState, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT p.conversation_id, COALESCE(cs.last_sequence, 0)
+        FROM participants p
+        LEFT JOIN conversation_sequences cs ON cs.conversation_id = p.conversation_id
+        WHERE p.user_id = $1
+        ORDER BY p.conversation_id
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []conversation.SequenceState
+	for rows.Next() {
+		var s conversation.SequenceState
+		if err := rows.Scan(&s.ConversationID, &s.LastSequence); err != nil {
+			return nil, err
+		}
+		states = append(states, s)
+	}
+	return states, rows.Err()
+}
+
+func (r *PostgresSyncRepository) GetMessagesAfter(ctx context.Context, conversationID uuid.UUID, afterSeq int64, limit int, recipientDeviceID, userID uuid.UUID) ([]message.Message, error) {
+	query := `SELECT` + deviceMessageColumns + `
+        FROM messages m
+        LEFT JOIN message_ciphertexts mc ON mc.message_id = m.id AND mc.recipient_device_id = $2
+        WHERE m.conversation_id = $1 AND m.seq_id > $4 AND m.deleted_at IS NULL AND ` + deviceMessageReadable + `
+    ` + visibleToUserClause("$3") + `
+        ORDER BY m.seq_id ASC
+        LIMIT $5`
+	return r.queryDeviceMessages(ctx, query, conversationID, recipientDeviceID, userID, afterSeq, limit)
+}
+
+func (r *PostgresSyncRepository) GetMessagesByIDs(ctx context.Context, ids []uuid.UUID, recipientDeviceID, userID uuid.UUID) ([]message.Message, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{recipientDeviceID, userID}
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	query := `SELECT` + deviceMessageColumns + `
+        FROM messages m
+        LEFT JOIN message_ciphertexts mc ON mc.message_id = m.id AND mc.recipient_device_id = $1
+        WHERE m.id IN (` + strings.Join(placeholders, ", ") + `) AND m.deleted_at IS NULL AND ` + deviceMessageReadable + `
+    ` + visibleToUserClause("$2") + `
+        ORDER BY m.conversation_id, m.seq_id`
+	return r.queryDeviceMessages(ctx, query, args...)
+}
+
+func (r *PostgresSyncRepository) queryDeviceMessages(ctx context.Context, query string, args ...interface{}) ([]message.Message, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []message.Message
+	for rows.Next() {
+		m, err := scanDeviceMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetChanges returns the user's feed of edits, deletions, receipts and
+// membership changes after the cursor, oldest first. Each branch is bounded by
+// the cursor time so the indexes on the change timestamps can be used, and the
+// outer comparison skips the changes already returned at that exact time.
+func (r *PostgresSyncRepository) GetChanges(ctx context.Context, userID uuid.UUID, after conversation.ChangeCursor, limit int) ([]conversation.Change, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        WITH mine AS (
+            SELECT conversation_id FROM participants WHERE user_id = $1
+        ),
+        changes AS (
+            SELECT 'message_edited' AS kind, m.conversation_id, m.id AS message_id, m.sender_id AS user_id,
+                   NULL::text AS value, m.edited_at AS changed_at
+            FROM messages m
+            WHERE m.edited_at >= $2 AND m.deleted_at IS NULL
+              AND m.conversation_id IN (SELECT conversation_id FROM mine)
+            `+visibleToUserClause("$1")+`
+            UNION ALL
+            SELECT 'message_deleted', m.conversation_id, m.id, m.sender_id, NULL, m.deleted_at
+            FROM messages m
+            WHERE m.deleted_at >= $2
+              AND m.conversation_id IN (SELECT conversation_id FROM mine)
+            UNION ALL
+            SELECT 'message_deleted_for_me', m.conversation_id, m.id, mus.user_id, NULL, mus.deleted_at
+            FROM message_user_states mus
+            JOIN messages m ON m.id = mus.message_id
+            WHERE mus.user_id = $1 AND mus.is_deleted AND mus.deleted_at >= $2
+            UNION ALL
+            SELECT 'conversation_cleared', cc.conversation_id, NULL, cc.user_id, NULL, cc.cleared_at
+            FROM conversation_clears cc
+            WHERE cc.user_id = $1 AND cc.cleared_at >= $2
+            UNION ALL
+            SELECT 'receipt', m.conversation_id, m.id, r.user_id, r.status::text, r.updated_at
+            FROM message_receipts r
+            JOIN messages m ON m.id = r.message_id
+            WHERE r.updated_at >= $2 AND (m.sender_id = $1 OR r.user_id = $1)
+              AND m.conversation_id IN (SELECT conversation_id FROM mine)
+            UNION ALL
+            SELECT 'member_' || lower(mc.action), mc.conversation_id, NULL, mc.user_id, mc.role, mc.changed_at
+            FROM membership_changes mc
+            WHERE mc.changed_at >= $2
+              AND (mc.user_id = $1 OR mc.conversation_id IN (SELECT conversation_id FROM mine))
+        )
+        SELECT kind, conversation_id, message_id, user_id, value, changed_at
+        FROM changes
+        WHERE (changed_at, kind, COALESCE(message_id, '00000000-0000-0000-0000-000000000000'::uuid), user_id) > ($2, $3, $4, $5)
+        ORDER BY changed_at, kind, COALESCE(message_id, '00000000-0000-0000-0000-000000000000'::uuid), user_id
+        LIMIT $6
+    `, userID, after.ChangedAt, after.Kind, after.MessageID, after.UserID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []conversation.Change
+	for rows.Next() {
+		var c conversation.Change
+		if err := rows.Scan(&c.Kind, &c.ConversationID, &c.MessageID, &c.UserID, &c.Value, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -414,6 +414,38 @@ func (r *PostgresUserRepository) UpdateLastSeen(ctx context.Context, userID uuid
 	return err
 }
 
+// GetPresenceAudience returns the users who share a conversation with userID and
+// have not been blocked by them. With contactsOnly, it is further limited to
+// users in userID's contact list.
+func (r *PostgresUserRepository) GetPresenceAudience(ctx context.Context, userID uuid.UUID, contactsOnly bool) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT DISTINCT other.user_id
+        FROM participants self
+        JOIN participants other ON other.conversation_id = self.conversation_id AND other.user_id <> self.user_id
+        LEFT JOIN user_contacts uc ON uc.user_id = self.user_id AND uc.contact_user_id = other.user_id
+        WHERE self.user_id = $1
+          AND COALESCE(uc.is_blocked, FALSE) = FALSE
+          AND ($2 = FALSE OR uc.contact_user_id IS NOT NULL)
+    `, userID, contactsOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 func (r *PostgresUserRepository) GetUserContacts(ctx context.Context, userID uuid.UUID) ([]user.UserContact, error) {
 	var contacts []user.UserContact
 	rows, err := r.db.QueryContext(ctx, `
@@ -31,6 +31,7 @@ type RateLimits struct {
 	MaxPresenceUpdates int
 	MaxCallSignals     int
 	MaxPingMessages    int
+	MaxDeliveryAcks    int
 }
 
 var DefaultRateLimits = RateLimits{
@@ -39,6 +40,7 @@ var DefaultRateLimits = RateLimits{
 	MaxPresenceUpdates: 30,
 	MaxCallSignals:     120,
 	MaxPingMessages:    60,
+	MaxDeliveryAcks:    120,
 }
 
 // ClientRateLimiter tracks rate limits per client
@@ -48,6 +50,7 @@ type ClientRateLimiter struct {
 	presenceTokens    int
 	callTokens        int
 	pingTokens        int
+	deliveryTokens    int
 	lastRefill        time.Time
 	mu                sync.Mutex
 }
@@ -60,6 +63,7 @@ func NewClientRateLimiter() *ClientRateLimiter {
 		presenceTokens:    DefaultRateLimits.MaxPresenceUpdates,
 		callTokens:        DefaultRateLimits.MaxCallSignals,
 		pingTokens:        DefaultRateLimits.MaxPingMessages,
+		deliveryTokens:    DefaultRateLimits.MaxDeliveryAcks,
 		lastRefill:        now,
 	}
 }
@@ -102,6 +106,11 @@ func (rl *ClientRateLimiter) Allow(msgType string) bool {
 			rl.pingTokens--
 			return true
 		}
+	case "ack", "envelopes:fetch":
+		if rl.deliveryTokens > 0 {
+			rl.deliveryTokens--
+			return true
+		}
 	}
 	return false
 }
@@ -112,6 +121,7 @@ func (rl *ClientRateLimiter) refillTokens() {
 	rl.presenceTokens = DefaultRateLimits.MaxPresenceUpdates
 	rl.callTokens = DefaultRateLimits.MaxCallSignals
 	rl.pingTokens = DefaultRateLimits.MaxPingMessages
+	rl.deliveryTokens = DefaultRateLimits.MaxDeliveryAcks
 }
 
 // Client represents a single WebSocket connection
@@ -132,9 +142,11 @@ type Client struct {
 
 // ClientMessage represents a message from the client
 type ClientMessage struct {
-	Type           string    `json:"type"`
-	ConversationID uuid.UUID `json:"conversation_id,omitempty"`
-	MessageID      uuid.UUID `json:"message_id,omitempty"`
+	Type           string      `json:"type"`
+	ConversationID uuid.UUID   `json:"conversation_id,omitempty"`
+	MessageID      uuid.UUID   `json:"message_id,omitempty"`
+	MessageIDs     []uuid.UUID `json:"message_ids,omitempty"`
+	Status         string      `json:"status,omitempty"`
 }
 
 func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, deviceID uuid.UUID, clientID string, logger WebSocketLogger) *Client {
@@ -165,6 +177,11 @@ func (c *Client) readPump() {
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(pongWait))
 		c.lastActivity = time.Now()
+		if c.hub.presenceService != nil {
+			if err := c.hub.presenceService.Heartbeat(context.Background(), c.userID, c.clientID); err != nil {
+				c.logger.Error("presence heartbeat failed", c.userID, c.clientID, err)
+			}
+		}
 		return nil
 	})
 
@@ -204,8 +221,15 @@ func (c *Client) handleMessage(message []byte) error {
 		return c.handleTypingStop(msg)
 	case "read":
 		return c.handleReadReceipt(msg)
+	case "presence":
+		return c.handlePresence(msg)
 	case "ping":
 		return c.handlePing()
+	case "ack":
+		return c.handleAck(msg)
+	case "envelopes:fetch":
+		c.hub.pushPendingEnvelopes(c)
+		return nil
 	default:
 		c.logger.Warn("unknown message type", c.userID, c.clientID, zap.String("msg_type", msg.Type))
 		return nil
@@ -247,6 +271,30 @@ func (c *Client) handleReadReceipt(msg ClientMessage) error {
 	)
 }
 
+func (c *Client) handlePresence(msg ClientMessage) error {
+	if c.hub.presenceService == nil {
+		return nil
+	}
+	return c.hub.presenceService.SetStatus(
+		context.Background(),
+		c.userID,
+		msg.Status,
+	)
+}
+
+func (c *Client) handleAck(msg ClientMessage) error {
+	if c.hub.deliveryService == nil {
+		return nil
+	}
+	_, err := c.hub.deliveryService.Acknowledge(
+		context.Background(),
+		c.userID,
+		c.deviceID,
+		msg.MessageIDs,
+	)
+	return err
+}
+
 func (c *Client) handlePing() error {
 	c.send <- []byte(`{"type":"pong"}`)
 	return nil
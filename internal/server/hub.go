@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"sentinal-chat/internal/events"
 	"sentinal-chat/internal/services"
+	"sentinal-chat/internal/transport/httpdto"
 )
 
 // Hub maintains the set of active clients and broadcasts messages
@@ -21,7 +22,8 @@ type Hub struct {
 	eventBus            events.EventBus
 	conversationService *services.ConversationService
 	messageService      *services.MessageService
-	userService         *services.UserService
+	presenceService     *services.PresenceService
+	deliveryService     *services.DeliveryService
 	rateLimiter         *WebSocketRateLimiter
 	logger              *WebSocketLogger
 	mu                  sync.RWMutex
@@ -30,9 +32,11 @@ type Hub struct {
 	isRunning           int32
 }
 
-// BroadcastMessage represents a message to broadcast
+// BroadcastMessage represents a message to broadcast. DeviceID narrows a
+// message for UserIDs down to the connections of that one device.
 type BroadcastMessage struct {
 	UserIDs        []uuid.UUID
+	DeviceID       *uuid.UUID
 	ConversationID *uuid.UUID
 	Event          events.Event
 	Payload        []byte
@@ -115,7 +119,8 @@ func NewHub(
 	eventBus events.EventBus,
 	conversationService *services.ConversationService,
 	messageService *services.MessageService,
-	userService *services.UserService,
+	presenceService *services.PresenceService,
+	deliveryService *services.DeliveryService,
 ) *Hub {
 	return &Hub{
 		clients:             make(map[uuid.UUID]map[string]*Client),
@@ -125,7 +130,8 @@ func NewHub(
 		eventBus:            eventBus,
 		conversationService: conversationService,
 		messageService:      messageService,
-		userService:         userService,
+		presenceService:     presenceService,
+		deliveryService:     deliveryService,
 		rateLimiter:         NewWebSocketRateLimiter(),
 		logger:              NewWebSocketLogger(),
 		stopChan:            make(chan struct{}),
@@ -140,6 +146,11 @@ func (h *Hub) Run() {
 	h.wg.Add(1)
 	go h.subscribeToEvents()
 
+	if h.presenceService != nil {
+		h.wg.Add(1)
+		go h.cleanupPresence()
+	}
+
 	for {
 		select {
 		case client := <-h.register:
@@ -178,6 +189,11 @@ func (h *Hub) handleRegister(client *Client) {
 		for id, c := range h.clients[client.userID] {
 			h.removeClient(c)
 			delete(h.clients[client.userID], id)
+			if h.presenceService != nil {
+				if err := h.presenceService.Disconnect(context.Background(), c.userID, c.clientID); err != nil {
+					h.logger.Error("presence disconnect failed", c.userID, c.clientID, err)
+				}
+			}
 			break
 		}
 	}
@@ -194,14 +210,58 @@ func (h *Hub) handleRegister(client *Client) {
 		}
 	}
 
-	if h.userService != nil {
-		h.userService.UpdateOnlineStatus(context.Background(), client.userID, client.userID, true)
+	if h.presenceService != nil {
+		if err := h.presenceService.Connect(context.Background(), client.userID, client.deviceID, client.clientID); err != nil {
+			h.logger.Error("presence connect failed", client.userID, client.clientID, err)
+		}
 	}
 
 	h.logger.Info("client connected", client.userID, client.clientID)
 
 	go client.writePump()
 	go client.readPump()
+	go h.pushPendingEnvelopes(client)
+}
+
+// envelopesMessage carries a page of the device's envelope queue to the client.
+type envelopesMessage struct {
+	Type string `json:"type"`
+	httpdto.PendingEnvelopesResponse
+}
+
+// pushPendingEnvelopes sends the oldest envelopes the client's device has not
+// acknowledged. The client acks them and sends envelopes:fetch while has_more
+// is set.
+func (h *Hub) pushPendingEnvelopes(client *Client) {
+	if h.deliveryService == nil || client.deviceID == uuid.Nil {
+		return
+	}
+	envelopes, hasMore, err := h.deliveryService.GetPending(context.Background(), client.deviceID, 0)
+	if err != nil {
+		h.logger.Error("pending envelopes fetch failed", client.userID, client.clientID, err)
+		return
+	}
+	if len(envelopes) == 0 {
+		return
+	}
+	data, err := json.Marshal(envelopesMessage{
+		Type:                     "envelopes",
+		PendingEnvelopesResponse: httpdto.FromPendingEnvelopes(envelopes, hasMore),
+	})
+	if err != nil {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.clients[client.userID][client.clientID] != client {
+		return
+	}
+	select {
+	case client.send <- data:
+	default:
+		h.logger.Warn("client send buffer full", client.userID, client.clientID)
+	}
 }
 
 func (h *Hub) handleUnregister(client *Client) {
@@ -215,8 +275,10 @@ func (h *Hub) handleUnregister(client *Client) {
 
 			if len(userClients) == 0 {
 				delete(h.clients, client.userID)
-				if h.userService != nil {
-					h.userService.UpdateOnlineStatus(context.Background(), client.userID, client.userID, false)
+			}
+			if h.presenceService != nil {
+				if err := h.presenceService.Disconnect(context.Background(), client.userID, client.clientID); err != nil {
+					h.logger.Error("presence disconnect failed", client.userID, client.clientID, err)
 				}
 			}
 
@@ -238,6 +300,10 @@ func (h *Hub) handleBroadcast(msg *BroadcastMessage) {
 
 	if msg.ConversationID != nil {
 		h.broadcastToConversation(*msg.ConversationID, data)
+	} else if len(msg.UserIDs) > 0 && msg.DeviceID != nil {
+		for _, userID := range msg.UserIDs {
+			h.broadcastToDevice(userID, *msg.DeviceID, data)
+		}
 	} else if len(msg.UserIDs) > 0 {
 		for _, userID := range msg.UserIDs {
 			h.broadcastToUser(userID, data)
@@ -257,6 +323,19 @@ func (h *Hub) broadcastToUser(userID uuid.UUID, data []byte) {
 	}
 }
 
+func (h *Hub) broadcastToDevice(userID, deviceID uuid.UUID, data []byte) {
+	for _, client := range h.clients[userID] {
+		if client.deviceID != deviceID {
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			h.logger.Warn("client send buffer full", client.userID, client.clientID)
+		}
+	}
+}
+
 func (h *Hub) broadcastToConversation(convID uuid.UUID, data []byte) {
 	for _, userClients := range h.clients {
 		for _, client := range userClients {
@@ -277,12 +356,38 @@ func (h *Hub) subscribeToEvents() {
 	eventTypes := []events.EventType{
 		events.EventMessageNew,
 		events.EventMessageRead,
+		events.EventMessageDelivered,
 		events.EventTypingStarted,
 		events.EventTypingStopped,
 		events.EventCallOffer,
 		events.EventCallAnswer,
 		events.EventCallICE,
 		events.EventCallEnded,
+		events.EventReactionAdded,
+		events.EventReactionRemoved,
+		events.EventPollUpdated,
+		events.EventMessageEdited,
+		events.EventCommandUndone,
+		events.EventPresenceOnline,
+		events.EventPresenceOffline,
+		events.EventLabelChanged,
+		events.EventConversationCleared,
+		events.EventMessageDeletedForMe,
+		events.EventMessageStarred,
+		events.EventMessageUnstarred,
+		events.EventMentionNew,
+		events.EventAttachmentViewed,
+		events.EventMessageExpired,
+		events.EventPermissionsChanged,
+		events.EventSenderKeyReceived,
+		events.EventSenderKeyRotate,
+		events.EventPreKeysLow,
+		events.EventSignedPreKeyRotate,
+		events.EventIdentityChanged,
+		events.EventMessageDeleted,
+		events.EventMessageRestored,
+		events.EventMessagePinned,
+		events.EventMessageUnpinned,
 	}
 
 	for _, eventType := range eventTypes {
@@ -290,6 +395,26 @@ func (h *Hub) subscribeToEvents() {
 	}
 }
 
+// cleanupPresence periodically marks users offline whose connections stopped
+// sending heartbeats, which happens when the instance holding them goes away
+// without unregistering its clients.
+func (h *Hub) cleanupPresence() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stopChan:
+			return
+		case <-ticker.C:
+			if _, err := h.presenceService.CleanupStale(context.Background()); err != nil {
+				h.logger.Error("presence cleanup failed", uuid.Nil, "", err)
+			}
+		}
+	}
+}
+
 // Stop gracefully shuts down the Hub
 func (h *Hub) Stop() {
 	close(h.stopChan)
@@ -312,8 +437,75 @@ type WebSocketEventHandler struct {
 }
 
 func (h *WebSocketEventHandler) Handle(ctx context.Context, event events.Event) error {
-	h.hub.broadcast <- &BroadcastMessage{
+	msg := &BroadcastMessage{
 		Event: event,
 	}
+
+	switch e := event.(type) {
+	case *events.MessageNewEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.MessageReadEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.MessageDeliveredEvent:
+		msg.UserIDs = []uuid.UUID{e.SenderID, e.RecipientID}
+	case *events.TypingEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.PresenceEvent:
+		msg.UserIDs = append([]uuid.UUID{e.UserID}, e.Audience...)
+		// Other handlers share the event, so strip the audience from a copy.
+		stripped := *e
+		stripped.Audience = nil
+		msg.Event = &stripped
+	case *events.CallSignalingEvent:
+		msg.UserIDs = []uuid.UUID{e.ToID}
+	case *events.CallEndedEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.ReactionEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.PollUpdatedEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.MessageEditedEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.CommandUndoneEvent:
+		msg.UserIDs = []uuid.UUID{e.UserID}
+	case *events.LabelChangedEvent:
+		msg.UserIDs = []uuid.UUID{e.UserID}
+	case *events.HistoryHiddenEvent:
+		msg.UserIDs = []uuid.UUID{e.UserID}
+	case *events.MessageStarEvent:
+		msg.UserIDs = []uuid.UUID{e.UserID}
+	case *events.MentionNewEvent:
+		msg.UserIDs = []uuid.UUID{e.UserID}
+	case *events.AttachmentViewedEvent:
+		msg.UserIDs = []uuid.UUID{e.SenderID}
+	case *events.MessageExpiredEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.GroupPermissionsChangedEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.SenderKeyReceivedEvent:
+		msg.UserIDs = e.RecipientIDs
+		stripped := *e
+		stripped.RecipientIDs = nil
+		msg.Event = &stripped
+	case *events.SenderKeyRotateEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.PreKeysLowEvent:
+		msg.UserIDs = []uuid.UUID{e.UserID}
+		msg.DeviceID = &e.DeviceID
+	case *events.SignedPreKeyRotateEvent:
+		msg.UserIDs = []uuid.UUID{e.UserID}
+		msg.DeviceID = &e.DeviceID
+	case *events.IdentityChangedEvent:
+		msg.UserIDs = e.RecipientIDs
+		stripped := *e
+		stripped.RecipientIDs = nil
+		msg.Event = &stripped
+	case *events.MessageDeletedEvent:
+		msg.ConversationID = &e.ConversationID
+	case *events.MessagePinnedEvent:
+		msg.ConversationID = &e.ConversationID
+	}
+
+	h.hub.broadcast <- msg
 	return nil
 }
@@ -36,14 +36,22 @@ var (
 )
 
 type Handlers struct {
-	Auth         *handler.AuthHandler
-	Message      *handler.MessageHandler
-	Conversation *handler.ConversationHandler
-	User         *handler.UserHandler
-	Call         *handler.CallHandler
-	Upload       *handler.UploadHandler
-	Encryption   *handler.EncryptionHandler
-	Broadcast    *handler.BroadcastHandler
+	Auth             *handler.AuthHandler
+	Message          *handler.MessageHandler
+	Conversation     *handler.ConversationHandler
+	User             *handler.UserHandler
+	Call             *handler.CallHandler
+	Upload           *handler.UploadHandler
+	Encryption       *handler.EncryptionHandler
+	Broadcast        *handler.BroadcastHandler
+	Poll             *handler.PollHandler
+	ScheduledMessage *handler.ScheduledMessageHandler
+	Command          *handler.CommandHandler
+	Attachment       *handler.AttachmentHandler
+	LinkPreview      *handler.LinkPreviewHandler
+	Sync             *handler.SyncHandler
+	Delivery         *handler.DeliveryHandler
+	SenderKey        *handler.SenderKeyHandler
 }
 
 func New(cfg *config.Config, l *logger.Logger) *Server {
@@ -80,9 +88,6 @@ func (s *Server) SetupRoutes(handlers *Handlers, authService *services.AuthServi
 		s.engine.Use(middleware.RateLimitMiddleware(rateLimiter))
 	}
 
-	// Store cacheStore reference for potential future use
-	_ = cacheStore
-
 	// WebSocket endpoint
 	if wsHandler != nil {
 		s.engine.GET("/v1/ws", wsHandler.Handle)
@@ -106,6 +111,17 @@ func (s *Server) SetupRoutes(handlers *Handlers, authService *services.AuthServi
 		})
 	})
 
+	if cacheStore != nil {
+		s.engine.GET("/cache/stats", func(c *gin.Context) {
+			stats, err := cacheStore.GetStats(c.Request.Context())
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, httpdto.NewErrorResponse(err.Error(), "UNHEALTHY"))
+				return
+			}
+			c.JSON(http.StatusOK, httpdto.NewSuccessResponse(stats))
+		})
+	}
+
 	auth := s.engine.Group("/v1/auth")
 	{
 		auth.POST("/register", handlers.Auth.Register)
@@ -123,16 +139,88 @@ func (s *Server) SetupRoutes(handlers *Handlers, authService *services.AuthServi
 		messages.Use(middleware.AuthMiddleware(authService))
 		if rateLimiter != nil {
 			messages.POST("", middleware.MessageRateLimitMiddleware(rateLimiter), handlers.Message.Send)
+			messages.POST("/:id/forward", middleware.MessageRateLimitMiddleware(rateLimiter), handlers.Message.Forward)
 		} else {
 			messages.POST("", handlers.Message.Send)
+			messages.POST("/:id/forward", handlers.Message.Forward)
 		}
 		messages.GET("", handlers.Message.List)
+		messages.GET("/pinned", handlers.Message.ListPinned)
 		messages.GET("/:id", handlers.Message.GetByID)
 		messages.PUT("/:id", handlers.Message.Update)
+		messages.GET("/:id/versions", handlers.Message.ListVersions)
 		messages.DELETE("/:id", handlers.Message.Delete)
 		messages.DELETE("/:id/hard", handlers.Message.HardDelete)
+		messages.DELETE("/:id/for-me", handlers.Message.DeleteForMe)
 		messages.POST("/:id/read", handlers.Message.MarkRead)
 		messages.POST("/:id/delivered", handlers.Message.MarkDelivered)
+		messages.GET("/:id/reactions", handlers.Message.ListReactions)
+		messages.POST("/:id/reactions", handlers.Message.AddReaction)
+		messages.DELETE("/:id/reactions", handlers.Message.RemoveReaction)
+		messages.POST("/:id/star", handlers.Message.Star)
+		messages.DELETE("/:id/star", handlers.Message.Unstar)
+		messages.POST("/:id/pin", handlers.Message.Pin)
+		messages.DELETE("/:id/pin", handlers.Message.Unpin)
+
+		me := s.engine.Group("/v1/users/me")
+		me.Use(middleware.AuthMiddleware(authService))
+		me.GET("/starred", handlers.Message.ListStarred)
+		me.GET("/mentions", handlers.Message.ListMentions)
+	}
+
+	if handlers.Attachment != nil {
+		attachments := s.engine.Group("/v1/attachments")
+		attachments.Use(middleware.AuthMiddleware(authService))
+		attachments.POST("/:id/view", handlers.Attachment.View)
+	}
+
+	if handlers.LinkPreview != nil {
+		previews := s.engine.Group("/v1/link-previews")
+		previews.Use(middleware.AuthMiddleware(authService))
+		if rateLimiter != nil {
+			previews.POST("", middleware.LinkPreviewRateLimitMiddleware(rateLimiter), handlers.LinkPreview.Create)
+		} else {
+			previews.POST("", handlers.LinkPreview.Create)
+		}
+	}
+
+	if handlers.Poll != nil {
+		polls := s.engine.Group("/v1/polls")
+		polls.Use(middleware.AuthMiddleware(authService))
+		polls.GET("/:id", handlers.Poll.GetByID)
+		polls.POST("/:id/votes", handlers.Poll.Vote)
+		polls.DELETE("/:id/votes", handlers.Poll.Retract)
+		polls.POST("/:id/close", handlers.Poll.Close)
+	}
+
+	if handlers.ScheduledMessage != nil {
+		scheduled := s.engine.Group("/v1/scheduled-messages")
+		scheduled.Use(middleware.AuthMiddleware(authService))
+		scheduled.POST("", handlers.ScheduledMessage.Create)
+		scheduled.GET("", handlers.ScheduledMessage.List)
+		scheduled.GET("/:id", handlers.ScheduledMessage.GetByID)
+		scheduled.POST("/:id/cancel", handlers.ScheduledMessage.Cancel)
+		scheduled.POST("/:id/reschedule", handlers.ScheduledMessage.Reschedule)
+	}
+
+	if handlers.Sync != nil {
+		sync := s.engine.Group("/v1/sync")
+		sync.Use(middleware.AuthMiddleware(authService))
+		sync.POST("", handlers.Sync.Sync)
+	}
+
+	if handlers.Delivery != nil {
+		envelopes := s.engine.Group("/v1/envelopes")
+		envelopes.Use(middleware.AuthMiddleware(authService))
+		envelopes.GET("", handlers.Delivery.Pending)
+		envelopes.POST("/ack", handlers.Delivery.Ack)
+	}
+
+	if handlers.Command != nil {
+		cmds := s.engine.Group("/v1/commands")
+		cmds.Use(middleware.AuthMiddleware(authService))
+		cmds.GET("", handlers.Command.List)
+		cmds.POST("/:id/undo", handlers.Command.Undo)
 	}
 
 	if handlers.Conversation != nil {
@@ -158,9 +246,28 @@ func (s *Server) SetupRoutes(handlers *Handlers, authService *services.AuthServi
 		conversations.POST("/:id/unpin", handlers.Conversation.Unpin)
 		conversations.POST("/:id/archive", handlers.Conversation.Archive)
 		conversations.POST("/:id/unarchive", handlers.Conversation.Unarchive)
+		conversations.POST("/:id/clear", handlers.Conversation.Clear)
+		conversations.PUT("/:id/disappearing", handlers.Conversation.SetDisappearingMode)
+		conversations.GET("/:id/permissions", handlers.Conversation.GetPermissions)
+		conversations.PUT("/:id/permissions", handlers.Conversation.SetPermissions)
 		conversations.POST("/:id/read-sequence", handlers.Conversation.UpdateLastReadSequence)
 		conversations.GET("/:id/sequence", handlers.Conversation.GetSequence)
 		conversations.POST("/:id/sequence", handlers.Conversation.IncrementSequence)
+		conversations.GET("/labels", handlers.Conversation.ListLabels)
+		conversations.POST("/labels", handlers.Conversation.CreateLabel)
+		conversations.PUT("/labels/order", handlers.Conversation.ReorderLabels)
+		conversations.PUT("/labels/:label_id", handlers.Conversation.UpdateLabel)
+		conversations.DELETE("/labels/:label_id", handlers.Conversation.DeleteLabel)
+		conversations.GET("/:id/labels", handlers.Conversation.ListConversationLabels)
+		conversations.POST("/:id/labels/:label_id", handlers.Conversation.AssignLabel)
+		conversations.DELETE("/:id/labels/:label_id", handlers.Conversation.UnassignLabel)
+	}
+
+	if handlers.SenderKey != nil {
+		senderKeys := s.engine.Group("/v1/conversations/:id/sender-keys")
+		senderKeys.Use(middleware.AuthMiddleware(authService))
+		senderKeys.GET("", handlers.SenderKey.Get)
+		senderKeys.POST("", handlers.SenderKey.Distribute)
 	}
 
 	if handlers.User != nil {
@@ -199,6 +306,7 @@ func (s *Server) SetupRoutes(handlers *Handlers, authService *services.AuthServi
 		calls.GET("/user", handlers.Call.ListByUser)
 		calls.GET("/active", handlers.Call.ActiveCalls)
 		calls.GET("/missed", handlers.Call.MissedCalls)
+		calls.GET("/ice-servers", handlers.Call.ICEServers)
 		calls.POST("/:id/participants", handlers.Call.AddParticipant)
 		calls.DELETE("/:id/participants/:user_id", handlers.Call.RemoveParticipant)
 		calls.GET("/:id/participants", handlers.Call.ListParticipants)
@@ -235,6 +343,8 @@ func (s *Server) SetupRoutes(handlers *Handlers, authService *services.AuthServi
 		enc.Use(middleware.AuthMiddleware(authService))
 		enc.POST("/identity", handlers.Encryption.UploadIdentityKey)
 		enc.GET("/identity", handlers.Encryption.GetIdentityKey)
+		enc.GET("/identity/history", handlers.Encryption.GetIdentityKeyHistory)
+		enc.GET("/identity/fingerprint", handlers.Encryption.GetFingerprint)
 		enc.PUT("/identity/:id/deactivate", handlers.Encryption.DeactivateIdentityKey)
 		enc.DELETE("/identity/:id", handlers.Encryption.DeleteIdentityKey)
 		enc.POST("/signed-prekeys", handlers.Encryption.UploadSignedPreKey)
@@ -243,9 +353,15 @@ func (s *Server) SetupRoutes(handlers *Handlers, authService *services.AuthServi
 		enc.POST("/signed-prekeys/rotate", handlers.Encryption.RotateSignedPreKey)
 		enc.PUT("/signed-prekeys/:id/deactivate", handlers.Encryption.DeactivateSignedPreKey)
 		enc.POST("/onetime-prekeys", handlers.Encryption.UploadOneTimePreKeys)
-		enc.POST("/onetime-prekeys/consume", handlers.Encryption.ConsumeOneTimePreKey)
+		enc.POST("/onetime-prekeys/batch", handlers.Encryption.UploadOneTimePreKeyBatch)
 		enc.GET("/onetime-prekeys/count", handlers.Encryption.GetPreKeyCount)
-		enc.GET("/bundles", handlers.Encryption.GetKeyBundle)
+		if rateLimiter != nil {
+			enc.GET("/bundles", middleware.KeyBundleRateLimitMiddleware(rateLimiter), handlers.Encryption.GetKeyBundle)
+			enc.POST("/bundles/batch", middleware.KeyBundleRateLimitMiddleware(rateLimiter), handlers.Encryption.GetKeyBundles)
+		} else {
+			enc.GET("/bundles", handlers.Encryption.GetKeyBundle)
+			enc.POST("/bundles/batch", handlers.Encryption.GetKeyBundles)
+		}
 		enc.GET("/keys/active", handlers.Encryption.HasActiveKeys)
 	}
 
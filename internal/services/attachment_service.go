@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sentinal-chat/internal/domain/message"
+	"sentinal-chat/internal/repository"
+	"sentinal-chat/internal/storage"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// AttachmentService hands out attachment files whose access is restricted
+// beyond the message list, such as view-once media, and removes their objects
+// from S3 once they may no longer be downloaded.
+type AttachmentService struct {
+	db               repository.DBTX
+	messageRepo      repository.MessageRepository
+	conversationRepo repository.ConversationRepository
+	storage          *storage.Client
+	eventPublisher   *EventPublisher
+	viewTTL          time.Duration
+	maxAge           time.Duration
+}
+
+// ViewOnceGrant is a short-lived download URL for one view of a view-once attachment.
+type ViewOnceGrant struct {
+	Attachment message.Attachment
+	MessageID  uuid.UUID
+	URL        string
+	ViewedAt   time.Time
+	ExpiresAt  time.Time
+}
+
+// NewAttachmentService creates an attachment service. View-once download URLs
+// expire after viewTTL, and the object is deleted once that window has passed
+// for the last recipient, or maxAge after the upload when some recipients
+// never open it.
+func NewAttachmentService(db repository.DBTX, messageRepo repository.MessageRepository, conversationRepo repository.ConversationRepository, storage *storage.Client, eventPublisher *EventPublisher, viewTTL, maxAge time.Duration) *AttachmentService {
+	if viewTTL <= 0 {
+		viewTTL = time.Minute
+	}
+	if maxAge <= 0 {
+		maxAge = 14 * 24 * time.Hour
+	}
+	return &AttachmentService{
+		db:               db,
+		messageRepo:      messageRepo,
+		conversationRepo: conversationRepo,
+		storage:          storage,
+		eventPublisher:   eventPublisher,
+		viewTTL:          viewTTL,
+		maxAge:           maxAge,
+	}
+}
+
+// ViewOnce issues a presigned GET for a view-once attachment to a recipient who
+// has not opened it yet. The view is recorded in the same transaction that
+// publishes attachment:viewed to the sender, so a second request from the same
+// user fails with ErrInvalidTransition even when both race.
+func (s *AttachmentService) ViewOnce(ctx context.Context, attachmentID, userID uuid.UUID) (ViewOnceGrant, error) {
+	if s.storage == nil {
+		return ViewOnceGrant{}, sentinal_errors.ErrServiceUnavailable
+	}
+	attachment, err := s.messageRepo.GetAttachmentByID(ctx, attachmentID)
+	if err != nil {
+		return ViewOnceGrant{}, err
+	}
+	if !attachment.ViewOnce {
+		return ViewOnceGrant{}, sentinal_errors.ErrInvalidInput
+	}
+
+	messageID, err := s.messageRepo.GetAttachmentMessageID(ctx, attachmentID)
+	if err != nil {
+		return ViewOnceGrant{}, err
+	}
+	msg, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return ViewOnceGrant{}, err
+	}
+	if msg.DeletedAt.Valid {
+		return ViewOnceGrant{}, sentinal_errors.ErrNotFound
+	}
+	if msg.SenderID == userID {
+		return ViewOnceGrant{}, sentinal_errors.ErrForbidden
+	}
+	ok, err := s.conversationRepo.IsParticipant(ctx, msg.ConversationID, userID)
+	if err != nil {
+		return ViewOnceGrant{}, err
+	}
+	if !ok {
+		return ViewOnceGrant{}, sentinal_errors.ErrForbidden
+	}
+	if !attachment.ObjectKey.Valid || time.Since(attachment.CreatedAt) > s.maxAge {
+		return ViewOnceGrant{}, sentinal_errors.ErrInvalidTransition
+	}
+
+	url, err := s.storage.PresignGet(ctx, attachment.ObjectKey.String, s.viewTTL)
+	if err != nil {
+		return ViewOnceGrant{}, err
+	}
+
+	viewedAt := time.Now()
+	record := func(repo repository.MessageRepository) error {
+		if err := repo.RecordAttachmentView(ctx, attachmentID, userID, viewedAt); err != nil {
+			if errors.Is(err, sentinal_errors.ErrAlreadyExists) {
+				return sentinal_errors.ErrInvalidTransition
+			}
+			return err
+		}
+		pending, err := repo.CountPendingAttachmentViewers(ctx, attachmentID, msg.ConversationID, msg.SenderID, msg.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if pending == 0 {
+			return repo.MarkViewOnceViewed(ctx, attachmentID)
+		}
+		return nil
+	}
+
+	if s.db == nil {
+		err = record(s.messageRepo)
+	} else {
+		err = repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+			if err := record(repository.NewMessageRepository(tx)); err != nil {
+				return err
+			}
+			if s.eventPublisher == nil {
+				return nil
+			}
+			return s.eventPublisher.PublishAttachmentViewed(ctx, tx, attachmentID, msg.ID, msg.ConversationID, msg.SenderID, userID, viewedAt)
+		})
+	}
+	if err != nil {
+		return ViewOnceGrant{}, err
+	}
+
+	return ViewOnceGrant{
+		Attachment: attachment,
+		MessageID:  msg.ID,
+		URL:        url,
+		ViewedAt:   viewedAt,
+		ExpiresAt:  viewedAt.Add(s.viewTTL),
+	}, nil
+}
+
+// PurgeViewedObjects deletes the S3 objects of view-once attachments that every
+// recipient has viewed and whose last download URL has expired, and of those
+// older than maxAge. It returns how many objects were removed.
+func (s *AttachmentService) PurgeViewedObjects(ctx context.Context, limit int) (int, error) {
+	if s.storage == nil {
+		return 0, nil
+	}
+	attachments, err := s.messageRepo.GetViewedAttachmentsToPurge(ctx, time.Now().Add(-s.viewTTL), time.Now().Add(-s.maxAge), limit)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, a := range attachments {
+		if err := s.storage.DeleteObject(ctx, a.ObjectKey.String); err != nil {
+			return purged, err
+		}
+		if err := s.messageRepo.ClearAttachmentObject(ctx, a.ID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// orphanedAttachmentGrace keeps the orphan sweep away from attachments that a
+// send is still linking to its message.
+const orphanedAttachmentGrace = 10 * time.Minute
+
+// PurgeOrphanedObjects deletes attachments that no message links to anymore,
+// typically because their disappearing messages expired, together with their
+// S3 objects. It returns how many attachments were removed.
+func (s *AttachmentService) PurgeOrphanedObjects(ctx context.Context, limit int) (int, error) {
+	if s.storage == nil {
+		return 0, nil
+	}
+	attachments, err := s.messageRepo.GetOrphanedAttachments(ctx, time.Now().Add(-orphanedAttachmentGrace), limit)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, a := range attachments {
+		if a.ObjectKey.Valid {
+			if err := s.storage.DeleteObject(ctx, a.ObjectKey.String); err != nil {
+				return purged, err
+			}
+		}
+		if err := s.messageRepo.DeleteAttachment(ctx, a.ID); err != nil && !errors.Is(err, sentinal_errors.ErrNotFound) {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
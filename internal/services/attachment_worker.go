@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AttachmentWorker periodically deletes the S3 objects of view-once
+// attachments that have been viewed by every recipient or have expired unopened.
+type AttachmentWorker struct {
+	*IntervalWorker
+	attachmentService *AttachmentService
+	batchSize         int
+}
+
+func NewAttachmentWorker(attachmentService *AttachmentService, logger *zap.Logger) *AttachmentWorker {
+	w := &AttachmentWorker{
+		attachmentService: attachmentService,
+		batchSize:         100,
+	}
+	w.IntervalWorker = NewIntervalWorker("attachment_worker", 30*time.Second, logger, w.processBatch)
+	return w
+}
+
+func (w *AttachmentWorker) processBatch(ctx context.Context) error {
+	return drainBatches(ctx, w.batchSize, w.attachmentService.PurgeViewedObjects)
+}
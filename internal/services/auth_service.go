@@ -15,6 +15,7 @@ import (
 
 	"sentinal-chat/config"
 	"sentinal-chat/internal/domain/user"
+	"sentinal-chat/internal/redis"
 	"sentinal-chat/internal/repository"
 	sentinal_errors "sentinal-chat/pkg/errors"
 
@@ -26,15 +27,18 @@ import (
 // AuthService handles user authentication and JWT management.
 type AuthService struct {
 	userRepo   repository.UserRepository
+	cache      *redis.CacheStore
 	jwtSecret  []byte
 	accessTTL  time.Duration
 	refreshTTL time.Duration
 }
 
-// NewAuthService creates an auth service with JWT configuration.
-func NewAuthService(userRepo repository.UserRepository, cfg *config.Config) *AuthService {
+// NewAuthService creates an auth service with JWT configuration. Sessions are
+// cached in cache when it is non-nil.
+func NewAuthService(userRepo repository.UserRepository, cfg *config.Config, cache *redis.CacheStore) *AuthService {
 	return &AuthService{
 		userRepo:   userRepo,
+		cache:      cache,
 		jwtSecret:  []byte(cfg.JWTSecret),
 		accessTTL:  time.Duration(cfg.JWTExpiryHours) * time.Hour,
 		refreshTTL: time.Duration(cfg.RefreshExpiry) * 24 * time.Hour,
@@ -239,7 +243,9 @@ func (s *AuthService) Login(ctx context.Context, in LoginInput) (AuthResponse, e
 		return AuthResponse{}, err
 	}
 
-	_ = s.userRepo.UpdateOnlineStatus(ctx, u.ID, true)
+	if err := s.userRepo.UpdateOnlineStatus(ctx, u.ID, true); err == nil && s.cache != nil {
+		_ = s.cache.InvalidateUser(ctx, u.ID)
+	}
 
 	accessToken, expiresIn, err := s.newAccessToken(u.ID, session.ID, toNullUUID(session.DeviceID))
 	if err != nil {
@@ -282,6 +288,7 @@ func (s *AuthService) Refresh(ctx context.Context, in RefreshInput) (AuthRespons
 
 	if !s.compareRefreshToken(session.RefreshTokenHash, in.RefreshToken) {
 		_ = s.userRepo.RevokeSession(ctx, session.ID)
+		s.invalidateSession(ctx, session.ID)
 		return AuthResponse{}, sentinal_errors.ErrUnauthorized
 	}
 
@@ -296,6 +303,7 @@ func (s *AuthService) Refresh(ctx context.Context, in RefreshInput) (AuthRespons
 	if err := s.userRepo.UpdateSession(ctx, session); err != nil {
 		return AuthResponse{}, err
 	}
+	s.invalidateSession(ctx, session.ID)
 
 	accessToken, expiresIn, err := s.newAccessToken(session.UserID, session.ID, toNullUUID(session.DeviceID))
 	if err != nil {
@@ -330,11 +338,19 @@ func (s *AuthService) Logout(ctx context.Context, sessionID string) error {
 	if err != nil {
 		return sentinal_errors.ErrInvalidInput
 	}
-	return s.userRepo.RevokeSession(ctx, parsedID)
+	if err := s.userRepo.RevokeSession(ctx, parsedID); err != nil {
+		return err
+	}
+	s.invalidateSession(ctx, parsedID)
+	return nil
 }
 
 func (s *AuthService) LogoutAll(ctx context.Context, userID uuid.UUID) error {
-	return s.userRepo.RevokeAllUserSessions(ctx, userID)
+	if err := s.userRepo.RevokeAllUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	s.invalidateUserSessions(ctx, userID)
+	return nil
 }
 
 func (s *AuthService) Sessions(ctx context.Context, userID uuid.UUID) ([]SessionInfo, error) {
@@ -427,8 +443,15 @@ func (s *AuthService) PasswordReset(ctx context.Context, in ResetInput) error {
 	if err := s.userRepo.UpdateUser(ctx, u); err != nil {
 		return err
 	}
+	if s.cache != nil {
+		_ = s.cache.InvalidateUser(ctx, u.ID)
+	}
 
-	return s.userRepo.RevokeAllUserSessions(ctx, u.ID)
+	if err := s.userRepo.RevokeAllUserSessions(ctx, u.ID); err != nil {
+		return err
+	}
+	s.invalidateUserSessions(ctx, u.ID)
+	return nil
 }
 
 func (s *AuthService) ParseAccessToken(tokenString string) (AccessClaims, error) {
@@ -454,7 +477,35 @@ func (s *AuthService) ParseAccessToken(tokenString string) (AccessClaims, error)
 	return *claims, nil
 }
 
+// ValidateSession checks that the session is live and belongs to userID. It is
+// called on every authenticated request, so the session is read through the
+// cache; revoking a session must invalidate its cache entry.
 func (s *AuthService) ValidateSession(ctx context.Context, sessionID uuid.UUID, userID uuid.UUID) (user.UserSession, error) {
+	if s.cache != nil {
+		cached, err := s.cache.GetSession(ctx, sessionID)
+		if err == nil && cached != nil && time.Now().Before(cached.ExpiresAt) {
+			if cached.UserID != userID {
+				return user.UserSession{}, sentinal_errors.ErrUnauthorized
+			}
+			session := user.UserSession{
+				ID:        cached.SessionID,
+				UserID:    cached.UserID,
+				ExpiresAt: cached.ExpiresAt,
+			}
+			if cached.DeviceID != "" {
+				if deviceID, err := uuid.Parse(cached.DeviceID); err == nil {
+					session.DeviceID = &deviceID
+				}
+			}
+			return session, nil
+		}
+	}
+
+	var token string
+	var tokenErr error
+	if s.cache != nil {
+		token, tokenErr = s.cache.SessionReadToken(ctx, sessionID, userID)
+	}
 	session, err := s.userRepo.GetSessionByID(ctx, sessionID)
 	if err != nil {
 		return user.UserSession{}, err
@@ -462,9 +513,24 @@ func (s *AuthService) ValidateSession(ctx context.Context, sessionID uuid.UUID,
 	if session.UserID != userID {
 		return user.UserSession{}, sentinal_errors.ErrUnauthorized
 	}
+	if s.cache != nil && tokenErr == nil {
+		_ = s.cache.SetSessionFromEntity(ctx, &session, token)
+	}
 	return session, nil
 }
 
+func (s *AuthService) invalidateSession(ctx context.Context, sessionID uuid.UUID) {
+	if s.cache != nil {
+		_ = s.cache.InvalidateSession(ctx, sessionID)
+	}
+}
+
+func (s *AuthService) invalidateUserSessions(ctx context.Context, userID uuid.UUID) {
+	if s.cache != nil {
+		_ = s.cache.InvalidateUserSessions(ctx, userID)
+	}
+}
+
 func HTTPStatus(err error) int {
 	switch {
 	case errors.Is(err, sentinal_errors.ErrInvalidInput):
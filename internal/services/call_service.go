@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"sentinal-chat/internal/domain/call"
+	"sentinal-chat/internal/domain/conversation"
 	"sentinal-chat/internal/redis"
 	"sentinal-chat/internal/repository"
 	sentinal_errors "sentinal-chat/pkg/errors"
@@ -15,18 +16,67 @@ import (
 
 // CallService handles voice/video calls and WebRTC signaling.
 type CallService struct {
-	db             repository.DBTX
-	repo           repository.CallRepository
-	signalingStore *redis.SignalingStore
-	eventPublisher *EventPublisher
+	db               repository.DBTX
+	repo             repository.CallRepository
+	conversationRepo repository.ConversationRepository
+	signalingStore   *redis.SignalingStore
+	eventPublisher   *EventPublisher
+	iceConfig        ICEConfig
+}
+
+// ICEConfig lists the STUN/TURN servers handed to WebRTC clients. TURN servers
+// are only advertised when TURNSecret is set, and their credentials are valid
+// for CredentialTTL.
+type ICEConfig struct {
+	STUNURLs      []string
+	TURNURLs      []string
+	TURNSecret    string
+	CredentialTTL time.Duration
 }
 
 // NewCallService creates a call service with dependencies.
-func NewCallService(db repository.DBTX, repo repository.CallRepository, signalingStore *redis.SignalingStore, eventPublisher *EventPublisher) *CallService {
-	return &CallService{db: db, repo: repo, signalingStore: signalingStore, eventPublisher: eventPublisher}
+func NewCallService(db repository.DBTX, repo repository.CallRepository, conversationRepo repository.ConversationRepository, signalingStore *redis.SignalingStore, eventPublisher *EventPublisher, iceConfig ICEConfig) *CallService {
+	if iceConfig.CredentialTTL <= 0 {
+		iceConfig.CredentialTTL = 24 * time.Hour
+	}
+	return &CallService{db: db, repo: repo, conversationRepo: conversationRepo, signalingStore: signalingStore, eventPublisher: eventPublisher, iceConfig: iceConfig}
+}
+
+// GetICEServers returns the configured STUN servers and, when a TURN secret is
+// configured, TURN servers with credentials issued to userID. The returned time
+// is when the TURN credentials expire.
+func (s *CallService) GetICEServers(ctx context.Context, userID uuid.UUID) ([]call.ICEServer, time.Time, error) {
+	if userID == uuid.Nil {
+		return nil, time.Time{}, sentinal_errors.ErrInvalidInput
+	}
+
+	servers := make([]call.ICEServer, 0, 2)
+	if len(s.iceConfig.STUNURLs) > 0 {
+		servers = append(servers, call.ICEServer{URLs: s.iceConfig.STUNURLs})
+	}
+
+	var expiresAt time.Time
+	if len(s.iceConfig.TURNURLs) > 0 && s.iceConfig.TURNSecret != "" && s.signalingStore != nil {
+		username, credential, exp := s.signalingStore.GenerateTURNCredentials(ctx, userID.String(), s.iceConfig.TURNSecret, s.iceConfig.CredentialTTL)
+		servers = append(servers, call.ICEServer{
+			URLs:       s.iceConfig.TURNURLs,
+			Username:   username,
+			Credential: credential,
+		})
+		expiresAt = exp
+	}
+
+	return servers, expiresAt, nil
 }
 
+// Create starts a call. The initiator must take part in the conversation and,
+// in a group, be allowed to start calls.
 func (s *CallService) Create(ctx context.Context, c *call.Call) error {
+	if s.conversationRepo != nil {
+		if _, _, err := authorizeAction(ctx, s.conversationRepo, c.ConversationID, c.InitiatedBy, conversation.ActionStartCalls); err != nil {
+			return err
+		}
+	}
 	if c.ID == uuid.Nil {
 		c.ID = uuid.New()
 	}
@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"time"
@@ -13,6 +12,7 @@ import (
 	"sentinal-chat/internal/domain/command"
 	"sentinal-chat/internal/domain/message"
 	"sentinal-chat/internal/repository"
+	sentinal_errors "sentinal-chat/pkg/errors"
 )
 
 // CommandExecutor executes commands with transactions and logging
@@ -58,10 +58,12 @@ func (e *CommandExecutor) Execute(ctx context.Context, cmd commands.Command) (*c
 	// Create log entry
 	payload, _ := cmd.ToJSON()
 	log := &command.CommandLog{
+		ID:          cmd.GetID(),
 		CommandType: cmd.GetType(),
 		UserID:      cmd.GetUserID(),
 		Status:      command.StatusPending,
 		Payload:     payload,
+		CreatedAt:   start,
 	}
 
 	if err := e.commandRepo.CreateLog(ctx, log); err != nil {
@@ -76,8 +78,6 @@ func (e *CommandExecutor) Execute(ctx context.Context, cmd commands.Command) (*c
 
 	var execErr error
 	switch c := cmd.(type) {
-	case *commands.SendMessageCommand:
-		execErr = e.executeSendMessage(ctx, c)
 	case *commands.DeleteMessageCommand:
 		execErr = e.executeDeleteMessage(ctx, c)
 	case *commands.EditMessageCommand:
@@ -100,10 +100,7 @@ func (e *CommandExecutor) Execute(ctx context.Context, cmd commands.Command) (*c
 		log.ErrorMessage = execErr.Error()
 	} else {
 		log.Status = command.StatusCompleted
-		if cmd.CanUndo() {
-			undoData, _ := cmd.ToJSON()
-			log.UndoData = undoData
-		}
+		setUndoData(log, cmd)
 	}
 
 	if updateErr := e.commandRepo.UpdateLog(ctx, log); updateErr != nil {
@@ -113,90 +110,161 @@ func (e *CommandExecutor) Execute(ctx context.Context, cmd commands.Command) (*c
 	return log, execErr
 }
 
-// executeSendMessage executes send message command
-func (e *CommandExecutor) executeSendMessage(ctx context.Context, cmd *commands.SendMessageCommand) error {
-	msg := message.Message{
-		ID:             uuid.New(),
-		ConversationID: cmd.ConversationID,
-		SenderID:       cmd.SenderID,
-		Content:        sql.NullString{String: cmd.Content, Valid: true},
-		CreatedAt:      time.Now(),
+// Record logs a command that a service already carried out inside tx, so it
+// shows up in the history and can be undone like an executed one.
+func (e *CommandExecutor) Record(ctx context.Context, tx repository.DBTX, cmd commands.Command) (*command.CommandLog, error) {
+	if err := cmd.Validate(); err != nil {
+		return nil, err
 	}
-
-	return repository.WithTx(ctx, e.db, func(tx repository.DBTX) error {
-		msgRepo := repository.NewMessageRepository(tx)
-		if err := msgRepo.Create(ctx, &msg); err != nil {
-			return err
-		}
-
-		if e.eventPublisher != nil {
-			if err := e.eventPublisher.PublishMessageNew(ctx, tx, msg.ID, msg.ConversationID, msg.SenderID); err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
+	payload, _ := cmd.ToJSON()
+	now := time.Now()
+	log := &command.CommandLog{
+		ID:          cmd.GetID(),
+		CommandType: cmd.GetType(),
+		UserID:      cmd.GetUserID(),
+		Status:      command.StatusCompleted,
+		Payload:     payload,
+		CreatedAt:   now,
+		ExecutedAt:  &now,
+	}
+	setUndoData(log, cmd)
+	if err := repository.NewCommandRepository(tx).CreateLog(ctx, log); err != nil {
+		return nil, err
+	}
+	return log, nil
 }
 
-// executeDeleteMessage executes delete message command
-func (e *CommandExecutor) executeDeleteMessage(ctx context.Context, cmd *commands.DeleteMessageCommand) error {
-	msg, err := e.messageRepo.GetByID(ctx, cmd.MessageID)
-	if err != nil {
-		return err
+// setUndoData stores the command state needed to reverse it while the undo
+// window is open.
+func setUndoData(log *command.CommandLog, cmd commands.Command) {
+	if !cmd.CanUndo() {
+		return
 	}
+	undoData, _ := cmd.ToJSON()
+	deadline := cmd.GetUndoDeadline()
+	log.UndoData = undoData
+	log.UndoDeadline = &deadline
+}
 
-	// Store original state for undo
-	cmd.OriginalContent = msg.Content.String
-
+// executeDeleteMessage soft deletes a message for everyone, or removes it
+// entirely when DeleteForAll is false. Only the sender may delete.
+func (e *CommandExecutor) executeDeleteMessage(ctx context.Context, cmd *commands.DeleteMessageCommand) error {
 	return repository.WithTx(ctx, e.db, func(tx repository.DBTX) error {
 		msgRepo := repository.NewMessageRepository(tx)
 
-		if cmd.DeleteForAll {
-			if err := msgRepo.SoftDelete(ctx, cmd.MessageID); err != nil {
-				return err
-			}
-		} else {
-			// Delete for me only - mark as deleted for user
+		msg, err := msgRepo.LockByID(ctx, cmd.MessageID)
+		if err != nil {
+			return err
+		}
+		if msg.SenderID != cmd.UserID {
+			return sentinal_errors.ErrForbidden
+		}
+		if msg.DeletedAt.Valid {
+			return sentinal_errors.ErrInvalidTransition
+		}
+		cmd.ConversationID = msg.ConversationID
+
+		if !cmd.DeleteForAll {
 			if err := msgRepo.HardDelete(ctx, cmd.MessageID); err != nil {
 				return err
 			}
+			return e.publishMessageDeleted(ctx, tx, msg.ID, msg.ConversationID, cmd.UserID, true)
 		}
 
-		return nil
+		// Store original state for undo
+		state, err := json.Marshal(map[string]interface{}{"deleted_at": nil})
+		if err != nil {
+			return err
+		}
+		cmd.OriginalState = state
+		if err := msgRepo.SoftDelete(ctx, cmd.MessageID); err != nil {
+			return err
+		}
+		return e.publishMessageDeleted(ctx, tx, msg.ID, msg.ConversationID, cmd.UserID, true)
 	})
 }
 
-// executeEditMessage executes edit message command
+// executeEditMessage snapshots the current ciphertexts into a new message
+// version, replaces them with the edited ones and publishes message:edited.
+// Sender-key group messages carry one shared ciphertext instead of per-device
+// ones and cannot be edited.
 func (e *CommandExecutor) executeEditMessage(ctx context.Context, cmd *commands.EditMessageCommand) error {
-	msg, err := e.messageRepo.GetByID(ctx, cmd.MessageID)
-	if err != nil {
-		return err
-	}
-
-	// Store previous content
-	cmd.PreviousContent = msg.Content.String
-
 	return repository.WithTx(ctx, e.db, func(tx repository.DBTX) error {
 		msgRepo := repository.NewMessageRepository(tx)
 
-		// Create version record
+		msg, err := msgRepo.LockByID(ctx, cmd.MessageID)
+		if err != nil {
+			return err
+		}
+		if msg.SenderID != cmd.UserID {
+			return sentinal_errors.ErrForbidden
+		}
+		if msg.DeletedAt.Valid {
+			return sentinal_errors.ErrInvalidTransition
+		}
+		if len(msg.Ciphertext) > 0 {
+			return sentinal_errors.ErrInvalidInput
+		}
+
+		current, err := msgRepo.GetCiphertexts(ctx, msg.ID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
 		version := &command.MessageVersion{
-			MessageID:     cmd.MessageID,
-			Content:       msg.Content.String,
-			EditedBy:      cmd.UserID,
-			VersionNumber: 1, // TODO: Get next version number
+			ID:          uuid.New(),
+			MessageID:   msg.ID,
+			EditedBy:    cmd.UserID,
+			EditedAt:    now,
+			Ciphertexts: make([]command.MessageVersionCiphertext, 0, len(current)),
+		}
+		for _, c := range current {
+			version.Ciphertexts = append(version.Ciphertexts, command.MessageVersionCiphertext{
+				ID:                uuid.New(),
+				RecipientUserID:   c.RecipientUserID,
+				RecipientDeviceID: c.RecipientDeviceID,
+				SenderDeviceID:    c.SenderDeviceID,
+				Ciphertext:        c.Ciphertext,
+				Header:            c.Header,
+				CreatedAt:         c.CreatedAt,
+			})
+		}
+		if err := msgRepo.CreateVersion(ctx, version); err != nil {
+			return err
 		}
 
-		// Save version (would need a versions repo in real implementation)
-		_ = version
+		if err := msgRepo.DeleteCiphertexts(ctx, msg.ID); err != nil {
+			return err
+		}
+		for _, c := range cmd.Ciphertexts {
+			if err := msgRepo.CreateCiphertext(ctx, &message.MessageCiphertext{
+				ID:                uuid.New(),
+				MessageID:         msg.ID,
+				RecipientUserID:   c.RecipientUserID,
+				RecipientDeviceID: c.RecipientDeviceID,
+				SenderDeviceID:    uuid.NullUUID{UUID: cmd.SenderDeviceID, Valid: true},
+				Ciphertext:        c.Ciphertext,
+				Header:            c.Header,
+				CreatedAt:         now,
+			}); err != nil {
+				return err
+			}
+		}
 
-		// Update message
-		msg.Content = sql.NullString{String: cmd.NewContent, Valid: true}
-		if err := msgRepo.Update(ctx, msg); err != nil {
+		if err := msgRepo.MarkAsEdited(ctx, msg.ID); err != nil {
 			return err
 		}
 
+		cmd.ConversationID = msg.ConversationID
+		cmd.PreviousVersion = version.VersionNumber
+
+		if e.eventPublisher != nil {
+			if err := e.eventPublisher.PublishMessageEdited(ctx, tx, msg.ID, msg.ConversationID, cmd.UserID, version.VersionNumber, now); err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
@@ -219,102 +287,206 @@ func (e *CommandExecutor) executeBulkArchive(ctx context.Context, cmd *commands.
 		} else if !isParticipant {
 			result.Success = false
 			result.Error = "not a participant"
-		} else {
-			// Archive conversation for user
-			// Note: This would need a conversation archive method
-			_ = e.convRepo.ArchiveConversation(ctx, convID, cmd.UserID)
+		} else if err := e.convRepo.ArchiveConversation(ctx, convID, cmd.UserID); err != nil {
+			result.Success = false
+			result.Error = err.Error()
 		}
 
 		results = append(results, result)
 	}
 
 	cmd.Results = results
-	return nil
+	for _, result := range results {
+		if result.Success {
+			return nil
+		}
+	}
+	return errors.New("no conversation archived: " + results[0].Error)
 }
 
-// Undo undoes a previously executed command
-func (e *CommandExecutor) Undo(ctx context.Context, commandID uuid.UUID, userID uuid.UUID) error {
-	// Check if can undo
-	canUndo, err := e.commandRepo.CanUndo(ctx, commandID, userID)
-	if err != nil {
-		return err
-	}
-	if !canUndo {
-		return errors.New("cannot undo this command")
-	}
+// Undo reverses a completed command owned by userID while its undo window is
+// open, marks it UNDONE and notifies the user's other devices.
+func (e *CommandExecutor) Undo(ctx context.Context, commandID uuid.UUID, userID uuid.UUID) (*command.CommandLog, error) {
+	var log command.CommandLog
+	err := repository.WithTx(ctx, e.db, func(tx repository.DBTX) error {
+		cmdRepo := repository.NewCommandRepository(tx)
 
-	// Fetch command log
-	log, err := e.commandRepo.GetLogByID(ctx, commandID)
-	if err != nil {
-		return err
-	}
+		var err error
+		log, err = cmdRepo.LockLog(ctx, commandID)
+		if err != nil {
+			return err
+		}
+		if log.UserID != userID {
+			return sentinal_errors.ErrNotFound
+		}
+		now := time.Now()
+		if !log.IsUndoable(now) {
+			return sentinal_errors.ErrInvalidTransition
+		}
 
-	// Parse undo data and execute reverse operation
-	var undoErr error
-	switch log.CommandType {
-	case "SendMessage":
-		var cmd commands.SendMessageCommand
-		if err := json.Unmarshal(log.UndoData, &cmd); err == nil {
-			undoErr = e.undoSendMessage(ctx, &cmd)
+		switch log.CommandType {
+		case "SendMessage":
+			var cmd commands.SendMessageCommand
+			if err := json.Unmarshal(log.UndoData, &cmd); err != nil {
+				return err
+			}
+			err = e.undoSendMessage(ctx, tx, &cmd)
+		case "DeleteMessage":
+			var cmd commands.DeleteMessageCommand
+			if err := json.Unmarshal(log.UndoData, &cmd); err != nil {
+				return err
+			}
+			err = e.undoDeleteMessage(ctx, tx, &cmd)
+		case "EditMessage":
+			var cmd commands.EditMessageCommand
+			if err := json.Unmarshal(log.UndoData, &cmd); err != nil {
+				return err
+			}
+			err = e.undoEditMessage(ctx, tx, &cmd)
+		case "BulkArchive":
+			var cmd commands.BulkArchiveCommand
+			if err := json.Unmarshal(log.UndoData, &cmd); err != nil {
+				return err
+			}
+			err = e.undoBulkArchive(ctx, tx, &cmd)
+		default:
+			err = sentinal_errors.ErrInvalidInput
 		}
-	case "DeleteMessage":
-		var cmd commands.DeleteMessageCommand
-		if err := json.Unmarshal(log.UndoData, &cmd); err == nil {
-			undoErr = e.undoDeleteMessage(ctx, &cmd)
+		if err != nil {
+			return err
 		}
-	case "EditMessage":
-		var cmd commands.EditMessageCommand
-		if err := json.Unmarshal(log.UndoData, &cmd); err == nil {
-			undoErr = e.undoEditMessage(ctx, &cmd)
+
+		log.Status = command.StatusUndone
+		log.UndoneAt = &now
+		if err := cmdRepo.UpdateLog(ctx, &log); err != nil {
+			return err
 		}
-	case "BulkArchive":
-		var cmd commands.BulkArchiveCommand
-		if err := json.Unmarshal(log.UndoData, &cmd); err == nil {
-			undoErr = e.undoBulkArchive(ctx, &cmd)
+
+		if e.eventPublisher != nil {
+			return e.eventPublisher.PublishCommandUndone(ctx, tx, log.ID, log.CommandType, userID, now)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return &log, nil
+}
 
-	if undoErr != nil {
-		return undoErr
+// undoSendMessage soft deletes the sent message
+func (e *CommandExecutor) undoSendMessage(ctx context.Context, tx repository.DBTX, cmd *commands.SendMessageCommand) error {
+	msgRepo := repository.NewMessageRepository(tx)
+	msg, err := msgRepo.LockByID(ctx, cmd.MessageID)
+	if err != nil {
+		return err
 	}
-
-	// Mark as undone
-	now := time.Now()
-	log.Status = command.StatusUndone
-	log.UndoneAt = &now
-
-	return e.commandRepo.UpdateLog(ctx, &log)
+	if msg.DeletedAt.Valid {
+		return sentinal_errors.ErrInvalidTransition
+	}
+	if err := msgRepo.SoftDelete(ctx, cmd.MessageID); err != nil {
+		return err
+	}
+	return e.publishMessageDeleted(ctx, tx, msg.ID, msg.ConversationID, cmd.SenderID, true)
 }
 
-// undoSendMessage deletes the sent message
-func (e *CommandExecutor) undoSendMessage(ctx context.Context, cmd *commands.SendMessageCommand) error {
-	// Find and delete the message
-	// In a real implementation, we'd need to track the message ID created
-	return nil
+// undoDeleteMessage restores the soft-deleted message
+func (e *CommandExecutor) undoDeleteMessage(ctx context.Context, tx repository.DBTX, cmd *commands.DeleteMessageCommand) error {
+	msgRepo := repository.NewMessageRepository(tx)
+	msg, err := msgRepo.LockByID(ctx, cmd.MessageID)
+	if err != nil {
+		return err
+	}
+	if err := msgRepo.Restore(ctx, cmd.MessageID); err != nil {
+		return err
+	}
+	return e.publishMessageDeleted(ctx, tx, msg.ID, msg.ConversationID, cmd.UserID, false)
 }
 
-// undoDeleteMessage restores the deleted message
-func (e *CommandExecutor) undoDeleteMessage(ctx context.Context, cmd *commands.DeleteMessageCommand) error {
-	// Restore soft-deleted message
-	return nil
+func (e *CommandExecutor) publishMessageDeleted(ctx context.Context, tx repository.DBTX, msgID, convID, actorID uuid.UUID, deleted bool) error {
+	if e.eventPublisher == nil {
+		return nil
+	}
+	return e.eventPublisher.PublishMessageDeleted(ctx, tx, msgID, convID, actorID, deleted)
 }
 
-// undoEditMessage reverts to previous version
-func (e *CommandExecutor) undoEditMessage(ctx context.Context, cmd *commands.EditMessageCommand) error {
-	// Restore previous content
+// undoEditMessage puts back the ciphertexts saved by the edit and drops that
+// version. Only the most recent edit can be undone.
+func (e *CommandExecutor) undoEditMessage(ctx context.Context, tx repository.DBTX, cmd *commands.EditMessageCommand) error {
+	msgRepo := repository.NewMessageRepository(tx)
+
+	if _, err := msgRepo.LockByID(ctx, cmd.MessageID); err != nil {
+		return err
+	}
+	latest, err := msgRepo.GetLatestVersion(ctx, cmd.MessageID)
+	if err != nil {
+		return err
+	}
+	if latest.VersionNumber != cmd.PreviousVersion {
+		return sentinal_errors.ErrInvalidTransition
+	}
+
+	if err := msgRepo.DeleteCiphertexts(ctx, cmd.MessageID); err != nil {
+		return err
+	}
+	for _, c := range latest.Ciphertexts {
+		if err := msgRepo.CreateCiphertext(ctx, &message.MessageCiphertext{
+			ID:                uuid.New(),
+			MessageID:         cmd.MessageID,
+			RecipientUserID:   c.RecipientUserID,
+			RecipientDeviceID: c.RecipientDeviceID,
+			SenderDeviceID:    c.SenderDeviceID,
+			Ciphertext:        c.Ciphertext,
+			Header:            c.Header,
+			CreatedAt:         c.CreatedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := msgRepo.DeleteVersion(ctx, latest.ID); err != nil {
+		return err
+	}
+	if latest.VersionNumber == 1 {
+		if err := msgRepo.UnmarkEdited(ctx, cmd.MessageID); err != nil {
+			return err
+		}
+	}
+
+	if e.eventPublisher != nil {
+		return e.eventPublisher.PublishMessageEdited(ctx, tx, cmd.MessageID, cmd.ConversationID, cmd.UserID, latest.VersionNumber-1, time.Now())
+	}
 	return nil
 }
 
 // undoBulkArchive unarchives conversations
-func (e *CommandExecutor) undoBulkArchive(ctx context.Context, cmd *commands.BulkArchiveCommand) error {
+func (e *CommandExecutor) undoBulkArchive(ctx context.Context, tx repository.DBTX, cmd *commands.BulkArchiveCommand) error {
+	convRepo := repository.NewConversationRepository(tx)
 	for _, result := range cmd.Results {
 		if result.Success {
-			e.convRepo.UnarchiveConversation(ctx, result.ConversationID, cmd.UserID)
+			if err := convRepo.UnarchiveConversation(ctx, result.ConversationID, cmd.UserID); err != nil && !errors.Is(err, sentinal_errors.ErrNotFound) {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+// ListCommands returns a page of the user's command history filtered by
+// command type and status.
+func (e *CommandExecutor) ListCommands(ctx context.Context, userID uuid.UUID, commandType, status string, page, limit int) ([]command.CommandLog, int64, error) {
+	switch command.Status(status) {
+	case "", command.StatusPending, command.StatusExecuting, command.StatusCompleted, command.StatusFailed, command.StatusUndone:
+	default:
+		return nil, 0, sentinal_errors.ErrInvalidInput
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	return e.commandRepo.ListCommands(ctx, userID, commandType, status, page, limit)
+}
+
 // GetCommandHistory returns command history for a user
 func (e *CommandExecutor) GetCommandHistory(ctx context.Context, userID uuid.UUID, limit int) ([]command.CommandLog, error) {
 	return e.commandRepo.GetCommandsByUser(ctx, userID, limit)
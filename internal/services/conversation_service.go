@@ -4,20 +4,57 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
 	"time"
 
+	"sentinal-chat/internal/commands"
+	"sentinal-chat/internal/domain/command"
 	"sentinal-chat/internal/domain/conversation"
+	"sentinal-chat/internal/domain/message"
 	"sentinal-chat/internal/repository"
 	sentinal_errors "sentinal-chat/pkg/errors"
 
 	"github.com/google/uuid"
 )
 
+// Disappearing message modes a conversation can be set to.
+const (
+	DisappearingOff     = "OFF"
+	Disappearing24Hours = "24_HOURS"
+	Disappearing7Days   = "7_DAYS"
+	Disappearing90Days  = "90_DAYS"
+)
+
+// maxDisappearingTTL bounds per-message timers to the longest conversation mode.
+const maxDisappearingTTL = 90 * 24 * time.Hour
+
+var disappearingModeTTLs = map[string]time.Duration{
+	Disappearing24Hours: 24 * time.Hour,
+	Disappearing7Days:   7 * 24 * time.Hour,
+	Disappearing90Days:  maxDisappearingTTL,
+}
+
+// disappearingTTL returns how long messages sent to the conversation live, or
+// zero when disappearing messages are off.
+func disappearingTTL(c conversation.Conversation) time.Duration {
+	if c.DisappearingMode == "" || c.DisappearingMode == DisappearingOff {
+		return 0
+	}
+	if c.MessageExpirySeconds.Valid && c.MessageExpirySeconds.Int32 > 0 {
+		return time.Duration(c.MessageExpirySeconds.Int32) * time.Second
+	}
+	return disappearingModeTTLs[c.DisappearingMode]
+}
+
 // ConversationService manages chat conversations and participants.
 type ConversationService struct {
-	db             repository.DBTX
-	repo           repository.ConversationRepository
-	eventPublisher *EventPublisher
+	db              repository.DBTX
+	repo            repository.ConversationRepository
+	eventPublisher  *EventPublisher
+	commandExecutor *CommandExecutor
 }
 
 // CreateConversationInput contains data needed to create a conversation.
@@ -30,8 +67,8 @@ type CreateConversationInput struct {
 }
 
 // NewConversationService creates a conversation service with dependencies.
-func NewConversationService(db repository.DBTX, repo repository.ConversationRepository, eventPublisher *EventPublisher) *ConversationService {
-	return &ConversationService{db: db, repo: repo, eventPublisher: eventPublisher}
+func NewConversationService(db repository.DBTX, repo repository.ConversationRepository, eventPublisher *EventPublisher, commandExecutor *CommandExecutor) *ConversationService {
+	return &ConversationService{db: db, repo: repo, eventPublisher: eventPublisher, commandExecutor: commandExecutor}
 }
 
 // Create validates input and creates a new conversation.
@@ -77,6 +114,7 @@ func (s *ConversationService) executeCreate(ctx context.Context, input CreateCon
 	if err != nil {
 		return conversation.Conversation{}, err
 	}
+	repository.InvalidateConversationCache(ctx, s.repo, result.ID)
 	return result, nil
 }
 
@@ -98,9 +136,9 @@ func (s *ConversationService) createDirect(ctx context.Context, input CreateConv
 	}
 
 	for _, participantID := range input.ParticipantIDs {
-		role := "MEMBER"
+		role := conversation.RoleMember
 		if participantID == input.CreatorID {
-			role = "OWNER"
+			role = conversation.RoleOwner
 		}
 		p := &conversation.Participant{
 			ConversationID: conv.ID,
@@ -121,16 +159,45 @@ func (s *ConversationService) GetUserConversations(ctx context.Context, userID u
 	return s.repo.GetUserConversations(ctx, userID, page, limit)
 }
 
+// GetUserConversationsByLabel lists the user's conversations carrying one of
+// their labels.
+func (s *ConversationService) GetUserConversationsByLabel(ctx context.Context, userID, labelID uuid.UUID, page, limit int) ([]conversation.Conversation, int64, error) {
+	if _, err := s.getOwnLabel(ctx, userID, labelID); err != nil {
+		return nil, 0, err
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.repo.GetUserConversationsByLabel(ctx, userID, labelID, page, limit)
+}
+
 func (s *ConversationService) GetByID(ctx context.Context, conversationID uuid.UUID) (conversation.Conversation, error) {
 	return s.repo.GetByID(ctx, conversationID)
 }
 
-func (s *ConversationService) Update(ctx context.Context, conv conversation.Conversation) error {
+// Update saves the conversation's subject, description and avatar when the
+// actor may edit the group info.
+func (s *ConversationService) Update(ctx context.Context, actorID uuid.UUID, conv conversation.Conversation) error {
+	if _, _, err := authorizeAction(ctx, s.repo, conv.ID, actorID, conversation.ActionEditInfo); err != nil {
+		return err
+	}
 	conv.UpdatedAt = time.Now()
-	return s.repo.Update(ctx, conv)
+	return s.repo.UpdateInfo(ctx, conv)
 }
 
-func (s *ConversationService) Delete(ctx context.Context, conversationID uuid.UUID) error {
+// Delete removes the conversation for everyone. Only the owner may delete a
+// group.
+func (s *ConversationService) Delete(ctx context.Context, conversationID, actorID uuid.UUID) error {
+	conv, actor, err := authorizeAction(ctx, s.repo, conversationID, actorID, "")
+	if err != nil {
+		return err
+	}
+	if conv.Type == "GROUP" && actor.Role != conversation.RoleOwner {
+		return sentinal_errors.ErrForbidden
+	}
 	return s.repo.Delete(ctx, conversationID)
 }
 
@@ -150,16 +217,89 @@ func (s *ConversationService) GetByInviteLink(ctx context.Context, link string)
 	return s.repo.GetByInviteLink(ctx, link)
 }
 
-func (s *ConversationService) RegenerateInviteLink(ctx context.Context, conversationID uuid.UUID) (string, error) {
+// RegenerateInviteLink issues a new invite link, which lets anyone holding it
+// join, so it needs the same permission as adding members.
+func (s *ConversationService) RegenerateInviteLink(ctx context.Context, conversationID, actorID uuid.UUID) (string, error) {
+	if _, _, err := authorizeAction(ctx, s.repo, conversationID, actorID, conversation.ActionAddMembers); err != nil {
+		return "", err
+	}
 	return s.repo.RegenerateInviteLink(ctx, conversationID)
 }
 
-func (s *ConversationService) AddParticipant(ctx context.Context, p *conversation.Participant) error {
-	return s.repo.AddParticipant(ctx, p)
+// AddParticipant adds a member to a group when the actor may add members. Only
+// admins may add someone directly as an admin, and nobody can be added as
+// owner. Direct conversations cannot gain participants.
+func (s *ConversationService) AddParticipant(ctx context.Context, actorID uuid.UUID, p *conversation.Participant) error {
+	conv, actor, err := authorizeAction(ctx, s.repo, p.ConversationID, actorID, conversation.ActionAddMembers)
+	if err != nil {
+		return err
+	}
+	if conv.Type != "GROUP" {
+		return sentinal_errors.ErrInvalidInput
+	}
+	switch p.Role {
+	case "":
+		p.Role = conversation.RoleMember
+	case conversation.RoleMember:
+	case conversation.RoleAdmin:
+		if !actor.IsAdmin() {
+			return sentinal_errors.ErrForbidden
+		}
+	default:
+		return sentinal_errors.ErrInvalidInput
+	}
+	p.AddedBy = uuid.NullUUID{UUID: actorID, Valid: true}
+	return s.changeMembership(ctx, p.ConversationID, p.UserID, SenderKeyRotateMemberAdded, func(repo repository.ConversationRepository) error {
+		return repo.AddParticipant(ctx, p)
+	})
 }
 
-func (s *ConversationService) RemoveParticipant(ctx context.Context, conversationID, userID uuid.UUID) error {
-	return s.repo.RemoveParticipant(ctx, conversationID, userID)
+// RemoveParticipant lets a participant leave, or an admin remove a participant
+// they outrank: the owner may remove anyone, admins only members.
+func (s *ConversationService) RemoveParticipant(ctx context.Context, conversationID, actorID, userID uuid.UUID) error {
+	conv, actor, err := authorizeAction(ctx, s.repo, conversationID, actorID, "")
+	if err != nil {
+		return err
+	}
+	if actorID != userID {
+		if conv.Type != "GROUP" {
+			return sentinal_errors.ErrForbidden
+		}
+		if err := s.checkOutranks(ctx, actor, userID); err != nil {
+			return err
+		}
+	}
+	reason := SenderKeyRotateMemberRemoved
+	if conv.Type != "GROUP" {
+		reason = ""
+	}
+	return s.changeMembership(ctx, conversationID, userID, reason, func(repo repository.ConversationRepository) error {
+		return repo.RemoveParticipant(ctx, conversationID, userID)
+	})
+}
+
+// changeMembership applies a membership change and, unless reason is empty,
+// moves the group to a new sender key epoch in the same transaction, so the
+// change never commits without its rotation. The cached participant list is
+// dropped once the transaction has committed.
+func (s *ConversationService) changeMembership(ctx context.Context, conversationID, memberID uuid.UUID, reason string, change func(repository.ConversationRepository) error) error {
+	if s.db == nil {
+		return change(s.repo)
+	}
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		if err := change(repository.NewConversationRepository(tx)); err != nil {
+			return err
+		}
+		if reason == "" {
+			return nil
+		}
+		return bumpSenderKeyEpoch(ctx, tx, s.eventPublisher, conversationID, memberID, reason)
+	})
+	if err != nil {
+		return err
+	}
+	repository.InvalidateConversationCache(ctx, s.repo, conversationID)
+	return nil
 }
 
 func (s *ConversationService) GetParticipants(ctx context.Context, conversationID uuid.UUID) ([]conversation.Participant, error) {
@@ -170,10 +310,129 @@ func (s *ConversationService) GetParticipant(ctx context.Context, conversationID
 	return s.repo.GetParticipant(ctx, conversationID, userID)
 }
 
-func (s *ConversationService) UpdateParticipantRole(ctx context.Context, conversationID, userID uuid.UUID, role string) error {
+// UpdateParticipantRole promotes a member to admin or demotes an admin. The
+// actor must be an admin who outranks the participant; ownership cannot be
+// handed over this way.
+func (s *ConversationService) UpdateParticipantRole(ctx context.Context, conversationID, actorID, userID uuid.UUID, role string) error {
+	if role != conversation.RoleAdmin && role != conversation.RoleMember {
+		return sentinal_errors.ErrInvalidInput
+	}
+	conv, actor, err := authorizeAction(ctx, s.repo, conversationID, actorID, "")
+	if err != nil {
+		return err
+	}
+	if conv.Type != "GROUP" {
+		return sentinal_errors.ErrInvalidInput
+	}
+	if err := s.checkOutranks(ctx, actor, userID); err != nil {
+		return err
+	}
 	return s.repo.UpdateParticipantRole(ctx, conversationID, userID, role)
 }
 
+// checkOutranks requires actor to be an admin ranked above the participant
+// userID in the same conversation.
+func (s *ConversationService) checkOutranks(ctx context.Context, actor conversation.Participant, userID uuid.UUID) error {
+	if !actor.IsAdmin() {
+		return sentinal_errors.ErrForbidden
+	}
+	target, err := s.repo.GetParticipant(ctx, actor.ConversationID, userID)
+	if err != nil {
+		return err
+	}
+	if conversation.RoleRank(actor.Role) <= conversation.RoleRank(target.Role) {
+		return sentinal_errors.ErrForbidden
+	}
+	return nil
+}
+
+// GetGroupPermissions returns a group's permissions to one of its participants.
+func (s *ConversationService) GetGroupPermissions(ctx context.Context, conversationID, userID uuid.UUID) (conversation.GroupPermissions, error) {
+	conv, _, err := authorizeAction(ctx, s.repo, conversationID, userID, "")
+	if err != nil {
+		return conversation.GroupPermissions{}, err
+	}
+	if conv.Type != "GROUP" {
+		return conversation.GroupPermissions{}, sentinal_errors.ErrInvalidInput
+	}
+	perms, _ := conversation.ParseGroupPermissions(conv.GroupPermissions)
+	return perms, nil
+}
+
+// SetGroupPermissions replaces what members of a group may do. Only admins and
+// the owner may change it; the change is published with the previous settings
+// so it can be audited.
+func (s *ConversationService) SetGroupPermissions(ctx context.Context, conversationID, actorID uuid.UUID, perms conversation.GroupPermissions) (conversation.GroupPermissions, error) {
+	if err := perms.Validate(); err != nil {
+		return conversation.GroupPermissions{}, sentinal_errors.ErrInvalidInput
+	}
+	if s.db == nil {
+		return conversation.GroupPermissions{}, sentinal_errors.ErrServiceUnavailable
+	}
+	raw, err := json.Marshal(perms)
+	if err != nil {
+		return conversation.GroupPermissions{}, err
+	}
+	document := string(raw)
+
+	err = repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		convRepo := repository.NewConversationRepository(tx)
+		conv, actor, err := authorizeAction(ctx, convRepo, conversationID, actorID, "")
+		if err != nil {
+			return err
+		}
+		if conv.Type != "GROUP" {
+			return sentinal_errors.ErrInvalidInput
+		}
+		if !actor.IsAdmin() {
+			return sentinal_errors.ErrForbidden
+		}
+		previous, _ := conversation.ParseGroupPermissions(conv.GroupPermissions)
+		if previous == perms {
+			return nil
+		}
+		if err := convRepo.SetGroupPermissions(ctx, conversationID, document); err != nil {
+			return err
+		}
+		if s.eventPublisher == nil {
+			return nil
+		}
+		return s.eventPublisher.PublishPermissionsChanged(ctx, tx, conversationID, actorID, previous.Settings(), perms.Settings())
+	})
+	if err != nil {
+		return conversation.GroupPermissions{}, err
+	}
+	repository.InvalidateConversationCache(ctx, s.repo, conversationID)
+	return perms, nil
+}
+
+// authorizeAction returns the conversation and the actor's participation when
+// the actor may perform action there; an empty action only requires the actor
+// to be a participant. Direct conversations have no roles, so both
+// participants may do everything. A stored permission document that cannot be
+// read falls back to the defaults.
+func authorizeAction(ctx context.Context, repo repository.ConversationRepository, conversationID, actorID uuid.UUID, action string) (conversation.Conversation, conversation.Participant, error) {
+	actor, err := repo.GetParticipant(ctx, conversationID, actorID)
+	if err != nil {
+		if errors.Is(err, sentinal_errors.ErrNotFound) {
+			return conversation.Conversation{}, conversation.Participant{}, sentinal_errors.ErrForbidden
+		}
+		return conversation.Conversation{}, conversation.Participant{}, err
+	}
+	conv, err := repo.GetByID(ctx, conversationID)
+	if err != nil {
+		return conversation.Conversation{}, conversation.Participant{}, err
+	}
+	if conv.Type != "GROUP" || action == "" {
+		return conv, actor, nil
+	}
+	perms, _ := conversation.ParseGroupPermissions(conv.GroupPermissions)
+	if !actor.Can(perms, action) {
+		return conversation.Conversation{}, conversation.Participant{}, sentinal_errors.ErrForbidden
+	}
+	return conv, actor, nil
+}
+
 func (s *ConversationService) IsParticipant(ctx context.Context, conversationID, userID uuid.UUID) (bool, error) {
 	return s.repo.IsParticipant(ctx, conversationID, userID)
 }
@@ -198,14 +457,132 @@ func (s *ConversationService) UnpinConversation(ctx context.Context, conversatio
 	return s.repo.UnpinConversation(ctx, conversationID, userID)
 }
 
-func (s *ConversationService) ArchiveConversation(ctx context.Context, conversationID, userID uuid.UUID) error {
-	return s.repo.ArchiveConversation(ctx, conversationID, userID)
+// ArchiveConversation archives the conversation for the user through the
+// command executor so it can be undone.
+func (s *ConversationService) ArchiveConversation(ctx context.Context, conversationID, userID uuid.UUID) (*command.CommandLog, error) {
+	if s.commandExecutor == nil {
+		return nil, s.repo.ArchiveConversation(ctx, conversationID, userID)
+	}
+	return s.commandExecutor.Execute(ctx, commands.NewBulkArchiveCommand(userID, []uuid.UUID{conversationID}))
 }
 
 func (s *ConversationService) UnarchiveConversation(ctx context.Context, conversationID, userID uuid.UUID) error {
 	return s.repo.UnarchiveConversation(ctx, conversationID, userID)
 }
 
+// ClearHistory hides every message currently in the conversation from the user
+// while other participants keep them.
+func (s *ConversationService) ClearHistory(ctx context.Context, conversationID, userID uuid.UUID) (time.Time, error) {
+	ok, err := s.repo.IsParticipant(ctx, conversationID, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !ok {
+		return time.Time{}, sentinal_errors.ErrForbidden
+	}
+
+	cleared := &conversation.ConversationClear{
+		ConversationID: conversationID,
+		UserID:         userID,
+		ClearedAt:      time.Now(),
+	}
+	if s.db == nil {
+		return cleared.ClearedAt, s.repo.ClearHistory(ctx, cleared)
+	}
+	err = repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		if err := repository.NewConversationRepository(tx).ClearHistory(ctx, cleared); err != nil {
+			return err
+		}
+		if s.eventPublisher == nil {
+			return nil
+		}
+		return s.eventPublisher.PublishConversationCleared(ctx, tx, conversationID, userID, cleared.ClearedAt)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cleared.ClearedAt, nil
+}
+
+// SetDisappearingMode changes how long new messages in the conversation live
+// and posts a SYSTEM message announcing the change, so every member's history
+// shows when the timer changed and who changed it. Messages already sent keep
+// their expiry. The returned message is nil when the mode was already set.
+func (s *ConversationService) SetDisappearingMode(ctx context.Context, conversationID, actorID uuid.UUID, mode string) (conversation.Conversation, *message.Message, error) {
+	ttl, ok := disappearingModeTTLs[mode]
+	if !ok && mode != DisappearingOff {
+		return conversation.Conversation{}, nil, sentinal_errors.ErrInvalidInput
+	}
+	if s.db == nil {
+		return conversation.Conversation{}, nil, sentinal_errors.ErrServiceUnavailable
+	}
+	if _, _, err := authorizeAction(ctx, s.repo, conversationID, actorID, conversation.ActionEditInfo); err != nil {
+		return conversation.Conversation{}, nil, err
+	}
+
+	var expirySeconds sql.NullInt32
+	if ttl > 0 {
+		expirySeconds = sql.NullInt32{Int32: int32(ttl / time.Second), Valid: true}
+	}
+
+	var updated conversation.Conversation
+	var announcement *message.Message
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		convRepo := repository.NewConversationRepository(tx)
+		current, err := convRepo.GetByID(ctx, conversationID)
+		if err != nil {
+			return err
+		}
+		if current.DisappearingMode == mode {
+			updated = current
+			return nil
+		}
+		if err := convRepo.SetDisappearingMode(ctx, conversationID, mode, expirySeconds); err != nil {
+			return err
+		}
+		if updated, err = convRepo.GetByID(ctx, conversationID); err != nil {
+			return err
+		}
+
+		metadata, err := json.Marshal(map[string]interface{}{
+			"system":         "disappearing_mode_changed",
+			"mode":           mode,
+			"expiry_seconds": int64(ttl / time.Second),
+			"actor_id":       actorID.String(),
+		})
+		if err != nil {
+			return err
+		}
+		msg := message.Message{
+			ID:             uuid.New(),
+			ConversationID: conversationID,
+			SenderID:       actorID,
+			Type:           "SYSTEM",
+			Metadata:       string(metadata),
+			CreatedAt:      time.Now(),
+		}
+		msgRepo := repository.NewMessageRepository(tx)
+		if err := msgRepo.Create(ctx, &msg); err != nil {
+			return err
+		}
+		// Reload to pick up the sequence number assigned by the trigger.
+		if msg, err = msgRepo.GetByID(ctx, msg.ID); err != nil {
+			return err
+		}
+		announcement = &msg
+
+		if s.eventPublisher == nil {
+			return nil
+		}
+		return s.eventPublisher.PublishMessageNew(ctx, tx, msg.ID, conversationID, actorID)
+	})
+	if err != nil {
+		return conversation.Conversation{}, nil, err
+	}
+	repository.InvalidateConversationCache(ctx, s.repo, conversationID)
+	return updated, announcement, nil
+}
+
 func (s *ConversationService) UpdateLastReadSequence(ctx context.Context, conversationID, userID uuid.UUID, seqID int64) error {
 	return s.repo.UpdateLastReadSequence(ctx, conversationID, userID, seqID)
 }
@@ -244,3 +621,197 @@ func convNullString(value string) sql.NullString {
 	}
 	return sql.NullString{String: value, Valid: true}
 }
+
+// Label actions carried by label:changed events.
+const (
+	LabelActionCreated    = "created"
+	LabelActionUpdated    = "updated"
+	LabelActionDeleted    = "deleted"
+	LabelActionReordered  = "reordered"
+	LabelActionAssigned   = "assigned"
+	LabelActionUnassigned = "unassigned"
+)
+
+const maxLabelNameLength = 64
+
+var labelColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// LabelInput holds the label fields a user can set. On update, nil fields are
+// left unchanged and an empty Color clears the color.
+type LabelInput struct {
+	Name     *string
+	Color    *string
+	Position *int32
+}
+
+// CreateLabel adds a label for the user. Without a position it is placed after
+// the user's existing labels.
+func (s *ConversationService) CreateLabel(ctx context.Context, userID uuid.UUID, input LabelInput) (conversation.ChatLabel, error) {
+	if userID == uuid.Nil || input.Name == nil {
+		return conversation.ChatLabel{}, sentinal_errors.ErrInvalidInput
+	}
+	label := conversation.ChatLabel{
+		ID:        uuid.New(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	if err := applyLabelInput(&label, input); err != nil {
+		return conversation.ChatLabel{}, err
+	}
+
+	err := s.withLabelTx(ctx, userID, LabelActionCreated, &label.ID, nil, nil, func(repo repository.ConversationRepository) error {
+		return repo.CreateLabel(ctx, &label)
+	})
+	if err != nil {
+		return conversation.ChatLabel{}, err
+	}
+	return label, nil
+}
+
+// ListLabels returns the user's labels in their chosen order.
+func (s *ConversationService) ListLabels(ctx context.Context, userID uuid.UUID) ([]conversation.ChatLabel, error) {
+	return s.repo.GetUserLabels(ctx, userID)
+}
+
+// UpdateLabel renames, recolors or moves one of the user's labels.
+func (s *ConversationService) UpdateLabel(ctx context.Context, userID, labelID uuid.UUID, input LabelInput) (conversation.ChatLabel, error) {
+	label, err := s.getOwnLabel(ctx, userID, labelID)
+	if err != nil {
+		return conversation.ChatLabel{}, err
+	}
+	if err := applyLabelInput(&label, input); err != nil {
+		return conversation.ChatLabel{}, err
+	}
+
+	err = s.withLabelTx(ctx, userID, LabelActionUpdated, &label.ID, nil, nil, func(repo repository.ConversationRepository) error {
+		return repo.UpdateLabel(ctx, label)
+	})
+	if err != nil {
+		return conversation.ChatLabel{}, err
+	}
+	return label, nil
+}
+
+// DeleteLabel removes one of the user's labels along with its assignments.
+func (s *ConversationService) DeleteLabel(ctx context.Context, userID, labelID uuid.UUID) error {
+	return s.withLabelTx(ctx, userID, LabelActionDeleted, &labelID, nil, nil, func(repo repository.ConversationRepository) error {
+		return repo.DeleteLabel(ctx, labelID, userID)
+	})
+}
+
+// ReorderLabels sets label positions from labelIDs, which must list every one
+// of the user's labels exactly once.
+func (s *ConversationService) ReorderLabels(ctx context.Context, userID uuid.UUID, labelIDs []uuid.UUID) ([]conversation.ChatLabel, error) {
+	existing, err := s.repo.GetUserLabels(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(labelIDs) != len(existing) {
+		return nil, sentinal_errors.ErrInvalidInput
+	}
+	owned := make(map[uuid.UUID]bool, len(existing))
+	for _, l := range existing {
+		owned[l.ID] = true
+	}
+	for _, id := range labelIDs {
+		if !owned[id] {
+			return nil, sentinal_errors.ErrInvalidInput
+		}
+		delete(owned, id)
+	}
+
+	err = s.withLabelTx(ctx, userID, LabelActionReordered, nil, nil, labelIDs, func(repo repository.ConversationRepository) error {
+		return repo.ReorderLabels(ctx, userID, labelIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetUserLabels(ctx, userID)
+}
+
+// AssignLabel tags a conversation the user participates in with one of their labels.
+func (s *ConversationService) AssignLabel(ctx context.Context, userID, conversationID, labelID uuid.UUID) error {
+	if _, err := s.getOwnLabel(ctx, userID, labelID); err != nil {
+		return err
+	}
+	ok, err := s.repo.IsParticipant(ctx, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return sentinal_errors.ErrForbidden
+	}
+
+	return s.withLabelTx(ctx, userID, LabelActionAssigned, &labelID, &conversationID, nil, func(repo repository.ConversationRepository) error {
+		return repo.AssignLabel(ctx, &conversation.ConversationLabel{
+			ConversationID: conversationID,
+			LabelID:        labelID,
+			UserID:         userID,
+			CreatedAt:      time.Now(),
+		})
+	})
+}
+
+// UnassignLabel removes one of the user's labels from a conversation.
+func (s *ConversationService) UnassignLabel(ctx context.Context, userID, conversationID, labelID uuid.UUID) error {
+	return s.withLabelTx(ctx, userID, LabelActionUnassigned, &labelID, &conversationID, nil, func(repo repository.ConversationRepository) error {
+		return repo.UnassignLabel(ctx, conversationID, labelID, userID)
+	})
+}
+
+// GetConversationLabels returns the labels the user put on a conversation.
+func (s *ConversationService) GetConversationLabels(ctx context.Context, userID, conversationID uuid.UUID) ([]conversation.ChatLabel, error) {
+	return s.repo.GetConversationLabels(ctx, conversationID, userID)
+}
+
+// getOwnLabel loads a label and hides labels of other users as not found.
+func (s *ConversationService) getOwnLabel(ctx context.Context, userID, labelID uuid.UUID) (conversation.ChatLabel, error) {
+	label, err := s.repo.GetLabel(ctx, labelID)
+	if err != nil {
+		return conversation.ChatLabel{}, err
+	}
+	if label.UserID != userID {
+		return conversation.ChatLabel{}, sentinal_errors.ErrNotFound
+	}
+	return label, nil
+}
+
+// withLabelTx applies a label change and publishes label:changed to the user's
+// devices in the same transaction.
+func (s *ConversationService) withLabelTx(ctx context.Context, userID uuid.UUID, action string, labelID, conversationID *uuid.UUID, labelIDs []uuid.UUID, fn func(repo repository.ConversationRepository) error) error {
+	if s.db == nil {
+		return fn(s.repo)
+	}
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		if err := fn(repository.NewConversationRepository(tx)); err != nil {
+			return err
+		}
+		if s.eventPublisher == nil {
+			return nil
+		}
+		return s.eventPublisher.PublishLabelChanged(ctx, tx, userID, action, labelID, conversationID, labelIDs)
+	})
+}
+
+func applyLabelInput(label *conversation.ChatLabel, input LabelInput) error {
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" || len(name) > maxLabelNameLength {
+			return sentinal_errors.ErrInvalidInput
+		}
+		label.Name = name
+	}
+	if input.Color != nil {
+		if *input.Color != "" && !labelColorPattern.MatchString(*input.Color) {
+			return sentinal_errors.ErrInvalidInput
+		}
+		label.Color = convNullString(*input.Color)
+	}
+	if input.Position != nil {
+		if *input.Position < 0 {
+			return sentinal_errors.ErrInvalidInput
+		}
+		label.Position = sql.NullInt32{Int32: *input.Position, Valid: true}
+	}
+	return nil
+}
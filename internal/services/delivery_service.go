@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"sentinal-chat/internal/domain/message"
+	"sentinal-chat/internal/repository"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultEnvelopePage = 100
+	maxEnvelopePage     = 500
+)
+
+// DeliveryService runs the per-device envelope queue. Every ciphertext waits
+// for its recipient device until the device acknowledges it; once all active
+// devices of a user have, the user's receipt becomes DELIVERED, and once all
+// recipient devices have, the ciphertexts are deleted.
+type DeliveryService struct {
+	db             repository.DBTX
+	repo           repository.DeliveryRepository
+	messageService *MessageService
+	eventPublisher *EventPublisher
+	retention      time.Duration
+}
+
+// NewDeliveryService creates a delivery service. Acknowledged ciphertexts are
+// kept for retention before they are collected; history and sync read them, so
+// retention bounds how far back a device can page through the server.
+func NewDeliveryService(db repository.DBTX, repo repository.DeliveryRepository, messageService *MessageService, eventPublisher *EventPublisher, retention time.Duration) *DeliveryService {
+	if retention < 0 {
+		retention = 0
+	}
+	return &DeliveryService{
+		db:             db,
+		repo:           repo,
+		messageService: messageService,
+		eventPublisher: eventPublisher,
+		retention:      retention,
+	}
+}
+
+// GetPending returns the oldest envelopes the device has not acknowledged and
+// whether more are waiting behind them.
+func (s *DeliveryService) GetPending(ctx context.Context, deviceID uuid.UUID, limit int) ([]message.Message, bool, error) {
+	if deviceID == uuid.Nil {
+		return nil, false, sentinal_errors.ErrInvalidInput
+	}
+	if limit <= 0 {
+		limit = defaultEnvelopePage
+	}
+	if limit > maxEnvelopePage {
+		limit = maxEnvelopePage
+	}
+	envelopes, err := s.repo.GetPendingEnvelopes(ctx, deviceID, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(envelopes) > limit
+	if hasMore {
+		envelopes = envelopes[:limit]
+	}
+	if err := s.messageService.loadAttachments(ctx, envelopes); err != nil {
+		return nil, false, err
+	}
+	return envelopes, hasMore, nil
+}
+
+// Acknowledge marks the device's envelopes for the given messages as delivered
+// and returns how many were still pending. Messages now acknowledged by every
+// active device of the user are marked DELIVERED and the sender is notified.
+func (s *DeliveryService) Acknowledge(ctx context.Context, userID, deviceID uuid.UUID, messageIDs []uuid.UUID) (int, error) {
+	if userID == uuid.Nil || deviceID == uuid.Nil || len(messageIDs) == 0 || len(messageIDs) > maxEnvelopePage {
+		return 0, sentinal_errors.ErrInvalidInput
+	}
+	if s.db == nil {
+		return 0, sentinal_errors.ErrServiceUnavailable
+	}
+
+	seen := make(map[uuid.UUID]bool, len(messageIDs))
+	ids := make([]uuid.UUID, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		if id == uuid.Nil {
+			return 0, sentinal_errors.ErrInvalidInput
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	var acknowledged int
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		repo := repository.NewDeliveryRepository(tx)
+		now := time.Now().UTC()
+		acked, err := repo.AcknowledgeEnvelopes(ctx, userID, deviceID, ids, now)
+		if err != nil {
+			return err
+		}
+		acknowledged = len(acked)
+
+		delivered, err := repo.GetDeliveredToUser(ctx, userID, acked)
+		if err != nil {
+			return err
+		}
+		for _, msg := range delivered {
+			if msg.SenderID == userID {
+				continue
+			}
+			changed, err := repo.MarkUserDelivered(ctx, msg.ID, userID, now)
+			if err != nil {
+				return err
+			}
+			if changed && s.eventPublisher != nil {
+				if err := s.eventPublisher.PublishMessageDelivered(ctx, tx, msg.ID, msg.ConversationID, msg.SenderID, userID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return acknowledged, nil
+}
+
+// CollectDelivered deletes the ciphertexts of up to limit messages that every
+// recipient device has acknowledged and returns how many messages it cleared.
+func (s *DeliveryService) CollectDelivered(ctx context.Context, limit int) (int, error) {
+	return s.repo.DeleteDeliveredCiphertexts(ctx, time.Now().UTC().Add(-s.retention), limit)
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DeliveryWorker periodically deletes the ciphertexts of messages that every
+// recipient device has acknowledged.
+type DeliveryWorker struct {
+	*IntervalWorker
+	deliveryService *DeliveryService
+	batchSize       int
+}
+
+func NewDeliveryWorker(deliveryService *DeliveryService, logger *zap.Logger) *DeliveryWorker {
+	w := &DeliveryWorker{
+		deliveryService: deliveryService,
+		batchSize:       100,
+	}
+	w.IntervalWorker = NewIntervalWorker("delivery_worker", time.Minute, logger, w.processBatch)
+	return w
+}
+
+func (w *DeliveryWorker) processBatch(ctx context.Context) error {
+	return drainBatches(ctx, w.batchSize, w.deliveryService.CollectDelivered)
+}
@@ -2,7 +2,9 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"time"
 
 	"sentinal-chat/internal/domain/encryption"
@@ -12,9 +14,65 @@ import (
 	"github.com/google/uuid"
 )
 
+// maxOneTimePreKeyBatch bounds how many one-time prekeys one upload may carry.
+const maxOneTimePreKeyBatch = 100
+
+// maxKeyBundleBatchUsers bounds how many users one batch bundle fetch may name.
+const maxKeyBundleBatchUsers = 100
+
+// How a device's identity key changed, as recorded in its history and
+// reported in identity:changed events.
+const (
+	IdentityKeyAdded       = "added"
+	IdentityKeyReplaced    = "replaced"
+	IdentityKeyDeactivated = "deactivated"
+	IdentityKeyDeleted     = "deleted"
+)
+
+// fingerprintVersion is the version of the safety number material returned by
+// GetFingerprintMaterial.
+const fingerprintVersion = 1
+
+// signedPreKeyRotationResend is how long a device that has not replaced a
+// stale signed prekey waits before it is asked again.
+const signedPreKeyRotationResend = 24 * time.Hour
+
+// preKeysLowResend is how long a device that is still below the low-water
+// mark waits before it is warned again.
+const preKeysLowResend = time.Hour
+
 // EncryptionService manages Signal Protocol keys and key bundles.
 type EncryptionService struct {
-	repo repository.EncryptionRepository
+	db             repository.DBTX
+	repo           repository.EncryptionRepository
+	eventPublisher *EventPublisher
+	policy         KeyPolicy
+}
+
+// KeyPolicy sets how devices' prekeys are replenished, rotated and retired.
+type KeyPolicy struct {
+	// PreKeyLowWater is how few unused one-time prekeys a device may have
+	// before it is told to upload more; zero disables the warning.
+	PreKeyLowWater int
+	// ConsumedPreKeyRetention is how long consumed one-time prekeys are kept.
+	ConsumedPreKeyRetention time.Duration
+	// PreKeysPerConsumer is how many of one device's one-time prekeys a user
+	// may consume per PreKeyConsumerWindow; past it, bundles come without
+	// one. Zero disables the cap.
+	PreKeysPerConsumer   int
+	PreKeyConsumerWindow time.Duration
+	// SignedPreKeyMaxAge is how old an active signed prekey may grow before
+	// its device is asked to rotate it; zero disables rotation requests.
+	SignedPreKeyMaxAge time.Duration
+	// SignedPreKeyGracePeriod is how long a replaced signed prekey is kept,
+	// and how long after SignedPreKeyMaxAge a stale one is still served.
+	SignedPreKeyGracePeriod time.Duration
+}
+
+// OneTimePreKeyInput is one one-time prekey in a batch upload.
+type OneTimePreKeyInput struct {
+	KeyID     int
+	PublicKey []byte
 }
 
 // KeyBundle contains all public keys needed for E2EE session setup.
@@ -29,13 +87,103 @@ type KeyBundle struct {
 	OneTimePreKey         []byte    `json:"one_time_prekey,omitempty"`
 }
 
+// FingerprintMaterial is what two users hash to compute and compare their
+// safety number: each side's stable identifier and the active identity keys
+// of its devices, ordered by device ID.
+type FingerprintMaterial struct {
+	Version int
+	Local   FingerprintParty
+	Remote  FingerprintParty
+}
+
+// FingerprintParty is one side of a safety number.
+type FingerprintParty struct {
+	UserID       uuid.UUID
+	IdentityKeys []encryption.IdentityKey
+}
+
+// KeyBundleBatch is the result of GetKeyBundles.
+type KeyBundleBatch struct {
+	Bundles        []KeyBundle
+	MissingUserIDs []uuid.UUID
+}
+
 // NewEncryptionService creates an encryption service.
-func NewEncryptionService(repo repository.EncryptionRepository) *EncryptionService {
-	return &EncryptionService{repo: repo}
+func NewEncryptionService(db repository.DBTX, repo repository.EncryptionRepository, eventPublisher *EventPublisher, policy KeyPolicy) *EncryptionService {
+	return &EncryptionService{
+		db:             db,
+		repo:           repo,
+		eventPublisher: eventPublisher,
+		policy:         policy,
+	}
 }
 
+func (s *EncryptionService) withTx(tx repository.DBTX) *EncryptionService {
+	clone := *s
+	clone.db = tx
+	clone.repo = repository.NewEncryptionRepository(tx)
+	return &clone
+}
+
+// CreateIdentityKey sets the identity key of one of the user's devices. A key
+// that differs from the device's current one is recorded in its history and
+// announced to everyone sharing a conversation with the user; uploading the
+// current key again changes nothing.
 func (s *EncryptionService) CreateIdentityKey(ctx context.Context, k *encryption.IdentityKey) error {
-	return s.repo.CreateIdentityKey(ctx, k)
+	if k.UserID == uuid.Nil || k.DeviceID == uuid.Nil || len(k.PublicKey) == 0 {
+		return sentinal_errors.ErrInvalidInput
+	}
+	if owned, err := s.repo.IsDeviceOwnedByUser(ctx, k.UserID, k.DeviceID); err != nil {
+		return err
+	} else if !owned {
+		return sentinal_errors.ErrForbidden
+	}
+	now := time.Now().UTC()
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = now
+	}
+	k.IsActive = true
+
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		repo := repository.NewEncryptionRepository(tx)
+		change := IdentityKeyAdded
+		previous, err := repo.GetIdentityKey(ctx, k.UserID, k.DeviceID)
+		switch {
+		case err == nil && bytes.Equal(previous.PublicKey, k.PublicKey):
+			*k = previous
+			return nil
+		case err == nil:
+			change = IdentityKeyReplaced
+			if err := repo.CloseIdentityKeyHistory(ctx, previous.ID, now, IdentityKeyReplaced); err != nil {
+				return err
+			}
+			// The old signed prekey was signed by the replaced identity key,
+			// so bundles must not pair it with the new one.
+			if err := repo.DeactivateDeviceSignedPreKeys(ctx, k.UserID, k.DeviceID, now); err != nil {
+				return err
+			}
+		case !errors.Is(err, sentinal_errors.ErrNotFound):
+			return err
+		}
+
+		if err := repo.CreateIdentityKey(ctx, k); err != nil {
+			return err
+		}
+		if err := repo.CreateIdentityKeyHistory(ctx, &encryption.IdentityKeyHistory{
+			ID:            uuid.New(),
+			UserID:        k.UserID,
+			DeviceID:      k.DeviceID,
+			IdentityKeyID: k.ID,
+			PublicKey:     k.PublicKey,
+			ActivatedAt:   k.CreatedAt,
+		}); err != nil {
+			return err
+		}
+		return s.publishIdentityChanged(ctx, tx, *k, change)
+	})
 }
 
 func (s *EncryptionService) GetIdentityKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (encryption.IdentityKey, error) {
@@ -46,15 +194,117 @@ func (s *EncryptionService) GetUserIdentityKeys(ctx context.Context, userID uuid
 	return s.repo.GetUserIdentityKeys(ctx, userID)
 }
 
-func (s *EncryptionService) DeactivateIdentityKey(ctx context.Context, id uuid.UUID) error {
-	return s.repo.DeactivateIdentityKey(ctx, id)
+// DeactivateIdentityKey deactivates one of the actor's identity keys.
+func (s *EncryptionService) DeactivateIdentityKey(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	return s.retireIdentityKey(ctx, id, actorID, IdentityKeyDeactivated)
+}
+
+// DeleteIdentityKey deletes one of the actor's identity keys. Its history is
+// kept.
+func (s *EncryptionService) DeleteIdentityKey(ctx context.Context, id uuid.UUID, actorID uuid.UUID) error {
+	return s.retireIdentityKey(ctx, id, actorID, IdentityKeyDeleted)
+}
+
+// retireIdentityKey deactivates or deletes an identity key and, if it was its
+// device's active key, closes its history and announces the change.
+func (s *EncryptionService) retireIdentityKey(ctx context.Context, id, actorID uuid.UUID, change string) error {
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		repo := repository.NewEncryptionRepository(tx)
+		key, err := repo.GetIdentityKeyByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if key.UserID != actorID {
+			return sentinal_errors.ErrNotFound
+		}
+		if change == IdentityKeyDeleted {
+			err = repo.DeleteIdentityKey(ctx, id)
+		} else {
+			err = repo.DeactivateIdentityKey(ctx, id)
+		}
+		if err != nil || !key.IsActive {
+			return err
+		}
+		if err := repo.CloseIdentityKeyHistory(ctx, key.ID, time.Now().UTC(), change); err != nil {
+			return err
+		}
+		return s.publishIdentityChanged(ctx, tx, key, change)
+	})
+}
+
+// publishIdentityChanged announces an identity key change to its owner's
+// devices and to everyone sharing a conversation with the owner.
+func (s *EncryptionService) publishIdentityChanged(ctx context.Context, tx repository.DBTX, key encryption.IdentityKey, change string) error {
+	if s.eventPublisher == nil {
+		return nil
+	}
+	audience, err := repository.NewEncryptionRepository(tx).GetIdentityAudience(ctx, key.UserID)
+	if err != nil {
+		return err
+	}
+	recipientIDs := append([]uuid.UUID{key.UserID}, audience...)
+	return s.eventPublisher.PublishIdentityChanged(ctx, tx, key, change, recipientIDs)
+}
+
+// GetIdentityKeyHistory returns the identity keys a user's devices have used,
+// or only those of one device, newest first. Only the user and those who share
+// a conversation or contact with them may see it.
+func (s *EncryptionService) GetIdentityKeyHistory(ctx context.Context, viewerID, userID uuid.UUID, deviceID uuid.NullUUID) ([]encryption.IdentityKeyHistory, error) {
+	if err := s.requireIdentityVisible(ctx, viewerID, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetIdentityKeyHistory(ctx, userID, deviceID)
+}
+
+func (s *EncryptionService) requireIdentityVisible(ctx context.Context, viewerID, userID uuid.UUID) error {
+	visible, err := s.repo.IsIdentityVisible(ctx, viewerID, userID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return sentinal_errors.ErrForbidden
+	}
+	return nil
+}
+
+// GetFingerprintMaterial returns what the local and remote user need to
+// compute their safety number. Both must have at least one active identity
+// key, and they must share a conversation or contact.
+func (s *EncryptionService) GetFingerprintMaterial(ctx context.Context, localUserID, remoteUserID uuid.UUID) (FingerprintMaterial, error) {
+	if localUserID == uuid.Nil || remoteUserID == uuid.Nil || localUserID == remoteUserID {
+		return FingerprintMaterial{}, sentinal_errors.ErrInvalidInput
+	}
+	if err := s.requireIdentityVisible(ctx, localUserID, remoteUserID); err != nil {
+		return FingerprintMaterial{}, err
+	}
+	local, err := s.fingerprintParty(ctx, localUserID)
+	if err != nil {
+		return FingerprintMaterial{}, err
+	}
+	remote, err := s.fingerprintParty(ctx, remoteUserID)
+	if err != nil {
+		return FingerprintMaterial{}, err
+	}
+	return FingerprintMaterial{Version: fingerprintVersion, Local: local, Remote: remote}, nil
 }
 
-func (s *EncryptionService) DeleteIdentityKey(ctx context.Context, id uuid.UUID) error {
-	return s.repo.DeleteIdentityKey(ctx, id)
+func (s *EncryptionService) fingerprintParty(ctx context.Context, userID uuid.UUID) (FingerprintParty, error) {
+	keys, err := s.repo.GetUserIdentityKeys(ctx, userID)
+	if err != nil {
+		return FingerprintParty{}, err
+	}
+	if len(keys) == 0 {
+		return FingerprintParty{}, sentinal_errors.ErrNotFound
+	}
+	return FingerprintParty{UserID: userID, IdentityKeys: keys}, nil
 }
 
+// CreateSignedPreKey stores a signed prekey once its signature verifies
+// against the device's identity key.
 func (s *EncryptionService) CreateSignedPreKey(ctx context.Context, k *encryption.SignedPreKey) error {
+	if err := s.prepareSignedPreKey(ctx, k); err != nil {
+		return err
+	}
 	return s.repo.CreateSignedPreKey(ctx, k)
 }
 
@@ -66,10 +316,89 @@ func (s *EncryptionService) GetActiveSignedPreKey(ctx context.Context, userID uu
 	return s.repo.GetActiveSignedPreKey(ctx, userID, deviceID)
 }
 
+// RotateSignedPreKey replaces the device's active signed prekey once the new
+// key's signature verifies against the device's identity key. The previous key
+// is kept for the grace period so sessions set up from bundles fetched before
+// the rotation still work.
 func (s *EncryptionService) RotateSignedPreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID, newKey *encryption.SignedPreKey) error {
+	newKey.UserID = userID
+	newKey.DeviceID = deviceID
+	if err := s.prepareSignedPreKey(ctx, newKey); err != nil {
+		return err
+	}
 	return s.repo.RotateSignedPreKey(ctx, userID, deviceID, newKey)
 }
 
+// prepareSignedPreKey verifies a new signed prekey's signature against the
+// device's active identity key and fills in its ID and creation time.
+func (s *EncryptionService) prepareSignedPreKey(ctx context.Context, k *encryption.SignedPreKey) error {
+	if k.UserID == uuid.Nil || k.DeviceID == uuid.Nil || len(k.PublicKey) == 0 || len(k.Signature) == 0 {
+		return sentinal_errors.ErrInvalidInput
+	}
+	identity, err := s.repo.GetIdentityKey(ctx, k.UserID, k.DeviceID)
+	if err != nil {
+		if errors.Is(err, sentinal_errors.ErrNotFound) {
+			return sentinal_errors.ErrInvalidInput
+		}
+		return err
+	}
+	if !encryption.VerifySignedPreKey(identity.PublicKey, k.PublicKey, k.Signature) {
+		return sentinal_errors.ErrInvalidSignature
+	}
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now().UTC()
+	}
+	k.IsActive = true
+	return nil
+}
+
+// RequestSignedPreKeyRotations asks up to limit devices whose active signed
+// prekey is older than the maximum age to rotate it, and returns how many were
+// asked. A device that does not rotate is asked again a day later.
+func (s *EncryptionService) RequestSignedPreKeyRotations(ctx context.Context, limit int) (int, error) {
+	if s.policy.SignedPreKeyMaxAge <= 0 {
+		return 0, nil
+	}
+	now := time.Now().UTC()
+	stale, err := s.repo.GetStaleSignedPreKeys(ctx, now.Add(-s.policy.SignedPreKeyMaxAge), now.Add(-signedPreKeyRotationResend), limit)
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range stale {
+		err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+			if err := repository.NewEncryptionRepository(tx).MarkSignedPreKeyRotationRequested(ctx, key.ID, now); err != nil {
+				return err
+			}
+			if s.eventPublisher == nil {
+				return nil
+			}
+			return s.eventPublisher.PublishSignedPreKeyRotate(ctx, tx, key, s.signedPreKeyExpiry(key))
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(stale), nil
+}
+
+// CleanupRetiredSignedPreKeys deletes signed prekeys that were replaced longer
+// ago than the grace period and returns how many were deleted.
+func (s *EncryptionService) CleanupRetiredSignedPreKeys(ctx context.Context) (int64, error) {
+	return s.repo.DeleteRetiredSignedPreKeys(ctx, time.Now().UTC().Add(-s.policy.SignedPreKeyGracePeriod))
+}
+
+// signedPreKeyExpiry is when bundles stop being served with a signed prekey
+// its device has not rotated. The zero time means it never expires.
+func (s *EncryptionService) signedPreKeyExpiry(k encryption.SignedPreKey) time.Time {
+	if s.policy.SignedPreKeyMaxAge <= 0 {
+		return time.Time{}
+	}
+	return k.CreatedAt.Add(s.policy.SignedPreKeyMaxAge + s.policy.SignedPreKeyGracePeriod)
+}
+
 func (s *EncryptionService) DeactivateSignedPreKey(ctx context.Context, id uuid.UUID) error {
 	return s.repo.DeactivateSignedPreKey(ctx, id)
 }
@@ -78,8 +407,105 @@ func (s *EncryptionService) UploadOneTimePreKeys(ctx context.Context, keys []enc
 	return s.repo.UploadOneTimePreKeys(ctx, keys)
 }
 
-func (s *EncryptionService) ConsumeOneTimePreKey(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID, consumedBy uuid.UUID, consumedByDeviceID uuid.UUID) (encryption.OneTimePreKey, error) {
-	return s.repo.ConsumeOneTimePreKey(ctx, userID, deviceID, consumedBy, consumedByDeviceID)
+// UploadOneTimePreKeyBatch stores a batch of one-time prekeys for one of the
+// caller's devices and returns how many are now available. Key IDs must be
+// unique within the batch and among the keys the device already stored,
+// including consumed ones that were not cleaned up yet; any duplicate rejects
+// the whole batch.
+func (s *EncryptionService) UploadOneTimePreKeyBatch(ctx context.Context, userID, deviceID uuid.UUID, keys []OneTimePreKeyInput) (int64, error) {
+	if userID == uuid.Nil || deviceID == uuid.Nil || len(keys) == 0 || len(keys) > maxOneTimePreKeyBatch {
+		return 0, sentinal_errors.ErrInvalidInput
+	}
+	seen := make(map[int]bool, len(keys))
+	for _, k := range keys {
+		if k.KeyID <= 0 || len(k.PublicKey) == 0 || seen[k.KeyID] {
+			return 0, sentinal_errors.ErrInvalidInput
+		}
+		seen[k.KeyID] = true
+	}
+	if owned, err := s.repo.IsDeviceOwnedByUser(ctx, userID, deviceID); err != nil {
+		return 0, err
+	} else if !owned {
+		return 0, sentinal_errors.ErrForbidden
+	}
+
+	now := time.Now().UTC()
+	prekeys := make([]encryption.OneTimePreKey, 0, len(keys))
+	for _, k := range keys {
+		prekeys = append(prekeys, encryption.OneTimePreKey{
+			ID:         uuid.New(),
+			UserID:     userID,
+			DeviceID:   deviceID,
+			KeyID:      k.KeyID,
+			PublicKey:  k.PublicKey,
+			UploadedAt: now,
+		})
+	}
+
+	var available int64
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		repo := repository.NewEncryptionRepository(tx)
+		if err := repo.UploadOneTimePreKeys(ctx, prekeys); err != nil {
+			return err
+		}
+		var err error
+		available, err = repo.GetAvailablePreKeyCount(ctx, userID, deviceID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return available, nil
+}
+
+// consumeOneTimePreKey hands out the device's oldest unused one-time prekey.
+// It returns ErrNotFound when none is left or the consumer has used up its
+// share of the device's keys. When the key leaves the device with fewer than
+// the low-water mark, the device is told to upload more. A device that stays
+// below the mark is warned again at most once per preKeysLowResend, not for
+// every bundle fetched.
+func (s *EncryptionService) consumeOneTimePreKey(ctx context.Context, userID, deviceID, consumedBy, consumedByDeviceID uuid.UUID) (encryption.OneTimePreKey, error) {
+	var key encryption.OneTimePreKey
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		repo := repository.NewEncryptionRepository(tx)
+		if s.policy.PreKeysPerConsumer > 0 {
+			if err := repo.LockPreKeyConsumer(ctx, consumedBy); err != nil {
+				return err
+			}
+			consumed, err := repo.CountPreKeysConsumedBy(ctx, deviceID, consumedBy, time.Now().Add(-s.policy.PreKeyConsumerWindow))
+			if err != nil {
+				return err
+			}
+			if consumed >= int64(s.policy.PreKeysPerConsumer) {
+				return sentinal_errors.ErrNotFound
+			}
+		}
+		var err error
+		key, err = repo.ConsumeOneTimePreKey(ctx, userID, deviceID, consumedBy, consumedByDeviceID)
+		if err != nil {
+			return err
+		}
+		if s.policy.PreKeyLowWater <= 0 || s.eventPublisher == nil {
+			return nil
+		}
+		remaining, err := repo.GetAvailablePreKeyCount(ctx, userID, deviceID)
+		if err != nil {
+			return err
+		}
+		if remaining >= int64(s.policy.PreKeyLowWater) {
+			return nil
+		}
+		now := time.Now().UTC()
+		warned, err := repo.MarkPreKeysLowWarned(ctx, deviceID, now, now.Add(-preKeysLowResend))
+		if err != nil || !warned {
+			return err
+		}
+		return s.eventPublisher.PublishPreKeysLow(ctx, tx, userID, deviceID, remaining, s.policy.PreKeyLowWater)
+	})
+	if err != nil {
+		return encryption.OneTimePreKey{}, err
+	}
+	return key, nil
 }
 
 func (s *EncryptionService) GetAvailablePreKeyCount(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (int64, error) {
@@ -90,6 +516,13 @@ func (s *EncryptionService) DeleteConsumedPreKeys(ctx context.Context, olderThan
 	return s.repo.DeleteConsumedPreKeys(ctx, olderThan)
 }
 
+// CleanupConsumedPreKeys deletes one-time prekeys consumed longer ago than the
+// retention period and returns how many were deleted. Their key IDs become
+// free for the device to upload again.
+func (s *EncryptionService) CleanupConsumedPreKeys(ctx context.Context) (int64, error) {
+	return s.repo.DeleteConsumedPreKeys(ctx, time.Now().Add(-s.policy.ConsumedPreKeyRetention))
+}
+
 func (s *EncryptionService) HasActiveKeys(ctx context.Context, userID uuid.UUID, deviceID uuid.UUID) (bool, error) {
 	return s.repo.HasActiveKeys(ctx, userID, deviceID)
 }
@@ -104,6 +537,96 @@ func (s *EncryptionService) GetKeyBundle(ctx context.Context, userID uuid.UUID,
 	if userID == consumerID {
 		return KeyBundle{}, sentinal_errors.ErrInvalidInput
 	}
+	blocked, err := s.repo.GetBlockedUserIDs(ctx, consumerID, []uuid.UUID{userID})
+	if err != nil {
+		return KeyBundle{}, err
+	}
+	if len(blocked) > 0 {
+		return KeyBundle{}, sentinal_errors.ErrNotFound
+	}
+	return s.buildKeyBundle(ctx, userID, deviceID, consumerID, consumerDeviceID)
+}
+
+// GetKeyBundles retrieves a key bundle for every active device of each user,
+// so a session can be started with all of them in one call. The caller's own
+// user may be included to reach its other devices. One one-time prekey is
+// consumed per device, all in one transaction: either every bundle is handed
+// out or no prekey is consumed. Users who blocked the caller or were blocked
+// by it, and users without a device to set up a session with, are returned in
+// MissingUserIDs without saying which.
+func (s *EncryptionService) GetKeyBundles(ctx context.Context, userIDs []uuid.UUID, consumerID uuid.UUID, consumerDeviceID uuid.UUID) (KeyBundleBatch, error) {
+	if len(userIDs) == 0 || len(userIDs) > maxKeyBundleBatchUsers {
+		return KeyBundleBatch{}, sentinal_errors.ErrInvalidInput
+	}
+	if owned, err := s.repo.IsDeviceOwnedByUser(ctx, consumerID, consumerDeviceID); err != nil {
+		return KeyBundleBatch{}, err
+	} else if !owned {
+		return KeyBundleBatch{}, sentinal_errors.ErrForbidden
+	}
+
+	seen := make(map[uuid.UUID]bool, len(userIDs))
+	targets := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if id == uuid.Nil {
+			return KeyBundleBatch{}, sentinal_errors.ErrInvalidInput
+		}
+		if !seen[id] {
+			seen[id] = true
+			targets = append(targets, id)
+		}
+	}
+	blockedIDs, err := s.repo.GetBlockedUserIDs(ctx, consumerID, targets)
+	if err != nil {
+		return KeyBundleBatch{}, err
+	}
+	blocked := make(map[uuid.UUID]bool, len(blockedIDs))
+	for _, id := range blockedIDs {
+		blocked[id] = true
+	}
+
+	var batch KeyBundleBatch
+	err = repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		txService := s.withTx(tx)
+		for _, userID := range targets {
+			if blocked[userID] {
+				batch.MissingUserIDs = append(batch.MissingUserIDs, userID)
+				continue
+			}
+			deviceIDs, err := txService.repo.GetBundleDeviceIDs(ctx, userID)
+			if err != nil {
+				return err
+			}
+			found := false
+			for _, deviceID := range deviceIDs {
+				if deviceID == consumerDeviceID {
+					continue
+				}
+				bundle, err := txService.buildKeyBundle(ctx, userID, deviceID, consumerID, consumerDeviceID)
+				if errors.Is(err, sentinal_errors.ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				batch.Bundles = append(batch.Bundles, bundle)
+				found = true
+			}
+			if !found {
+				batch.MissingUserIDs = append(batch.MissingUserIDs, userID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return KeyBundleBatch{}, err
+	}
+	return batch, nil
+}
+
+// buildKeyBundle assembles a device's bundle, consuming one of its one-time
+// prekeys if any are left. A device without a usable signed prekey has no
+// bundle.
+func (s *EncryptionService) buildKeyBundle(ctx context.Context, userID, deviceID, consumerID, consumerDeviceID uuid.UUID) (KeyBundle, error) {
 	identity, err := s.repo.GetIdentityKey(ctx, userID, deviceID)
 	if err != nil {
 		return KeyBundle{}, err
@@ -113,6 +636,9 @@ func (s *EncryptionService) GetKeyBundle(ctx context.Context, userID uuid.UUID,
 	if err != nil {
 		return KeyBundle{}, err
 	}
+	if expiry := s.signedPreKeyExpiry(signed); !expiry.IsZero() && time.Now().After(expiry) {
+		return KeyBundle{}, sentinal_errors.ErrNotFound
+	}
 
 	var bundle KeyBundle
 	bundle.UserID = userID
@@ -122,7 +648,7 @@ func (s *EncryptionService) GetKeyBundle(ctx context.Context, userID uuid.UUID,
 	bundle.SignedPreKey = signed.PublicKey
 	bundle.SignedPreKeySignature = signed.Signature
 
-	prekey, prekeyErr := s.repo.ConsumeOneTimePreKey(ctx, userID, deviceID, consumerID, consumerDeviceID)
+	prekey, prekeyErr := s.consumeOneTimePreKey(ctx, userID, deviceID, consumerID, consumerDeviceID)
 	if prekeyErr == nil {
 		bundle.OneTimePreKeyID = &prekey.KeyID
 		bundle.OneTimePreKey = prekey.PublicKey
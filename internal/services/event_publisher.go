@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"sentinal-chat/internal/domain/encryption"
 	"sentinal-chat/internal/domain/outbox"
 	"sentinal-chat/internal/events"
 	"sentinal-chat/internal/repository"
@@ -91,7 +92,7 @@ func (p *EventPublisher) PublishMessageRead(ctx context.Context, tx repository.D
 }
 
 // PublishMessageDelivered creates an event when message is delivered
-func (p *EventPublisher) PublishMessageDelivered(ctx context.Context, tx repository.DBTX, msgID, convID, recipientID uuid.UUID) error {
+func (p *EventPublisher) PublishMessageDelivered(ctx context.Context, tx repository.DBTX, msgID, convID, senderID, recipientID uuid.UUID) error {
 	event := &events.MessageDeliveredEvent{
 		BaseEvent: events.BaseEvent{
 			EventTypeVal: events.EventMessageDelivered,
@@ -101,14 +102,15 @@ func (p *EventPublisher) PublishMessageDelivered(ctx context.Context, tx reposit
 		},
 		MessageID:      msgID,
 		ConversationID: convID,
+		SenderID:       senderID,
 		RecipientID:    recipientID,
 	}
 
 	return p.saveToOutbox(ctx, tx, events.EventMessageDelivered, "message", msgID.String(), event)
 }
 
-// PublishPresenceOnline creates an event when user comes online
-func (p *EventPublisher) PublishPresenceOnline(ctx context.Context, tx repository.DBTX, userID uuid.UUID) error {
+// PublishPresenceOnline creates an event when user comes online or changes status
+func (p *EventPublisher) PublishPresenceOnline(ctx context.Context, tx repository.DBTX, userID uuid.UUID, status string, audience []uuid.UUID) error {
 	event := &events.PresenceEvent{
 		BaseEvent: events.BaseEvent{
 			EventTypeVal: events.EventPresenceOnline,
@@ -117,14 +119,15 @@ func (p *EventPublisher) PublishPresenceOnline(ctx context.Context, tx repositor
 		},
 		UserID:   userID,
 		IsOnline: true,
-		Status:   "online",
+		Status:   status,
+		Audience: audience,
 	}
 
 	return p.saveToOutbox(ctx, tx, events.EventPresenceOnline, "user", userID.String(), event)
 }
 
 // PublishPresenceOffline creates an event when user goes offline
-func (p *EventPublisher) PublishPresenceOffline(ctx context.Context, tx repository.DBTX, userID uuid.UUID) error {
+func (p *EventPublisher) PublishPresenceOffline(ctx context.Context, tx repository.DBTX, userID uuid.UUID, lastSeen *time.Time, audience []uuid.UUID) error {
 	event := &events.PresenceEvent{
 		BaseEvent: events.BaseEvent{
 			EventTypeVal: events.EventPresenceOffline,
@@ -134,6 +137,8 @@ func (p *EventPublisher) PublishPresenceOffline(ctx context.Context, tx reposito
 		UserID:   userID,
 		IsOnline: false,
 		Status:   "offline",
+		LastSeen: lastSeen,
+		Audience: audience,
 	}
 
 	return p.saveToOutbox(ctx, tx, events.EventPresenceOffline, "user", userID.String(), event)
@@ -212,6 +217,379 @@ func (p *EventPublisher) PublishCallEnded(ctx context.Context, tx repository.DBT
 	return p.saveToOutbox(ctx, tx, events.EventCallEnded, "call", callID.String(), event)
 }
 
+// PublishReactionAdded creates an event when a user reacts to a message
+func (p *EventPublisher) PublishReactionAdded(ctx context.Context, tx repository.DBTX, msgID, convID, userID uuid.UUID, reactionCode string) error {
+	return p.publishReaction(ctx, tx, events.EventReactionAdded, msgID, convID, userID, reactionCode)
+}
+
+// PublishReactionRemoved creates an event when a user removes a reaction
+func (p *EventPublisher) PublishReactionRemoved(ctx context.Context, tx repository.DBTX, msgID, convID, userID uuid.UUID, reactionCode string) error {
+	return p.publishReaction(ctx, tx, events.EventReactionRemoved, msgID, convID, userID, reactionCode)
+}
+
+func (p *EventPublisher) publishReaction(ctx context.Context, tx repository.DBTX, eventType events.EventType, msgID, convID, userID uuid.UUID, reactionCode string) error {
+	event := &events.ReactionEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: eventType,
+			TimestampVal: time.Now(),
+			UserIDVal:    userID,
+			ConvIDVal:    convID,
+		},
+		MessageID:      msgID,
+		ConversationID: convID,
+		UserID:         userID,
+		ReactionCode:   reactionCode,
+	}
+
+	return p.saveToOutbox(ctx, tx, eventType, "message", msgID.String(), event)
+}
+
+// PublishPollUpdated creates an event carrying the current tallies of a poll
+func (p *EventPublisher) PublishPollUpdated(ctx context.Context, tx repository.DBTX, pollID, msgID, convID, actorID uuid.UUID, isClosed bool, totalVoters int64, tallies []events.PollTally) error {
+	event := &events.PollUpdatedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventPollUpdated,
+			TimestampVal: time.Now(),
+			UserIDVal:    actorID,
+			ConvIDVal:    convID,
+		},
+		PollID:         pollID,
+		MessageID:      msgID,
+		ConversationID: convID,
+		IsClosed:       isClosed,
+		TotalVoters:    totalVoters,
+		Tallies:        tallies,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventPollUpdated, "poll", pollID.String(), event)
+}
+
+// PublishMessageEdited creates an event when a message gets a new version
+func (p *EventPublisher) PublishMessageEdited(ctx context.Context, tx repository.DBTX, msgID, convID, editorID uuid.UUID, versionNumber int, editedAt time.Time) error {
+	event := &events.MessageEditedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventMessageEdited,
+			TimestampVal: time.Now(),
+			UserIDVal:    editorID,
+			ConvIDVal:    convID,
+		},
+		MessageID:      msgID,
+		ConversationID: convID,
+		EditorID:       editorID,
+		VersionNumber:  versionNumber,
+		EditedAt:       editedAt,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventMessageEdited, "message", msgID.String(), event)
+}
+
+// PublishCommandUndone notifies the user's devices that a command was reversed
+func (p *EventPublisher) PublishCommandUndone(ctx context.Context, tx repository.DBTX, commandID uuid.UUID, commandType string, userID uuid.UUID, undoneAt time.Time) error {
+	event := &events.CommandUndoneEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventCommandUndone,
+			TimestampVal: time.Now(),
+			UserIDVal:    userID,
+		},
+		CommandID:   commandID,
+		CommandType: commandType,
+		UserID:      userID,
+		UndoneAt:    undoneAt,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventCommandUndone, "command", commandID.String(), event)
+}
+
+// PublishLabelChanged notifies the user's other devices that their labels or
+// label assignments changed
+func (p *EventPublisher) PublishLabelChanged(ctx context.Context, tx repository.DBTX, userID uuid.UUID, action string, labelID, conversationID *uuid.UUID, labelIDs []uuid.UUID) error {
+	event := &events.LabelChangedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventLabelChanged,
+			TimestampVal: time.Now(),
+			UserIDVal:    userID,
+		},
+		UserID:         userID,
+		Action:         action,
+		LabelID:        labelID,
+		ConversationID: conversationID,
+		LabelIDs:       labelIDs,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventLabelChanged, "chat_label", userID.String(), event)
+}
+
+// PublishConversationCleared notifies the user's other devices that they
+// cleared a conversation's history
+func (p *EventPublisher) PublishConversationCleared(ctx context.Context, tx repository.DBTX, convID, userID uuid.UUID, clearedAt time.Time) error {
+	event := &events.HistoryHiddenEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventConversationCleared,
+			TimestampVal: time.Now(),
+			UserIDVal:    userID,
+		},
+		UserID:         userID,
+		ConversationID: convID,
+		ClearedAt:      &clearedAt,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventConversationCleared, "conversation", convID.String(), event)
+}
+
+// PublishMessageDeletedForMe notifies the user's other devices that they
+// deleted a message for themselves
+func (p *EventPublisher) PublishMessageDeletedForMe(ctx context.Context, tx repository.DBTX, msgID, convID, userID uuid.UUID) error {
+	event := &events.HistoryHiddenEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventMessageDeletedForMe,
+			TimestampVal: time.Now(),
+			UserIDVal:    userID,
+		},
+		UserID:         userID,
+		ConversationID: convID,
+		MessageID:      &msgID,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventMessageDeletedForMe, "message", msgID.String(), event)
+}
+
+// PublishMessageStarred notifies the user's other devices that they starred or
+// unstarred a message
+func (p *EventPublisher) PublishMessageStarred(ctx context.Context, tx repository.DBTX, msgID, convID, userID uuid.UUID, starred bool) error {
+	eventType := events.EventMessageUnstarred
+	if starred {
+		eventType = events.EventMessageStarred
+	}
+	event := &events.MessageStarEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: eventType,
+			TimestampVal: time.Now(),
+			UserIDVal:    userID,
+		},
+		MessageID:      msgID,
+		ConversationID: convID,
+		UserID:         userID,
+		Starred:        starred,
+	}
+
+	return p.saveToOutbox(ctx, tx, eventType, "message", msgID.String(), event)
+}
+
+// PublishMentionNew notifies a mentioned user of a new message mentioning them
+func (p *EventPublisher) PublishMentionNew(ctx context.Context, tx repository.DBTX, msgID, convID, senderID, userID uuid.UUID, mentions []events.MentionRange) error {
+	event := &events.MentionNewEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventMentionNew,
+			TimestampVal: time.Now(),
+			UserIDVal:    senderID,
+		},
+		MessageID:      msgID,
+		ConversationID: convID,
+		SenderID:       senderID,
+		UserID:         userID,
+		Mentions:       mentions,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventMentionNew, "message", msgID.String(), event)
+}
+
+// PublishAttachmentViewed tells the sender that a recipient opened a view-once attachment
+func (p *EventPublisher) PublishAttachmentViewed(ctx context.Context, tx repository.DBTX, attachmentID, msgID, convID, senderID, viewerID uuid.UUID, viewedAt time.Time) error {
+	event := &events.AttachmentViewedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventAttachmentViewed,
+			TimestampVal: time.Now(),
+			UserIDVal:    viewerID,
+		},
+		AttachmentID:   attachmentID,
+		MessageID:      msgID,
+		ConversationID: convID,
+		SenderID:       senderID,
+		ViewerID:       viewerID,
+		ViewedAt:       viewedAt,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventAttachmentViewed, "attachment", attachmentID.String(), event)
+}
+
+// PublishMessageExpired notifies conversation members that a disappearing
+// message was deleted after its expiry
+func (p *EventPublisher) PublishMessageExpired(ctx context.Context, tx repository.DBTX, msgID, convID, senderID uuid.UUID, seqID int64, expiresAt time.Time) error {
+	event := &events.MessageExpiredEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventMessageExpired,
+			TimestampVal: time.Now(),
+			UserIDVal:    senderID,
+			ConvIDVal:    convID,
+		},
+		MessageID:      msgID,
+		ConversationID: convID,
+		SeqID:          seqID,
+		ExpiresAt:      expiresAt,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventMessageExpired, "message", msgID.String(), event)
+}
+
+// PublishPermissionsChanged records which group permissions an admin changed,
+// keeping the previous settings for auditing
+func (p *EventPublisher) PublishPermissionsChanged(ctx context.Context, tx repository.DBTX, convID, actorID uuid.UUID, previous, current map[string]string) error {
+	event := &events.GroupPermissionsChangedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventPermissionsChanged,
+			TimestampVal: time.Now(),
+			UserIDVal:    actorID,
+			ConvIDVal:    convID,
+		},
+		ConversationID: convID,
+		ActorID:        actorID,
+		Previous:       previous,
+		Permissions:    current,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventPermissionsChanged, "conversation", convID.String(), event)
+}
+
+// PublishSenderKeyReceived tells the recipients of a sender key distribution
+// to fetch it.
+func (p *EventPublisher) PublishSenderKeyReceived(ctx context.Context, tx repository.DBTX, key encryption.SenderKey, recipientIDs []uuid.UUID) error {
+	event := &events.SenderKeyReceivedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventSenderKeyReceived,
+			TimestampVal: time.Now(),
+			UserIDVal:    key.SenderID,
+			ConvIDVal:    key.ConversationID,
+		},
+		ConversationID: key.ConversationID,
+		SenderID:       key.SenderID,
+		SenderDeviceID: key.SenderDeviceID,
+		DistributionID: key.DistributionID,
+		Epoch:          key.Epoch,
+		RecipientIDs:   recipientIDs,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventSenderKeyReceived, "conversation", key.ConversationID.String(), event)
+}
+
+// PublishSenderKeyRotate asks the members of a group to rotate their sender
+// keys for the new epoch.
+func (p *EventPublisher) PublishSenderKeyRotate(ctx context.Context, tx repository.DBTX, convID, memberID uuid.UUID, epoch int64, reason string) error {
+	event := &events.SenderKeyRotateEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventSenderKeyRotate,
+			TimestampVal: time.Now(),
+			UserIDVal:    memberID,
+			ConvIDVal:    convID,
+		},
+		ConversationID: convID,
+		Epoch:          epoch,
+		Reason:         reason,
+		MemberID:       memberID,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventSenderKeyRotate, "conversation", convID.String(), event)
+}
+
+// PublishPreKeysLow tells a device to upload more one-time prekeys.
+func (p *EventPublisher) PublishPreKeysLow(ctx context.Context, tx repository.DBTX, userID, deviceID uuid.UUID, remaining int64, threshold int) error {
+	event := &events.PreKeysLowEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventPreKeysLow,
+			TimestampVal: time.Now(),
+			UserIDVal:    userID,
+		},
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Remaining: remaining,
+		Threshold: threshold,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventPreKeysLow, "device", deviceID.String(), event)
+}
+
+// PublishSignedPreKeyRotate asks a device to replace a stale signed prekey.
+func (p *EventPublisher) PublishSignedPreKeyRotate(ctx context.Context, tx repository.DBTX, key encryption.SignedPreKey, expiresAt time.Time) error {
+	event := &events.SignedPreKeyRotateEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventSignedPreKeyRotate,
+			TimestampVal: time.Now(),
+			UserIDVal:    key.UserID,
+		},
+		UserID:    key.UserID,
+		DeviceID:  key.DeviceID,
+		KeyID:     key.KeyID,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: expiresAt,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventSignedPreKeyRotate, "device", key.DeviceID.String(), event)
+}
+
+// PublishIdentityChanged tells the recipients that a device's identity key
+// was added, replaced, deactivated or deleted.
+func (p *EventPublisher) PublishIdentityChanged(ctx context.Context, tx repository.DBTX, key encryption.IdentityKey, change string, recipientIDs []uuid.UUID) error {
+	event := &events.IdentityChangedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: events.EventIdentityChanged,
+			TimestampVal: time.Now(),
+			UserIDVal:    key.UserID,
+		},
+		UserID:        key.UserID,
+		DeviceID:      key.DeviceID,
+		IdentityKeyID: key.ID,
+		Change:        change,
+		RecipientIDs:  recipientIDs,
+	}
+
+	return p.saveToOutbox(ctx, tx, events.EventIdentityChanged, "device", key.DeviceID.String(), event)
+}
+
+// PublishMessageDeleted tells the conversation a message was deleted for
+// everyone, or restored when deleted is false
+func (p *EventPublisher) PublishMessageDeleted(ctx context.Context, tx repository.DBTX, msgID, convID, actorID uuid.UUID, deleted bool) error {
+	eventType := events.EventMessageRestored
+	if deleted {
+		eventType = events.EventMessageDeleted
+	}
+	event := &events.MessageDeletedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: eventType,
+			TimestampVal: time.Now(),
+			UserIDVal:    actorID,
+			ConvIDVal:    convID,
+		},
+		MessageID:      msgID,
+		ConversationID: convID,
+		ActorID:        actorID,
+		Deleted:        deleted,
+	}
+
+	return p.saveToOutbox(ctx, tx, eventType, "message", msgID.String(), event)
+}
+
+// PublishMessagePinned tells the conversation a message was pinned, or
+// unpinned when pinned is false
+func (p *EventPublisher) PublishMessagePinned(ctx context.Context, tx repository.DBTX, msgID, convID, actorID uuid.UUID, pinned bool) error {
+	eventType := events.EventMessageUnpinned
+	if pinned {
+		eventType = events.EventMessagePinned
+	}
+	event := &events.MessagePinnedEvent{
+		BaseEvent: events.BaseEvent{
+			EventTypeVal: eventType,
+			TimestampVal: time.Now(),
+			UserIDVal:    actorID,
+			ConvIDVal:    convID,
+		},
+		MessageID:      msgID,
+		ConversationID: convID,
+		ActorID:        actorID,
+		Pinned:         pinned,
+	}
+
+	return p.saveToOutbox(ctx, tx, eventType, "message", msgID.String(), event)
+}
+
 // saveToOutbox serializes the event and creates an outbox record within the transaction
 func (p *EventPublisher) saveToOutbox(ctx context.Context, tx repository.DBTX, eventType events.EventType, aggregateType, aggregateID string, event interface{}) error {
 	payload, err := json.Marshal(event)
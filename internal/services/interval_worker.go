@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// IntervalWorker calls a tick function on a fixed interval until stopped.
+// Background jobs embed it and supply the tick; a tick error is logged and the
+// next tick runs as usual.
+type IntervalWorker struct {
+	name     string
+	interval time.Duration
+	tick     func(ctx context.Context) error
+	logger   *zap.Logger
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	start    sync.Once
+	stop     sync.Once
+}
+
+func NewIntervalWorker(name string, interval time.Duration, logger *zap.Logger, tick func(ctx context.Context) error) *IntervalWorker {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &IntervalWorker{
+		name:     name,
+		interval: interval,
+		tick:     tick,
+		logger:   logger.With(zap.String("worker", name)),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start begins the worker loop
+func (w *IntervalWorker) Start() {
+	w.start.Do(func() {
+		w.wg.Add(1)
+		go w.run()
+	})
+}
+
+// Stop gracefully shuts down, cancelling a tick in progress
+func (w *IntervalWorker) Stop() {
+	w.stop.Do(w.cancel)
+	w.wg.Wait()
+}
+
+func (w *IntervalWorker) run() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.tick(w.ctx); err != nil && w.ctx.Err() == nil {
+				w.logger.Error("worker tick failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// drainBatches calls process until it handles fewer than batchSize items, so
+// a backlog is worked off within one tick.
+func drainBatches(ctx context.Context, batchSize int, process func(ctx context.Context, limit int) (int, error)) error {
+	for {
+		n, err := process(ctx, batchSize)
+		if err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sentinal-chat/internal/domain/message"
+	"sentinal-chat/internal/linkpreview"
+	"sentinal-chat/internal/redis"
+	"sentinal-chat/internal/repository"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// LinkPreviewService fetches previews for URLs a client explicitly discloses.
+// Previews are cached by URL hash so a popular link is fetched once per
+// cacheTTL, no matter how many users share it, and a failed fetch is not
+// retried for failureTTL. The client embeds the result in its encrypted
+// message; the server never links a preview to a message itself.
+type LinkPreviewService struct {
+	messageRepo repository.MessageRepository
+	fetcher     *linkpreview.Fetcher
+	cache       *redis.CacheStore
+	cacheTTL    time.Duration
+	failureTTL  time.Duration
+}
+
+// NewLinkPreviewService creates a link preview service. Failed fetches are
+// remembered in cache when it is non-nil.
+func NewLinkPreviewService(messageRepo repository.MessageRepository, fetcher *linkpreview.Fetcher, cache *redis.CacheStore, cacheTTL, failureTTL time.Duration) *LinkPreviewService {
+	if cacheTTL <= 0 {
+		cacheTTL = 24 * time.Hour
+	}
+	if failureTTL <= 0 {
+		failureTTL = 10 * time.Minute
+	}
+	return &LinkPreviewService{
+		messageRepo: messageRepo,
+		fetcher:     fetcher,
+		cache:       cache,
+		cacheTTL:    cacheTTL,
+		failureTTL:  failureTTL,
+	}
+}
+
+// GetPreview returns the cached preview for rawURL, fetching it when there is
+// none or it is older than the cache TTL. A URL whose fetch failed recently
+// fails again with the same reason without being fetched.
+func (s *LinkPreviewService) GetPreview(ctx context.Context, rawURL string) (message.LinkPreview, error) {
+	normalized, err := linkpreview.NormalizeURL(rawURL)
+	if err != nil {
+		return message.LinkPreview{}, sentinal_errors.ErrInvalidInput
+	}
+	hash := linkpreview.HashURL(normalized)
+
+	cached, err := s.messageRepo.GetLinkPreviewByHash(ctx, hash)
+	if err == nil && time.Since(cached.FetchedAt) < s.cacheTTL {
+		return cached, nil
+	}
+	if err != nil && !errors.Is(err, sentinal_errors.ErrNotFound) {
+		return message.LinkPreview{}, err
+	}
+	if s.cache != nil {
+		if reason, err := s.cache.GetLinkPreviewFailure(ctx, hash); err == nil && reason != "" {
+			return message.LinkPreview{}, errors.New(reason)
+		}
+	}
+
+	fetched, err := s.fetcher.Fetch(ctx, normalized)
+	if err != nil {
+		// A request cancelled by its caller says nothing about the URL.
+		if s.cache != nil && ctx.Err() == nil {
+			_ = s.cache.SetLinkPreviewFailure(ctx, hash, err.Error(), s.failureTTL)
+		}
+		return message.LinkPreview{}, err
+	}
+
+	preview := message.LinkPreview{
+		ID:          uuid.New(),
+		URL:         normalized,
+		URLHash:     hash,
+		Title:       msgNullString(fetched.Title),
+		Description: msgNullString(fetched.Description),
+		ImageURL:    msgNullString(fetched.ImageURL),
+		SiteName:    msgNullString(fetched.SiteName),
+		FetchedAt:   time.Now(),
+	}
+	if err := s.messageRepo.UpsertLinkPreview(ctx, &preview); err != nil {
+		return message.LinkPreview{}, err
+	}
+	return preview, nil
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MessageExpiryWorker periodically deletes disappearing messages past their
+// expiry and then the attachment objects those messages left behind.
+type MessageExpiryWorker struct {
+	*IntervalWorker
+	messageService    *MessageService
+	attachmentService *AttachmentService
+	batchSize         int
+}
+
+func NewMessageExpiryWorker(messageService *MessageService, attachmentService *AttachmentService, logger *zap.Logger) *MessageExpiryWorker {
+	w := &MessageExpiryWorker{
+		messageService:    messageService,
+		attachmentService: attachmentService,
+		batchSize:         100,
+	}
+	w.IntervalWorker = NewIntervalWorker("message_expiry_worker", 15*time.Second, logger, w.processBatch)
+	return w
+}
+
+func (w *MessageExpiryWorker) processBatch(ctx context.Context) error {
+	if err := drainBatches(ctx, w.batchSize, w.messageService.ExpireMessages); err != nil {
+		// Objects orphaned by earlier ticks can still be purged.
+		w.logger.Error("message expiry failed", zap.Error(err))
+	}
+	if w.attachmentService == nil {
+		return nil
+	}
+	return drainBatches(ctx, w.batchSize, w.attachmentService.PurgeOrphanedObjects)
+}
@@ -5,10 +5,15 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"strings"
 	"time"
 
+	"sentinal-chat/internal/commands"
+	"sentinal-chat/internal/domain/command"
+	"sentinal-chat/internal/domain/conversation"
 	"sentinal-chat/internal/domain/message"
+	"sentinal-chat/internal/events"
 	"sentinal-chat/internal/repository"
 	sentinal_errors "sentinal-chat/pkg/errors"
 
@@ -20,6 +25,8 @@ type MessageService struct {
 	db               repository.DBTX
 	messageRepo      repository.MessageRepository
 	conversationRepo repository.ConversationRepository
+	uploadRepo       repository.UploadRepository
+	senderKeyRepo    repository.SenderKeyRepository
 	eventPublisher   *EventPublisher
 	commandExecutor  *CommandExecutor
 }
@@ -31,33 +38,180 @@ type CiphertextPayload struct {
 	Header            map[string]interface{}
 }
 
-// SendMessageInput contains all data needed to send an E2EE message.
+// GroupCiphertextPayload is a group message encrypted once with the sending
+// device's sender key. Every member device reads the same ciphertext.
+type GroupCiphertextPayload struct {
+	DistributionID uuid.UUID
+	Ciphertext     []byte
+	Header         map[string]interface{}
+}
+
+// SendMessageInput contains all data needed to send an E2EE message. A group
+// message carries either per-device Ciphertexts or one GroupCiphertext.
 type SendMessageInput struct {
+	ConversationID  uuid.UUID
+	SenderID        uuid.UUID
+	Ciphertexts     []CiphertextPayload
+	GroupCiphertext *GroupCiphertextPayload
+	MessageType     string
+	ClientMsgID     string
+	IdempotencyKey  string
+	Metadata        map[string]interface{}
+	Poll            *PollInput
+	Mentions        []MentionInput
+	Attachments     []AttachmentInput
+	// ExpiresInSeconds sets a per-message disappearing timer. It may shorten
+	// the conversation's disappearing mode but not extend it. Zero uses the
+	// conversation setting.
+	ExpiresInSeconds int
+	// ReplyToMsgID quotes an earlier message of the same conversation.
+	ReplyToMsgID uuid.NullUUID
+	// ForwardedFromMsgID marks the message as a forward of a message the
+	// sender can see; its attachments are shared with the new message.
+	ForwardedFromMsgID uuid.NullUUID
+}
+
+// maxForwardTargets bounds how many conversations one forward may reach.
+const maxForwardTargets = 5
+
+// ForwardMessageInput forwards one message to several conversations. The
+// client re-encrypts the content for the devices of each target.
+type ForwardMessageInput struct {
+	MessageID uuid.UUID
+	SenderID  uuid.UUID
+	Targets   []ForwardTarget
+}
+
+// ForwardTarget is one conversation a message is forwarded to.
+type ForwardTarget struct {
 	ConversationID uuid.UUID
-	SenderID       uuid.UUID
 	Ciphertexts    []CiphertextPayload
-	MessageType    string
 	ClientMsgID    string
 	IdempotencyKey string
-	Metadata       map[string]interface{}
 }
 
+// AttachmentInput references a completed upload owned by the sender, plus the
+// media details and key material only the client knows about the encrypted file.
+type AttachmentInput struct {
+	UploadID          uuid.UUID
+	Width             *int32
+	Height            *int32
+	DurationSeconds   *int32
+	EncryptionKeyHash string
+	EncryptionIV      string
+	ThumbnailURL      string
+	ViewOnce          bool
+}
+
+// MentionInput locates a mention of a participant inside the plaintext the
+// client encrypted.
+type MentionInput struct {
+	UserID uuid.UUID
+	Offset int
+	Length int
+}
+
+// PollInput describes the poll attached to a POLL message.
+type PollInput struct {
+	Question       string
+	Options        []string
+	AllowsMultiple bool
+	ClosesAt       time.Time
+}
+
+const (
+	maxPollOptions = 12
+	minPollOptions = 2
+
+	maxMessageMentions    = 50
+	maxMessageAttachments = 10
+)
+
 // NewMessageService creates a message service with all dependencies.
-func NewMessageService(db repository.DBTX, messageRepo repository.MessageRepository, conversationRepo repository.ConversationRepository, eventPublisher *EventPublisher, commandExecutor *CommandExecutor) *MessageService {
+func NewMessageService(db repository.DBTX, messageRepo repository.MessageRepository, conversationRepo repository.ConversationRepository, uploadRepo repository.UploadRepository, senderKeyRepo repository.SenderKeyRepository, eventPublisher *EventPublisher, commandExecutor *CommandExecutor) *MessageService {
 	return &MessageService{
 		db:               db,
 		messageRepo:      messageRepo,
 		conversationRepo: conversationRepo,
+		uploadRepo:       uploadRepo,
+		senderKeyRepo:    senderKeyRepo,
 		eventPublisher:   eventPublisher,
 		commandExecutor:  commandExecutor,
 	}
 }
 
-// SendMessage creates and stores a new E2EE message.
-func (s *MessageService) SendMessage(ctx context.Context, input SendMessageInput) (message.Message, error) {
+// withTx returns a copy of the service whose repositories run on tx, so callers
+// that already hold a transaction can send messages inside it.
+func (s *MessageService) withTx(tx repository.DBTX) *MessageService {
+	clone := *s
+	clone.db = tx
+	clone.messageRepo = repository.NewMessageRepository(tx)
+	if s.conversationRepo != nil {
+		clone.conversationRepo = repository.NewConversationRepository(tx)
+	}
+	if s.uploadRepo != nil {
+		clone.uploadRepo = repository.NewUploadRepository(tx)
+	}
+	if s.senderKeyRepo != nil {
+		clone.senderKeyRepo = repository.NewSenderKeyRepository(tx)
+	}
+	return &clone
+}
+
+// SendMessage creates and stores a new E2EE message. The returned command log
+// can be used to undo the send.
+func (s *MessageService) SendMessage(ctx context.Context, input SendMessageInput) (message.Message, *command.CommandLog, error) {
 	return s.executeSendMessage(ctx, input)
 }
 
+// ForwardMessage sends the message to every target conversation in one
+// transaction, so either all targets receive it or none does.
+func (s *MessageService) ForwardMessage(ctx context.Context, input ForwardMessageInput) ([]message.Message, error) {
+	if input.MessageID == uuid.Nil || len(input.Targets) == 0 || len(input.Targets) > maxForwardTargets {
+		return nil, sentinal_errors.ErrInvalidInput
+	}
+	seen := make(map[uuid.UUID]bool, len(input.Targets))
+	for _, target := range input.Targets {
+		if seen[target.ConversationID] {
+			return nil, sentinal_errors.ErrInvalidInput
+		}
+		seen[target.ConversationID] = true
+	}
+
+	forward := func(svc *MessageService) ([]message.Message, error) {
+		sent := make([]message.Message, 0, len(input.Targets))
+		for _, target := range input.Targets {
+			msg, _, err := svc.executeSendMessage(ctx, SendMessageInput{
+				ConversationID:     target.ConversationID,
+				SenderID:           input.SenderID,
+				Ciphertexts:        target.Ciphertexts,
+				ClientMsgID:        target.ClientMsgID,
+				IdempotencyKey:     target.IdempotencyKey,
+				ForwardedFromMsgID: uuid.NullUUID{UUID: input.MessageID, Valid: true},
+			})
+			if err != nil {
+				return nil, err
+			}
+			sent = append(sent, msg)
+		}
+		return sent, nil
+	}
+
+	if s.db == nil {
+		return forward(s)
+	}
+	var sent []message.Message
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		var err error
+		sent, err = forward(s.withTx(tx))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sent, nil
+}
+
 // GetConversationMessages retrieves messages with pagination and access control.
 func (s *MessageService) GetConversationMessages(ctx context.Context, conversationID uuid.UUID, beforeSeq int64, limit int, userID uuid.UUID) ([]message.Message, error) {
 	if s.conversationRepo == nil {
@@ -77,7 +231,14 @@ func (s *MessageService) GetConversationMessages(ctx context.Context, conversati
 	if !ok || !deviceID.Valid {
 		return nil, sentinal_errors.ErrInvalidInput
 	}
-	return s.messageRepo.GetConversationMessages(ctx, conversationID, beforeSeq, limit, deviceID.UUID)
+	msgs, err := s.messageRepo.GetConversationMessages(ctx, conversationID, beforeSeq, limit, deviceID.UUID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadAttachments(ctx, msgs); err != nil {
+		return nil, err
+	}
+	return msgs, nil
 }
 
 func (s *MessageService) GetByID(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) (message.Message, error) {
@@ -97,8 +258,40 @@ func (s *MessageService) GetByID(ctx context.Context, messageID uuid.UUID, userI
 	return msg, nil
 }
 
-func (s *MessageService) Delete(ctx context.Context, messageID uuid.UUID) error {
-	return s.messageRepo.SoftDelete(ctx, messageID)
+// DeleteMessage soft deletes a message for everyone through the command
+// executor so the deletion can be undone.
+func (s *MessageService) DeleteMessage(ctx context.Context, messageID, userID uuid.UUID) (*command.CommandLog, error) {
+	if messageID == uuid.Nil || userID == uuid.Nil {
+		return nil, sentinal_errors.ErrInvalidInput
+	}
+	if s.commandExecutor == nil {
+		return nil, sentinal_errors.ErrServiceUnavailable
+	}
+	return s.commandExecutor.Execute(ctx, commands.NewDeleteMessageCommand(messageID, userID, true))
+}
+
+// DeleteForMe hides a message from the caller only; other participants still
+// see it.
+func (s *MessageService) DeleteForMe(ctx context.Context, messageID, userID uuid.UUID) error {
+	if messageID == uuid.Nil || userID == uuid.Nil {
+		return sentinal_errors.ErrInvalidInput
+	}
+	msg, err := s.GetByID(ctx, messageID, userID)
+	if err != nil {
+		return err
+	}
+	if s.db == nil {
+		return s.messageRepo.DeleteForUser(ctx, messageID, userID)
+	}
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		if err := repository.NewMessageRepository(tx).DeleteForUser(ctx, messageID, userID); err != nil {
+			return err
+		}
+		if s.eventPublisher == nil {
+			return nil
+		}
+		return s.eventPublisher.PublishMessageDeletedForMe(ctx, tx, messageID, msg.ConversationID, userID)
+	})
 }
 
 func (s *MessageService) HardDelete(ctx context.Context, messageID uuid.UUID) error {
@@ -109,12 +302,151 @@ func (s *MessageService) Update(ctx context.Context, msg message.Message) error
 	return s.messageRepo.Update(ctx, msg)
 }
 
+// EditMessageInput carries the re-encrypted payloads of an edited message.
+type EditMessageInput struct {
+	MessageID   uuid.UUID
+	EditorID    uuid.UUID
+	Ciphertexts []CiphertextPayload
+}
+
+// EditMessage replaces a message's ciphertexts through the command executor,
+// which keeps the previous set as a new message version.
+func (s *MessageService) EditMessage(ctx context.Context, input EditMessageInput) (message.Message, *command.CommandLog, error) {
+	if input.MessageID == uuid.Nil || input.EditorID == uuid.Nil || len(input.Ciphertexts) == 0 {
+		return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+	}
+	if s.commandExecutor == nil {
+		return message.Message{}, nil, sentinal_errors.ErrServiceUnavailable
+	}
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+	}
+
+	items := make([]commands.EditCiphertext, 0, len(input.Ciphertexts))
+	for _, payload := range input.Ciphertexts {
+		if payload.RecipientDeviceID == uuid.Nil || len(payload.Ciphertext) == 0 {
+			return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+		}
+		recipientUserID, err := s.lookupUserIDByDevice(ctx, payload.RecipientDeviceID)
+		if err != nil {
+			return message.Message{}, nil, err
+		}
+		header := payload.Header
+		if header == nil {
+			header = map[string]interface{}{"version": 1, "cipher": "signal"}
+		}
+		headerRaw, _ := json.Marshal(header)
+		items = append(items, commands.EditCiphertext{
+			RecipientUserID:   recipientUserID,
+			RecipientDeviceID: payload.RecipientDeviceID,
+			Ciphertext:        payload.Ciphertext,
+			Header:            string(headerRaw),
+		})
+	}
+
+	cmd := commands.NewEditMessageCommand(input.MessageID, input.EditorID, deviceID.UUID, items)
+	cmdLog, err := s.commandExecutor.Execute(ctx, cmd)
+	if err != nil {
+		return message.Message{}, nil, err
+	}
+	msg, err := s.messageRepo.GetByID(ctx, input.MessageID)
+	if err != nil {
+		return message.Message{}, nil, err
+	}
+	return msg, cmdLog, nil
+}
+
+// GetMessageVersions returns the edit history of a message as seen by the
+// caller's device.
+func (s *MessageService) GetMessageVersions(ctx context.Context, messageID, userID uuid.UUID) ([]command.MessageVersion, error) {
+	if _, err := s.GetByID(ctx, messageID, userID); err != nil {
+		return nil, err
+	}
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return nil, sentinal_errors.ErrInvalidInput
+	}
+	return s.messageRepo.GetVersions(ctx, messageID, deviceID.UUID)
+}
+
+// AddReaction records a reaction and fans it out to the conversation.
 func (s *MessageService) AddReaction(ctx context.Context, reaction *message.MessageReaction) error {
-	return s.messageRepo.AddReaction(ctx, reaction)
+	reaction.ReactionCode = strings.TrimSpace(reaction.ReactionCode)
+	if reaction.MessageID == uuid.Nil || reaction.UserID == uuid.Nil || reaction.ReactionCode == "" {
+		return sentinal_errors.ErrInvalidInput
+	}
+	msg, err := s.GetByID(ctx, reaction.MessageID, reaction.UserID)
+	if err != nil {
+		return err
+	}
+	if msg.DeletedAt.Valid {
+		return sentinal_errors.ErrNotFound
+	}
+	if reaction.ID == uuid.Nil {
+		reaction.ID = uuid.New()
+	}
+	if reaction.CreatedAt.IsZero() {
+		reaction.CreatedAt = time.Now()
+	}
+
+	if s.db == nil {
+		return s.messageRepo.AddReaction(ctx, reaction)
+	}
+
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		msgRepo := repository.NewMessageRepository(tx)
+		if err := msgRepo.AddReaction(ctx, reaction); err != nil {
+			return err
+		}
+
+		if s.eventPublisher != nil {
+			if err := s.eventPublisher.PublishReactionAdded(ctx, tx, msg.ID, msg.ConversationID, reaction.UserID, reaction.ReactionCode); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
+// RemoveReaction deletes a reaction and fans the removal out to the conversation.
 func (s *MessageService) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, reactionCode string) error {
-	return s.messageRepo.RemoveReaction(ctx, messageID, userID, reactionCode)
+	reactionCode = strings.TrimSpace(reactionCode)
+	if reactionCode == "" {
+		return sentinal_errors.ErrInvalidInput
+	}
+	msg, err := s.GetByID(ctx, messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	if s.db == nil {
+		return s.messageRepo.RemoveReaction(ctx, messageID, userID, reactionCode)
+	}
+
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		msgRepo := repository.NewMessageRepository(tx)
+		if err := msgRepo.RemoveReaction(ctx, messageID, userID, reactionCode); err != nil {
+			return err
+		}
+
+		if s.eventPublisher != nil {
+			if err := s.eventPublisher.PublishReactionRemoved(ctx, tx, messageID, msg.ConversationID, userID, reactionCode); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetReactionSummary returns reactions on a message grouped by reaction code.
+func (s *MessageService) GetReactionSummary(ctx context.Context, messageID, userID uuid.UUID) ([]message.ReactionSummary, error) {
+	if _, err := s.GetByID(ctx, messageID, userID); err != nil {
+		return nil, err
+	}
+	return s.messageRepo.GetReactionSummary(ctx, messageID, userID)
 }
 
 func (s *MessageService) MarkAsRead(ctx context.Context, messageID, userID uuid.UUID) error {
@@ -160,7 +492,7 @@ func (s *MessageService) MarkAsDelivered(ctx context.Context, messageID, userID
 		}
 
 		if s.eventPublisher != nil {
-			if err := s.eventPublisher.PublishMessageDelivered(ctx, tx, messageID, msg.ConversationID, userID); err != nil {
+			if err := s.eventPublisher.PublishMessageDelivered(ctx, tx, messageID, msg.ConversationID, msg.SenderID, userID); err != nil {
 				return err
 			}
 		}
@@ -245,26 +577,189 @@ func (s *MessageService) GetMessageMentions(ctx context.Context, messageID uuid.
 	return s.messageRepo.GetMessageMentions(ctx, messageID)
 }
 
-func (s *MessageService) GetUserMentions(ctx context.Context, userID uuid.UUID, page, limit int) ([]message.Message, int64, error) {
-	return s.messageRepo.GetUserMentions(ctx, userID, page, limit)
+// GetUserMentions lists messages mentioning the user with the ciphertexts
+// addressed to the calling device and the user's mention ranges in each.
+func (s *MessageService) GetUserMentions(ctx context.Context, userID uuid.UUID, unreadOnly bool, page, limit int) ([]message.MentionDetails, int64, error) {
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return nil, 0, sentinal_errors.ErrInvalidInput
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	items, total, err := s.messageRepo.GetUserMentions(ctx, userID, deviceID.UUID, unreadOnly, page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range items {
+		mentions, err := s.messageRepo.GetMessageMentions(ctx, items[i].Message.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, m := range mentions {
+			if m.UserID == userID {
+				items[i].Mentions = append(items[i].Mentions, m)
+			}
+		}
+	}
+	return items, total, nil
 }
 
-func (s *MessageService) StarMessage(ctx context.Context, sMsg *message.StarredMessage) error {
-	return s.messageRepo.StarMessage(ctx, sMsg)
+// StarMessage stars a message the user can see and syncs it to their devices.
+func (s *MessageService) StarMessage(ctx context.Context, messageID, userID uuid.UUID) (message.StarredMessage, error) {
+	msg, err := s.GetByID(ctx, messageID, userID)
+	if err != nil {
+		return message.StarredMessage{}, err
+	}
+	starred := message.StarredMessage{
+		UserID:    userID,
+		MessageID: messageID,
+		StarredAt: time.Now(),
+	}
+	err = s.withStarTx(ctx, msg, userID, true, func(repo repository.MessageRepository) error {
+		return repo.StarMessage(ctx, &starred)
+	})
+	if err != nil {
+		return message.StarredMessage{}, err
+	}
+	return starred, nil
 }
 
-func (s *MessageService) UnstarMessage(ctx context.Context, userID, messageID uuid.UUID) error {
-	return s.messageRepo.UnstarMessage(ctx, userID, messageID)
+// UnstarMessage removes a star and syncs the change to the user's devices.
+func (s *MessageService) UnstarMessage(ctx context.Context, messageID, userID uuid.UUID) error {
+	msg, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	return s.withStarTx(ctx, msg, userID, false, func(repo repository.MessageRepository) error {
+		return repo.UnstarMessage(ctx, userID, messageID)
+	})
 }
 
-func (s *MessageService) GetUserStarredMessages(ctx context.Context, userID uuid.UUID, page, limit int) ([]message.StarredMessage, int64, error) {
-	return s.messageRepo.GetUserStarredMessages(ctx, userID, page, limit)
+// GetUserStarredMessages lists the user's starred messages with the
+// ciphertexts addressed to the calling device.
+func (s *MessageService) GetUserStarredMessages(ctx context.Context, userID uuid.UUID, page, limit int) ([]message.StarredMessageDetails, int64, error) {
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return nil, 0, sentinal_errors.ErrInvalidInput
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	return s.messageRepo.GetUserStarredMessages(ctx, userID, deviceID.UUID, page, limit)
 }
 
 func (s *MessageService) IsMessageStarred(ctx context.Context, userID, messageID uuid.UUID) (bool, error) {
 	return s.messageRepo.IsMessageStarred(ctx, userID, messageID)
 }
 
+// withStarTx applies a star change and publishes it to the user's devices in
+// the same transaction.
+func (s *MessageService) withStarTx(ctx context.Context, msg message.Message, userID uuid.UUID, starred bool, fn func(repository.MessageRepository) error) error {
+	if s.db == nil {
+		return fn(s.messageRepo)
+	}
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		if err := fn(repository.NewMessageRepository(tx)); err != nil {
+			return err
+		}
+		if s.eventPublisher == nil {
+			return nil
+		}
+		return s.eventPublisher.PublishMessageStarred(ctx, tx, msg.ID, msg.ConversationID, userID, starred)
+	})
+}
+
+// PinMessage pins a message to the top of its conversation for everyone. In
+// groups the pin_messages permission decides who may pin.
+func (s *MessageService) PinMessage(ctx context.Context, messageID, userID uuid.UUID) (message.PinnedMessage, error) {
+	msg, err := s.authorizePin(ctx, messageID, userID)
+	if err != nil {
+		return message.PinnedMessage{}, err
+	}
+	if msg.DeletedAt.Valid || (msg.ExpiresAt.Valid && !msg.ExpiresAt.Time.After(time.Now())) {
+		return message.PinnedMessage{}, sentinal_errors.ErrNotFound
+	}
+	pinned := message.PinnedMessage{
+		ConversationID: msg.ConversationID,
+		MessageID:      msg.ID,
+		PinnedBy:       uuid.NullUUID{UUID: userID, Valid: true},
+		PinnedAt:       time.Now(),
+	}
+	err = s.withPinTx(ctx, msg, userID, true, func(repo repository.MessageRepository) error {
+		return repo.PinMessage(ctx, &pinned)
+	})
+	if err != nil {
+		return message.PinnedMessage{}, err
+	}
+	return pinned, nil
+}
+
+// UnpinMessage removes a message's pin, subject to the same permission as
+// pinning it.
+func (s *MessageService) UnpinMessage(ctx context.Context, messageID, userID uuid.UUID) error {
+	msg, err := s.authorizePin(ctx, messageID, userID)
+	if err != nil {
+		return err
+	}
+	return s.withPinTx(ctx, msg, userID, false, func(repo repository.MessageRepository) error {
+		return repo.UnpinMessage(ctx, msg.ConversationID, msg.ID)
+	})
+}
+
+// GetPinnedMessages lists a conversation's pins to one of its participants.
+func (s *MessageService) GetPinnedMessages(ctx context.Context, conversationID, userID uuid.UUID) ([]message.PinnedMessage, error) {
+	if s.conversationRepo != nil {
+		ok, err := s.conversationRepo.IsParticipant(ctx, conversationID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, sentinal_errors.ErrForbidden
+		}
+	}
+	return s.messageRepo.GetPinnedMessages(ctx, conversationID)
+}
+
+func (s *MessageService) authorizePin(ctx context.Context, messageID, userID uuid.UUID) (message.Message, error) {
+	if messageID == uuid.Nil || userID == uuid.Nil {
+		return message.Message{}, sentinal_errors.ErrInvalidInput
+	}
+	msg, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return message.Message{}, err
+	}
+	if s.conversationRepo != nil {
+		if _, _, err := authorizeAction(ctx, s.conversationRepo, msg.ConversationID, userID, conversation.ActionPinMessages); err != nil {
+			return message.Message{}, err
+		}
+	}
+	return msg, nil
+}
+
+// withPinTx runs fn and publishes the pin change to the conversation in one
+// transaction.
+func (s *MessageService) withPinTx(ctx context.Context, msg message.Message, userID uuid.UUID, pinned bool, fn func(repository.MessageRepository) error) error {
+	if s.db == nil {
+		return fn(s.messageRepo)
+	}
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		if err := fn(repository.NewMessageRepository(tx)); err != nil {
+			return err
+		}
+		if s.eventPublisher == nil {
+			return nil
+		}
+		return s.eventPublisher.PublishMessagePinned(ctx, tx, msg.ID, msg.ConversationID, userID, pinned)
+	})
+}
+
 func (s *MessageService) CreateAttachment(ctx context.Context, a *message.Attachment) error {
 	return s.messageRepo.CreateAttachment(ctx, a)
 }
@@ -305,10 +800,6 @@ func (s *MessageService) GetPollByID(ctx context.Context, id uuid.UUID) (message
 	return s.messageRepo.GetPollByID(ctx, id)
 }
 
-func (s *MessageService) ClosePoll(ctx context.Context, pollID uuid.UUID) error {
-	return s.messageRepo.ClosePoll(ctx, pollID)
-}
-
 func (s *MessageService) AddPollOption(ctx context.Context, o *message.PollOption) error {
 	return s.messageRepo.AddPollOption(ctx, o)
 }
@@ -317,14 +808,6 @@ func (s *MessageService) GetPollOptions(ctx context.Context, pollID uuid.UUID) (
 	return s.messageRepo.GetPollOptions(ctx, pollID)
 }
 
-func (s *MessageService) VotePoll(ctx context.Context, v *message.PollVote) error {
-	return s.messageRepo.VotePoll(ctx, v)
-}
-
-func (s *MessageService) RemoveVote(ctx context.Context, pollID, optionID, userID uuid.UUID) error {
-	return s.messageRepo.RemoveVote(ctx, pollID, optionID, userID)
-}
-
 func (s *MessageService) GetPollVotes(ctx context.Context, pollID uuid.UUID) ([]message.PollVote, error) {
 	return s.messageRepo.GetPollVotes(ctx, pollID)
 }
@@ -333,49 +816,347 @@ func (s *MessageService) GetUserVotes(ctx context.Context, pollID, userID uuid.U
 	return s.messageRepo.GetUserVotes(ctx, pollID, userID)
 }
 
-// DeleteExpiredMessages removes messages past their expiry date.
-func (s *MessageService) DeleteExpiredMessages(ctx context.Context) (int64, error) {
-	return s.messageRepo.DeleteExpiredMessages(ctx)
+// GetPoll returns a poll with tallies for a participant of its conversation.
+func (s *MessageService) GetPoll(ctx context.Context, pollID, userID uuid.UUID) (message.PollDetails, error) {
+	poll, err := s.messageRepo.GetPollByID(ctx, pollID)
+	if err != nil {
+		return message.PollDetails{}, err
+	}
+	msg, err := s.pollMessage(ctx, poll, userID)
+	if err != nil {
+		return message.PollDetails{}, err
+	}
+	return s.buildPollDetails(ctx, s.messageRepo, poll, msg.ConversationID, userID)
 }
 
-// executeSendMessage validates and creates a message within a transaction.
-func (s *MessageService) executeSendMessage(ctx context.Context, input SendMessageInput) (message.Message, error) {
-	if input.ConversationID == uuid.Nil || input.SenderID == uuid.Nil {
-		return message.Message{}, sentinal_errors.ErrInvalidInput
-	}
-	if len(input.Ciphertexts) == 0 {
-		return message.Message{}, sentinal_errors.ErrInvalidInput
+// VotePoll replaces the caller's selection with optionIDs.
+// Single-choice polls accept exactly one option; closed polls reject votes.
+func (s *MessageService) VotePoll(ctx context.Context, pollID, userID uuid.UUID, optionIDs []uuid.UUID) (message.PollDetails, error) {
+	if len(optionIDs) == 0 {
+		return message.PollDetails{}, sentinal_errors.ErrInvalidInput
 	}
-	for _, payload := range input.Ciphertexts {
-		if payload.RecipientDeviceID == uuid.Nil || len(payload.Ciphertext) == 0 {
-			return message.Message{}, sentinal_errors.ErrInvalidInput
+	seen := make(map[uuid.UUID]bool, len(optionIDs))
+	for _, id := range optionIDs {
+		if id == uuid.Nil || seen[id] {
+			return message.PollDetails{}, sentinal_errors.ErrInvalidInput
 		}
+		seen[id] = true
 	}
 
-	if s.conversationRepo != nil {
-		ok, err := s.conversationRepo.IsParticipant(ctx, input.ConversationID, input.SenderID)
+	return s.mutatePoll(ctx, pollID, userID, func(msgRepo repository.MessageRepository, poll message.Poll, msg message.Message) error {
+		if poll.IsClosed(time.Now()) {
+			return sentinal_errors.ErrInvalidTransition
+		}
+		if !poll.AllowsMultiple && len(optionIDs) > 1 {
+			return sentinal_errors.ErrInvalidInput
+		}
+		options, err := msgRepo.GetPollOptions(ctx, poll.ID)
 		if err != nil {
-			return message.Message{}, err
+			return err
 		}
-		if !ok {
-			return message.Message{}, sentinal_errors.ErrForbidden
+		valid := make(map[uuid.UUID]bool, len(options))
+		for _, o := range options {
+			valid[o.ID] = true
+		}
+		for _, id := range optionIDs {
+			if !valid[id] {
+				return sentinal_errors.ErrInvalidInput
+			}
 		}
-	}
 
+		if err := msgRepo.RemoveUserVotes(ctx, poll.ID, userID); err != nil && !errors.Is(err, sentinal_errors.ErrNotFound) {
+			return err
+		}
+		now := time.Now()
+		for _, id := range optionIDs {
+			if err := msgRepo.VotePoll(ctx, &message.PollVote{
+				PollID:   poll.ID,
+				OptionID: id,
+				UserID:   userID,
+				VotedAt:  now,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RetractPollVote removes one of the caller's votes, or all of them when optionID is not set.
+func (s *MessageService) RetractPollVote(ctx context.Context, pollID, userID uuid.UUID, optionID uuid.NullUUID) (message.PollDetails, error) {
+	return s.mutatePoll(ctx, pollID, userID, func(msgRepo repository.MessageRepository, poll message.Poll, msg message.Message) error {
+		if poll.IsClosed(time.Now()) {
+			return sentinal_errors.ErrInvalidTransition
+		}
+		if optionID.Valid {
+			return msgRepo.RemoveVote(ctx, poll.ID, optionID.UUID, userID)
+		}
+		return msgRepo.RemoveUserVotes(ctx, poll.ID, userID)
+	})
+}
+
+// ClosePoll closes a poll early. Only the sender of the poll message may close it.
+func (s *MessageService) ClosePoll(ctx context.Context, pollID, userID uuid.UUID) (message.PollDetails, error) {
+	return s.mutatePoll(ctx, pollID, userID, func(msgRepo repository.MessageRepository, poll message.Poll, msg message.Message) error {
+		if msg.SenderID != userID {
+			return sentinal_errors.ErrForbidden
+		}
+		if poll.ClosedAt.Valid {
+			return sentinal_errors.ErrInvalidTransition
+		}
+		return msgRepo.ClosePoll(ctx, poll.ID)
+	})
+}
+
+// CloseDuePolls finalizes polls whose closing time has passed and announces the final tallies.
+func (s *MessageService) CloseDuePolls(ctx context.Context, limit int) (int, error) {
 	if s.db == nil {
-		return s.executeSendMessageDirect(ctx, input)
+		return 0, sentinal_errors.ErrServiceUnavailable
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	closed := 0
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		msgRepo := repository.NewMessageRepository(tx)
+		polls, err := msgRepo.CloseDuePolls(ctx, limit)
+		if err != nil {
+			return err
+		}
+		for _, poll := range polls {
+			if !poll.MessageID.Valid {
+				continue
+			}
+			msg, err := msgRepo.GetByID(ctx, poll.MessageID.UUID)
+			if err != nil {
+				if errors.Is(err, sentinal_errors.ErrNotFound) {
+					continue
+				}
+				return err
+			}
+			if err := s.publishPollUpdated(ctx, tx, msgRepo, poll, msg, msg.SenderID); err != nil {
+				return err
+			}
+			closed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	return closed, nil
+}
 
-	var result message.Message
+// mutatePoll locks the poll row, applies fn and publishes the new tallies in one transaction.
+func (s *MessageService) mutatePoll(ctx context.Context, pollID, userID uuid.UUID, fn func(repository.MessageRepository, message.Poll, message.Message) error) (message.PollDetails, error) {
+	if s.db == nil {
+		return message.PollDetails{}, sentinal_errors.ErrServiceUnavailable
+	}
+	var result message.PollDetails
 	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
 		msgRepo := repository.NewMessageRepository(tx)
-		prevMsgRepo := s.messageRepo
-		s.messageRepo = msgRepo
-		defer func() {
-			s.messageRepo = prevMsgRepo
-		}()
+		poll, err := msgRepo.LockPoll(ctx, pollID)
+		if err != nil {
+			return err
+		}
+		msg, err := s.pollMessage(ctx, poll, userID)
+		if err != nil {
+			return err
+		}
+		if err := fn(msgRepo, poll, msg); err != nil {
+			return err
+		}
+		poll, err = msgRepo.GetPollByID(ctx, pollID)
+		if err != nil {
+			return err
+		}
+		if err := s.publishPollUpdated(ctx, tx, msgRepo, poll, msg, userID); err != nil {
+			return err
+		}
+		result, err = s.buildPollDetails(ctx, msgRepo, poll, msg.ConversationID, userID)
+		return err
+	})
+	if err != nil {
+		return message.PollDetails{}, err
+	}
+	return result, nil
+}
+
+// pollMessage returns the message a poll belongs to after checking the caller can see it.
+func (s *MessageService) pollMessage(ctx context.Context, poll message.Poll, userID uuid.UUID) (message.Message, error) {
+	if !poll.MessageID.Valid {
+		return message.Message{}, sentinal_errors.ErrNotFound
+	}
+	msg, err := s.GetByID(ctx, poll.MessageID.UUID, userID)
+	if err != nil {
+		return message.Message{}, err
+	}
+	if msg.DeletedAt.Valid {
+		return message.Message{}, sentinal_errors.ErrNotFound
+	}
+	return msg, nil
+}
+
+func (s *MessageService) publishPollUpdated(ctx context.Context, tx repository.DBTX, msgRepo repository.MessageRepository, poll message.Poll, msg message.Message, actorID uuid.UUID) error {
+	if s.eventPublisher == nil {
+		return nil
+	}
+	tallies, voters, err := msgRepo.GetPollTallies(ctx, poll.ID)
+	if err != nil {
+		return err
+	}
+	items := make([]events.PollTally, len(tallies))
+	for i, t := range tallies {
+		items[i] = events.PollTally{OptionID: t.OptionID, Votes: t.Votes}
+	}
+	return s.eventPublisher.PublishPollUpdated(ctx, tx, poll.ID, msg.ID, msg.ConversationID, actorID, poll.IsClosed(time.Now()), voters, items)
+}
+
+func (s *MessageService) buildPollDetails(ctx context.Context, msgRepo repository.MessageRepository, poll message.Poll, conversationID, userID uuid.UUID) (message.PollDetails, error) {
+	options, err := msgRepo.GetPollOptions(ctx, poll.ID)
+	if err != nil {
+		return message.PollDetails{}, err
+	}
+	tallies, voters, err := msgRepo.GetPollTallies(ctx, poll.ID)
+	if err != nil {
+		return message.PollDetails{}, err
+	}
+	votes, err := msgRepo.GetUserVotes(ctx, poll.ID, userID)
+	if err != nil {
+		return message.PollDetails{}, err
+	}
+	mine := make([]uuid.UUID, len(votes))
+	for i, v := range votes {
+		mine[i] = v.OptionID
+	}
+	return message.PollDetails{
+		Poll:           poll,
+		ConversationID: conversationID,
+		Options:        options,
+		Tallies:        tallies,
+		TotalVoters:    voters,
+		MyVotes:        mine,
+	}, nil
+}
+
+// ExpireMessages deletes up to limit disappearing messages whose expiry has
+// passed, with their ciphertexts, and publishes message:expired for each. The
+// S3 objects of their attachments are removed afterwards by
+// AttachmentService.PurgeOrphanedObjects, once no other message links them.
+func (s *MessageService) ExpireMessages(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+	if s.db == nil {
+		expired, err := s.messageRepo.DeleteExpiredMessages(ctx, now, limit)
+		return len(expired), err
+	}
+
+	count := 0
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		expired, err := repository.NewMessageRepository(tx).DeleteExpiredMessages(ctx, now, limit)
+		if err != nil {
+			return err
+		}
+		count = len(expired)
+		if s.eventPublisher == nil {
+			return nil
+		}
+		for _, m := range expired {
+			if err := s.eventPublisher.PublishMessageExpired(ctx, tx, m.ID, m.ConversationID, m.SenderID, m.SeqID.Int64, m.ExpiresAt.Time); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// messageExpiry returns when a message sent at sentAt disappears: after the
+// shorter of the per-message timer and the conversation's disappearing timer,
+// or never when neither is set. A sender can shorten the conversation's
+// timer but not outlast it.
+func (s *MessageService) messageExpiry(ctx context.Context, conversationID uuid.UUID, expiresInSeconds int, sentAt time.Time) (sql.NullTime, error) {
+	ttl := time.Duration(expiresInSeconds) * time.Second
+	if s.conversationRepo != nil {
+		conv, err := s.conversationRepo.GetByID(ctx, conversationID)
+		if err != nil {
+			return sql.NullTime{}, err
+		}
+		if convTTL := disappearingTTL(conv); convTTL > 0 && (ttl <= 0 || convTTL < ttl) {
+			ttl = convTTL
+		}
+	}
+	if ttl <= 0 {
+		return sql.NullTime{}, nil
+	}
+	return sql.NullTime{Time: sentAt.Add(ttl), Valid: true}, nil
+}
+
+// executeSendMessage validates and creates a message within a transaction.
+func (s *MessageService) executeSendMessage(ctx context.Context, input SendMessageInput) (message.Message, *command.CommandLog, error) {
+	if input.ConversationID == uuid.Nil || input.SenderID == uuid.Nil {
+		return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+	}
+	if (len(input.Ciphertexts) == 0) == (input.GroupCiphertext == nil) {
+		return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+	}
+	for _, payload := range input.Ciphertexts {
+		if payload.RecipientDeviceID == uuid.Nil || len(payload.Ciphertext) == 0 {
+			return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+		}
+	}
+	if g := input.GroupCiphertext; g != nil && (g.DistributionID == uuid.Nil || len(g.Ciphertext) == 0) {
+		return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+	}
+	// SYSTEM messages are authored by the server and never encrypted, so
+	// clients must not be able to send one.
+	if input.MessageType == "SYSTEM" {
+		return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+	}
+	if input.Poll != nil && input.MessageType == "" {
+		input.MessageType = "POLL"
+	}
+	if err := validatePollInput(input.MessageType, input.Poll); err != nil {
+		return message.Message{}, nil, err
+	}
+	// Compared in seconds, since a large value would overflow the Duration.
+	if input.ExpiresInSeconds < 0 || input.ExpiresInSeconds > int(maxDisappearingTTL/time.Second) {
+		return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+	}
 
-		res, err := s.executeSendMessageDirect(ctx, input)
+	if s.conversationRepo != nil {
+		conv, _, err := authorizeAction(ctx, s.conversationRepo, input.ConversationID, input.SenderID, conversation.ActionSendMessages)
+		if err != nil {
+			return message.Message{}, nil, err
+		}
+		if input.GroupCiphertext != nil && conv.Type != "GROUP" {
+			return message.Message{}, nil, sentinal_errors.ErrInvalidInput
+		}
+	}
+	if err := s.validateGroupCiphertext(ctx, input); err != nil {
+		return message.Message{}, nil, err
+	}
+	if err := s.validateMentions(ctx, input.ConversationID, input.Mentions); err != nil {
+		return message.Message{}, nil, err
+	}
+	if err := s.validateAttachments(input.Attachments); err != nil {
+		return message.Message{}, nil, err
+	}
+	if err := s.validateReferences(ctx, input); err != nil {
+		return message.Message{}, nil, err
+	}
+
+	if s.db == nil {
+		msg, err := s.executeSendMessageDirect(ctx, input)
+		return msg, nil, err
+	}
+
+	var result message.Message
+	var cmdLog *command.CommandLog
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		res, err := s.withTx(tx).executeSendMessageDirect(ctx, input)
 		if err != nil {
 			return err
 		}
@@ -386,14 +1167,24 @@ func (s *MessageService) executeSendMessage(ctx context.Context, input SendMessa
 			if err := s.eventPublisher.PublishMessageNew(ctx, tx, res.ID, res.ConversationID, res.SenderID); err != nil {
 				return err
 			}
+			if err := s.publishMentions(ctx, tx, res, input.Mentions); err != nil {
+				return err
+			}
+		}
+
+		if s.commandExecutor != nil {
+			cmdLog, err = s.commandExecutor.Record(ctx, tx, commands.NewSendMessageCommand(res.ConversationID, res.SenderID, res.ID))
+			if err != nil {
+				return err
+			}
 		}
 
 		return nil
 	})
 	if err != nil {
-		return message.Message{}, err
+		return message.Message{}, nil, err
 	}
-	return result, nil
+	return result, cmdLog, nil
 }
 
 // executeSendMessageDirect creates message and ciphertexts without transaction.
@@ -403,8 +1194,32 @@ func (s *MessageService) executeSendMessageDirect(ctx context.Context, input Sen
 		ConversationID: input.ConversationID,
 		SenderID:       input.SenderID,
 		Type:           msgTypeOrDefault(input.MessageType),
+		ReplyToMsgID:   input.ReplyToMsgID,
 		CreatedAt:      time.Now(),
 	}
+	if input.Metadata == nil {
+		input.Metadata = map[string]interface{}{}
+	}
+
+	var source message.Message
+	if input.ForwardedFromMsgID.Valid {
+		var err error
+		source, err = s.messageRepo.GetByID(ctx, input.ForwardedFromMsgID.UUID)
+		if err != nil {
+			return message.Message{}, err
+		}
+		msg.IsForwarded = true
+		msg.ForwardedFromMsgID = input.ForwardedFromMsgID
+		if input.MessageType == "" {
+			msg.Type = source.Type
+		}
+		input.Metadata["forward_depth"] = source.ForwardDepth() + 1
+	}
+	expiresAt, err := s.messageExpiry(ctx, input.ConversationID, input.ExpiresInSeconds, msg.CreatedAt)
+	if err != nil {
+		return message.Message{}, err
+	}
+	msg.ExpiresAt = expiresAt
 	if input.ClientMsgID != "" {
 		msg.ClientMessageID = msgNullString(input.ClientMsgID)
 	}
@@ -413,15 +1228,59 @@ func (s *MessageService) executeSendMessageDirect(ctx context.Context, input Sen
 		msg.IdempotencyKey = msgNullString(idempotencyKey)
 	}
 
-	if input.Metadata == nil {
-		input.Metadata = map[string]interface{}{}
+	if input.Poll != nil {
+		msg.PollID = uuid.NullUUID{UUID: uuid.New(), Valid: true}
 	}
+	msg.MentionCount = len(mentionRangesByUser(input.Mentions))
+
 	input.Metadata["e2ee"] = true
 
+	if g := input.GroupCiphertext; g != nil {
+		header := g.Header
+		if header == nil {
+			header = map[string]interface{}{"version": 1, "cipher": "signal"}
+		}
+		header["distribution_id"] = g.DistributionID.String()
+		headerRaw, err := json.Marshal(header)
+		if err != nil {
+			return message.Message{}, err
+		}
+		msg.Ciphertext = g.Ciphertext
+		msg.Header = string(headerRaw)
+	}
+
 	if err := s.messageRepo.Create(ctx, &msg); err != nil {
 		return message.Message{}, err
 	}
 
+	if input.Poll != nil {
+		if err := s.createPoll(ctx, msg, input.Poll); err != nil {
+			return message.Message{}, err
+		}
+	}
+
+	attachments, err := s.createAttachments(ctx, msg, input.Attachments)
+	if err != nil {
+		return message.Message{}, err
+	}
+	msg.Attachments = attachments
+	if input.ForwardedFromMsgID.Valid {
+		if msg.Attachments, err = s.shareAttachments(ctx, msg, source.ID); err != nil {
+			return message.Message{}, err
+		}
+	}
+
+	for _, mention := range input.Mentions {
+		if err := s.messageRepo.AddMention(ctx, &message.MessageMention{
+			MessageID: msg.ID,
+			UserID:    mention.UserID,
+			Offset:    mention.Offset,
+			Length:    mention.Length,
+		}); err != nil {
+			return message.Message{}, err
+		}
+	}
+
 	deviceID, ok := DeviceIDFromContext(ctx)
 	if !ok || !deviceID.Valid {
 		return message.Message{}, sentinal_errors.ErrInvalidInput
@@ -437,6 +1296,14 @@ func (s *MessageService) executeSendMessageDirect(ctx context.Context, input Sen
 		return message.Message{}, err
 	}
 
+	// A sender-key message is stored once, but every member device still gets
+	// an envelope so it is pushed, acknowledged and marked delivered.
+	if input.GroupCiphertext != nil {
+		if err := s.messageRepo.QueueGroupEnvelopes(ctx, msg.ID, deviceID, msg.CreatedAt); err != nil {
+			return message.Message{}, err
+		}
+	}
+
 	for _, payload := range input.Ciphertexts {
 		recipientUserID, err := s.lookupUserIDByDevice(ctx, payload.RecipientDeviceID)
 		if err != nil {
@@ -465,6 +1332,303 @@ func (s *MessageService) executeSendMessageDirect(ctx context.Context, input Sen
 	return msg, nil
 }
 
+// validateGroupCiphertext requires a sender-key message to be encrypted with
+// the sending device's current sender key, so that every member device holds
+// the key and none who left the group does.
+func (s *MessageService) validateGroupCiphertext(ctx context.Context, input SendMessageInput) error {
+	if input.GroupCiphertext == nil {
+		return nil
+	}
+	if s.senderKeyRepo == nil {
+		return sentinal_errors.ErrServiceUnavailable
+	}
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return sentinal_errors.ErrInvalidInput
+	}
+	return checkSenderKey(ctx, s.senderKeyRepo, input.ConversationID, deviceID.UUID, input.GroupCiphertext.DistributionID)
+}
+
+// validateReferences checks that a reply quotes a live message of the same
+// conversation, and that a forwarded message is one the sender can see and
+// whose content may be passed on. Polls and system messages cannot be
+// forwarded, nor can messages with view-once attachments.
+func (s *MessageService) validateReferences(ctx context.Context, input SendMessageInput) error {
+	if input.ReplyToMsgID.Valid && input.ForwardedFromMsgID.Valid {
+		return sentinal_errors.ErrInvalidInput
+	}
+	if input.ReplyToMsgID.Valid {
+		quoted, err := s.liveMessage(ctx, input.ReplyToMsgID.UUID)
+		if err != nil {
+			return err
+		}
+		if quoted.ConversationID != input.ConversationID {
+			return sentinal_errors.ErrInvalidInput
+		}
+	}
+	if !input.ForwardedFromMsgID.Valid {
+		return nil
+	}
+
+	if input.Poll != nil || len(input.Attachments) > 0 {
+		return sentinal_errors.ErrInvalidInput
+	}
+	source, err := s.liveMessage(ctx, input.ForwardedFromMsgID.UUID)
+	if err != nil {
+		return err
+	}
+	if source.Type == "SYSTEM" || source.PollID.Valid {
+		return sentinal_errors.ErrInvalidInput
+	}
+	if s.conversationRepo != nil {
+		ok, err := s.conversationRepo.IsParticipant(ctx, source.ConversationID, input.SenderID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return sentinal_errors.ErrForbidden
+		}
+	}
+	attachments, err := s.messageRepo.GetMessageAttachments(ctx, source.ID)
+	if err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if a.ViewOnce {
+			return sentinal_errors.ErrInvalidInput
+		}
+	}
+	return nil
+}
+
+// liveMessage loads a message that has been neither deleted nor expired.
+func (s *MessageService) liveMessage(ctx context.Context, messageID uuid.UUID) (message.Message, error) {
+	msg, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return message.Message{}, err
+	}
+	if msg.DeletedAt.Valid || (msg.ExpiresAt.Valid && !msg.ExpiresAt.Time.After(time.Now())) {
+		return message.Message{}, sentinal_errors.ErrNotFound
+	}
+	return msg, nil
+}
+
+// shareAttachments links the attachments of a forwarded message to its
+// forward. The files are encrypted with keys the client passes along inside
+// the ciphertext, so the stored objects are shared rather than copied; the
+// orphan sweep keeps them until no message links them anymore.
+func (s *MessageService) shareAttachments(ctx context.Context, msg message.Message, sourceID uuid.UUID) ([]message.Attachment, error) {
+	attachments, err := s.messageRepo.GetMessageAttachments(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		if err := s.messageRepo.LinkAttachmentToMessage(ctx, &message.MessageAttachment{
+			MessageID:    msg.ID,
+			AttachmentID: a.ID,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return attachments, nil
+}
+
+// validateMentions checks that every mention targets a participant and that no
+// mention range is submitted twice.
+func (s *MessageService) validateMentions(ctx context.Context, conversationID uuid.UUID, mentions []MentionInput) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+	if len(mentions) > maxMessageMentions {
+		return sentinal_errors.ErrInvalidInput
+	}
+	type mentionKey struct {
+		userID uuid.UUID
+		offset int
+	}
+	seen := make(map[mentionKey]bool, len(mentions))
+	for _, m := range mentions {
+		if m.UserID == uuid.Nil || m.Offset < 0 || m.Length <= 0 {
+			return sentinal_errors.ErrInvalidInput
+		}
+		key := mentionKey{userID: m.UserID, offset: m.Offset}
+		if seen[key] {
+			return sentinal_errors.ErrInvalidInput
+		}
+		seen[key] = true
+	}
+
+	if s.conversationRepo == nil {
+		return nil
+	}
+	for userID := range mentionRangesByUser(mentions) {
+		ok, err := s.conversationRepo.IsParticipant(ctx, conversationID, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return sentinal_errors.ErrInvalidInput
+		}
+	}
+	return nil
+}
+
+// publishMentions emits mention:new to each mentioned user other than the
+// sender. Muted conversations are not filtered out: a mention always notifies.
+func (s *MessageService) publishMentions(ctx context.Context, tx repository.DBTX, msg message.Message, mentions []MentionInput) error {
+	for userID, ranges := range mentionRangesByUser(mentions) {
+		if userID == msg.SenderID {
+			continue
+		}
+		if err := s.eventPublisher.PublishMentionNew(ctx, tx, msg.ID, msg.ConversationID, msg.SenderID, userID, ranges); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAttachments checks the attachment references before any upload is
+// looked up: a bounded count, no upload referenced twice, and sane media sizes.
+func (s *MessageService) validateAttachments(attachments []AttachmentInput) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	if s.uploadRepo == nil {
+		return sentinal_errors.ErrServiceUnavailable
+	}
+	if len(attachments) > maxMessageAttachments {
+		return sentinal_errors.ErrInvalidInput
+	}
+	seen := make(map[uuid.UUID]bool, len(attachments))
+	for _, a := range attachments {
+		if a.UploadID == uuid.Nil || seen[a.UploadID] {
+			return sentinal_errors.ErrInvalidInput
+		}
+		seen[a.UploadID] = true
+		for _, v := range []*int32{a.Width, a.Height, a.DurationSeconds} {
+			if v != nil && *v < 0 {
+				return sentinal_errors.ErrInvalidInput
+			}
+		}
+	}
+	return nil
+}
+
+// createAttachments turns the referenced upload sessions into attachment rows
+// linked to msg. Only completed uploads owned by the sender can be attached,
+// each to a single message; file name, MIME type and size come from the upload
+// session, not the client.
+func (s *MessageService) createAttachments(ctx context.Context, msg message.Message, inputs []AttachmentInput) ([]message.Attachment, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	attachments := make([]message.Attachment, 0, len(inputs))
+	for _, input := range inputs {
+		session, err := s.uploadRepo.GetByID(ctx, input.UploadID)
+		if err != nil {
+			return nil, err
+		}
+		if session.UploaderID != msg.SenderID {
+			return nil, sentinal_errors.ErrForbidden
+		}
+		if session.Status != "COMPLETED" {
+			return nil, sentinal_errors.ErrNotUploaded
+		}
+
+		url := session.ObjectKey
+		if session.FileURL.Valid && session.FileURL.String != "" {
+			url = session.FileURL.String
+		}
+		a := message.Attachment{
+			ID:                uuid.New(),
+			UploaderID:        uuid.NullUUID{UUID: msg.SenderID, Valid: true},
+			URL:               url,
+			Filename:          msgNullString(session.Filename),
+			MimeType:          session.MimeType,
+			SizeBytes:         session.SizeBytes,
+			ViewOnce:          input.ViewOnce,
+			ThumbnailURL:      msgNullString(input.ThumbnailURL),
+			Width:             msgNullInt32(input.Width),
+			Height:            msgNullInt32(input.Height),
+			DurationSeconds:   msgNullInt32(input.DurationSeconds),
+			EncryptionKeyHash: msgNullString(input.EncryptionKeyHash),
+			EncryptionIV:      msgNullString(input.EncryptionIV),
+			UploadSessionID:   uuid.NullUUID{UUID: session.ID, Valid: true},
+			ObjectKey:         msgNullString(session.ObjectKey),
+			CreatedAt:         time.Now(),
+		}
+		if err := s.messageRepo.CreateAttachment(ctx, &a); err != nil {
+			if errors.Is(err, sentinal_errors.ErrAlreadyExists) {
+				return nil, sentinal_errors.ErrConflict
+			}
+			return nil, err
+		}
+		if err := s.messageRepo.LinkAttachmentToMessage(ctx, &message.MessageAttachment{
+			MessageID:    msg.ID,
+			AttachmentID: a.ID,
+		}); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+// loadAttachments fills in the attachments of a page of messages.
+func (s *MessageService) loadAttachments(ctx context.Context, msgs []message.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	byMessage, err := s.messageRepo.GetAttachmentsForMessages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		msgs[i].Attachments = byMessage[msgs[i].ID]
+	}
+	return nil
+}
+
+func mentionRangesByUser(mentions []MentionInput) map[uuid.UUID][]events.MentionRange {
+	byUser := make(map[uuid.UUID][]events.MentionRange)
+	for _, m := range mentions {
+		byUser[m.UserID] = append(byUser[m.UserID], events.MentionRange{Offset: m.Offset, Length: m.Length})
+	}
+	return byUser
+}
+
+// createPoll stores the poll and its options for a freshly created POLL message.
+func (s *MessageService) createPoll(ctx context.Context, msg message.Message, input *PollInput) error {
+	poll := &message.Poll{
+		ID:             msg.PollID.UUID,
+		MessageID:      uuid.NullUUID{UUID: msg.ID, Valid: true},
+		Question:       strings.TrimSpace(input.Question),
+		AllowsMultiple: input.AllowsMultiple,
+		CreatedAt:      msg.CreatedAt,
+	}
+	if !input.ClosesAt.IsZero() {
+		poll.ClosesAt = sql.NullTime{Time: input.ClosesAt, Valid: true}
+	}
+	if err := s.messageRepo.CreatePoll(ctx, poll); err != nil {
+		return err
+	}
+	for i, text := range input.Options {
+		if err := s.messageRepo.AddPollOption(ctx, &message.PollOption{
+			ID:         uuid.New(),
+			PollID:     poll.ID,
+			OptionText: strings.TrimSpace(text),
+			Position:   i,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // lookupUserIDByDevice finds the user who owns a device.
 func (s *MessageService) lookupUserIDByDevice(ctx context.Context, deviceID uuid.UUID) (uuid.UUID, error) {
 	if s.db == nil {
@@ -484,6 +1648,36 @@ func (s *MessageService) lookupUserIDByDevice(ctx context.Context, deviceID uuid
 	return userID, nil
 }
 
+func validatePollInput(msgType string, input *PollInput) error {
+	if input == nil {
+		if msgType == "POLL" {
+			return sentinal_errors.ErrInvalidInput
+		}
+		return nil
+	}
+	if msgType != "POLL" {
+		return sentinal_errors.ErrInvalidInput
+	}
+	if strings.TrimSpace(input.Question) == "" {
+		return sentinal_errors.ErrInvalidInput
+	}
+	if len(input.Options) < minPollOptions || len(input.Options) > maxPollOptions {
+		return sentinal_errors.ErrInvalidInput
+	}
+	seen := make(map[string]bool, len(input.Options))
+	for _, opt := range input.Options {
+		text := strings.TrimSpace(opt)
+		if text == "" || seen[text] {
+			return sentinal_errors.ErrInvalidInput
+		}
+		seen[text] = true
+	}
+	if !input.ClosesAt.IsZero() && !input.ClosesAt.After(time.Now()) {
+		return sentinal_errors.ErrInvalidInput
+	}
+	return nil
+}
+
 func msgTypeOrDefault(value string) string {
 	if strings.TrimSpace(value) == "" {
 		return "TEXT"
@@ -497,3 +1691,10 @@ func msgNullString(value string) sql.NullString {
 	}
 	return sql.NullString{String: value, Valid: true}
 }
+
+func msgNullInt32(value *int32) sql.NullInt32 {
+	if value == nil {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: *value, Valid: true}
+}
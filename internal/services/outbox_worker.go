@@ -6,70 +6,39 @@ import (
 	"sentinal-chat/internal/domain/outbox"
 	"sentinal-chat/internal/events"
 	"sentinal-chat/internal/repository"
-	"sync"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 // OutboxWorker polls the outbox table and publishes events to Redis
 type OutboxWorker struct {
+	*IntervalWorker
 	outboxRepo repository.OutboxRepository
 	eventBus   events.EventBus
-	interval   time.Duration
 	batchSize  int
-	stopChan   chan struct{}
-	wg         sync.WaitGroup
-	running    bool
 }
 
-func NewOutboxWorker(outboxRepo repository.OutboxRepository, eventBus events.EventBus) *OutboxWorker {
-	return &OutboxWorker{
+func NewOutboxWorker(outboxRepo repository.OutboxRepository, eventBus events.EventBus, logger *zap.Logger) *OutboxWorker {
+	w := &OutboxWorker{
 		outboxRepo: outboxRepo,
 		eventBus:   eventBus,
-		interval:   100 * time.Millisecond,
 		batchSize:  100,
-		stopChan:   make(chan struct{}),
 	}
+	w.IntervalWorker = NewIntervalWorker("outbox_worker", 100*time.Millisecond, logger, w.processBatch)
+	return w
 }
 
-// Start begins the worker loop
-func (w *OutboxWorker) Start() {
-	w.running = true
-	w.wg.Add(1)
-	go w.run()
-}
-
-// Stop gracefully shuts down
-func (w *OutboxWorker) Stop() {
-	w.running = false
-	close(w.stopChan)
-	w.wg.Wait()
-}
-
-func (w *OutboxWorker) run() {
-	defer w.wg.Done()
-	ticker := time.NewTicker(w.interval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-w.stopChan:
-			return
-		case <-ticker.C:
-			w.processBatch()
-		}
-	}
-}
-
-func (w *OutboxWorker) processBatch() {
-	ctx := context.Background()
+func (w *OutboxWorker) processBatch(ctx context.Context) error {
 	events, err := w.outboxRepo.GetPending(ctx, w.batchSize)
 	if err != nil {
-		return
+		return err
 	}
 
 	for _, event := range events {
 		w.processEvent(ctx, &event)
 	}
+	return nil
 }
 
 func (w *OutboxWorker) processEvent(ctx context.Context, event *outbox.OutboxEvent) {
@@ -134,6 +103,96 @@ func (w *OutboxWorker) unmarshalEvent(eventType string, payload []byte) events.E
 		if err := json.Unmarshal(payload, &e); err == nil {
 			return &e
 		}
+	case events.EventReactionAdded, events.EventReactionRemoved:
+		var e events.ReactionEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventPollUpdated:
+		var e events.PollUpdatedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventMessageEdited:
+		var e events.MessageEditedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventCommandUndone:
+		var e events.CommandUndoneEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventLabelChanged:
+		var e events.LabelChangedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventConversationCleared, events.EventMessageDeletedForMe:
+		var e events.HistoryHiddenEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventMessageStarred, events.EventMessageUnstarred:
+		var e events.MessageStarEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventMentionNew:
+		var e events.MentionNewEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventAttachmentViewed:
+		var e events.AttachmentViewedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventMessageExpired:
+		var e events.MessageExpiredEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventPermissionsChanged:
+		var e events.GroupPermissionsChangedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventSenderKeyReceived:
+		var e events.SenderKeyReceivedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventSenderKeyRotate:
+		var e events.SenderKeyRotateEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventPreKeysLow:
+		var e events.PreKeysLowEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventSignedPreKeyRotate:
+		var e events.SignedPreKeyRotateEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventIdentityChanged:
+		var e events.IdentityChangedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventMessageDeleted, events.EventMessageRestored:
+		var e events.MessageDeletedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
+	case events.EventMessagePinned, events.EventMessageUnpinned:
+		var e events.MessagePinnedEvent
+		if err := json.Unmarshal(payload, &e); err == nil {
+			return &e
+		}
 	}
 	return nil
 }
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PollWorker periodically closes polls whose ClosesAt has passed and
+// publishes their final tallies.
+type PollWorker struct {
+	*IntervalWorker
+	messageService *MessageService
+	batchSize      int
+}
+
+func NewPollWorker(messageService *MessageService, logger *zap.Logger) *PollWorker {
+	w := &PollWorker{
+		messageService: messageService,
+		batchSize:      100,
+	}
+	w.IntervalWorker = NewIntervalWorker("poll_worker", 5*time.Second, logger, w.processBatch)
+	return w
+}
+
+func (w *PollWorker) processBatch(ctx context.Context) error {
+	return drainBatches(ctx, w.batchSize, w.messageService.CloseDuePolls)
+}
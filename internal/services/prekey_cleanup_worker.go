@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PreKeyCleanupWorker periodically deletes one-time prekeys that were consumed
+// longer ago than the retention period and reports how many it removed.
+type PreKeyCleanupWorker struct {
+	*IntervalWorker
+	encryptionService *EncryptionService
+}
+
+func NewPreKeyCleanupWorker(encryptionService *EncryptionService, logger *zap.Logger) *PreKeyCleanupWorker {
+	w := &PreKeyCleanupWorker{
+		encryptionService: encryptionService,
+	}
+	w.IntervalWorker = NewIntervalWorker("prekey_cleanup_worker", time.Hour, logger, w.processBatch)
+	return w
+}
+
+func (w *PreKeyCleanupWorker) processBatch(ctx context.Context) error {
+	deleted, err := w.encryptionService.CleanupConsumedPreKeys(ctx)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		w.logger.Info("prekey cleanup deleted consumed one-time prekeys", zap.Int64("deleted", deleted))
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sentinal-chat/internal/redis"
+	"sentinal-chat/internal/repository"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// Presence statuses a client may set on itself.
+const (
+	PresenceOnline = "online"
+	PresenceAway   = "away"
+	PresenceBusy   = "busy"
+)
+
+// PresenceService tracks per-connection presence in Redis so a user stays online
+// while any of their connections on any API instance is alive, and publishes
+// presence changes to the users allowed to see them.
+type PresenceService struct {
+	db             repository.DBTX
+	userRepo       repository.UserRepository
+	store          *redis.PresenceStore
+	cache          *redis.CacheStore
+	eventPublisher *EventPublisher
+	staleAfter     time.Duration
+}
+
+// NewPresenceService creates a presence service. Connections that have not sent
+// a heartbeat for staleAfter are treated as gone. The cached user profile,
+// which carries the online flag, is dropped whenever the flag changes.
+func NewPresenceService(db repository.DBTX, userRepo repository.UserRepository, store *redis.PresenceStore, cache *redis.CacheStore, eventPublisher *EventPublisher, staleAfter time.Duration) *PresenceService {
+	if staleAfter <= 0 {
+		staleAfter = 5 * time.Minute
+	}
+	return &PresenceService{
+		db:             db,
+		userRepo:       userRepo,
+		store:          store,
+		cache:          cache,
+		eventPublisher: eventPublisher,
+		staleAfter:     staleAfter,
+	}
+}
+
+// Connect records a new WebSocket connection and publishes presence:online when
+// it is the user's first live connection.
+func (s *PresenceService) Connect(ctx context.Context, userID, deviceID uuid.UUID, clientID string) error {
+	first, err := s.store.TrackUserConnection(ctx, userID.String(), clientID, deviceID.String())
+	if err != nil {
+		return err
+	}
+	if !first {
+		return nil
+	}
+	if err := s.setOnline(ctx, userID, true); err != nil {
+		return err
+	}
+	return s.publish(ctx, userID, PresenceOnline, nil)
+}
+
+// Disconnect removes a WebSocket connection and publishes presence:offline when
+// the user has no live connection left on any instance.
+func (s *PresenceService) Disconnect(ctx context.Context, userID uuid.UUID, clientID string) error {
+	offline, err := s.store.RemoveUserConnection(ctx, userID.String(), clientID)
+	if err != nil {
+		return err
+	}
+	if !offline {
+		return nil
+	}
+	return s.markOffline(ctx, userID)
+}
+
+// Heartbeat keeps a connection alive in the presence store.
+func (s *PresenceService) Heartbeat(ctx context.Context, userID uuid.UUID, clientID string) error {
+	return s.store.Heartbeat(ctx, userID.String(), clientID)
+}
+
+// SetStatus changes the status shown to others while the user stays connected.
+func (s *PresenceService) SetStatus(ctx context.Context, userID uuid.UUID, status string) error {
+	switch status {
+	case PresenceOnline, PresenceAway, PresenceBusy:
+	default:
+		return sentinal_errors.ErrInvalidInput
+	}
+	current, err := s.store.GetPresence(ctx, userID.String())
+	if err != nil {
+		return err
+	}
+	if !current.IsOnline {
+		return sentinal_errors.ErrInvalidTransition
+	}
+	if current.Status == status {
+		return nil
+	}
+	if err := s.store.UpdateStatus(ctx, userID.String(), status); err != nil {
+		return err
+	}
+	return s.publish(ctx, userID, status, nil)
+}
+
+// CleanupStale marks users offline whose connections all stopped sending
+// heartbeats, e.g. because the instance holding them crashed.
+func (s *PresenceService) CleanupStale(ctx context.Context) (int, error) {
+	offline, err := s.store.CleanupStalePresence(ctx, s.staleAfter)
+	for _, raw := range offline {
+		userID, parseErr := uuid.Parse(raw)
+		if parseErr != nil {
+			continue
+		}
+		if pubErr := s.markOffline(ctx, userID); pubErr != nil && err == nil {
+			err = pubErr
+		}
+	}
+	return len(offline), err
+}
+
+func (s *PresenceService) markOffline(ctx context.Context, userID uuid.UUID) error {
+	if err := s.setOnline(ctx, userID, false); err != nil {
+		return err
+	}
+	lastSeen := time.Now().UTC()
+	return s.publish(ctx, userID, "offline", &lastSeen)
+}
+
+// setOnline stores the user's online flag and last seen time and drops the
+// cached profile that still holds the old ones.
+func (s *PresenceService) setOnline(ctx context.Context, userID uuid.UUID, online bool) error {
+	if err := s.userRepo.UpdateOnlineStatus(ctx, userID, online); err != nil && !errors.Is(err, sentinal_errors.ErrNotFound) {
+		return err
+	}
+	if s.cache != nil {
+		_ = s.cache.InvalidateUser(ctx, userID)
+	}
+	return nil
+}
+
+// publish sends a presence change to the user's own devices and to the audience
+// their PrivacyLastSeen setting allows: everyone they share a conversation with,
+// only their contacts among those, or nobody.
+func (s *PresenceService) publish(ctx context.Context, userID uuid.UUID, status string, lastSeen *time.Time) error {
+	if s.eventPublisher == nil || s.db == nil {
+		return nil
+	}
+
+	privacy := "EVERYONE"
+	settings, err := s.userRepo.GetUserSettings(ctx, userID)
+	if err != nil && !errors.Is(err, sentinal_errors.ErrNotFound) {
+		return err
+	}
+	if err == nil && settings.PrivacyLastSeen != "" {
+		privacy = settings.PrivacyLastSeen
+	}
+
+	var audience []uuid.UUID
+	if privacy != "NOBODY" {
+		audience, err = s.userRepo.GetPresenceAudience(ctx, userID, privacy == "CONTACTS")
+		if err != nil {
+			return err
+		}
+	}
+
+	return repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		if status == "offline" {
+			return s.eventPublisher.PublishPresenceOffline(ctx, tx, userID, lastSeen, audience)
+		}
+		return s.eventPublisher.PublishPresenceOnline(ctx, tx, userID, status, audience)
+	})
+}
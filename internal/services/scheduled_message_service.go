@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"sentinal-chat/internal/domain/command"
+	"sentinal-chat/internal/repository"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+const maxScheduledDeliveryAttempts = 5
+
+// Failed deliveries are retried after scheduledRetryBaseDelay, doubling with
+// every attempt up to scheduledRetryMaxDelay.
+const (
+	scheduledRetryBaseDelay = 30 * time.Second
+	scheduledRetryMaxDelay  = 30 * time.Minute
+)
+
+// scheduledLocalLayout is a wall-clock time without offset, read in the
+// message's timezone.
+const scheduledLocalLayout = "2006-01-02T15:04:05"
+
+// ScheduledMessageService queues E2EE messages for delivery at a future time.
+type ScheduledMessageService struct {
+	db               repository.DBTX
+	repo             repository.ScheduledMessageRepository
+	conversationRepo repository.ConversationRepository
+	messageService   *MessageService
+}
+
+// ScheduleMessageInput is a send request plus the time it should be delivered.
+// ScheduledFor is an RFC3339 timestamp, or a wall-clock time without offset
+// that is read in Timezone.
+type ScheduleMessageInput struct {
+	Message      SendMessageInput
+	ScheduledFor string
+	Timezone     string
+}
+
+// NewScheduledMessageService creates a scheduled message service.
+func NewScheduledMessageService(db repository.DBTX, repo repository.ScheduledMessageRepository, conversationRepo repository.ConversationRepository, messageService *MessageService) *ScheduledMessageService {
+	return &ScheduledMessageService{
+		db:               db,
+		repo:             repo,
+		conversationRepo: conversationRepo,
+		messageService:   messageService,
+	}
+}
+
+// Schedule stores the message and its per-device ciphertexts until ScheduledFor.
+func (s *ScheduledMessageService) Schedule(ctx context.Context, input ScheduleMessageInput) (command.ScheduledMessage, error) {
+	msg := input.Message
+	if msg.ConversationID == uuid.Nil || msg.SenderID == uuid.Nil || len(msg.Ciphertexts) == 0 {
+		return command.ScheduledMessage{}, sentinal_errors.ErrInvalidInput
+	}
+	if msg.Poll != nil || len(msg.Mentions) > 0 || len(msg.Attachments) > 0 || msg.ExpiresInSeconds != 0 ||
+		msg.ReplyToMsgID.Valid || msg.ForwardedFromMsgID.Valid || msg.MessageType == "SYSTEM" {
+		return command.ScheduledMessage{}, sentinal_errors.ErrInvalidInput
+	}
+	for _, payload := range msg.Ciphertexts {
+		if payload.RecipientDeviceID == uuid.Nil || len(payload.Ciphertext) == 0 {
+			return command.ScheduledMessage{}, sentinal_errors.ErrInvalidInput
+		}
+	}
+	scheduledFor, timezone, err := resolveSchedule(input.ScheduledFor, input.Timezone)
+	if err != nil {
+		return command.ScheduledMessage{}, err
+	}
+
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return command.ScheduledMessage{}, sentinal_errors.ErrInvalidInput
+	}
+
+	if s.conversationRepo != nil {
+		ok, err := s.conversationRepo.IsParticipant(ctx, msg.ConversationID, msg.SenderID)
+		if err != nil {
+			return command.ScheduledMessage{}, err
+		}
+		if !ok {
+			return command.ScheduledMessage{}, sentinal_errors.ErrForbidden
+		}
+	}
+
+	now := time.Now().UTC()
+	scheduled := command.ScheduledMessage{
+		ID:              uuid.New(),
+		ConversationID:  msg.ConversationID,
+		SenderID:        msg.SenderID,
+		SenderDeviceID:  deviceID,
+		MessageType:     msgTypeOrDefault(msg.MessageType),
+		ClientMessageID: msg.ClientMsgID,
+		ScheduledFor:    scheduledFor,
+		Timezone:        timezone,
+		Status:          command.ScheduledPending,
+		NextAttemptAt:   scheduledFor,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+
+	err = repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		repo := repository.NewScheduledMessageRepository(tx)
+		if err := repo.Create(ctx, &scheduled); err != nil {
+			return err
+		}
+		for _, payload := range msg.Ciphertexts {
+			header := payload.Header
+			if header == nil {
+				header = map[string]interface{}{"version": 1, "cipher": "signal"}
+			}
+			headerRaw, err := json.Marshal(header)
+			if err != nil {
+				return err
+			}
+			if err := repo.CreateCiphertext(ctx, &command.ScheduledMessageCiphertext{
+				ID:                 uuid.New(),
+				ScheduledMessageID: scheduled.ID,
+				RecipientDeviceID:  payload.RecipientDeviceID,
+				Ciphertext:         payload.Ciphertext,
+				Header:             string(headerRaw),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return command.ScheduledMessage{}, err
+	}
+	return scheduled, nil
+}
+
+// List returns the caller's scheduled messages, optionally filtered by status.
+func (s *ScheduledMessageService) List(ctx context.Context, senderID uuid.UUID, status string, page, limit int) ([]command.ScheduledMessage, int64, error) {
+	switch status {
+	case "", command.ScheduledPending, command.ScheduledSent, command.ScheduledCanceled, command.ScheduledFailed:
+	default:
+		return nil, 0, sentinal_errors.ErrInvalidInput
+	}
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	return s.repo.ListBySender(ctx, senderID, status, page, limit)
+}
+
+// GetByID returns a scheduled message owned by the caller.
+func (s *ScheduledMessageService) GetByID(ctx context.Context, id, senderID uuid.UUID) (command.ScheduledMessage, error) {
+	scheduled, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return command.ScheduledMessage{}, err
+	}
+	if scheduled.SenderID != senderID {
+		return command.ScheduledMessage{}, sentinal_errors.ErrNotFound
+	}
+	return scheduled, nil
+}
+
+// Cancel stops a pending scheduled message from being delivered.
+func (s *ScheduledMessageService) Cancel(ctx context.Context, id, senderID uuid.UUID) (command.ScheduledMessage, error) {
+	if _, err := s.GetByID(ctx, id, senderID); err != nil {
+		return command.ScheduledMessage{}, err
+	}
+	if err := s.repo.Cancel(ctx, id, senderID); err != nil {
+		if errors.Is(err, sentinal_errors.ErrNotFound) {
+			return command.ScheduledMessage{}, sentinal_errors.ErrInvalidTransition
+		}
+		return command.ScheduledMessage{}, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+// Reschedule moves a pending scheduled message to a new delivery time. A
+// wall-clock time is read in timezone, or in the message's stored timezone
+// when none is given.
+func (s *ScheduledMessageService) Reschedule(ctx context.Context, id, senderID uuid.UUID, value, timezone string) (command.ScheduledMessage, error) {
+	current, err := s.GetByID(ctx, id, senderID)
+	if err != nil {
+		return command.ScheduledMessage{}, err
+	}
+	if timezone == "" {
+		timezone = current.Timezone
+	}
+	scheduledFor, timezone, err := resolveSchedule(value, timezone)
+	if err != nil {
+		return command.ScheduledMessage{}, err
+	}
+	if err := s.repo.Reschedule(ctx, id, senderID, scheduledFor, timezone); err != nil {
+		if errors.Is(err, sentinal_errors.ErrNotFound) {
+			return command.ScheduledMessage{}, sentinal_errors.ErrInvalidTransition
+		}
+		return command.ScheduledMessage{}, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+// DeliverDue sends up to limit due messages and returns how many were processed.
+func (s *ScheduledMessageService) DeliverDue(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		found, err := s.deliverNext(ctx)
+		if err != nil {
+			return processed, err
+		}
+		if !found {
+			break
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// deliverNext claims one due message and sends it in the same transaction that
+// marks it SENT. The row lock with SKIP LOCKED keeps replicas from claiming the
+// same message, and the shared commit means a crash either delivers and marks it
+// or does neither. A failed send is retried after a growing delay.
+func (s *ScheduledMessageService) deliverNext(ctx context.Context) (bool, error) {
+	found := false
+	err := repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		repo := repository.NewScheduledMessageRepository(tx)
+		scheduled, err := repo.LockNextDue(ctx, time.Now().UTC())
+		if err != nil {
+			if errors.Is(err, sentinal_errors.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		found = true
+
+		ciphertexts, err := repo.GetCiphertexts(ctx, scheduled.ID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT scheduled_send"); err != nil {
+			return err
+		}
+		msg, sendErr := s.send(ctx, tx, scheduled, ciphertexts)
+		if sendErr != nil {
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT scheduled_send"); err != nil {
+				return err
+			}
+			final := isPermanentSendError(sendErr) || scheduled.Attempts+1 >= maxScheduledDeliveryAttempts
+			nextAttemptAt := time.Now().UTC().Add(scheduledRetryDelay(scheduled.Attempts))
+			return repo.RecordFailure(ctx, scheduled.ID, sendErr.Error(), final, nextAttemptAt)
+		}
+
+		return repo.MarkSent(ctx, scheduled.ID, msg, time.Now().UTC())
+	})
+	return found, err
+}
+
+func (s *ScheduledMessageService) send(ctx context.Context, tx repository.DBTX, scheduled command.ScheduledMessage, ciphertexts []command.ScheduledMessageCiphertext) (uuid.UUID, error) {
+	if len(ciphertexts) == 0 {
+		return uuid.Nil, sentinal_errors.ErrInvalidInput
+	}
+	if !scheduled.SenderDeviceID.Valid {
+		return uuid.Nil, sentinal_errors.ErrInvalidInput
+	}
+
+	payloads := make([]CiphertextPayload, 0, len(ciphertexts))
+	for _, c := range ciphertexts {
+		var header map[string]interface{}
+		if c.Header != "" {
+			if err := json.Unmarshal([]byte(c.Header), &header); err != nil {
+				return uuid.Nil, err
+			}
+		}
+		payloads = append(payloads, CiphertextPayload{
+			RecipientDeviceID: c.RecipientDeviceID,
+			Ciphertext:        c.Ciphertext,
+			Header:            header,
+		})
+	}
+
+	sendCtx := WithUserSessionContext(ctx, scheduled.SenderID, uuid.Nil, scheduled.SenderDeviceID)
+	msg, _, err := s.messageService.withTx(tx).SendMessage(sendCtx, SendMessageInput{
+		ConversationID: scheduled.ConversationID,
+		SenderID:       scheduled.SenderID,
+		Ciphertexts:    payloads,
+		MessageType:    scheduled.MessageType,
+		ClientMsgID:    scheduled.ClientMessageID,
+		IdempotencyKey: "scheduled:" + scheduled.ID.String(),
+		Metadata:       map[string]interface{}{"scheduled_message_id": scheduled.ID.String()},
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return msg.ID, nil
+}
+
+// resolveSchedule turns an RFC3339 timestamp or a wall-clock time in timezone
+// into the UTC delivery time. A wall-clock time that does not exist in the
+// timezone, such as one skipped by a daylight saving change, is rejected.
+func resolveSchedule(value, timezone string) (time.Time, string, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, "", sentinal_errors.ErrInvalidInput
+	}
+	scheduledFor, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		scheduledFor, err = time.ParseInLocation(scheduledLocalLayout, value, loc)
+		if err != nil || scheduledFor.Format(scheduledLocalLayout) != value {
+			return time.Time{}, "", sentinal_errors.ErrInvalidInput
+		}
+	}
+	if !scheduledFor.After(time.Now()) {
+		return time.Time{}, "", sentinal_errors.ErrInvalidInput
+	}
+	return scheduledFor.UTC(), timezone, nil
+}
+
+// scheduledRetryDelay is how long a message waits after its attempts-th
+// failed delivery.
+func scheduledRetryDelay(attempts int) time.Duration {
+	delay := scheduledRetryBaseDelay
+	for i := 0; i < attempts && delay < scheduledRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > scheduledRetryMaxDelay {
+		return scheduledRetryMaxDelay
+	}
+	return delay
+}
+
+func isPermanentSendError(err error) bool {
+	return errors.Is(err, sentinal_errors.ErrForbidden) ||
+		errors.Is(err, sentinal_errors.ErrInvalidInput) ||
+		errors.Is(err, sentinal_errors.ErrNotFound) ||
+		errors.Is(err, sentinal_errors.ErrAlreadyExists)
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ScheduledMessageWorker periodically delivers scheduled messages whose
+// ScheduledFor has passed.
+type ScheduledMessageWorker struct {
+	*IntervalWorker
+	service   *ScheduledMessageService
+	batchSize int
+}
+
+func NewScheduledMessageWorker(service *ScheduledMessageService, logger *zap.Logger) *ScheduledMessageWorker {
+	w := &ScheduledMessageWorker{
+		service:   service,
+		batchSize: 100,
+	}
+	w.IntervalWorker = NewIntervalWorker("scheduled_message_worker", 5*time.Second, logger, w.processBatch)
+	return w
+}
+
+func (w *ScheduledMessageWorker) processBatch(ctx context.Context) error {
+	return drainBatches(ctx, w.batchSize, w.service.DeliverDue)
+}
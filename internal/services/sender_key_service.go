@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"sentinal-chat/internal/domain/conversation"
+	"sentinal-chat/internal/domain/encryption"
+	"sentinal-chat/internal/repository"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+// maxSenderKeyDistributions bounds how many devices one upload may address.
+const maxSenderKeyDistributions = 1000
+
+// Reasons a group's sender keys are rotated.
+const (
+	SenderKeyRotateMemberAdded   = "member_added"
+	SenderKeyRotateMemberRemoved = "member_removed"
+)
+
+// SenderKeyService distributes group sender keys. Each member device encrypts
+// group messages with its own sender key and hands that key to every other
+// member device in a distribution message it encrypted pairwise. The server
+// only stores and routes these; it never sees a key.
+type SenderKeyService struct {
+	db               repository.DBTX
+	repo             repository.SenderKeyRepository
+	conversationRepo repository.ConversationRepository
+	userRepo         repository.UserRepository
+	eventPublisher   *EventPublisher
+}
+
+// SenderKeyDistributionInput is one distribution message, encrypted for one
+// member device.
+type SenderKeyDistributionInput struct {
+	RecipientDeviceID uuid.UUID
+	Ciphertext        []byte
+	Header            map[string]interface{}
+}
+
+// DistributeSenderKeyInput announces the sender key the calling device sends
+// with and distributes it to some or all member devices.
+type DistributeSenderKeyInput struct {
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	DistributionID uuid.UUID
+	Distributions  []SenderKeyDistributionInput
+}
+
+// SenderKeyState is what a device needs to send and read sender-key messages
+// in a group: the current epoch, the keys other devices distributed to it, its
+// own current key if any, and the member devices that still lack that key.
+type SenderKeyState struct {
+	Epoch            int64
+	Distributions    []encryption.SenderKeyDistribution
+	SenderKey        *encryption.SenderKey
+	MissingDeviceIDs []uuid.UUID
+}
+
+// NewSenderKeyService creates a sender key service.
+func NewSenderKeyService(db repository.DBTX, repo repository.SenderKeyRepository, conversationRepo repository.ConversationRepository, userRepo repository.UserRepository, eventPublisher *EventPublisher) *SenderKeyService {
+	return &SenderKeyService{
+		db:               db,
+		repo:             repo,
+		conversationRepo: conversationRepo,
+		userRepo:         userRepo,
+		eventPublisher:   eventPublisher,
+	}
+}
+
+// Distribute stores distribution messages of the calling device's sender key
+// and notifies their recipients. A new DistributionID replaces the device's
+// previous key for the current epoch; repeating the current one adds devices
+// that did not receive it yet, such as a member's newly linked device. A key
+// from an earlier epoch cannot be distributed again.
+func (s *SenderKeyService) Distribute(ctx context.Context, input DistributeSenderKeyInput) (SenderKeyState, error) {
+	if input.ConversationID == uuid.Nil || input.SenderID == uuid.Nil || input.DistributionID == uuid.Nil {
+		return SenderKeyState{}, sentinal_errors.ErrInvalidInput
+	}
+	if len(input.Distributions) == 0 || len(input.Distributions) > maxSenderKeyDistributions {
+		return SenderKeyState{}, sentinal_errors.ErrInvalidInput
+	}
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return SenderKeyState{}, sentinal_errors.ErrInvalidInput
+	}
+	if s.db == nil {
+		return SenderKeyState{}, sentinal_errors.ErrServiceUnavailable
+	}
+
+	if err := s.authorizeGroup(ctx, input.ConversationID, input.SenderID, conversation.ActionSendMessages); err != nil {
+		return SenderKeyState{}, err
+	}
+	participants, err := s.conversationRepo.GetParticipants(ctx, input.ConversationID)
+	if err != nil {
+		return SenderKeyState{}, err
+	}
+	members := make(map[uuid.UUID]bool, len(participants))
+	for _, p := range participants {
+		members[p.UserID] = true
+	}
+
+	seen := make(map[uuid.UUID]bool, len(input.Distributions))
+	recipientUsers := make(map[uuid.UUID]uuid.UUID, len(input.Distributions))
+	for _, d := range input.Distributions {
+		if d.RecipientDeviceID == uuid.Nil || d.RecipientDeviceID == deviceID.UUID || len(d.Ciphertext) == 0 || seen[d.RecipientDeviceID] {
+			return SenderKeyState{}, sentinal_errors.ErrInvalidInput
+		}
+		seen[d.RecipientDeviceID] = true
+		device, err := s.userRepo.GetDeviceByID(ctx, d.RecipientDeviceID)
+		if err != nil {
+			if errors.Is(err, sentinal_errors.ErrNotFound) {
+				return SenderKeyState{}, sentinal_errors.ErrInvalidInput
+			}
+			return SenderKeyState{}, err
+		}
+		if !device.IsActive || !members[device.UserID] {
+			return SenderKeyState{}, sentinal_errors.ErrInvalidInput
+		}
+		recipientUsers[d.RecipientDeviceID] = device.UserID
+	}
+
+	var key encryption.SenderKey
+	var missing []uuid.UUID
+	err = repository.WithTx(ctx, s.db, func(tx repository.DBTX) error {
+		repo := repository.NewSenderKeyRepository(tx)
+		epoch, err := repo.GetEpoch(ctx, input.ConversationID)
+		if err != nil {
+			return err
+		}
+		current, err := repo.GetSenderKey(ctx, input.ConversationID, deviceID.UUID)
+		if err != nil && !errors.Is(err, sentinal_errors.ErrNotFound) {
+			return err
+		}
+		if err == nil && current.DistributionID == input.DistributionID && current.Epoch != epoch {
+			return sentinal_errors.ErrConflict
+		}
+
+		now := time.Now().UTC()
+		key = encryption.SenderKey{
+			ConversationID: input.ConversationID,
+			SenderDeviceID: deviceID.UUID,
+			SenderID:       input.SenderID,
+			DistributionID: input.DistributionID,
+			Epoch:          epoch,
+			CreatedAt:      now,
+		}
+		if err == nil && current.DistributionID == input.DistributionID {
+			key.CreatedAt = current.CreatedAt
+		}
+		if err := repo.UpsertSenderKey(ctx, &key); err != nil {
+			return err
+		}
+
+		notified := make(map[uuid.UUID]bool, len(recipientUsers))
+		recipientIDs := make([]uuid.UUID, 0, len(recipientUsers))
+		for _, d := range input.Distributions {
+			header := d.Header
+			if header == nil {
+				header = map[string]interface{}{"version": 1, "cipher": "signal"}
+			}
+			headerRaw, err := json.Marshal(header)
+			if err != nil {
+				return err
+			}
+			recipientID := recipientUsers[d.RecipientDeviceID]
+			if err := repo.UpsertDistribution(ctx, &encryption.SenderKeyDistribution{
+				ID:                uuid.New(),
+				ConversationID:    input.ConversationID,
+				SenderID:          input.SenderID,
+				SenderDeviceID:    deviceID.UUID,
+				RecipientUserID:   recipientID,
+				RecipientDeviceID: d.RecipientDeviceID,
+				DistributionID:    input.DistributionID,
+				Epoch:             epoch,
+				Ciphertext:        d.Ciphertext,
+				Header:            string(headerRaw),
+				CreatedAt:         now,
+			}); err != nil {
+				return err
+			}
+			if !notified[recipientID] {
+				notified[recipientID] = true
+				recipientIDs = append(recipientIDs, recipientID)
+			}
+		}
+
+		missing, err = repo.GetUndistributedDevices(ctx, input.ConversationID, deviceID.UUID, input.DistributionID)
+		if err != nil {
+			return err
+		}
+		if s.eventPublisher == nil {
+			return nil
+		}
+		return s.eventPublisher.PublishSenderKeyReceived(ctx, tx, key, recipientIDs)
+	})
+	if err != nil {
+		return SenderKeyState{}, err
+	}
+	return SenderKeyState{Epoch: key.Epoch, SenderKey: &key, MissingDeviceIDs: missing}, nil
+}
+
+// GetState returns the calling device's sender key state in a group.
+func (s *SenderKeyService) GetState(ctx context.Context, conversationID, userID uuid.UUID) (SenderKeyState, error) {
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return SenderKeyState{}, sentinal_errors.ErrInvalidInput
+	}
+	if err := s.authorizeGroup(ctx, conversationID, userID, ""); err != nil {
+		return SenderKeyState{}, err
+	}
+
+	epoch, err := s.repo.GetEpoch(ctx, conversationID)
+	if err != nil {
+		return SenderKeyState{}, err
+	}
+	distributions, err := s.repo.GetDistributionsForDevice(ctx, conversationID, deviceID.UUID)
+	if err != nil {
+		return SenderKeyState{}, err
+	}
+	state := SenderKeyState{Epoch: epoch, Distributions: distributions}
+
+	key, err := s.repo.GetSenderKey(ctx, conversationID, deviceID.UUID)
+	if err != nil {
+		if errors.Is(err, sentinal_errors.ErrNotFound) {
+			return state, nil
+		}
+		return SenderKeyState{}, err
+	}
+	state.SenderKey = &key
+	state.MissingDeviceIDs, err = s.repo.GetUndistributedDevices(ctx, conversationID, deviceID.UUID, key.DistributionID)
+	if err != nil {
+		return SenderKeyState{}, err
+	}
+	return state, nil
+}
+
+// authorizeGroup requires a group the user may perform the action in. Direct
+// conversations keep using per-device ciphertexts.
+func (s *SenderKeyService) authorizeGroup(ctx context.Context, conversationID, userID uuid.UUID, action string) error {
+	conv, _, err := authorizeAction(ctx, s.conversationRepo, conversationID, userID, action)
+	if err != nil {
+		return err
+	}
+	if conv.Type != "GROUP" {
+		return sentinal_errors.ErrInvalidInput
+	}
+	return nil
+}
+
+// checkSenderKey requires distributionID to be the sending device's current
+// sender key, created in the group's current epoch and distributed to every
+// active member device, before a message encrypted with it is accepted.
+func checkSenderKey(ctx context.Context, repo repository.SenderKeyRepository, conversationID, senderDeviceID, distributionID uuid.UUID) error {
+	key, err := repo.GetSenderKey(ctx, conversationID, senderDeviceID)
+	if err != nil {
+		if errors.Is(err, sentinal_errors.ErrNotFound) {
+			return sentinal_errors.ErrConflict
+		}
+		return err
+	}
+	if key.DistributionID != distributionID {
+		return sentinal_errors.ErrConflict
+	}
+	epoch, err := repo.GetEpoch(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	if key.Epoch != epoch {
+		return sentinal_errors.ErrConflict
+	}
+	missing, err := repo.GetUndistributedDevices(ctx, conversationID, senderDeviceID, distributionID)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return sentinal_errors.ErrConflict
+	}
+	return nil
+}
+
+// bumpSenderKeyEpoch starts a new sender key epoch after a membership change
+// and asks the group to rotate. A member who left loses the distributions
+// addressed to them and their own keys.
+func bumpSenderKeyEpoch(ctx context.Context, tx repository.DBTX, eventPublisher *EventPublisher, conversationID, memberID uuid.UUID, reason string) error {
+	repo := repository.NewSenderKeyRepository(tx)
+	epoch, err := repo.BumpEpoch(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	if reason == SenderKeyRotateMemberRemoved {
+		if err := repo.DeleteUserKeys(ctx, conversationID, memberID); err != nil {
+			return err
+		}
+	}
+	if eventPublisher == nil {
+		return nil
+	}
+	return eventPublisher.PublishSenderKeyRotate(ctx, tx, conversationID, memberID, epoch, reason)
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SignedPreKeyRotationWorker periodically asks devices with stale signed
+// prekeys to rotate them and deletes replaced keys past their grace period.
+type SignedPreKeyRotationWorker struct {
+	*IntervalWorker
+	encryptionService *EncryptionService
+	batchSize         int
+}
+
+func NewSignedPreKeyRotationWorker(encryptionService *EncryptionService, logger *zap.Logger) *SignedPreKeyRotationWorker {
+	w := &SignedPreKeyRotationWorker{
+		encryptionService: encryptionService,
+		batchSize:         100,
+	}
+	w.IntervalWorker = NewIntervalWorker("signed_prekey_rotation_worker", 15*time.Minute, logger, w.processBatch)
+	return w
+}
+
+func (w *SignedPreKeyRotationWorker) processBatch(ctx context.Context) error {
+	requested := 0
+	err := drainBatches(ctx, w.batchSize, func(ctx context.Context, limit int) (int, error) {
+		n, err := w.encryptionService.RequestSignedPreKeyRotations(ctx, limit)
+		requested += n
+		return n, err
+	})
+	if requested > 0 {
+		w.logger.Info("asked devices to rotate stale signed prekeys", zap.Int("requested", requested))
+	}
+	if err != nil {
+		// Replaced keys can be cleaned up regardless.
+		w.logger.Error("signed prekey rotation requests failed", zap.Error(err))
+	}
+
+	deleted, err := w.encryptionService.CleanupRetiredSignedPreKeys(ctx)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		w.logger.Info("signed prekey cleanup deleted replaced signed prekeys", zap.Int64("deleted", deleted))
+	}
+	return nil
+}
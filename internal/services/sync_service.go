@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"sentinal-chat/internal/domain/conversation"
+	"sentinal-chat/internal/domain/message"
+	"sentinal-chat/internal/repository"
+	sentinal_errors "sentinal-chat/pkg/errors"
+
+	"github.com/google/uuid"
+)
+
+const (
+	syncTokenVersion = 1
+	defaultSyncLimit = 100
+	maxSyncLimit     = 500
+
+	// syncOverlap is how far the change feed is rewound once it is drained. A
+	// change is stamped when its statement runs but only becomes visible at
+	// commit, so a transaction that was still open during this sync can surface
+	// a change older than the last one returned.
+	syncOverlap = 10 * time.Second
+)
+
+// SyncService tells a reconnecting device what it missed: new messages per
+// conversation by sequence number, and edits, deletions, receipts and
+// membership changes from a time-ordered change feed.
+type SyncService struct {
+	syncRepo       repository.SyncRepository
+	messageService *MessageService
+}
+
+// SyncInput is the position a device last synced to. Token, when set, replaces
+// Sequences and Since. Conversations missing from Sequences are synced from
+// the beginning; a zero Since starts the change feed at the time of the sync.
+type SyncInput struct {
+	UserID    uuid.UUID
+	Sequences map[uuid.UUID]int64
+	Since     time.Time
+	Token     string
+	Limit     int
+}
+
+// SyncResult is one page of changes. Sequences and Token describe the position
+// after this page; HasMore means the device should sync again straight away.
+type SyncResult struct {
+	Messages  []message.Message
+	Edits     []message.Message
+	Changes   []conversation.Change
+	Sequences map[uuid.UUID]int64
+	Token     string
+	HasMore   bool
+}
+
+type syncToken struct {
+	Version   int              `json:"v"`
+	Sequences map[string]int64 `json:"seqs"`
+	Since     time.Time        `json:"since"`
+	Kind      string           `json:"kind,omitempty"`
+	MessageID uuid.UUID        `json:"message_id"`
+	UserID    uuid.UUID        `json:"user_id"`
+}
+
+// NewSyncService creates a sync service.
+func NewSyncService(syncRepo repository.SyncRepository, messageService *MessageService) *SyncService {
+	return &SyncService{syncRepo: syncRepo, messageService: messageService}
+}
+
+// Sync returns up to Limit new messages and up to Limit changes since the
+// given position. Messages are returned in sequence order within each
+// conversation. Changes may repeat across syncs and must be applied
+// idempotently.
+func (s *SyncService) Sync(ctx context.Context, input SyncInput) (SyncResult, error) {
+	if input.UserID == uuid.Nil {
+		return SyncResult{}, sentinal_errors.ErrInvalidInput
+	}
+	deviceID, ok := DeviceIDFromContext(ctx)
+	if !ok || !deviceID.Valid {
+		return SyncResult{}, sentinal_errors.ErrInvalidInput
+	}
+	limit := input.Limit
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	now := time.Now().UTC()
+	known := input.Sequences
+	cursor := conversation.ChangeCursor{ChangedAt: input.Since.UTC()}
+	if input.Token != "" {
+		var err error
+		known, cursor, err = decodeSyncToken(input.Token)
+		if err != nil {
+			return SyncResult{}, err
+		}
+	}
+	if cursor.ChangedAt.IsZero() {
+		cursor.ChangedAt = now
+	}
+	for _, seq := range known {
+		if seq < 0 {
+			return SyncResult{}, sentinal_errors.ErrInvalidInput
+		}
+	}
+
+	states, err := s.syncRepo.GetSequenceStates(ctx, input.UserID)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	result := SyncResult{Sequences: make(map[uuid.UUID]int64, len(states))}
+	budget := limit
+	for _, state := range states {
+		seq := known[state.ConversationID]
+		result.Sequences[state.ConversationID] = seq
+		if state.LastSequence <= seq {
+			continue
+		}
+		if budget == 0 {
+			result.HasMore = true
+			continue
+		}
+		msgs, err := s.syncRepo.GetMessagesAfter(ctx, state.ConversationID, seq, budget, deviceID.UUID, input.UserID)
+		if err != nil {
+			return SyncResult{}, err
+		}
+		// A short page means everything up to LastSequence was either returned
+		// or is not visible to this device, so the cursor can skip past it.
+		next := state.LastSequence
+		if len(msgs) > 0 {
+			last := msgs[len(msgs)-1].SeqID.Int64
+			if len(msgs) == budget {
+				next = last
+				result.HasMore = true
+			} else if last > next {
+				next = last
+			}
+		}
+		result.Sequences[state.ConversationID] = next
+		result.Messages = append(result.Messages, msgs...)
+		budget -= len(msgs)
+	}
+
+	changes, err := s.syncRepo.GetChanges(ctx, input.UserID, cursor, limit+1)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		cursor = changes[len(changes)-1].Cursor()
+		result.HasMore = true
+	} else {
+		cursor = conversation.ChangeCursor{ChangedAt: now.Add(-syncOverlap)}
+	}
+	result.Changes = changes
+
+	var edited []uuid.UUID
+	for _, c := range changes {
+		if c.Kind == conversation.ChangeMessageEdited && c.MessageID.Valid {
+			edited = append(edited, c.MessageID.UUID)
+		}
+	}
+	result.Edits, err = s.syncRepo.GetMessagesByIDs(ctx, edited, deviceID.UUID, input.UserID)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	if err := s.messageService.loadAttachments(ctx, result.Messages); err != nil {
+		return SyncResult{}, err
+	}
+	if err := s.messageService.loadAttachments(ctx, result.Edits); err != nil {
+		return SyncResult{}, err
+	}
+
+	result.Token, err = encodeSyncToken(result.Sequences, cursor)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	return result, nil
+}
+
+func encodeSyncToken(sequences map[uuid.UUID]int64, cursor conversation.ChangeCursor) (string, error) {
+	token := syncToken{
+		Version:   syncTokenVersion,
+		Sequences: make(map[string]int64, len(sequences)),
+		Since:     cursor.ChangedAt,
+		Kind:      cursor.Kind,
+		MessageID: cursor.MessageID,
+		UserID:    cursor.UserID,
+	}
+	for id, seq := range sequences {
+		token.Sequences[id.String()] = seq
+	}
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeSyncToken(encoded string) (map[uuid.UUID]int64, conversation.ChangeCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, conversation.ChangeCursor{}, sentinal_errors.ErrInvalidInput
+	}
+	var token syncToken
+	if err := json.Unmarshal(raw, &token); err != nil || token.Version != syncTokenVersion {
+		return nil, conversation.ChangeCursor{}, sentinal_errors.ErrInvalidInput
+	}
+	sequences := make(map[uuid.UUID]int64, len(token.Sequences))
+	for rawID, seq := range token.Sequences {
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			return nil, conversation.ChangeCursor{}, sentinal_errors.ErrInvalidInput
+		}
+		sequences[id] = seq
+	}
+	return sequences, conversation.ChangeCursor{
+		ChangedAt: token.Since,
+		Kind:      token.Kind,
+		MessageID: token.MessageID,
+		UserID:    token.UserID,
+	}, nil
+}
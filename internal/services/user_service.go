@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"sentinal-chat/internal/domain/user"
+	"sentinal-chat/internal/redis"
 	"sentinal-chat/internal/repository"
 	sentinal_errors "sentinal-chat/pkg/errors"
 
@@ -14,12 +15,14 @@ import (
 
 // UserService manages user profiles, contacts, devices, and sessions.
 type UserService struct {
-	repo repository.UserRepository
+	repo  repository.UserRepository
+	cache *redis.CacheStore
 }
 
-// NewUserService creates a user service.
-func NewUserService(repo repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+// NewUserService creates a user service. Profiles are cached in cache when it
+// is non-nil.
+func NewUserService(repo repository.UserRepository, cache *redis.CacheStore) *UserService {
+	return &UserService{repo: repo, cache: cache}
 }
 
 func (s *UserService) List(ctx context.Context, page, limit int, search string) ([]user.User, int64, error) {
@@ -33,7 +36,19 @@ func (s *UserService) GetByID(ctx context.Context, actorID, userID uuid.UUID) (u
 	if actorID != userID {
 		return user.User{}, sentinal_errors.ErrForbidden
 	}
-	return s.repo.GetUserByID(ctx, userID)
+	if s.cache != nil {
+		if cached, err := s.cache.GetUser(ctx, userID); err == nil && cached != nil {
+			return cached.ToEntity(), nil
+		}
+	}
+	u, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return user.User{}, err
+	}
+	if s.cache != nil {
+		_ = s.cache.SetUserFromEntity(ctx, &u)
+	}
+	return u, nil
 }
 
 func (s *UserService) GetByEmail(ctx context.Context, email string) (user.User, error) {
@@ -56,6 +71,7 @@ func (s *UserService) UpdateProfile(ctx context.Context, actorID uuid.UUID, inpu
 	if err := s.repo.UpdateUser(ctx, input); err != nil {
 		return user.User{}, err
 	}
+	s.invalidateUser(ctx, input.ID)
 	return s.repo.GetUserByID(ctx, input.ID)
 }
 
@@ -63,21 +79,36 @@ func (s *UserService) UpdateOnlineStatus(ctx context.Context, actorID, userID uu
 	if actorID != userID {
 		return sentinal_errors.ErrForbidden
 	}
-	return s.repo.UpdateOnlineStatus(ctx, userID, isOnline)
+	if err := s.repo.UpdateOnlineStatus(ctx, userID, isOnline); err != nil {
+		return err
+	}
+	s.invalidateUser(ctx, userID)
+	return nil
 }
 
 func (s *UserService) UpdateLastSeen(ctx context.Context, actorID, userID uuid.UUID, lastSeen time.Time) error {
 	if actorID != userID {
 		return sentinal_errors.ErrForbidden
 	}
-	return s.repo.UpdateLastSeen(ctx, userID, lastSeen)
+	if err := s.repo.UpdateLastSeen(ctx, userID, lastSeen); err != nil {
+		return err
+	}
+	s.invalidateUser(ctx, userID)
+	return nil
 }
 
 func (s *UserService) Delete(ctx context.Context, actorID, userID uuid.UUID) error {
 	if actorID != userID {
 		return sentinal_errors.ErrForbidden
 	}
-	return s.repo.DeleteUser(ctx, userID)
+	if err := s.repo.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	s.invalidateUser(ctx, userID)
+	if s.cache != nil {
+		_ = s.cache.InvalidateUserSessions(ctx, userID)
+	}
+	return nil
 }
 
 func (s *UserService) GetSettings(ctx context.Context, actorID, userID uuid.UUID) (user.UserSettings, error) {
@@ -230,12 +261,30 @@ func (s *UserService) RevokeSession(ctx context.Context, actorID, userID, sessio
 	if actorID != userID {
 		return sentinal_errors.ErrForbidden
 	}
-	return s.repo.RevokeSession(ctx, sessionID)
+	if err := s.repo.RevokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		_ = s.cache.InvalidateSession(ctx, sessionID)
+	}
+	return nil
 }
 
 func (s *UserService) RevokeAllSessions(ctx context.Context, actorID, userID uuid.UUID) error {
 	if actorID != userID {
 		return sentinal_errors.ErrForbidden
 	}
-	return s.repo.RevokeAllUserSessions(ctx, userID)
+	if err := s.repo.RevokeAllUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		_ = s.cache.InvalidateUserSessions(ctx, userID)
+	}
+	return nil
+}
+
+func (s *UserService) invalidateUser(ctx context.Context, userID uuid.UUID) {
+	if s.cache != nil {
+		_ = s.cache.InvalidateUser(ctx, userID)
+	}
 }
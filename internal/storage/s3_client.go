@@ -112,6 +112,47 @@ func (c *Client) PresignPut(ctx context.Context, key, contentType string, sizeBy
 	return presigned.URL, headers, nil
 }
 
+// PresignGet returns a URL that downloads the object until ttl elapses. A
+// non-positive ttl falls back to the configured presign TTL.
+func (c *Client) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if c == nil {
+		return "", errors.New("s3 client not initialized")
+	}
+	if key == "" {
+		return "", errors.New("object key is required")
+	}
+	if ttl <= 0 {
+		ttl = c.cfg.PresignTTL
+	}
+	presigned, err := c.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.cfg.Bucket),
+		Key:    aws.String(key),
+	}, func(po *s3.PresignOptions) {
+		if ttl > 0 {
+			po.Expires = ttl
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return presigned.URL, nil
+}
+
+// DeleteObject removes the object from the bucket. Deleting a missing key succeeds.
+func (c *Client) DeleteObject(ctx context.Context, key string) error {
+	if c == nil {
+		return errors.New("s3 client not initialized")
+	}
+	if key == "" {
+		return errors.New("object key is required")
+	}
+	_, err := c.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
 func (c *Client) FileURL(key string) string {
 	if c == nil || key == "" {
 		return ""
@@ -141,6 +141,37 @@ type DeletedCountResponse struct {
 	Deleted int64 `json:"deleted"`
 }
 
+// ICEServerDTO is an RTCIceServer entry for WebRTC clients
+type ICEServerDTO struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICEServersResponse is returned by GET /calls/ice-servers
+type ICEServersResponse struct {
+	ICEServers []ICEServerDTO `json:"ice_servers"`
+	ExpiresAt  string         `json:"expires_at,omitempty"`
+	TTL        int64          `json:"ttl,omitempty"` // seconds until the TURN credentials expire
+}
+
+// FromICEServers converts domain ICE servers to an ICEServersResponse
+func FromICEServers(servers []call.ICEServer, expiresAt time.Time) ICEServersResponse {
+	resp := ICEServersResponse{ICEServers: make([]ICEServerDTO, 0, len(servers))}
+	for _, s := range servers {
+		resp.ICEServers = append(resp.ICEServers, ICEServerDTO{
+			URLs:       s.URLs,
+			Username:   s.Username,
+			Credential: s.Credential,
+		})
+	}
+	if !expiresAt.IsZero() {
+		resp.ExpiresAt = expiresAt.Format(time.RFC3339)
+		resp.TTL = int64(time.Until(expiresAt).Seconds())
+	}
+	return resp
+}
+
 // FromCall converts a domain call to CallDTO
 func FromCall(c call.Call) CallDTO {
 	dto := CallDTO{
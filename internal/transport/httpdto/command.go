@@ -0,0 +1,81 @@
+package httpdto
+
+import (
+	"encoding/json"
+	"sentinal-chat/internal/domain/command"
+	"time"
+)
+
+// CommandRefDTO identifies the command behind a mutation so it can be undone
+type CommandRefDTO struct {
+	CommandID    string `json:"command_id,omitempty"`
+	UndoDeadline string `json:"undo_deadline,omitempty"`
+}
+
+// CommandLogDTO represents a command history entry
+type CommandLogDTO struct {
+	ID              string          `json:"id"`
+	CommandType     string          `json:"command_type"`
+	Status          string          `json:"status"`
+	Payload         json.RawMessage `json:"payload,omitempty"`
+	ErrorMessage    string          `json:"error_message,omitempty"`
+	ExecutionTimeMs int             `json:"execution_time_ms"`
+	CanUndo         bool            `json:"can_undo"`
+	UndoDeadline    string          `json:"undo_deadline,omitempty"`
+	CreatedAt       string          `json:"created_at"`
+	ExecutedAt      string          `json:"executed_at,omitempty"`
+	UndoneAt        string          `json:"undone_at,omitempty"`
+}
+
+// ListCommandsResponse is returned for GET /commands
+type ListCommandsResponse struct {
+	Commands []CommandLogDTO `json:"commands"`
+	Total    int64           `json:"total"`
+}
+
+// FromCommandRef builds the command reference for a mutation response
+func FromCommandRef(log *command.CommandLog) CommandRefDTO {
+	if log == nil {
+		return CommandRefDTO{}
+	}
+	ref := CommandRefDTO{CommandID: log.ID.String()}
+	if log.UndoDeadline != nil {
+		ref.UndoDeadline = log.UndoDeadline.Format(time.RFC3339)
+	}
+	return ref
+}
+
+// FromCommandLog converts a domain CommandLog to CommandLogDTO
+func FromCommandLog(log command.CommandLog) CommandLogDTO {
+	dto := CommandLogDTO{
+		ID:              log.ID.String(),
+		CommandType:     log.CommandType,
+		Status:          string(log.Status),
+		ErrorMessage:    log.ErrorMessage,
+		ExecutionTimeMs: log.ExecutionTimeMs,
+		CanUndo:         log.IsUndoable(time.Now()),
+		CreatedAt:       log.CreatedAt.Format(time.RFC3339),
+	}
+	if json.Valid(log.Payload) {
+		dto.Payload = log.Payload
+	}
+	if log.UndoDeadline != nil {
+		dto.UndoDeadline = log.UndoDeadline.Format(time.RFC3339)
+	}
+	if log.ExecutedAt != nil {
+		dto.ExecutedAt = log.ExecutedAt.Format(time.RFC3339)
+	}
+	if log.UndoneAt != nil {
+		dto.UndoneAt = log.UndoneAt.Format(time.RFC3339)
+	}
+	return dto
+}
+
+// FromCommandLogSlice converts a slice of command logs to CommandLogDTO slice
+func FromCommandLogSlice(logs []command.CommandLog) []CommandLogDTO {
+	dtos := make([]CommandLogDTO, len(logs))
+	for i, log := range logs {
+		dtos[i] = FromCommandLog(log)
+	}
+	return dtos
+}
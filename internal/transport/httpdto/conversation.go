@@ -45,16 +45,18 @@ type ListConversationsResponse struct {
 
 // ConversationDTO represents a conversation in API responses
 type ConversationDTO struct {
-	ID               string `json:"id"`
-	Type             string `json:"type"`
-	Subject          string `json:"subject,omitempty"`
-	Description      string `json:"description,omitempty"`
-	AvatarURL        string `json:"avatar_url,omitempty"`
-	CreatorID        string `json:"creator_id"`
-	InviteLink       string `json:"invite_link,omitempty"`
-	ParticipantCount int    `json:"participant_count"`
-	LastMessageAt    string `json:"last_message_at,omitempty"`
-	CreatedAt        string `json:"created_at"`
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	Subject              string `json:"subject,omitempty"`
+	Description          string `json:"description,omitempty"`
+	AvatarURL            string `json:"avatar_url,omitempty"`
+	CreatorID            string `json:"creator_id"`
+	InviteLink           string `json:"invite_link,omitempty"`
+	ParticipantCount     int    `json:"participant_count"`
+	DisappearingMode     string `json:"disappearing_mode,omitempty"`
+	MessageExpirySeconds int32  `json:"message_expiry_seconds,omitempty"`
+	LastMessageAt        string `json:"last_message_at,omitempty"`
+	CreatedAt            string `json:"created_at"`
 }
 
 // SearchConversationsRequest holds query parameters for searching
@@ -112,6 +114,64 @@ type UpdateLastReadSequenceRequest struct {
 	SeqID int64 `json:"seq_id" binding:"required"`
 }
 
+// ClearConversationResponse is returned after POST /conversations/:id/clear
+type ClearConversationResponse struct {
+	ConversationID string `json:"conversation_id"`
+	ClearedAt      string `json:"cleared_at"`
+}
+
+// SetDisappearingModeRequest is used for PUT /conversations/:id/disappearing
+type SetDisappearingModeRequest struct {
+	Mode string `json:"mode" binding:"required"` // OFF, 24_HOURS, 7_DAYS or 90_DAYS
+}
+
+// SetDisappearingModeResponse is returned after changing the disappearing mode.
+// SystemMessage is omitted when the mode was already set.
+type SetDisappearingModeResponse struct {
+	Conversation  ConversationDTO `json:"conversation"`
+	SystemMessage *MessageDTO     `json:"system_message,omitempty"`
+}
+
+// GroupPermissionsDTO lists who may perform each group action: EVERYONE or
+// ADMINS.
+type GroupPermissionsDTO struct {
+	SendMessages string `json:"send_messages"`
+	EditInfo     string `json:"edit_info"`
+	AddMembers   string `json:"add_members"`
+	PinMessages  string `json:"pin_messages"`
+	StartCalls   string `json:"start_calls"`
+}
+
+// SetGroupPermissionsRequest is used for PUT /conversations/:id/permissions.
+// Omitted settings keep their current value.
+type SetGroupPermissionsRequest struct {
+	SendMessages string `json:"send_messages,omitempty"`
+	EditInfo     string `json:"edit_info,omitempty"`
+	AddMembers   string `json:"add_members,omitempty"`
+	PinMessages  string `json:"pin_messages,omitempty"`
+	StartCalls   string `json:"start_calls,omitempty"`
+}
+
+// ApplyTo overlays the settings present in the request on current.
+func (r SetGroupPermissionsRequest) ApplyTo(current conversation.GroupPermissions) conversation.GroupPermissions {
+	if r.SendMessages != "" {
+		current.SendMessages = r.SendMessages
+	}
+	if r.EditInfo != "" {
+		current.EditInfo = r.EditInfo
+	}
+	if r.AddMembers != "" {
+		current.AddMembers = r.AddMembers
+	}
+	if r.PinMessages != "" {
+		current.PinMessages = r.PinMessages
+	}
+	if r.StartCalls != "" {
+		current.StartCalls = r.StartCalls
+	}
+	return current
+}
+
 // RegenerateInviteLinkResponse is returned when regenerating invite link
 type RegenerateInviteLinkResponse struct {
 	InviteLink string `json:"invite_link"`
@@ -129,6 +189,39 @@ type ConversationSequenceDTO struct {
 	UpdatedAt      string `json:"updated_at"`
 }
 
+// CreateLabelRequest is used for POST /conversations/labels
+type CreateLabelRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Color    string `json:"color,omitempty"` // "#RRGGBB"
+	Position *int32 `json:"position,omitempty"`
+}
+
+// UpdateLabelRequest is used for PUT /conversations/labels/:label_id
+type UpdateLabelRequest struct {
+	Name     *string `json:"name,omitempty"`
+	Color    *string `json:"color,omitempty"` // empty string clears the color
+	Position *int32  `json:"position,omitempty"`
+}
+
+// ReorderLabelsRequest is used for PUT /conversations/labels/order
+type ReorderLabelsRequest struct {
+	LabelIDs []string `json:"label_ids" binding:"required"`
+}
+
+// LabelsResponse is returned when listing labels
+type LabelsResponse struct {
+	Labels []LabelDTO `json:"labels"`
+}
+
+// LabelDTO represents a chat label in API responses
+type LabelDTO struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Color     string `json:"color,omitempty"`
+	Position  *int32 `json:"position,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
 // FromConversation converts a domain conversation to ConversationDTO
 func FromConversation(c conversation.Conversation) ConversationDTO {
 	dto := ConversationDTO{
@@ -152,9 +245,24 @@ func FromConversation(c conversation.Conversation) ConversationDTO {
 		dto.InviteLink = c.InviteLink.String
 	}
 	dto.ParticipantCount = len(c.Participants)
+	dto.DisappearingMode = c.DisappearingMode
+	if c.MessageExpirySeconds.Valid {
+		dto.MessageExpirySeconds = c.MessageExpirySeconds.Int32
+	}
 	return dto
 }
 
+// FromGroupPermissions converts domain group permissions to GroupPermissionsDTO
+func FromGroupPermissions(g conversation.GroupPermissions) GroupPermissionsDTO {
+	return GroupPermissionsDTO{
+		SendMessages: g.SendMessages,
+		EditInfo:     g.EditInfo,
+		AddMembers:   g.AddMembers,
+		PinMessages:  g.PinMessages,
+		StartCalls:   g.StartCalls,
+	}
+}
+
 // FromConversationSlice converts a slice of domain conversations to ConversationDTO slice
 func FromConversationSlice(conversations []conversation.Conversation) []ConversationDTO {
 	dtos := make([]ConversationDTO, len(conversations))
@@ -191,3 +299,29 @@ func FromConversationSequence(s conversation.ConversationSequence) ConversationS
 		UpdatedAt:      s.UpdatedAt.Format(time.RFC3339),
 	}
 }
+
+// FromChatLabel converts a domain chat label to LabelDTO
+func FromChatLabel(l conversation.ChatLabel) LabelDTO {
+	dto := LabelDTO{
+		ID:        l.ID.String(),
+		Name:      l.Name,
+		CreatedAt: l.CreatedAt.Format(time.RFC3339),
+	}
+	if l.Color.Valid {
+		dto.Color = l.Color.String
+	}
+	if l.Position.Valid {
+		position := l.Position.Int32
+		dto.Position = &position
+	}
+	return dto
+}
+
+// FromChatLabelSlice converts a slice of domain chat labels to LabelDTO slice
+func FromChatLabelSlice(labels []conversation.ChatLabel) []LabelDTO {
+	dtos := make([]LabelDTO, len(labels))
+	for i, l := range labels {
+		dtos[i] = FromChatLabel(l)
+	}
+	return dtos
+}
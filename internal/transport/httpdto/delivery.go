@@ -0,0 +1,32 @@
+package httpdto
+
+import "sentinal-chat/internal/domain/message"
+
+// PendingEnvelopesResponse is a page of the calling device's envelope queue.
+// It is also pushed over the WebSocket as the "envelopes" message.
+type PendingEnvelopesResponse struct {
+	Envelopes []MessageDTO `json:"envelopes"`
+	HasMore   bool         `json:"has_more"`
+}
+
+// AckEnvelopesRequest is used for POST /envelopes/ack
+type AckEnvelopesRequest struct {
+	MessageIDs []string `json:"message_ids" binding:"required"`
+}
+
+// AckEnvelopesResponse reports how many envelopes were still pending
+type AckEnvelopesResponse struct {
+	Acknowledged int `json:"acknowledged"`
+}
+
+// FromPendingEnvelopes converts a page of queued messages to PendingEnvelopesResponse
+func FromPendingEnvelopes(envelopes []message.Message, hasMore bool) PendingEnvelopesResponse {
+	resp := PendingEnvelopesResponse{
+		Envelopes: make([]MessageDTO, 0, len(envelopes)),
+		HasMore:   hasMore,
+	}
+	for _, m := range envelopes {
+		resp.Envelopes = append(resp.Envelopes, FromMessage(m))
+	}
+	return resp
+}
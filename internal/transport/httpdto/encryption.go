@@ -76,12 +76,23 @@ type UploadedKeysCountResponse struct {
 	Uploaded int `json:"uploaded"`
 }
 
-// ConsumeOneTimePreKeyRequest holds query parameters for consuming prekey
-type ConsumeOneTimePreKeyRequest struct {
-	UserID           string `form:"user_id" binding:"required"`
-	DeviceID         string `form:"device_id" binding:"required"`
-	ConsumedBy       string `form:"consumed_by" binding:"required"`
-	ConsumedDeviceID string `form:"consumed_device_id" binding:"required"`
+// UploadOneTimePreKeyBatchRequest is used for POST /encryption/onetime-prekeys/batch.
+// DeviceID defaults to the device of the session.
+type UploadOneTimePreKeyBatchRequest struct {
+	DeviceID string                     `json:"device_id"`
+	Keys     []OneTimePreKeyBatchKeyDTO `json:"keys" binding:"required"`
+}
+
+// OneTimePreKeyBatchKeyDTO is one key of a batch upload
+type OneTimePreKeyBatchKeyDTO struct {
+	KeyID     int    `json:"key_id" binding:"required"`
+	PublicKey string `json:"public_key" binding:"required"`
+}
+
+// UploadOneTimePreKeyBatchResponse is returned after a batch upload
+type UploadOneTimePreKeyBatchResponse struct {
+	Uploaded  int   `json:"uploaded"`
+	Available int64 `json:"available"`
 }
 
 // PreKeyCountRequest holds query parameters for getting prekey count
@@ -102,6 +113,18 @@ type GetKeyBundleRequest struct {
 	ConsumerDeviceID string `form:"consumer_device_id" binding:"required"`
 }
 
+// FetchKeyBundlesRequest is the body of POST /encryption/bundles/batch
+type FetchKeyBundlesRequest struct {
+	UserIDs          []string `json:"user_ids" binding:"required"`
+	ConsumerDeviceID string   `json:"consumer_device_id"`
+}
+
+// KeyBundleBatchResponse is returned when fetching key bundles in a batch
+type KeyBundleBatchResponse struct {
+	Bundles        []KeyBundleDTO `json:"bundles"`
+	MissingUserIDs []string       `json:"missing_user_ids"`
+}
+
 // HasActiveKeysRequest holds query parameters for checking active keys
 type HasActiveKeysRequest struct {
 	UserID   string `form:"user_id" binding:"required"`
@@ -123,6 +146,30 @@ type IdentityKeyDTO struct {
 	CreatedAt string `json:"created_at"`
 }
 
+// IdentityKeyHistoryDTO represents one identity key a device has used
+type IdentityKeyHistoryDTO struct {
+	IdentityKeyID      string `json:"identity_key_id"`
+	UserID             string `json:"user_id"`
+	DeviceID           string `json:"device_id"`
+	PublicKey          string `json:"public_key"`
+	ActivatedAt        string `json:"activated_at"`
+	DeactivatedAt      string `json:"deactivated_at,omitempty"`
+	DeactivationReason string `json:"deactivation_reason,omitempty"`
+}
+
+// FingerprintPartyDTO is one side of a safety number
+type FingerprintPartyDTO struct {
+	UserID       string           `json:"user_id"`
+	IdentityKeys []IdentityKeyDTO `json:"identity_keys"`
+}
+
+// FingerprintResponse is returned by GET /encryption/identity/fingerprint
+type FingerprintResponse struct {
+	Version int                 `json:"version"`
+	Local   FingerprintPartyDTO `json:"local"`
+	Remote  FingerprintPartyDTO `json:"remote"`
+}
+
 // SignedPreKeyDTO represents a signed prekey in API responses
 type SignedPreKeyDTO struct {
 	ID        string `json:"id"`
@@ -133,6 +180,9 @@ type SignedPreKeyDTO struct {
 	Signature string `json:"signature,omitempty"`
 	CreatedAt string `json:"created_at"`
 	IsActive  bool   `json:"is_active"`
+
+	DeactivatedAt       string `json:"deactivated_at,omitempty"`
+	RotationRequestedAt string `json:"rotation_requested_at,omitempty"`
 }
 
 // OneTimePreKeyDTO represents a one-time prekey in API responses
@@ -167,9 +217,27 @@ func FromIdentityKey(k encryption.IdentityKey) IdentityKeyDTO {
 	}
 }
 
+// FromIdentityKeyHistory converts a domain identity key history entry to IdentityKeyHistoryDTO
+func FromIdentityKeyHistory(h encryption.IdentityKeyHistory) IdentityKeyHistoryDTO {
+	dto := IdentityKeyHistoryDTO{
+		IdentityKeyID: h.IdentityKeyID.String(),
+		UserID:        h.UserID.String(),
+		DeviceID:      h.DeviceID.String(),
+		PublicKey:     base64.StdEncoding.EncodeToString(h.PublicKey),
+		ActivatedAt:   h.ActivatedAt.Format(time.RFC3339),
+	}
+	if h.DeactivatedAt.Valid {
+		dto.DeactivatedAt = h.DeactivatedAt.Time.Format(time.RFC3339)
+	}
+	if h.DeactivationReason.Valid {
+		dto.DeactivationReason = h.DeactivationReason.String
+	}
+	return dto
+}
+
 // FromSignedPreKey converts a domain signed prekey to SignedPreKeyDTO
 func FromSignedPreKey(k encryption.SignedPreKey) SignedPreKeyDTO {
-	return SignedPreKeyDTO{
+	dto := SignedPreKeyDTO{
 		ID:        k.ID.String(),
 		UserID:    k.UserID.String(),
 		DeviceID:  k.DeviceID.String(),
@@ -179,6 +247,13 @@ func FromSignedPreKey(k encryption.SignedPreKey) SignedPreKeyDTO {
 		CreatedAt: k.CreatedAt.Format(time.RFC3339),
 		IsActive:  k.IsActive,
 	}
+	if k.DeactivatedAt.Valid {
+		dto.DeactivatedAt = k.DeactivatedAt.Time.Format(time.RFC3339)
+	}
+	if k.RotationRequestedAt.Valid {
+		dto.RotationRequestedAt = k.RotationRequestedAt.Time.Format(time.RFC3339)
+	}
+	return dto
 }
 
 // FromOneTimePreKey converts a domain one-time prekey to OneTimePreKeyDTO
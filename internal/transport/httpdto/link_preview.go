@@ -0,0 +1,35 @@
+package httpdto
+
+import (
+	"sentinal-chat/internal/domain/message"
+	"time"
+)
+
+// LinkPreviewRequest is used for POST /link-previews
+type LinkPreviewRequest struct {
+	URL string `json:"url" binding:"required"`
+}
+
+// LinkPreviewDTO is the metadata of a previewed page
+type LinkPreviewDTO struct {
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	FetchedAt   string `json:"fetched_at"`
+}
+
+// FromLinkPreview converts a domain link preview to LinkPreviewDTO
+func FromLinkPreview(lp message.LinkPreview) LinkPreviewDTO {
+	return LinkPreviewDTO{
+		ID:          lp.ID.String(),
+		URL:         lp.URL,
+		Title:       lp.Title.String,
+		Description: lp.Description.String,
+		ImageURL:    lp.ImageURL.String,
+		SiteName:    lp.SiteName.String,
+		FetchedAt:   lp.FetchedAt.Format(time.RFC3339),
+	}
+}
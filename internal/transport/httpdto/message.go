@@ -1,22 +1,81 @@
 package httpdto
 
 import (
+	"database/sql"
 	"encoding/base64"
+	"encoding/json"
+	"sentinal-chat/internal/domain/command"
 	"sentinal-chat/internal/domain/message"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// SendMessageRequest is used for POST /messages
+// SendMessageRequest is used for POST /messages. It carries either
+// ciphertexts, one per recipient device, or a single group_ciphertext.
 type SendMessageRequest struct {
+	ConversationID   string                   `json:"conversation_id" binding:"required"`
+	Ciphertexts      []MessageCiphertextInput `json:"ciphertexts"`
+	GroupCiphertext  *GroupCiphertextInput    `json:"group_ciphertext,omitempty"`
+	MessageType      string                   `json:"message_type"`
+	ClientMsgID      string                   `json:"client_message_id"`
+	IdempotencyKey   string                   `json:"idempotency_key"`
+	Poll             *CreatePollRequest       `json:"poll,omitempty"`
+	Mentions         []MentionInput           `json:"mentions,omitempty"`
+	Attachments      []AttachmentInput        `json:"attachments,omitempty"`
+	ExpiresInSeconds int                      `json:"expires_in_seconds,omitempty"` // shortens the conversation's disappearing timer
+	ReplyToMessageID string                   `json:"reply_to_message_id,omitempty"`
+}
+
+// ForwardMessageRequest is used for POST /messages/:id/forward
+type ForwardMessageRequest struct {
+	Targets []ForwardTargetInput `json:"targets" binding:"required"`
+}
+
+// ForwardTargetInput is one conversation to forward to, with the message
+// re-encrypted for each of its recipient devices
+type ForwardTargetInput struct {
 	ConversationID string                   `json:"conversation_id" binding:"required"`
 	Ciphertexts    []MessageCiphertextInput `json:"ciphertexts" binding:"required"`
-	MessageType    string                   `json:"message_type"`
 	ClientMsgID    string                   `json:"client_message_id"`
 	IdempotencyKey string                   `json:"idempotency_key"`
 }
 
+// ForwardMessageResponse is returned after forwarding a message
+type ForwardMessageResponse struct {
+	Messages []SendMessageResponse `json:"messages"`
+}
+
+// MessageReferenceDTO carries the reply and forward references of a message
+type MessageReferenceDTO struct {
+	ReplyToMessageID       string `json:"reply_to_message_id,omitempty"`
+	IsForwarded            bool   `json:"is_forwarded,omitempty"`
+	ForwardedFromMessageID string `json:"forwarded_from_message_id,omitempty"`
+	ForwardDepth           int    `json:"forward_depth,omitempty"`
+	ForwardedManyTimes     bool   `json:"forwarded_many_times,omitempty"`
+}
+
+// AttachmentInput attaches a completed upload session to a message, with the
+// details of the client-side encrypted file
+type AttachmentInput struct {
+	UploadID          string `json:"upload_id" binding:"required"`
+	Width             *int32 `json:"width"`
+	Height            *int32 `json:"height"`
+	DurationSeconds   *int32 `json:"duration_seconds"`
+	EncryptionKeyHash string `json:"encryption_key_hash"`
+	EncryptionIV      string `json:"encryption_iv"`
+	ThumbnailURL      string `json:"thumbnail_url"`
+	ViewOnce          bool   `json:"view_once"`
+}
+
+// MentionInput marks a participant mentioned in the plaintext, by character
+// offset and length
+type MentionInput struct {
+	UserID string `json:"user_id" binding:"required"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length" binding:"required"`
+}
+
 // MessageCiphertextInput represents per-device ciphertext for a message
 type MessageCiphertextInput struct {
 	RecipientDeviceID string                 `json:"recipient_device_id" binding:"required"`
@@ -24,14 +83,34 @@ type MessageCiphertextInput struct {
 	Header            map[string]interface{} `json:"header"`
 }
 
+// GroupCiphertextInput is a group message encrypted once with the sending
+// device's sender key
+type GroupCiphertextInput struct {
+	DistributionID string                 `json:"distribution_id" binding:"required"`
+	Ciphertext     string                 `json:"ciphertext" binding:"required"` // base64
+	Header         map[string]interface{} `json:"header"`
+}
+
 // SendMessageResponse is returned after sending a message
 type SendMessageResponse struct {
-	ID             string `json:"id"`
-	ConversationID string `json:"conversation_id"`
-	SenderID       string `json:"sender_id"`
-	ClientMsgID    string `json:"client_message_id,omitempty"`
-	SequenceNumber int64  `json:"sequence_number"`
-	CreatedAt      string `json:"created_at"`
+	ID             string          `json:"id"`
+	ConversationID string          `json:"conversation_id"`
+	SenderID       string          `json:"sender_id"`
+	ClientMsgID    string          `json:"client_message_id,omitempty"`
+	SequenceNumber int64           `json:"sequence_number"`
+	MessageType    string          `json:"message_type"`
+	PollID         string          `json:"poll_id,omitempty"`
+	Attachments    []AttachmentDTO `json:"attachments,omitempty"`
+	CreatedAt      string          `json:"created_at"`
+	ExpiresAt      string          `json:"expires_at,omitempty"`
+	MessageReferenceDTO
+	CommandRefDTO
+}
+
+// EditMessageResponse is returned after editing a message
+type EditMessageResponse struct {
+	MessageDTO
+	CommandRefDTO
 }
 
 // ListMessagesRequest holds query parameters for listing messages
@@ -48,23 +127,163 @@ type ListMessagesResponse struct {
 
 // MessageDTO represents a message in API responses
 type MessageDTO struct {
+	ID                string          `json:"id"`
+	ConversationID    string          `json:"conversation_id"`
+	SenderID          string          `json:"sender_id"`
+	ClientMsgID       string          `json:"client_message_id,omitempty"`
+	SequenceNumber    int64           `json:"sequence_number"`
+	MessageType       string          `json:"message_type"`
+	PollID            string          `json:"poll_id,omitempty"`
+	MentionCount      int             `json:"mention_count,omitempty"`
+	Attachments       []AttachmentDTO `json:"attachments,omitempty"`
+	Metadata          json.RawMessage `json:"metadata,omitempty"` // SYSTEM messages only
+	IsDeleted         bool            `json:"is_deleted"`
+	IsEdited          bool            `json:"is_edited"`
+	Ciphertext        string          `json:"ciphertext,omitempty"`
+	Header            string          `json:"header,omitempty"`
+	RecipientDeviceID string          `json:"recipient_device_id,omitempty"`
+	CreatedAt         string          `json:"created_at"`
+	UpdatedAt         string          `json:"updated_at,omitempty"`
+	ExpiresAt         string          `json:"expires_at,omitempty"`
+	MessageReferenceDTO
+}
+
+// AttachmentDTO describes a file attached to a message
+type AttachmentDTO struct {
 	ID                string `json:"id"`
-	ConversationID    string `json:"conversation_id"`
-	SenderID          string `json:"sender_id"`
-	ClientMsgID       string `json:"client_message_id,omitempty"`
-	SequenceNumber    int64  `json:"sequence_number"`
-	IsDeleted         bool   `json:"is_deleted"`
-	IsEdited          bool   `json:"is_edited"`
-	Ciphertext        string `json:"ciphertext,omitempty"`
-	Header            string `json:"header,omitempty"`
-	RecipientDeviceID string `json:"recipient_device_id,omitempty"`
-	CreatedAt         string `json:"created_at"`
-	UpdatedAt         string `json:"updated_at,omitempty"`
+	URL               string `json:"url,omitempty"`
+	Filename          string `json:"filename,omitempty"`
+	MimeType          string `json:"mime_type"`
+	SizeBytes         int64  `json:"size_bytes"`
+	Width             *int32 `json:"width,omitempty"`
+	Height            *int32 `json:"height,omitempty"`
+	DurationSeconds   *int32 `json:"duration_seconds,omitempty"`
+	ThumbnailURL      string `json:"thumbnail_url,omitempty"`
+	EncryptionKeyHash string `json:"encryption_key_hash,omitempty"`
+	EncryptionIV      string `json:"encryption_iv,omitempty"`
+	ViewOnce          bool   `json:"view_once"`
+	ViewedAt          string `json:"viewed_at,omitempty"`
+}
+
+// ViewOnceResponse is returned for POST /attachments/:id/view
+type ViewOnceResponse struct {
+	Attachment AttachmentDTO `json:"attachment"`
+	MessageID  string        `json:"message_id"`
+	URL        string        `json:"url"`
+	ViewedAt   string        `json:"viewed_at"`
+	ExpiresAt  string        `json:"expires_at"`
 }
 
 // UpdateMessageRequest is used for PUT /messages/:id
 type UpdateMessageRequest struct {
-	Ciphertext string `json:"ciphertext" binding:"required"`
+	Ciphertexts []MessageCiphertextInput `json:"ciphertexts" binding:"required"`
+}
+
+// MessageVersionDTO is one prior version of an edited message
+type MessageVersionDTO struct {
+	ID                string `json:"id"`
+	MessageID         string `json:"message_id"`
+	VersionNumber     int    `json:"version_number"`
+	EditedBy          string `json:"edited_by"`
+	EditedAt          string `json:"edited_at"`
+	Ciphertext        string `json:"ciphertext"`
+	Header            string `json:"header,omitempty"`
+	RecipientDeviceID string `json:"recipient_device_id"`
+	SenderDeviceID    string `json:"sender_device_id,omitempty"`
+}
+
+// MessageVersionsResponse is returned for GET /messages/:id/versions
+type MessageVersionsResponse struct {
+	MessageID string              `json:"message_id"`
+	Versions  []MessageVersionDTO `json:"versions"`
+}
+
+// ReactionRequest is used for POST/DELETE /messages/:id/reactions
+type ReactionRequest struct {
+	ReactionCode string `json:"reaction_code" binding:"required"`
+}
+
+// ReactionSummaryDTO represents one aggregated reaction on a message
+type ReactionSummaryDTO struct {
+	ReactionCode string `json:"reaction_code"`
+	Count        int64  `json:"count"`
+	ReactedByMe  bool   `json:"reacted_by_me"`
+}
+
+// MessageReactionsResponse is returned for reaction endpoints
+type MessageReactionsResponse struct {
+	MessageID string               `json:"message_id"`
+	Reactions []ReactionSummaryDTO `json:"reactions"`
+}
+
+// StarMessageResponse is returned after POST /messages/:id/star
+type StarMessageResponse struct {
+	MessageID string `json:"message_id"`
+	StarredAt string `json:"starred_at"`
+}
+
+// PinnedMessageDTO is a message pinned to its conversation
+type PinnedMessageDTO struct {
+	MessageID      string `json:"message_id"`
+	ConversationID string `json:"conversation_id"`
+	PinnedBy       string `json:"pinned_by,omitempty"`
+	PinnedAt       string `json:"pinned_at"`
+}
+
+// ListPinnedMessagesResponse is returned by GET /messages/pinned
+type ListPinnedMessagesResponse struct {
+	Pinned []PinnedMessageDTO `json:"pinned"`
+}
+
+func FromPinnedMessage(p message.PinnedMessage) PinnedMessageDTO {
+	dto := PinnedMessageDTO{
+		MessageID:      p.MessageID.String(),
+		ConversationID: p.ConversationID.String(),
+		PinnedAt:       p.PinnedAt.Format(time.RFC3339),
+	}
+	if p.PinnedBy.Valid {
+		dto.PinnedBy = p.PinnedBy.UUID.String()
+	}
+	return dto
+}
+
+func FromPinnedMessageSlice(items []message.PinnedMessage) []PinnedMessageDTO {
+	out := make([]PinnedMessageDTO, 0, len(items))
+	for _, item := range items {
+		out = append(out, FromPinnedMessage(item))
+	}
+	return out
+}
+
+// StarredMessageDTO is a starred message in API responses
+type StarredMessageDTO struct {
+	MessageDTO
+	StarredAt string `json:"starred_at"`
+}
+
+// StarredMessagesResponse is returned for GET /users/me/starred
+type StarredMessagesResponse struct {
+	Messages []StarredMessageDTO `json:"messages"`
+	Total    int64               `json:"total"`
+}
+
+// MentionRangeDTO locates one mention of the caller in the decrypted text
+type MentionRangeDTO struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// MentionDTO is a message mentioning the caller in API responses
+type MentionDTO struct {
+	MessageDTO
+	Mentions []MentionRangeDTO `json:"mentions"`
+	IsRead   bool              `json:"is_read"`
+}
+
+// MentionsResponse is returned for GET /users/me/mentions
+type MentionsResponse struct {
+	Mentions []MentionDTO `json:"mentions"`
+	Total    int64        `json:"total"`
 }
 
 // FromMessage converts a domain message to MessageDTO
@@ -73,10 +292,14 @@ func FromMessage(m message.Message) MessageDTO {
 		ID:             m.ID.String(),
 		ConversationID: m.ConversationID.String(),
 		SenderID:       m.SenderID.String(),
+		MessageType:    m.Type,
+		PollID:         NullUUIDString(m.PollID),
+		MentionCount:   m.MentionCount,
 		CreatedAt:      m.CreatedAt.Format(time.RFC3339),
 		IsDeleted:      m.DeletedAt.Valid,
 		IsEdited:       m.EditedAt.Valid,
 	}
+	dto.MessageReferenceDTO = FromMessageReference(m)
 	if m.ClientMessageID.Valid {
 		dto.ClientMsgID = m.ClientMessageID.String
 	}
@@ -95,6 +318,17 @@ func FromMessage(m message.Message) MessageDTO {
 	if m.EditedAt.Valid {
 		dto.UpdatedAt = m.EditedAt.Time.Format(time.RFC3339)
 	}
+	if m.ExpiresAt.Valid {
+		dto.ExpiresAt = m.ExpiresAt.Time.Format(time.RFC3339)
+	}
+	if len(m.Attachments) > 0 {
+		dto.Attachments = FromAttachmentSlice(m.Attachments)
+	}
+	// Only server-authored messages expose metadata; for user messages it holds
+	// server bookkeeping such as the sending device.
+	if m.Type == "SYSTEM" && m.Metadata != "" {
+		dto.Metadata = json.RawMessage(m.Metadata)
+	}
 	return dto
 }
 
@@ -104,17 +338,38 @@ func FromSendMessage(m message.Message) SendMessageResponse {
 		ID:             m.ID.String(),
 		ConversationID: m.ConversationID.String(),
 		SenderID:       m.SenderID.String(),
+		MessageType:    m.Type,
+		PollID:         NullUUIDString(m.PollID),
 		CreatedAt:      m.CreatedAt.Format(time.RFC3339),
 	}
+	res.MessageReferenceDTO = FromMessageReference(m)
 	if m.ClientMessageID.Valid {
 		res.ClientMsgID = m.ClientMessageID.String
 	}
 	if m.SeqID.Valid {
 		res.SequenceNumber = m.SeqID.Int64
 	}
+	if m.ExpiresAt.Valid {
+		res.ExpiresAt = m.ExpiresAt.Time.Format(time.RFC3339)
+	}
+	if len(m.Attachments) > 0 {
+		res.Attachments = FromAttachmentSlice(m.Attachments)
+	}
 	return res
 }
 
+// FromMessageReference extracts the reply and forward references of a message
+func FromMessageReference(m message.Message) MessageReferenceDTO {
+	depth := m.ForwardDepth()
+	return MessageReferenceDTO{
+		ReplyToMessageID:       NullUUIDString(m.ReplyToMsgID),
+		IsForwarded:            m.IsForwarded,
+		ForwardedFromMessageID: NullUUIDString(m.ForwardedFromMsgID),
+		ForwardDepth:           depth,
+		ForwardedManyTimes:     depth >= message.ForwardedManyTimesDepth,
+	}
+}
+
 // FromMessageSlice converts a slice of domain messages to MessageDTO slice
 func FromMessageSlice(messages []message.Message) []MessageDTO {
 	dtos := make([]MessageDTO, len(messages))
@@ -124,6 +379,90 @@ func FromMessageSlice(messages []message.Message) []MessageDTO {
 	return dtos
 }
 
+// FromReactionSummary builds the reactions response for a message
+func FromReactionSummary(messageID uuid.UUID, summary []message.ReactionSummary) MessageReactionsResponse {
+	dtos := make([]ReactionSummaryDTO, len(summary))
+	for i, item := range summary {
+		dtos[i] = ReactionSummaryDTO{
+			ReactionCode: item.ReactionCode,
+			Count:        item.Count,
+			ReactedByMe:  item.ReactedByMe,
+		}
+	}
+	return MessageReactionsResponse{
+		MessageID: messageID.String(),
+		Reactions: dtos,
+	}
+}
+
+// FromMessageVersions builds the edit history response for a message
+func FromMessageVersions(messageID uuid.UUID, versions []command.MessageVersion) MessageVersionsResponse {
+	dtos := make([]MessageVersionDTO, 0, len(versions))
+	for _, v := range versions {
+		dto := MessageVersionDTO{
+			ID:            v.ID.String(),
+			MessageID:     v.MessageID.String(),
+			VersionNumber: v.VersionNumber,
+			EditedBy:      v.EditedBy.String(),
+			EditedAt:      v.EditedAt.Format(time.RFC3339),
+		}
+		if len(v.Ciphertexts) > 0 {
+			c := v.Ciphertexts[0]
+			dto.Ciphertext = base64.StdEncoding.EncodeToString(c.Ciphertext)
+			dto.Header = c.Header
+			dto.RecipientDeviceID = c.RecipientDeviceID.String()
+			dto.SenderDeviceID = NullUUIDString(c.SenderDeviceID)
+		}
+		dtos = append(dtos, dto)
+	}
+	return MessageVersionsResponse{
+		MessageID: messageID.String(),
+		Versions:  dtos,
+	}
+}
+
+// FromAttachment converts a domain attachment to AttachmentDTO. View-once
+// attachments carry no URL; recipients request one through the view endpoint.
+func FromAttachment(a message.Attachment) AttachmentDTO {
+	dto := AttachmentDTO{
+		ID:                a.ID.String(),
+		Filename:          a.Filename.String,
+		MimeType:          a.MimeType,
+		SizeBytes:         a.SizeBytes,
+		Width:             nullInt32Ptr(a.Width),
+		Height:            nullInt32Ptr(a.Height),
+		DurationSeconds:   nullInt32Ptr(a.DurationSeconds),
+		ThumbnailURL:      a.ThumbnailURL.String,
+		EncryptionKeyHash: a.EncryptionKeyHash.String,
+		EncryptionIV:      a.EncryptionIV.String,
+		ViewOnce:          a.ViewOnce,
+	}
+	if !a.ViewOnce {
+		dto.URL = a.URL
+	}
+	if a.ViewedAt.Valid {
+		dto.ViewedAt = a.ViewedAt.Time.Format(time.RFC3339)
+	}
+	return dto
+}
+
+// FromAttachmentSlice converts a slice of domain attachments to AttachmentDTO slice
+func FromAttachmentSlice(attachments []message.Attachment) []AttachmentDTO {
+	dtos := make([]AttachmentDTO, len(attachments))
+	for i, a := range attachments {
+		dtos[i] = FromAttachment(a)
+	}
+	return dtos
+}
+
+func nullInt32Ptr(value sql.NullInt32) *int32 {
+	if !value.Valid {
+		return nil
+	}
+	v := value.Int32
+	return &v
+}
+
 // NullUUIDString converts a uuid.NullUUID to string
 func NullUUIDString(value uuid.NullUUID) string {
 	if value.Valid {
@@ -131,3 +470,24 @@ func NullUUIDString(value uuid.NullUUID) string {
 	}
 	return ""
 }
+
+// FromStarredMessage converts a starred message to StarredMessageDTO
+func FromStarredMessage(d message.StarredMessageDetails) StarredMessageDTO {
+	return StarredMessageDTO{
+		MessageDTO: FromMessage(d.Message),
+		StarredAt:  d.StarredAt.Format(time.RFC3339),
+	}
+}
+
+// FromMention converts a mention inbox entry to MentionDTO
+func FromMention(d message.MentionDetails) MentionDTO {
+	dto := MentionDTO{
+		MessageDTO: FromMessage(d.Message),
+		Mentions:   make([]MentionRangeDTO, len(d.Mentions)),
+		IsRead:     d.IsRead,
+	}
+	for i, m := range d.Mentions {
+		dto.Mentions[i] = MentionRangeDTO{Offset: m.Offset, Length: m.Length}
+	}
+	return dto
+}
@@ -0,0 +1,82 @@
+package httpdto
+
+import (
+	"sentinal-chat/internal/domain/message"
+	"time"
+)
+
+// CreatePollRequest describes the poll attached to a POLL message
+type CreatePollRequest struct {
+	Question       string   `json:"question" binding:"required"`
+	Options        []string `json:"options" binding:"required"`
+	AllowsMultiple bool     `json:"allows_multiple"`
+	ClosesAt       string   `json:"closes_at,omitempty"`
+}
+
+// VotePollRequest is used for POST /polls/:id/votes
+type VotePollRequest struct {
+	OptionIDs []string `json:"option_ids" binding:"required"`
+}
+
+// PollOptionDTO represents a poll option with its tally
+type PollOptionDTO struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	Position int    `json:"position"`
+	Votes    int64  `json:"votes"`
+}
+
+// PollDTO represents a poll in API responses
+type PollDTO struct {
+	ID             string          `json:"id"`
+	MessageID      string          `json:"message_id"`
+	ConversationID string          `json:"conversation_id"`
+	Question       string          `json:"question"`
+	AllowsMultiple bool            `json:"allows_multiple"`
+	IsClosed       bool            `json:"is_closed"`
+	ClosesAt       string          `json:"closes_at,omitempty"`
+	ClosedAt       string          `json:"closed_at,omitempty"`
+	TotalVoters    int64           `json:"total_voters"`
+	Options        []PollOptionDTO `json:"options"`
+	MyVotes        []string        `json:"my_votes"`
+	CreatedAt      string          `json:"created_at"`
+}
+
+// FromPollDetails converts poll details to PollDTO
+func FromPollDetails(d message.PollDetails) PollDTO {
+	votes := make(map[string]int64, len(d.Tallies))
+	for _, t := range d.Tallies {
+		votes[t.OptionID.String()] = t.Votes
+	}
+
+	dto := PollDTO{
+		ID:             d.Poll.ID.String(),
+		MessageID:      NullUUIDString(d.Poll.MessageID),
+		ConversationID: d.ConversationID.String(),
+		Question:       d.Poll.Question,
+		AllowsMultiple: d.Poll.AllowsMultiple,
+		IsClosed:       d.Poll.IsClosed(time.Now()),
+		TotalVoters:    d.TotalVoters,
+		Options:        make([]PollOptionDTO, len(d.Options)),
+		MyVotes:        make([]string, len(d.MyVotes)),
+		CreatedAt:      d.Poll.CreatedAt.Format(time.RFC3339),
+	}
+	if d.Poll.ClosesAt.Valid {
+		dto.ClosesAt = d.Poll.ClosesAt.Time.Format(time.RFC3339)
+	}
+	if d.Poll.ClosedAt.Valid {
+		dto.ClosedAt = d.Poll.ClosedAt.Time.Format(time.RFC3339)
+	}
+	for i, o := range d.Options {
+		dto.Options[i] = PollOptionDTO{
+			ID:       o.ID.String(),
+			Text:     o.OptionText,
+			Position: o.Position,
+			Votes:    votes[o.ID.String()],
+		}
+	}
+	for i, id := range d.MyVotes {
+		dto.MyVotes[i] = id.String()
+	}
+	return dto
+}
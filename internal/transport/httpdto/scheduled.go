@@ -0,0 +1,77 @@
+package httpdto
+
+import (
+	"sentinal-chat/internal/domain/command"
+	"time"
+)
+
+// ScheduleMessageRequest is used for POST /scheduled-messages
+type ScheduleMessageRequest struct {
+	ConversationID string                   `json:"conversation_id" binding:"required"`
+	Ciphertexts    []MessageCiphertextInput `json:"ciphertexts" binding:"required"`
+	MessageType    string                   `json:"message_type"`
+	ClientMsgID    string                   `json:"client_message_id"`
+	ScheduledFor   string                   `json:"scheduled_for" binding:"required"`
+	Timezone       string                   `json:"timezone"`
+}
+
+// RescheduleMessageRequest is used for POST /scheduled-messages/:id/reschedule
+type RescheduleMessageRequest struct {
+	ScheduledFor string `json:"scheduled_for" binding:"required"`
+	Timezone     string `json:"timezone"`
+}
+
+// ScheduledMessageDTO represents a scheduled message in API responses
+type ScheduledMessageDTO struct {
+	ID                string `json:"id"`
+	ConversationID    string `json:"conversation_id"`
+	SenderID          string `json:"sender_id"`
+	MessageID         string `json:"message_id,omitempty"`
+	MessageType       string `json:"message_type"`
+	ClientMsgID       string `json:"client_message_id,omitempty"`
+	ScheduledFor      string `json:"scheduled_for"`
+	ScheduledForLocal string `json:"scheduled_for_local"`
+	Timezone          string `json:"timezone"`
+	Status            string `json:"status"`
+	Attempts          int    `json:"attempts"`
+	NextAttemptAt     string `json:"next_attempt_at,omitempty"`
+	LastError         string `json:"last_error,omitempty"`
+	SentAt            string `json:"sent_at,omitempty"`
+	CreatedAt         string `json:"created_at"`
+}
+
+// ScheduledMessageListResponse wraps a page of scheduled messages
+type ScheduledMessageListResponse struct {
+	ScheduledMessages []ScheduledMessageDTO `json:"scheduled_messages"`
+	Total             int64                 `json:"total"`
+}
+
+// FromScheduledMessage converts a domain ScheduledMessage to ScheduledMessageDTO
+func FromScheduledMessage(m command.ScheduledMessage) ScheduledMessageDTO {
+	local := m.ScheduledFor
+	if loc, err := time.LoadLocation(m.Timezone); err == nil {
+		local = m.ScheduledFor.In(loc)
+	}
+	dto := ScheduledMessageDTO{
+		ID:                m.ID.String(),
+		ConversationID:    m.ConversationID.String(),
+		SenderID:          m.SenderID.String(),
+		MessageID:         NullUUIDString(m.MessageID),
+		MessageType:       m.MessageType,
+		ClientMsgID:       m.ClientMessageID,
+		ScheduledFor:      m.ScheduledFor.UTC().Format(time.RFC3339),
+		ScheduledForLocal: local.Format(time.RFC3339),
+		Timezone:          m.Timezone,
+		Status:            m.Status,
+		Attempts:          m.Attempts,
+		LastError:         m.LastError,
+		CreatedAt:         m.CreatedAt.Format(time.RFC3339),
+	}
+	if m.Status == command.ScheduledPending && m.Attempts > 0 {
+		dto.NextAttemptAt = m.NextAttemptAt.UTC().Format(time.RFC3339)
+	}
+	if m.SentAt != nil {
+		dto.SentAt = m.SentAt.Format(time.RFC3339)
+	}
+	return dto
+}
@@ -0,0 +1,73 @@
+package httpdto
+
+import (
+	"encoding/base64"
+	"time"
+
+	"sentinal-chat/internal/domain/encryption"
+)
+
+// DistributeSenderKeyRequest is used for POST /conversations/:id/sender-keys
+type DistributeSenderKeyRequest struct {
+	DistributionID string                       `json:"distribution_id" binding:"required"`
+	Distributions  []SenderKeyDistributionInput `json:"distributions" binding:"required"`
+}
+
+// SenderKeyDistributionInput is a distribution message encrypted for one
+// member device
+type SenderKeyDistributionInput struct {
+	RecipientDeviceID string                 `json:"recipient_device_id" binding:"required"`
+	Ciphertext        string                 `json:"ciphertext" binding:"required"` // base64
+	Header            map[string]interface{} `json:"header"`
+}
+
+// SenderKeyDTO describes the sender key a device sends with in a group
+type SenderKeyDTO struct {
+	DistributionID string `json:"distribution_id"`
+	Epoch          int64  `json:"epoch"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// SenderKeyDistributionDTO is a distribution message addressed to the caller's
+// device
+type SenderKeyDistributionDTO struct {
+	SenderID       string `json:"sender_id"`
+	SenderDeviceID string `json:"sender_device_id"`
+	DistributionID string `json:"distribution_id"`
+	Epoch          int64  `json:"epoch"`
+	Ciphertext     string `json:"ciphertext"`
+	Header         string `json:"header"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// SenderKeyStateResponse is the caller's device's sender key state in a group.
+// MissingDeviceIDs lists member devices that have not been sent SenderKey.
+type SenderKeyStateResponse struct {
+	Epoch            int64                      `json:"epoch"`
+	SenderKey        *SenderKeyDTO              `json:"sender_key,omitempty"`
+	MissingDeviceIDs []string                   `json:"missing_device_ids"`
+	Distributions    []SenderKeyDistributionDTO `json:"distributions,omitempty"`
+}
+
+// FromSenderKey converts a domain sender key to SenderKeyDTO
+func FromSenderKey(k encryption.SenderKey) SenderKeyDTO {
+	return SenderKeyDTO{
+		DistributionID: k.DistributionID.String(),
+		Epoch:          k.Epoch,
+		CreatedAt:      k.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// FromSenderKeyDistribution converts a domain distribution message to
+// SenderKeyDistributionDTO
+func FromSenderKeyDistribution(d encryption.SenderKeyDistribution) SenderKeyDistributionDTO {
+	return SenderKeyDistributionDTO{
+		SenderID:       d.SenderID.String(),
+		SenderDeviceID: d.SenderDeviceID.String(),
+		DistributionID: d.DistributionID.String(),
+		Epoch:          d.Epoch,
+		Ciphertext:     base64.StdEncoding.EncodeToString(d.Ciphertext),
+		Header:         d.Header,
+		CreatedAt:      d.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,55 @@
+package httpdto
+
+import (
+	"time"
+
+	"sentinal-chat/internal/domain/conversation"
+)
+
+// SyncRequest is used for POST /sync. Either sync_token from the previous
+// response or conversations and since from the client's own state.
+type SyncRequest struct {
+	Conversations map[string]int64 `json:"conversations"`
+	Since         string           `json:"since"`
+	SyncToken     string           `json:"sync_token"`
+	Limit         int              `json:"limit"`
+}
+
+// SyncChangeDTO is one edit, deletion, receipt or membership change
+type SyncChangeDTO struct {
+	Kind           string `json:"kind"`
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id,omitempty"`
+	UserID         string `json:"user_id"`
+	Status         string `json:"status,omitempty"`
+	Role           string `json:"role,omitempty"`
+	ChangedAt      string `json:"changed_at"`
+}
+
+// SyncResponse is one page of a delta sync
+type SyncResponse struct {
+	Messages      []MessageDTO     `json:"messages"`
+	Edits         []MessageDTO     `json:"edits"`
+	Changes       []SyncChangeDTO  `json:"changes"`
+	Conversations map[string]int64 `json:"conversations"`
+	SyncToken     string           `json:"sync_token"`
+	HasMore       bool             `json:"has_more"`
+}
+
+// FromSyncChange converts a domain Change to SyncChangeDTO
+func FromSyncChange(c conversation.Change) SyncChangeDTO {
+	dto := SyncChangeDTO{
+		Kind:           c.Kind,
+		ConversationID: c.ConversationID.String(),
+		MessageID:      NullUUIDString(c.MessageID),
+		UserID:         c.UserID.String(),
+		ChangedAt:      c.ChangedAt.Format(time.RFC3339),
+	}
+	switch c.Kind {
+	case conversation.ChangeReceipt:
+		dto.Status = c.Value.String
+	case conversation.ChangeMemberAdded, conversation.ChangeMemberRemoved, conversation.ChangeMemberRoleChanged:
+		dto.Role = c.Value.String
+	}
+	return dto
+}
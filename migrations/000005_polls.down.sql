@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_poll_votes_poll_user;
+DROP INDEX IF EXISTS idx_polls_due;
+DROP INDEX IF EXISTS idx_polls_message;
+
+ALTER TABLE polls DROP COLUMN IF EXISTS closed_at;
@@ -0,0 +1,7 @@
+-- Polls: explicit close marker so expired polls are finalized exactly once
+ALTER TABLE polls ADD COLUMN IF NOT EXISTS closed_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_polls_message ON polls (message_id);
+CREATE INDEX IF NOT EXISTS idx_polls_due ON polls (closes_at) WHERE closed_at IS NULL AND closes_at IS NOT NULL;
+-- A voter's ballot in one poll; idx_poll_votes_user (000003) only covers user_id
+CREATE INDEX IF NOT EXISTS idx_poll_votes_poll_user ON poll_votes (poll_id, user_id);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_scheduled_messages_sender;
+DROP INDEX IF EXISTS idx_scheduled_messages_due;
+
+DROP TABLE IF EXISTS scheduled_message_ciphertexts;
+
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS last_error;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS attempts;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS client_message_id;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS message_type;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS sender_device_id;
@@ -0,0 +1,23 @@
+-- Scheduled messages carry per-device ciphertexts instead of plaintext content
+ALTER TYPE scheduled_messages_status ADD VALUE IF NOT EXISTS 'FAILED';
+
+ALTER TABLE scheduled_messages ALTER COLUMN message_id DROP NOT NULL;
+ALTER TABLE scheduled_messages ALTER COLUMN content DROP NOT NULL;
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS sender_device_id UUID REFERENCES devices(id) ON DELETE SET NULL;
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS message_type message_type DEFAULT 'TEXT';
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS client_message_id TEXT;
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW();
+
+CREATE TABLE IF NOT EXISTS scheduled_message_ciphertexts (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  scheduled_message_id UUID NOT NULL REFERENCES scheduled_messages(id) ON DELETE CASCADE,
+  recipient_device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  ciphertext BYTEA NOT NULL,
+  header JSONB,
+  UNIQUE (scheduled_message_id, recipient_device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages (scheduled_for) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_sender ON scheduled_messages (sender_id, status);
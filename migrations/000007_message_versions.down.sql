@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_message_version_ciphertexts_device;
+DROP INDEX IF EXISTS idx_message_versions_number;
+
+DROP TABLE IF EXISTS message_version_ciphertexts;
@@ -0,0 +1,17 @@
+-- Message versions hold the per-device ciphertexts a message had before each edit
+ALTER TABLE message_versions ALTER COLUMN content DROP NOT NULL;
+
+CREATE TABLE IF NOT EXISTS message_version_ciphertexts (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  version_id UUID NOT NULL REFERENCES message_versions(id) ON DELETE CASCADE,
+  recipient_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  recipient_device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  sender_device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+  ciphertext BYTEA NOT NULL,
+  header JSONB NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW(),
+  UNIQUE (version_id, recipient_device_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_message_versions_number ON message_versions(message_id, version_number);
+CREATE INDEX IF NOT EXISTS idx_message_version_ciphertexts_device ON message_version_ciphertexts(recipient_device_id);
@@ -0,0 +1 @@
+ALTER TABLE command_logs DROP COLUMN IF EXISTS undo_deadline;
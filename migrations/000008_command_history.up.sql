@@ -0,0 +1,6 @@
+-- The first command_status definition wins, so add the states CommandExecutor uses
+ALTER TYPE command_status ADD VALUE IF NOT EXISTS 'EXECUTING';
+ALTER TYPE command_status ADD VALUE IF NOT EXISTS 'COMPLETED';
+ALTER TYPE command_status ADD VALUE IF NOT EXISTS 'UNDONE';
+
+ALTER TABLE command_logs ADD COLUMN IF NOT EXISTS undo_deadline TIMESTAMP;
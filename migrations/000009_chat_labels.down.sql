@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_chat_labels_user_position;
+DROP INDEX IF EXISTS idx_conversation_labels_user_label;
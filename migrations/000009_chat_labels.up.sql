@@ -0,0 +1,4 @@
+-- Label filters look up a user's conversations by label, and label lists are
+-- read in the user's chosen order
+CREATE INDEX IF NOT EXISTS idx_conversation_labels_user_label ON conversation_labels(user_id, label_id);
+CREATE INDEX IF NOT EXISTS idx_chat_labels_user_position ON chat_labels(user_id, position);
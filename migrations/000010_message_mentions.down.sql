@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_message_mentions_user;
@@ -0,0 +1,2 @@
+-- The mentions inbox looks up mentions by the mentioned user
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user ON message_mentions(user_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_message_attachments_attachment;
+ALTER TABLE attachments DROP COLUMN IF EXISTS object_key;
+ALTER TABLE attachments DROP COLUMN IF EXISTS upload_session_id;
@@ -0,0 +1,7 @@
+-- Attachments created from an upload session keep its object key so the stored
+-- file can be removed from S3 later
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS upload_session_id UUID REFERENCES upload_sessions(id) ON DELETE SET NULL;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS object_key TEXT;
+
+-- Access checks look up the messages an attachment is linked to
+CREATE INDEX IF NOT EXISTS idx_message_attachments_attachment ON message_attachments(attachment_id);
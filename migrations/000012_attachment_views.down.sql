@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_attachments_view_once_viewed;
+DROP TABLE IF EXISTS attachment_views;
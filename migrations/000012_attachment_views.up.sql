@@ -0,0 +1,11 @@
+-- Each recipient may open a view-once attachment once; the attachment counts as
+-- viewed when every recipient has a row here
+CREATE TABLE IF NOT EXISTS attachment_views (
+  attachment_id UUID NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  viewed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (attachment_id, user_id)
+);
+
+-- The purge job finds viewed view-once attachments whose object is still stored
+CREATE INDEX IF NOT EXISTS idx_attachments_view_once_viewed ON attachments(viewed_at) WHERE view_once = TRUE AND object_key IS NOT NULL;
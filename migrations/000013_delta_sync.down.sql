@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_message_receipts_updated;
+DROP INDEX IF EXISTS idx_messages_deleted_at;
+DROP INDEX IF EXISTS idx_messages_edited_at;
+DROP TRIGGER IF EXISTS tr_participants_membership_log ON participants;
+DROP FUNCTION IF EXISTS fn_log_membership_change();
+DROP INDEX IF EXISTS idx_membership_changes_user;
+DROP INDEX IF EXISTS idx_membership_changes_conversation;
+DROP TABLE IF EXISTS membership_changes;
@@ -0,0 +1,44 @@
+-- Log of participants joining, leaving and changing role. Removed participants
+-- lose their participants row, so delta sync reads membership changes from here.
+-- There are no foreign keys because rows are written while a conversation or
+-- user is being deleted.
+CREATE TABLE IF NOT EXISTS membership_changes (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  conversation_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  action TEXT NOT NULL,
+  role TEXT,
+  changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_membership_changes_conversation ON membership_changes(conversation_id, changed_at);
+CREATE INDEX IF NOT EXISTS idx_membership_changes_user ON membership_changes(user_id, changed_at);
+
+CREATE OR REPLACE FUNCTION fn_log_membership_change()
+RETURNS TRIGGER LANGUAGE plpgsql AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO membership_changes (conversation_id, user_id, action, role)
+        VALUES (NEW.conversation_id, NEW.user_id, 'ADDED', NEW.role::text);
+        RETURN NEW;
+    ELSIF TG_OP = 'DELETE' THEN
+        INSERT INTO membership_changes (conversation_id, user_id, action, role)
+        VALUES (OLD.conversation_id, OLD.user_id, 'REMOVED', OLD.role::text);
+        RETURN OLD;
+    ELSIF NEW.role IS DISTINCT FROM OLD.role THEN
+        INSERT INTO membership_changes (conversation_id, user_id, action, role)
+        VALUES (NEW.conversation_id, NEW.user_id, 'ROLE_CHANGED', NEW.role::text);
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS tr_participants_membership_log ON participants;
+CREATE TRIGGER tr_participants_membership_log
+AFTER INSERT OR DELETE OR UPDATE OF role ON participants FOR EACH ROW
+EXECUTE FUNCTION fn_log_membership_change();
+
+-- Delta sync looks up edits, deletions and receipts by the time they happened
+CREATE INDEX IF NOT EXISTS idx_messages_edited_at ON messages(edited_at) WHERE edited_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_message_receipts_updated ON message_receipts(updated_at);
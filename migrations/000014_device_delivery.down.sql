@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_message_ciphertexts_delivered;
+DROP INDEX IF EXISTS idx_message_ciphertexts_pending;
+ALTER TABLE message_ciphertexts DROP COLUMN IF EXISTS delivered_at;
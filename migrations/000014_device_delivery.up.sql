@@ -0,0 +1,7 @@
+-- Each ciphertext is an envelope queued for one device until that device
+-- acknowledges it. Delivered envelopes are garbage collected once every active
+-- recipient device of the message has acknowledged its own.
+ALTER TABLE message_ciphertexts ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_message_ciphertexts_pending ON message_ciphertexts(recipient_device_id, created_at) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_message_ciphertexts_delivered ON message_ciphertexts(delivered_at) WHERE delivered_at IS NOT NULL;
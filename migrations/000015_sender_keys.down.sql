@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_sender_key_distributions_recipient;
+DROP TABLE IF EXISTS sender_key_distributions;
+DROP TABLE IF EXISTS sender_keys;
+ALTER TABLE conversations DROP COLUMN IF EXISTS sender_key_epoch;
+ALTER TABLE messages DROP COLUMN IF EXISTS header;
+ALTER TABLE messages DROP COLUMN IF EXISTS ciphertext;
@@ -0,0 +1,38 @@
+-- Group messages may carry a single sender-key ciphertext that every member
+-- device reads instead of one ciphertext per device.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS ciphertext BYTEA;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS header JSONB;
+
+-- Bumped on every membership change. Sender keys created in an earlier epoch
+-- can no longer be used to send.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS sender_key_epoch BIGINT NOT NULL DEFAULT 0;
+
+-- The sender key each device currently sends with in a group.
+CREATE TABLE IF NOT EXISTS sender_keys (
+  conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+  sender_device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  distribution_id UUID NOT NULL,
+  epoch BIGINT NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW(),
+  PRIMARY KEY (conversation_id, sender_device_id)
+);
+
+-- Sender key distribution messages, pairwise encrypted for one member device.
+-- Only the latest distribution of each sender device is kept per recipient.
+CREATE TABLE IF NOT EXISTS sender_key_distributions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+  sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  sender_device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  recipient_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  recipient_device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  distribution_id UUID NOT NULL,
+  epoch BIGINT NOT NULL,
+  ciphertext BYTEA NOT NULL,
+  header JSONB NOT NULL,
+  created_at TIMESTAMP DEFAULT NOW(),
+  UNIQUE (conversation_id, sender_device_id, recipient_device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sender_key_distributions_recipient ON sender_key_distributions(recipient_device_id, conversation_id);
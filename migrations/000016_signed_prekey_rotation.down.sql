@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_signed_prekeys_active_created;
+ALTER TABLE signed_prekeys DROP COLUMN IF EXISTS rotation_requested_at;
+ALTER TABLE signed_prekeys DROP COLUMN IF EXISTS deactivated_at;
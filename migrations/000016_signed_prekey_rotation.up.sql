@@ -0,0 +1,10 @@
+-- When a signed prekey stopped being the device's active one. It is kept for
+-- a grace window so sessions started from it can still be set up.
+ALTER TABLE signed_prekeys ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMP;
+
+-- When the device was last asked to replace this key because it grew stale.
+ALTER TABLE signed_prekeys ADD COLUMN IF NOT EXISTS rotation_requested_at TIMESTAMP;
+
+UPDATE signed_prekeys SET deactivated_at = NOW() WHERE is_active = false AND deactivated_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_signed_prekeys_active_created ON signed_prekeys (created_at) WHERE is_active = true;
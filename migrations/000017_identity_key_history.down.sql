@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_identity_key_history_device;
+DROP TABLE IF EXISTS identity_key_history;
@@ -0,0 +1,21 @@
+-- Every identity key a device has used, so key changes can be audited and
+-- contacts can tell when a safety number stopped being valid.
+CREATE TABLE IF NOT EXISTS identity_key_history (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  identity_key_id UUID NOT NULL,
+  public_key BYTEA NOT NULL,
+  activated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  deactivated_at TIMESTAMP,
+  deactivation_reason TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_identity_key_history_device ON identity_key_history (user_id, device_id, activated_at);
+
+INSERT INTO identity_key_history (user_id, device_id, identity_key_id, public_key, activated_at, deactivated_at, deactivation_reason)
+SELECT k.user_id, k.device_id, k.id, k.public_key, COALESCE(k.created_at, NOW()),
+       CASE WHEN k.is_active THEN NULL ELSE NOW() END,
+       CASE WHEN k.is_active THEN NULL ELSE 'deactivated' END
+FROM identity_keys k
+WHERE NOT EXISTS (SELECT 1 FROM identity_key_history h WHERE h.identity_key_id = k.id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_scheduled_messages_next_attempt;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS next_attempt_at;
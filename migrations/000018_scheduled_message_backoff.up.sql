@@ -0,0 +1,7 @@
+-- Failed scheduled deliveries wait before the next attempt instead of being
+-- claimed again straight away
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP;
+
+UPDATE scheduled_messages SET next_attempt_at = scheduled_for WHERE next_attempt_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_messages_next_attempt ON scheduled_messages (next_attempt_at) WHERE status = 'PENDING';
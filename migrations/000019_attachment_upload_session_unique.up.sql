@@ -0,0 +1,12 @@
+-- An upload session backs at most one attachment, so the same stored file
+-- cannot be attached to several messages. Older duplicates keep their file but
+-- lose the link to the session.
+UPDATE attachments a SET upload_session_id = NULL
+WHERE upload_session_id IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM attachments b
+      WHERE b.upload_session_id = a.upload_session_id
+        AND (b.created_at, b.id) < (a.created_at, a.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attachments_upload_session ON attachments (upload_session_id);
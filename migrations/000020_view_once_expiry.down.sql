@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_attachments_view_once_created;
@@ -0,0 +1,3 @@
+-- The purge job also removes view-once attachments that were never opened by
+-- every recipient once they reach their maximum age
+CREATE INDEX IF NOT EXISTS idx_attachments_view_once_created ON attachments(created_at) WHERE view_once = TRUE AND object_key IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Messages pinned to the top of a conversation for every participant. Who may
+-- pin is governed by the pin_messages group permission.
+CREATE TABLE IF NOT EXISTS pinned_messages (
+  conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+  message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  pinned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  pinned_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (conversation_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_conversation ON pinned_messages (conversation_id, pinned_at DESC);
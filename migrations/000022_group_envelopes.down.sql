@@ -0,0 +1,3 @@
+DELETE FROM message_ciphertexts WHERE ciphertext IS NULL OR header IS NULL;
+ALTER TABLE message_ciphertexts ALTER COLUMN header SET NOT NULL;
+ALTER TABLE message_ciphertexts ALTER COLUMN ciphertext SET NOT NULL;
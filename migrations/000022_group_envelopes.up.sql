@@ -0,0 +1,5 @@
+-- Sender-key group messages keep one shared ciphertext on messages, but each
+-- member device still needs an envelope row to track delivery. Those rows have
+-- no ciphertext or header of their own.
+ALTER TABLE message_ciphertexts ALTER COLUMN ciphertext DROP NOT NULL;
+ALTER TABLE message_ciphertexts ALTER COLUMN header DROP NOT NULL;
@@ -0,0 +1,3 @@
+-- When the device was last told it is running low on one-time prekeys, so a
+-- device that stays below the low-water mark is not warned on every fetch.
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS prekeys_low_warned_at TIMESTAMP;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_onetime_prekeys_consumer;
@@ -0,0 +1,3 @@
+-- Counts how many of a device's one-time prekeys one user consumed recently,
+-- which caps how fast a single user can drain them.
+CREATE INDEX IF NOT EXISTS idx_onetime_prekeys_consumer ON onetime_prekeys (device_id, consumed_by, consumed_at) WHERE consumed_at IS NOT NULL;
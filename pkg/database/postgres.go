@@ -478,10 +478,13 @@ func CreateUserWithDefaults(input CreateAdminUserInput) (*user.User, error) {
 func TruncateAllTables() error {
 	tables := []string{
 		"key_bundles",
+		"sender_key_distributions",
+		"sender_keys",
 		"upload_sessions",
 		"conversation_clears",
 		"message_user_states",
 		"encrypted_sessions",
+		"identity_key_history",
 		"onetime_prekeys",
 		"signed_prekeys",
 		"identity_keys",
@@ -496,15 +499,18 @@ func TruncateAllTables() error {
 		"poll_options",
 		"polls",
 		"message_attachments",
+		"attachment_views",
 		"attachments",
 		"link_previews",
 		"starred_messages",
+		"pinned_messages",
 		"message_mentions",
 		"message_receipts",
 		"message_reactions",
 		"message_ciphertexts",
 		"messages",
 		"conversation_sequences",
+		"membership_changes",
 		"participants",
 		"conversations",
 		"user_contacts",
@@ -515,7 +521,9 @@ func TruncateAllTables() error {
 		"users",
 		"outbox_events",
 		"command_logs",
+		"scheduled_message_ciphertexts",
 		"scheduled_messages",
+		"message_version_ciphertexts",
 		"message_versions",
 	}
 
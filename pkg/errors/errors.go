@@ -18,6 +18,7 @@ var (
 	ErrServiceUnavailable = errors.New("service unavailable")
 	ErrAlreadyExists      = errors.New("already exists")
 	ErrNotUploaded        = errors.New("file not uploaded")
+	ErrInvalidSignature   = errors.New("invalid signature")
 )
 
 func NowPtr() *time.Time {